@@ -0,0 +1,383 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errAdminNoConsensus      = errors.New("backend group is not consensus aware")
+	errAdminForcedCandidate  = errors.New("backend is a forced candidate and cannot be banned")
+	errAdminUnknownGroup     = errors.New("backend group not found")
+	errAdminUnknownBackend   = errors.New("backend not found in backend group")
+	errAdminInvalidParameter = errors.New("invalid parameter")
+)
+
+// AdminServer exposes an authenticated HTTP API to inspect and control
+// the backends and consensus pollers of a running server
+type AdminServer struct {
+	srv *Server
+	// authentication maps admin tokens to operator names
+	authentication map[string]string
+
+	httpServer *http.Server
+	srvMu      sync.Mutex
+}
+
+func NewAdminServer(srv *Server, authentication map[string]string) *AdminServer {
+	return &AdminServer{
+		srv:            srv,
+		authentication: authentication,
+	}
+}
+
+type adminBackendGroup struct {
+	Name            string          `json:"name"`
+	RoutingStrategy RoutingStrategy `json:"routing_strategy"`
+	Consensus       *adminConsensus `json:"consensus,omitempty"`
+	Backends        []*adminBackend `json:"backends"`
+}
+
+type adminConsensus struct {
+	LatestBlockNumber    hexutil.Uint64 `json:"latest_block_number"`
+	SafeBlockNumber      hexutil.Uint64 `json:"safe_block_number"`
+	FinalizedBlockNumber hexutil.Uint64 `json:"finalized_block_number"`
+	Backends             []string       `json:"backends"`
+}
+
+type adminBackend struct {
+	Name            string             `json:"name"`
+	Healthy         bool               `json:"healthy"`
+	Degraded        bool               `json:"degraded"`
+	Draining        bool               `json:"draining"`
+	ForcedCandidate bool               `json:"forced_candidate"`
+	ErrorRate       float64            `json:"error_rate"`
+	AvgLatencyMs    int64              `json:"avg_latency_ms"`
+	CircuitBreaker  string             `json:"circuit_breaker,omitempty"`
+	HealthCheck     *adminHealthCheck  `json:"health_check,omitempty"`
+	State           *adminBackendState `json:"state,omitempty"`
+}
+
+type adminHealthCheck struct {
+	Healthy     bool           `json:"healthy"`
+	Reason      string         `json:"reason,omitempty"`
+	BlockNumber hexutil.Uint64 `json:"block_number,omitempty"`
+	LatencyMs   int64          `json:"latency_ms"`
+	LastCheck   time.Time      `json:"last_check"`
+}
+
+type adminBackendState struct {
+	LatestBlockNumber    hexutil.Uint64 `json:"latest_block_number"`
+	LatestBlockHash      string         `json:"latest_block_hash"`
+	SafeBlockNumber      hexutil.Uint64 `json:"safe_block_number"`
+	FinalizedBlockNumber hexutil.Uint64 `json:"finalized_block_number"`
+	PeerCount            uint64         `json:"peer_count"`
+	InSync               bool           `json:"in_sync"`
+	LastUpdate           time.Time      `json:"last_update"`
+	Banned               bool           `json:"banned"`
+	BannedUntil          time.Time      `json:"banned_until"`
+}
+
+func (a *AdminServer) Handler() http.Handler {
+	hdlr := mux.NewRouter()
+	hdlr.HandleFunc("/backend_groups", a.authenticated(a.handleListGroups)).Methods("GET")
+	hdlr.HandleFunc("/backend_groups/{group}", a.authenticated(a.handleGetGroup)).Methods("GET")
+	hdlr.HandleFunc("/backend_groups/{group}/consensus/reset", a.authenticated(a.handleReset)).Methods("POST")
+	hdlr.HandleFunc("/backend_groups/{group}/backends/{backend}/ban", a.authenticated(a.handleBan)).Methods("POST")
+	hdlr.HandleFunc("/backend_groups/{group}/backends/{backend}/unban", a.authenticated(a.handleUnban)).Methods("POST")
+	hdlr.HandleFunc("/backend_groups/{group}/backends/{backend}/drain", a.authenticated(a.handleDrain(true))).Methods("POST")
+	hdlr.HandleFunc("/backend_groups/{group}/backends/{backend}/undrain", a.authenticated(a.handleDrain(false))).Methods("POST")
+	hdlr.HandleFunc("/backend_groups/{group}/backends/{backend}/forced_candidate", a.authenticated(a.handleForcedCandidate)).Methods("POST")
+	return hdlr
+}
+
+func (a *AdminServer) ListenAndServe(host string, port int) error {
+	a.srvMu.Lock()
+	addr := fmt.Sprintf("%s:%d", host, port)
+	a.httpServer = &http.Server{
+		Handler: a.Handler(),
+		Addr:    addr,
+	}
+	log.Info("starting admin server", "addr", addr)
+	a.srvMu.Unlock()
+	return a.httpServer.ListenAndServe()
+}
+
+func (a *AdminServer) Shutdown() {
+	a.srvMu.Lock()
+	defer a.srvMu.Unlock()
+	if a.httpServer != nil {
+		_ = a.httpServer.Shutdown(context.Background())
+	}
+}
+
+type adminHandlerFunc func(w http.ResponseWriter, r *http.Request, operator string)
+
+// authenticated resolves the operator from the bearer token of the request
+func (a *AdminServer) authenticated(next adminHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, hasScheme := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		operator := ""
+		for secret, name := range a.authentication {
+			if subtle.ConstantTimeCompare([]byte(secret), []byte(token)) == 1 {
+				operator = name
+			}
+		}
+		if !hasScheme || token == "" || operator == "" {
+			log.Warn("unauthorized admin request", "path", r.URL.Path, "remote_ip", r.RemoteAddr)
+			writeAdminError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next(w, r, operator)
+	}
+}
+
+func (a *AdminServer) handleListGroups(w http.ResponseWriter, r *http.Request, operator string) {
+	a.srv.stateMu.RLock()
+	groups := a.srv.BackendGroups
+	a.srv.stateMu.RUnlock()
+
+	res := make([]*adminBackendGroup, 0, len(groups))
+	for _, bg := range groups {
+		res = append(res, describeBackendGroup(bg))
+	}
+	writeAdminJSON(w, http.StatusOK, res)
+}
+
+func (a *AdminServer) handleGetGroup(w http.ResponseWriter, r *http.Request, operator string) {
+	bg, err := a.backendGroup(r)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, describeBackendGroup(bg))
+}
+
+func (a *AdminServer) handleReset(w http.ResponseWriter, r *http.Request, operator string) {
+	bg, err := a.backendGroup(r)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	if bg.Consensus == nil {
+		writeAdminError(w, http.StatusBadRequest, errAdminNoConsensus)
+		return
+	}
+	bg.Consensus.Reset()
+	for _, be := range bg.Backends {
+		RecordConsensusBackendBanned(be, false)
+	}
+	a.recordAction(operator, "reset", bg, nil)
+	writeAdminJSON(w, http.StatusOK, describeBackendGroup(bg))
+}
+
+func (a *AdminServer) handleBan(w http.ResponseWriter, r *http.Request, operator string) {
+	bg, be, err := a.backend(r)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	if bg.Consensus == nil {
+		writeAdminError(w, http.StatusBadRequest, errAdminNoConsensus)
+		return
+	}
+	if be.IsForcedCandidate() {
+		writeAdminError(w, http.StatusConflict, errAdminForcedCandidate)
+		return
+	}
+	period := bg.Consensus.banPeriod
+	if d := r.URL.Query().Get("duration"); d != "" {
+		period, err = time.ParseDuration(d)
+		if err != nil || period <= 0 {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("%w: duration %q", errAdminInvalidParameter, d))
+			return
+		}
+	}
+	bg.Consensus.BanFor(be, period)
+	RecordConsensusBackendBanned(be, true)
+	a.recordAction(operator, "ban", bg, be, "duration", period)
+	writeAdminJSON(w, http.StatusOK, describeBackend(bg, be))
+}
+
+func (a *AdminServer) handleUnban(w http.ResponseWriter, r *http.Request, operator string) {
+	bg, be, err := a.backend(r)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	if bg.Consensus == nil {
+		writeAdminError(w, http.StatusBadRequest, errAdminNoConsensus)
+		return
+	}
+	bg.Consensus.Unban(be)
+	RecordConsensusBackendBanned(be, false)
+	a.recordAction(operator, "unban", bg, be)
+	writeAdminJSON(w, http.StatusOK, describeBackend(bg, be))
+}
+
+func (a *AdminServer) handleDrain(draining bool) adminHandlerFunc {
+	action := "undrain"
+	if draining {
+		action = "drain"
+	}
+	return func(w http.ResponseWriter, r *http.Request, operator string) {
+		bg, be, err := a.backend(r)
+		if err != nil {
+			writeAdminError(w, http.StatusNotFound, err)
+			return
+		}
+		be.SetDraining(draining)
+		a.recordAction(operator, action, bg, be)
+		writeAdminJSON(w, http.StatusOK, describeBackend(bg, be))
+	}
+}
+
+func (a *AdminServer) handleForcedCandidate(w http.ResponseWriter, r *http.Request, operator string) {
+	bg, be, err := a.backend(r)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	if bg.Consensus == nil {
+		writeAdminError(w, http.StatusBadRequest, errAdminNoConsensus)
+		return
+	}
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("%w: enabled must be true or false", errAdminInvalidParameter))
+		return
+	}
+	be.SetForcedCandidate(enabled)
+	a.recordAction(operator, "forced_candidate", bg, be, "enabled", enabled)
+	writeAdminJSON(w, http.StatusOK, describeBackend(bg, be))
+}
+
+func (a *AdminServer) backendGroup(r *http.Request) (*BackendGroup, error) {
+	a.srv.stateMu.RLock()
+	defer a.srv.stateMu.RUnlock()
+	bg := a.srv.BackendGroups[mux.Vars(r)["group"]]
+	if bg == nil {
+		return nil, errAdminUnknownGroup
+	}
+	return bg, nil
+}
+
+func (a *AdminServer) backend(r *http.Request) (*BackendGroup, *Backend, error) {
+	bg, err := a.backendGroup(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := mux.Vars(r)["backend"]
+	for _, be := range bg.Backends {
+		if be.Name == name {
+			return bg, be, nil
+		}
+	}
+	return nil, nil, errAdminUnknownBackend
+}
+
+func (a *AdminServer) recordAction(operator, action string, bg *BackendGroup, be *Backend, ctx ...interface{}) {
+	backendName := ""
+	if be != nil {
+		backendName = be.Name
+	}
+	RecordAdminAction(operator, action, bg.Name, backendName)
+	log.Info(
+		"admin action",
+		append([]interface{}{
+			"operator", operator,
+			"action", action,
+			"backend_group", bg.Name,
+			"backend", backendName,
+		}, ctx...)...,
+	)
+}
+
+func describeBackendGroup(bg *BackendGroup) *adminBackendGroup {
+	res := &adminBackendGroup{
+		Name:            bg.Name,
+		RoutingStrategy: bg.GetRoutingStrategy(),
+		Backends:        make([]*adminBackend, 0, len(bg.Backends)),
+	}
+	if bg.Consensus != nil {
+		consensus := &adminConsensus{
+			LatestBlockNumber:    bg.Consensus.GetLatestBlockNumber(),
+			SafeBlockNumber:      bg.Consensus.GetSafeBlockNumber(),
+			FinalizedBlockNumber: bg.Consensus.GetFinalizedBlockNumber(),
+			Backends:             make([]string, 0),
+		}
+		for _, be := range bg.Consensus.GetConsensusGroup() {
+			consensus.Backends = append(consensus.Backends, be.Name)
+		}
+		res.Consensus = consensus
+	}
+	for _, be := range bg.Backends {
+		res.Backends = append(res.Backends, describeBackend(bg, be))
+	}
+	return res
+}
+
+func describeBackend(bg *BackendGroup, be *Backend) *adminBackend {
+	res := &adminBackend{
+		Name:            be.Name,
+		Healthy:         be.IsHealthy(),
+		Degraded:        be.IsDegraded(),
+		Draining:        be.IsDraining(),
+		ForcedCandidate: be.IsForcedCandidate(),
+		ErrorRate:       be.ErrorRate(),
+		AvgLatencyMs:    time.Duration(be.latencySlidingWindow.Avg()).Milliseconds(),
+	}
+	if be.circuitBreaker != nil {
+		res.CircuitBreaker = be.circuitBreaker.State().String()
+	}
+	if bg.HealthChecker != nil {
+		if hs, ok := bg.HealthChecker.GetState(be); ok {
+			res.HealthCheck = &adminHealthCheck{
+				Healthy:     hs.Healthy,
+				Reason:      hs.Reason,
+				BlockNumber: hexutil.Uint64(hs.BlockNumber),
+				LatencyMs:   hs.Latency.Milliseconds(),
+				LastCheck:   hs.LastCheck,
+			}
+		}
+	}
+	if bg.Consensus != nil {
+		bs := bg.Consensus.GetBackendState(be)
+		res.State = &adminBackendState{
+			LatestBlockNumber:    bs.latestBlockNumber,
+			LatestBlockHash:      bs.latestBlockHash,
+			SafeBlockNumber:      bs.safeBlockNumber,
+			FinalizedBlockNumber: bs.finalizedBlockNumber,
+			PeerCount:            bs.peerCount,
+			InSync:               bs.inSync,
+			LastUpdate:           bs.lastUpdate,
+			Banned:               bs.IsBanned(),
+			BannedUntil:          bs.bannedUntil,
+		}
+	}
+	return res
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("error writing admin response", "err", err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, code int, err error) {
+	writeAdminJSON(w, code, map[string]string{"error": err.Error()})
+}
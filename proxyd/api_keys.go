@@ -0,0 +1,305 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	apiKeysRedisKey               = "api_keys"
+	defaultAPIKeysRefreshInterval = 30 * time.Second
+	defaultAPIKeyRateInterval     = time.Second
+	apiKeyQuotaInterval           = 24 * time.Hour
+)
+
+// APIKey is an authenticated client of proxyd with its own limits
+type APIKey struct {
+	Name         string
+	BackendGroup string
+	// Label identifies the client in logs and metrics, it is the name of the key for
+	// API keys and the label of the policy for JWTs
+	Label string
+
+	// client is what the limits are counted by, the name of the key for API keys
+	// and the subject of the token for JWTs
+	client            string
+	cfg               APIKeyConfig
+	allowedMethods    *StringSet
+	allowedPathRoutes *StringSet
+	rateLim           FrontendRateLimiter
+	quotaLim          FrontendRateLimiter
+}
+
+func newAPIKey(name string, cfg APIKeyConfig, limiterFactory limiterFactoryFunc) (*APIKey, error) {
+	if name == "" || name == "none" {
+		return nil, fmt.Errorf("invalid api key name %q", name)
+	}
+	if cfg.Key == "" {
+		return nil, fmt.Errorf("api key %s has no key", name)
+	}
+	if cfg.RateLimit < 0 || cfg.DailyQuota < 0 {
+		return nil, fmt.Errorf("api key %s has a negative limit", name)
+	}
+	return newLimitedKey(name, cfg, "api_key", limiterFactory), nil
+}
+
+// newLimitedKey creates a key with the methods, backend group and limits of cfg,
+// its limiters are namespaced by prefix
+func newLimitedKey(name string, cfg APIKeyConfig, prefix string, limiterFactory limiterFactoryFunc) *APIKey {
+	key := &APIKey{
+		Name:         name,
+		BackendGroup: cfg.BackendGroup,
+		Label:        name,
+		client:       name,
+		cfg:          cfg,
+	}
+	if len(cfg.AllowedMethods) > 0 {
+		key.allowedMethods = NewStringSetFromStrings(cfg.AllowedMethods)
+	}
+	if len(cfg.AllowedPathRoutes) > 0 {
+		key.allowedPathRoutes = NewStringSetFromStrings(cfg.AllowedPathRoutes)
+	}
+	if cfg.RateLimit > 0 {
+		interval := time.Duration(cfg.RateLimitInterval)
+		if interval == 0 {
+			interval = defaultAPIKeyRateInterval
+		}
+		key.rateLim = limiterFactory(interval, cfg.RateLimit, prefix, FixedWindowRateLimitAlgorithm)
+	}
+	if cfg.DailyQuota > 0 {
+		key.quotaLim = limiterFactory(apiKeyQuotaInterval, cfg.DailyQuota, prefix+"_quota", FixedWindowRateLimitAlgorithm)
+	}
+	return key
+}
+
+// AllowsMethod returns whether the key is allowed to call the method
+func (k *APIKey) AllowsMethod(method string) bool {
+	return k.allowedMethods == nil || k.allowedMethods.Has(method)
+}
+
+// AllowsPathRoute returns whether the key is allowed to use the path route. Keys restricted
+// to some methods can only use the path routes they list.
+func (k *APIKey) AllowsPathRoute(route string) bool {
+	if k.allowedPathRoutes != nil {
+		return k.allowedPathRoutes.Has(route)
+	}
+	return k.allowedMethods == nil
+}
+
+// Take counts a call against the rate limit and then the daily quota of the key,
+// so that calls rejected by the rate limit don't use up the quota.
+func (k *APIKey) Take(ctx context.Context) error {
+	if k.rateLim != nil {
+		ok, err := k.rateLim.Take(ctx, k.client)
+		if err != nil {
+			log.Warn("error taking api key rate limit", "key", k.Name, "err", err)
+		}
+		if err != nil || !ok {
+			RecordAPIKeyRejection(k.Name, "rate_limit")
+			return ErrOverRateLimit
+		}
+	}
+	if k.quotaLim != nil {
+		ok, err := k.quotaLim.Take(ctx, k.client)
+		if err != nil {
+			log.Warn("error taking api key quota", "key", k.Name, "err", err)
+		}
+		if err != nil || !ok {
+			RecordAPIKeyRejection(k.Name, "quota")
+			return ErrOverAPIKeyQuota
+		}
+	}
+	RecordAPIKeyRequest(k.Name)
+	return nil
+}
+
+// APIKeyStore resolves request credentials to API keys. Keys come from the
+// config and, if enabled, from redis, where they are refreshed periodically
+// so that keys can be added and revoked without a restart.
+type APIKeyStore struct {
+	header          string
+	static          map[string]*APIKey
+	redisClient     redis.UniversalClient
+	redisKey        string
+	refreshInterval time.Duration
+	limiterFactory  limiterFactoryFunc
+
+	mtx   sync.RWMutex
+	keys  map[string]*APIKey
+	names map[string]*APIKey
+
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewAPIKeyStore(cfg APIKeysConfig, redisClient redis.UniversalClient, redisNamespace string, limiterFactory limiterFactoryFunc) (*APIKeyStore, error) {
+	if cfg.UseRedis && redisClient == nil {
+		return nil, errors.New("must specify a Redis URL if use_redis is true in api_keys config")
+	}
+
+	s := &APIKeyStore{
+		header:          cfg.Header,
+		static:          make(map[string]*APIKey),
+		refreshInterval: defaultAPIKeysRefreshInterval,
+		limiterFactory:  limiterFactory,
+		quit:            make(chan struct{}),
+	}
+	if cfg.RefreshInterval != 0 {
+		s.refreshInterval = time.Duration(cfg.RefreshInterval)
+	}
+	if cfg.UseRedis {
+		s.redisClient = redisClient
+		s.redisKey = apiKeysRedisKey
+		if redisNamespace != "" {
+			s.redisKey = redisNamespace + ":" + apiKeysRedisKey
+		}
+	}
+
+	for name, keyCfg := range cfg.Keys {
+		resolved := *keyCfg
+		secret, err := ReadFromEnvOrConfig(keyCfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Key = secret
+		key, err := newAPIKey(name, resolved, limiterFactory)
+		if err != nil {
+			return nil, err
+		}
+		if s.static[secret] != nil {
+			return nil, fmt.Errorf("api keys %s and %s use the same key", s.static[secret].Name, name)
+		}
+		s.static[secret] = key
+	}
+	s.setKeys(s.static)
+	return s, nil
+}
+
+// Start loads the redis keys and keeps refreshing them until Stop is called.
+// A failed load is logged and the static keys stay usable.
+func (s *APIKeyStore) Start() {
+	if s.redisClient == nil {
+		return
+	}
+	if err := s.Refresh(context.Background()); err != nil {
+		log.Error("error loading api keys from redis", "err", err)
+	}
+	go func() {
+		ticker := time.NewTicker(s.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Refresh(context.Background()); err != nil {
+					log.Error("error refreshing api keys from redis", "err", err)
+				}
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (s *APIKeyStore) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+}
+
+// Refresh replaces the redis keys with the current content of the redis hash.
+// Keys whose config didn't change are kept, so their in-memory limits carry over.
+func (s *APIKeyStore) Refresh(ctx context.Context) error {
+	entries, err := s.redisClient.HGetAll(ctx, s.redisKey).Result()
+	if err != nil {
+		return err
+	}
+
+	s.mtx.RLock()
+	current := s.names
+	s.mtx.RUnlock()
+
+	keys := make(map[string]*APIKey, len(s.static)+len(entries))
+	for secret, key := range s.static {
+		keys[secret] = key
+	}
+	for name, val := range entries {
+		var cfg APIKeyConfig
+		if err := json.Unmarshal([]byte(val), &cfg); err != nil {
+			log.Warn("skipping invalid api key from redis", "key", name, "err", err)
+			continue
+		}
+		if existing := keys[cfg.Key]; existing != nil {
+			log.Warn("skipping api key from redis that is already in use", "key", name, "existing", existing.Name)
+			continue
+		}
+		key := current[name]
+		if key == nil || !reflect.DeepEqual(key.cfg, cfg) {
+			key, err = newAPIKey(name, cfg, s.limiterFactory)
+			if err != nil {
+				log.Warn("skipping invalid api key from redis", "key", name, "err", err)
+				continue
+			}
+		}
+		keys[cfg.Key] = key
+	}
+	s.setKeys(keys)
+	return nil
+}
+
+func (s *APIKeyStore) setKeys(keys map[string]*APIKey) {
+	names := make(map[string]*APIKey, len(keys))
+	for _, key := range keys {
+		names[key.Name] = key
+	}
+	s.mtx.Lock()
+	s.keys = keys
+	s.names = names
+	s.mtx.Unlock()
+	RecordAPIKeysLoaded(len(keys))
+}
+
+// Lookup returns the key with the given secret, or nil if there is none
+func (s *APIKeyStore) Lookup(secret string) *APIKey {
+	if secret == "" {
+		return nil
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.keys[secret]
+}
+
+// Authenticate returns the key presented by the request in the URL path, the
+// bearer token or the configured header, or nil if none of them is a valid key.
+func (s *APIKeyStore) Authenticate(r *http.Request, pathSecret string) *APIKey {
+	candidates := []string{pathSecret}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		candidates = append(candidates, token)
+	}
+	if s.header != "" {
+		candidates = append(candidates, r.Header.Get(s.header))
+	}
+	for _, secret := range candidates {
+		if key := s.Lookup(secret); key != nil {
+			return key
+		}
+	}
+	return nil
+}
+
+func GetAPIKey(ctx context.Context) *APIKey {
+	key, ok := ctx.Value(ContextKeyAPIKey).(*APIKey)
+	if !ok {
+		return nil
+	}
+	return key
+}
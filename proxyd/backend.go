@@ -15,11 +15,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	sw "github.com/ethereum-optimism/infra/proxyd/pkg/avg-sliding-window"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
@@ -111,6 +113,31 @@ var (
 		HTTPErrorCode: 500,
 	}
 
+	ErrOverAPIKeyQuota = &RPCErr{
+		Code:          JSONRPCErrorInternal - 22,
+		Message:       "api key is over its daily quota",
+		HTTPErrorCode: 429,
+	}
+
+	ErrQuorumNotReached = &RPCErr{
+		Code:          JSONRPCErrorInternal - 23,
+		Message:       "backends did not reach quorum",
+		HTTPErrorCode: 502,
+	}
+
+	// ErrFilterNotFound is returned when the backend that created a filter is unavailable,
+	// with the message of geth so that clients create a new filter
+	ErrFilterNotFound = &RPCErr{
+		Code:    JSONRPCErrorInternal - 24,
+		Message: "filter not found",
+	}
+
+	ErrSenderDenied = &RPCErr{
+		Code:          JSONRPCErrorInternal - 25,
+		Message:       "sender is not allowed",
+		HTTPErrorCode: 403,
+	}
+
 	ErrBackendUnexpectedJSONRPC = errors.New("backend returned an unexpected JSON-RPC response")
 
 	ErrConsensusGetReceiptsCantBeBatched = errors.New("consensus_getReceipts cannot be batched")
@@ -140,6 +167,7 @@ type Backend struct {
 	wsURL                string
 	authUsername         string
 	authPassword         string
+	jwtAuth              rpc.HTTPAuth
 	headers              map[string]string
 	client               *LimitedHTTPClient
 	dialer               *websocket.Dialer
@@ -152,7 +180,10 @@ type Backend struct {
 	proxydIP             string
 
 	skipPeerCountCheck bool
-	forcedCandidate    bool
+	forcedCandidate    atomic.Bool
+
+	// draining backends keep their consensus state but don't receive new requests
+	draining atomic.Bool
 
 	maxDegradedLatencyThreshold time.Duration
 	maxLatencyThreshold         time.Duration
@@ -162,7 +193,19 @@ type Backend struct {
 	networkRequestsSlidingWindow    *sw.AvgSlidingWindow
 	intermittentErrorsSlidingWindow *sw.AvgSlidingWindow
 
+	// outstandingRequests counts the requests currently in flight to the backend
+	outstandingRequests atomic.Int64
+
+	latencySamples latencySamples
+
+	// circuitBreaker is nil when disabled
+	circuitBreaker *circuitBreaker
+
 	weight int
+
+	// ctx is cancelled by Close, it stops the background work of the backend
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type BackendOpt func(b *Backend)
@@ -174,6 +217,14 @@ func WithBasicAuth(username, password string) BackendOpt {
 	}
 }
 
+// WithJWTSecret makes the backend authenticate with a token signed with secret, minted for
+// every request like the engine API expects
+func WithJWTSecret(secret [32]byte) BackendOpt {
+	return func(b *Backend) {
+		b.jwtAuth = node.NewJWTAuth(secret)
+	}
+}
+
 func WithHeaders(headers map[string]string) BackendOpt {
 	return func(b *Backend) {
 		b.headers = headers
@@ -204,6 +255,12 @@ func WithOutOfServiceDuration(interval time.Duration) BackendOpt {
 	}
 }
 
+func WithCircuitBreaker(cfg CircuitBreakerConfig) BackendOpt {
+	return func(b *Backend) {
+		b.circuitBreaker = newCircuitBreaker(b, cfg)
+	}
+}
+
 func WithMaxRPS(maxRPS int) BackendOpt {
 	return func(b *Backend) {
 		b.maxRPS = maxRPS
@@ -245,7 +302,7 @@ func WithConsensusSkipPeerCountCheck(skipPeerCountCheck bool) BackendOpt {
 
 func WithConsensusForcedCandidate(forcedCandidate bool) BackendOpt {
 	return func(b *Backend) {
-		b.forcedCandidate = forcedCandidate
+		b.forcedCandidate.Store(forcedCandidate)
 	}
 }
 
@@ -338,6 +395,7 @@ func NewBackend(
 		networkRequestsSlidingWindow:    sw.NewSlidingWindow(),
 		intermittentErrorsSlidingWindow: sw.NewSlidingWindow(),
 	}
+	backend.ctx, backend.cancel = context.WithCancel(context.Background())
 
 	backend.Override(opts...)
 
@@ -348,6 +406,14 @@ func NewBackend(
 	return backend
 }
 
+// Close stops the background work of a retired backend, such as its circuit breaker probes.
+// Requests already sent to it still complete.
+func (b *Backend) Close() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
 func (b *Backend) Override(opts ...BackendOpt) {
 	for _, opt := range opts {
 		opt(b)
@@ -355,6 +421,11 @@ func (b *Backend) Override(opts ...BackendOpt) {
 }
 
 func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]*RPCRes, error) {
+	ticket, ok := b.circuitBreaker.allow()
+	if !ok {
+		return nil, ErrBackendOffline
+	}
+
 	var lastError error
 	// <= to account for the first attempt not technically being
 	// a retry
@@ -380,7 +451,20 @@ func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]
 			"max_attempts", b.maxRetries+1,
 			"method", metricLabelMethod,
 		)
-		res, err := b.doForward(ctx, reqs, isBatch)
+		attemptCtx, span := StartSpan(ctx, "proxyd.backend.request", SpanKindClient)
+		span.SetAttributes(
+			"proxyd.backend", b.Name,
+			"rpc.method", metricLabelMethod,
+			"rpc.batch_size", len(reqs),
+			"proxyd.attempt", i+1,
+		)
+		res, err := b.doForward(attemptCtx, reqs, isBatch)
+		span.RecordError(err)
+		span.End()
+		if err != nil && lostHedge(ctx) {
+			b.circuitBreaker.release(ticket)
+			return nil, err
+		}
 		switch err {
 		case nil: // do nothing
 		case ErrBackendResponseTooLarge:
@@ -430,12 +514,23 @@ func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]
 			)
 			timer.ObserveDuration()
 			RecordBatchRPCError(ctx, b.Name, reqs, err)
+			// every failed attempt counts against the circuit, and retries stop once it opened
+			b.circuitBreaker.record(ticket, err)
+			if !b.circuitBreaker.admits(ticket) {
+				return nil, wrapErr(lastError, "permanent error forwarding request")
+			}
 			sleepContext(ctx, calcBackoff(i))
 			continue
 		}
 		timer.ObserveDuration()
 
 		MaybeRecordErrorsInRPCRes(ctx, b.Name, reqs, res)
+		// only network errors count against the circuit
+		if err == nil {
+			b.circuitBreaker.record(ticket, nil)
+		} else {
+			b.circuitBreaker.release(ticket)
+		}
 		return res, err
 	}
 
@@ -443,15 +538,47 @@ func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]
 }
 
 func (b *Backend) ProxyWS(clientConn *websocket.Conn, methodWhitelist *StringSet) (*WSProxier, error) {
-	backendConn, _, err := b.dialer.Dial(b.wsURL, nil) // nolint:bodyclose
+	backendConn, err := b.dialWS()
 	if err != nil {
-		return nil, wrapErr(err, "error dialing backend")
+		return nil, err
 	}
 
 	activeBackendWsConnsGauge.WithLabelValues(b.Name).Inc()
 	return NewWSProxier(b, clientConn, backendConn, methodWhitelist), nil
 }
 
+// setAuth authenticates a request to the backend, with basic auth or a freshly minted JWT
+func (b *Backend) setAuth(req *http.Request) {
+	if b.authPassword != "" {
+		req.SetBasicAuth(b.authUsername, b.authPassword)
+	}
+	if b.jwtAuth != nil {
+		if err := b.jwtAuth(req.Header); err != nil {
+			log.Error("error minting backend jwt", "name", b.Name, "err", err)
+		}
+	}
+}
+
+// wsHeader returns the headers of the websocket handshake with the backend
+func (b *Backend) wsHeader() http.Header {
+	if b.jwtAuth == nil {
+		return nil
+	}
+	header := make(http.Header)
+	if err := b.jwtAuth(header); err != nil {
+		log.Error("error minting backend jwt", "name", b.Name, "err", err)
+	}
+	return header
+}
+
+func (b *Backend) dialWS() (*websocket.Conn, error) {
+	conn, _, err := b.dialer.Dial(b.wsURL, b.wsHeader()) // nolint:bodyclose
+	if err != nil {
+		return nil, wrapErr(err, "error dialing backend")
+	}
+	return conn, nil
+}
+
 // ForwardRPC makes a call directly to a backend and populate the response into `res`
 func (b *Backend) ForwardRPC(ctx context.Context, res *RPCRes, id string, method string, params ...any) error {
 	jsonParams, err := json.Marshal(params)
@@ -486,6 +613,11 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 	// we are concerned about network error rates, so we record 1 request independently of how many are in the batch
 	b.networkRequestsSlidingWindow.Incr()
 
+	RecordBackendOutstandingRequests(b, b.outstandingRequests.Add(1))
+	defer func() {
+		RecordBackendOutstandingRequests(b, b.outstandingRequests.Add(-1))
+	}()
+
 	translatedReqs := make(map[string]*RPCReq, len(rpcReqs))
 	// translate consensus_getReceipts to receipts target
 	// right now we only support non-batched
@@ -557,32 +689,27 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 		return nil, wrapErr(err, "error creating backend request")
 	}
 
-	if b.authPassword != "" {
-		httpReq.SetBasicAuth(b.authUsername, b.authPassword)
-	}
+	b.setAuth(httpReq)
 
 	opTxProxyAuth := GetOpTxProxyAuthHeader(ctx)
 	if opTxProxyAuth != "" {
 		httpReq.Header.Set(DefaultOpTxProxyAuthHeader, opTxProxyAuth)
 	}
 
-	xForwardedFor := GetXForwardedFor(ctx)
-	if b.stripTrailingXFF {
-		xForwardedFor = stripXFF(xForwardedFor)
-	} else if b.proxydIP != "" {
-		xForwardedFor = fmt.Sprintf("%s, %s", xForwardedFor, b.proxydIP)
-	}
-
 	httpReq.Header.Set("content-type", "application/json")
-	httpReq.Header.Set("X-Forwarded-For", xForwardedFor)
+	httpReq.Header.Set("X-Forwarded-For", b.forwardedFor(ctx))
 
 	for name, value := range b.headers {
 		httpReq.Header.Set(name, value)
 	}
+	InjectTraceContext(ctx, httpReq.Header)
 
 	start := time.Now()
 	httpRes, err := b.client.DoLimited(httpReq)
 	if err != nil {
+		if lostHedge(ctx) {
+			return nil, wrapErr(err, "hedged request cancelled")
+		}
 		b.intermittentErrorsSlidingWindow.Incr()
 		RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
 		return nil, wrapErr(err, "error in backend request")
@@ -599,6 +726,7 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 		strconv.Itoa(httpRes.StatusCode),
 		strconv.FormatBool(isBatch),
 	).Inc()
+	SpanFromContext(ctx).SetAttributes("http.status_code", httpRes.StatusCode)
 
 	// Alchemy returns a 400 on bad JSONs, so handle that case
 	if httpRes.StatusCode != 200 && httpRes.StatusCode != 400 {
@@ -613,6 +741,9 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 		return nil, ErrBackendResponseTooLarge
 	}
 	if err != nil {
+		if lostHedge(ctx) {
+			return nil, wrapErr(err, "hedged request cancelled")
+		}
 		b.intermittentErrorsSlidingWindow.Incr()
 		RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
 		return nil, wrapErr(err, "error reading response body")
@@ -656,6 +787,7 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 	}
 	duration := time.Since(start)
 	b.latencySlidingWindow.Add(float64(duration))
+	b.latencySamples.Add(duration)
 	RecordBackendNetworkLatencyAverageSlidingWindow(b, time.Duration(b.latencySlidingWindow.Avg()))
 	RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
 
@@ -675,8 +807,23 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 	return rpcRes, nil
 }
 
+// forwardedFor returns the X-Forwarded-For header sent to the backend
+func (b *Backend) forwardedFor(ctx context.Context) string {
+	xForwardedFor := GetXForwardedFor(ctx)
+	if b.stripTrailingXFF {
+		return stripXFF(xForwardedFor)
+	}
+	if b.proxydIP != "" {
+		return fmt.Sprintf("%s, %s", xForwardedFor, b.proxydIP)
+	}
+	return xForwardedFor
+}
+
 // IsHealthy checks if the backend is able to serve traffic, based on dynamic parameters
 func (b *Backend) IsHealthy() bool {
+	if b.circuitBreaker.State() == CircuitOpen {
+		return false
+	}
 	errorRate := b.ErrorRate()
 	avgLatency := time.Duration(b.latencySlidingWindow.Avg())
 	if errorRate >= b.maxErrorRateThreshold {
@@ -698,6 +845,41 @@ func (b *Backend) ErrorRate() (errorRate float64) {
 	return errorRate
 }
 
+// IsForcedCandidate checks if the backend is always included in the consensus group
+func (b *Backend) IsForcedCandidate() bool {
+	return b.forcedCandidate.Load()
+}
+
+func (b *Backend) SetForcedCandidate(forcedCandidate bool) {
+	b.forcedCandidate.Store(forcedCandidate)
+	RecordConsensusBackendForcedCandidate(b, forcedCandidate)
+}
+
+// IsDraining checks if the backend was taken out of rotation
+func (b *Backend) IsDraining() bool {
+	return b.draining.Load()
+}
+
+func (b *Backend) SetDraining(draining bool) {
+	b.draining.Store(draining)
+	RecordBackendDraining(b, draining)
+}
+
+// OutstandingRequests returns the number of requests currently in flight to the backend
+func (b *Backend) OutstandingRequests() int64 {
+	return b.outstandingRequests.Load()
+}
+
+// AvgLatency returns the average latency of the backend over its sliding window
+func (b *Backend) AvgLatency() time.Duration {
+	return time.Duration(b.latencySlidingWindow.Avg())
+}
+
+// LatencyPercentile returns the p-th percentile (0 < p <= 1) of the latest latencies of the backend
+func (b *Backend) LatencyPercentile(p float64) (time.Duration, bool) {
+	return b.latencySamples.Percentile(p)
+}
+
 // IsDegraded checks if the backend is serving traffic in a degraded state (i.e. used as a last resource)
 func (b *Backend) IsDegraded() bool {
 	avgLatency := time.Duration(b.latencySlidingWindow.Avg())
@@ -732,9 +914,35 @@ type BackendGroup struct {
 	Backends               []*Backend
 	WeightedRouting        bool
 	Consensus              *ConsensusPoller
+	HealthChecker          *HealthChecker
 	FallbackBackends       map[string]bool
 	routingStrategy        RoutingStrategy
 	multicallRPCErrorCheck bool
+
+	// rankingStrategy is the load aware strategy used to order the candidate backends, if any
+	rankingStrategy RoutingStrategy
+
+	// hedgeMethods is nil when hedging is disabled
+	hedgeMethods           *StringSet
+	hedgeDelay             time.Duration
+	hedgeLatencyPercentile float64
+
+	// getLogsSplitRange is 0 when eth_getLogs splitting is disabled
+	getLogsSplitRange       uint64
+	getLogsSplitConcurrency int
+	getLogsSplitMaxChunks   int
+	getLogsMaxResults       int
+
+	// quorumMethods is nil unless routing_strategy is quorum
+	quorumMethods   *StringSet
+	quorumSize      int
+	quorumThreshold int
+
+	// stickySessions keeps the filters and, if enabled, the clients on the same backend
+	stickySessions *stickySessions
+
+	subscriptionMux   *WSSubscriptionMux
+	subscriptionMuxMu sync.Mutex
 }
 
 func (bg *BackendGroup) GetRoutingStrategy() RoutingStrategy {
@@ -768,7 +976,25 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 		return nil, "", nil
 	}
 
+	if bg.stickySessions != nil {
+		if res, servedBy, split, err := bg.forwardFilterCalls(ctx, rpcReqs, isBatch); split {
+			return res, servedBy, err
+		}
+	}
+	if bg.getLogsSplitRange > 0 {
+		if res, servedBy, split, err := bg.forwardSplitLogs(ctx, rpcReqs, isBatch); split {
+			return res, servedBy, err
+		}
+	}
+	return bg.forward(ctx, rpcReqs, isBatch)
+}
+
+func (bg *BackendGroup) forward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool) ([]*RPCRes, string, error) {
+
 	backends := bg.orderedBackendsForRequest()
+	if bg.stickySessions != nil {
+		backends = bg.stickySessions.order(ctx, backends)
+	}
 
 	overriddenResponses := make([]*indexedReqRes, 0)
 	rewrittenReqs := make([]*RPCReq, 0, len(rpcReqs))
@@ -777,7 +1003,10 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 	// serving traffic from any backend that agrees in the consensus group
 	// We also rewrite block tags to enforce compliance with consensus
 	if bg.Consensus != nil {
+		_, span := StartSpan(ctx, "proxyd.consensus.rewrite", SpanKindInternal)
 		rpcReqs, overriddenResponses = bg.OverwriteConsensusResponses(rpcReqs, overriddenResponses, rewrittenReqs)
+		span.SetAttributes("proxyd.backend_group", bg.Name, "proxyd.overridden_responses", len(overriddenResponses))
+		span.End()
 	}
 
 	// When routing_strategy is set to 'multicall' the request will be forward to all backends
@@ -792,7 +1021,14 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 	ch := make(chan BackendGroupRPCResponse)
 	go func() {
 		defer close(ch)
-		backendResp := bg.ForwardRequestToBackendGroup(rpcReqs, backends, ctx, isBatch)
+		var backendResp *BackendGroupRPCResponse
+		if bg.canQuorum(rpcReqs) {
+			backendResp = bg.ForwardQuorum(rpcReqs, backends, ctx, isBatch)
+		} else if bg.canHedge(rpcReqs) {
+			backendResp = bg.ForwardHedged(rpcReqs, backends, ctx, isBatch)
+		} else {
+			backendResp = bg.ForwardRequestToBackendGroup(rpcReqs, backends, ctx, isBatch)
+		}
 		ch <- *backendResp
 	}()
 	backendResp := <-ch
@@ -806,6 +1042,10 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 		return backendResp.RPCRes, backendResp.ServedBy, backendResp.error
 	}
 
+	if bg.stickySessions != nil {
+		bg.stickySessions.record(ctx, backendResp.backend, rpcReqs, backendResp.RPCRes)
+	}
+
 	// re-apply overridden responses
 	log.Trace("successfully served request overriding responses",
 		"req_id", GetReqID(ctx),
@@ -843,6 +1083,9 @@ func (bg *BackendGroup) ExecuteMulticall(ctx context.Context, rpcReqs []*RPCReq)
 	var wg sync.WaitGroup
 	ch := make(chan *multicallTuple, len(bg.Backends))
 	for _, backend := range bg.Backends {
+		if backend.IsDraining() {
+			continue
+		}
 		wg.Add(1)
 		go bg.MulticallRequest(backend, rpcReqs, &wg, bgCtx, ch)
 	}
@@ -956,6 +1199,9 @@ func (bg *BackendGroup) ProcessMulticallResponses(ch chan *multicallTuple, ctx c
 
 func (bg *BackendGroup) ProxyWS(ctx context.Context, clientConn *websocket.Conn, methodWhitelist *StringSet) (*WSProxier, error) {
 	for _, back := range bg.Backends {
+		if back.IsDraining() {
+			continue
+		}
 		proxier, err := back.ProxyWS(clientConn, methodWhitelist)
 		if errors.Is(err, ErrBackendOffline) {
 			log.Warn(
@@ -985,6 +1231,7 @@ func (bg *BackendGroup) ProxyWS(ctx context.Context, clientConn *websocket.Conn,
 			)
 			continue
 		}
+		proxier.bg = bg
 		return proxier, nil
 	}
 
@@ -999,6 +1246,40 @@ func weightedShuffle(backends []*Backend) {
 	weightedshuffle.ShuffleInplace(backends, weight, nil)
 }
 
+// rankBackends orders backends in place according to a load aware routing strategy.
+// Backends are shuffled first so that ties don't always favor the same backend.
+func rankBackends(strategy RoutingStrategy, backends []*Backend) {
+	rand.Shuffle(len(backends), func(i, j int) {
+		backends[i], backends[j] = backends[j], backends[i]
+	})
+
+	switch strategy {
+	case LeastLatencyRoutingStrategy:
+		sort.SliceStable(backends, func(i, j int) bool {
+			return backends[i].AvgLatency() < backends[j].AvgLatency()
+		})
+	case LeastOutstandingRoutingStrategy:
+		sort.SliceStable(backends, func(i, j int) bool {
+			return backends[i].OutstandingRequests() < backends[j].OutstandingRequests()
+		})
+	case PowerOfTwoChoicesRoutingStrategy:
+		// the first two backends are a random sample after the shuffle,
+		// the least loaded one is tried first and the rest are kept as failovers
+		if len(backends) >= 2 && lessLoaded(backends[1], backends[0]) {
+			backends[0], backends[1] = backends[1], backends[0]
+		}
+	}
+}
+
+// lessLoaded compares backends by in-flight requests, breaking ties with the average latency
+func lessLoaded(a, b *Backend) bool {
+	aOutstanding, bOutstanding := a.OutstandingRequests(), b.OutstandingRequests()
+	if aOutstanding != bOutstanding {
+		return aOutstanding < bOutstanding
+	}
+	return a.AvgLatency() < b.AvgLatency()
+}
+
 func (bg *BackendGroup) orderedBackendsForRequest() []*Backend {
 	if bg.Consensus != nil {
 		return bg.loadBalancedConsensusGroup()
@@ -1006,13 +1287,19 @@ func (bg *BackendGroup) orderedBackendsForRequest() []*Backend {
 		healthy := make([]*Backend, 0, len(bg.Backends))
 		unhealthy := make([]*Backend, 0, len(bg.Backends))
 		for _, be := range bg.Backends {
-			if be.IsHealthy() {
+			if be.IsDraining() {
+				continue
+			}
+			if be.IsHealthy() && bg.HealthChecker.IsHealthy(be) {
 				healthy = append(healthy, be)
 			} else {
 				unhealthy = append(unhealthy, be)
 			}
 		}
-		if bg.WeightedRouting {
+		if bg.rankingStrategy != "" {
+			rankBackends(bg.rankingStrategy, healthy)
+			rankBackends(bg.rankingStrategy, unhealthy)
+		} else if bg.WeightedRouting {
 			weightedShuffle(healthy)
 			weightedShuffle(unhealthy)
 		}
@@ -1027,8 +1314,8 @@ func (bg *BackendGroup) loadBalancedConsensusGroup() []*Backend {
 	backendsDegraded := make([]*Backend, 0, len(cg))
 	// separate into healthy, degraded and unhealthy backends
 	for _, be := range cg {
-		// unhealthy are filtered out and not attempted
-		if !be.IsHealthy() {
+		// unhealthy and draining are filtered out and not attempted
+		if !be.IsHealthy() || be.IsDraining() {
 			continue
 		}
 		if be.IsDegraded() {
@@ -1047,7 +1334,13 @@ func (bg *BackendGroup) loadBalancedConsensusGroup() []*Backend {
 		backendsDegraded[i], backendsDegraded[j] = backendsDegraded[j], backendsDegraded[i]
 	})
 
-	if bg.WeightedRouting {
+	if bg.rankingStrategy != "" {
+		rankBackends(bg.rankingStrategy, backendsHealthy)
+		rankBackends(bg.rankingStrategy, backendsDegraded)
+	} else if bg.Consensus.scoring {
+		bg.Consensus.scoredShuffle(backendsHealthy, bg.WeightedRouting)
+		bg.Consensus.scoredShuffle(backendsDegraded, bg.WeightedRouting)
+	} else if bg.WeightedRouting {
 		weightedShuffle(backendsHealthy)
 	}
 
@@ -1062,6 +1355,14 @@ func (bg *BackendGroup) Shutdown() {
 	if bg.Consensus != nil {
 		bg.Consensus.Shutdown()
 	}
+	if bg.HealthChecker != nil {
+		bg.HealthChecker.Shutdown()
+	}
+	bg.subscriptionMuxMu.Lock()
+	if bg.subscriptionMux != nil {
+		bg.subscriptionMux.Close()
+	}
+	bg.subscriptionMuxMu.Unlock()
 }
 
 func calcBackoff(i int) time.Duration {
@@ -1072,6 +1373,7 @@ func calcBackoff(i int) time.Duration {
 
 type WSProxier struct {
 	backend         *Backend
+	bg              *BackendGroup
 	clientConn      *websocket.Conn
 	clientConnMu    sync.Mutex
 	backendConn     *websocket.Conn
@@ -1079,6 +1381,20 @@ type WSProxier struct {
 	methodWhitelist *StringSet
 	readTimeout     time.Duration
 	writeTimeout    time.Duration
+	closing         atomic.Bool
+
+	// subscriptions of the client, replayed on the next backend
+	// of the group when the backend connection fails
+	subsMu         sync.Mutex
+	pendingSubs    map[string]json.RawMessage
+	subs           map[string]*wsProxiedSubscription
+	upstreamSubs   map[string]string
+	resubscribing  map[string]string
+	nextInternalID uint64
+	failedOver     bool
+	// inflight counts the calls of the client waiting for a response by ID,
+	// they are answered by proxyd when the backend connection fails
+	inflight map[string]int
 }
 
 func NewWSProxier(backend *Backend, clientConn, backendConn *websocket.Conn, methodWhitelist *StringSet) *WSProxier {
@@ -1089,6 +1405,11 @@ func NewWSProxier(backend *Backend, clientConn, backendConn *websocket.Conn, met
 		methodWhitelist: methodWhitelist,
 		readTimeout:     defaultWSReadTimeout,
 		writeTimeout:    defaultWSWriteTimeout,
+		pendingSubs:     make(map[string]json.RawMessage),
+		subs:            make(map[string]*wsProxiedSubscription),
+		upstreamSubs:    make(map[string]string),
+		resubscribing:   make(map[string]string),
+		inflight:        make(map[string]int),
 	}
 }
 
@@ -1106,6 +1427,7 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 		// Block until we get a message.
 		msgType, msg, err := w.clientConn.ReadMessage()
 		if err != nil {
+			w.closing.Store(true)
 			if err := w.writeBackendConn(websocket.CloseMessage, formatWSError(err)); err != nil {
 				log.Error("error writing backendConn message", "err", err)
 				errC <- err
@@ -1113,13 +1435,13 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 			}
 		}
 
-		RecordWSMessage(ctx, w.backend.Name, SourceClient)
+		RecordWSMessage(ctx, w.currentBackend().Name, SourceClient)
 
 		// Route control messages to the backend. These don't
 		// count towards the total RPC requests count.
 		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
 			err := w.writeBackendConn(msgType, msg)
-			if err != nil {
+			if err != nil && !w.canFailover() {
 				errC <- err
 				return
 			}
@@ -1130,7 +1452,7 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 
 		// Don't bother sending invalid requests to the backend,
 		// just handle them here.
-		req, err := w.prepareClientMsg(msg)
+		req, err := w.prepareClientMsg(ctx, msg)
 		if err != nil {
 			var id json.RawMessage
 			method := MethodUnknown
@@ -1168,7 +1490,26 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 			continue
 		}
 
-		RecordRPCForward(ctx, w.backend.Name, req.Method, RPCRequestSourceWS)
+		switch req.Method {
+		case "eth_subscribe":
+			w.trackSubscribe(req)
+		default:
+			w.trackCall(req)
+		}
+		switch req.Method {
+		case "eth_unsubscribe":
+			var res *RPCRes
+			msg, res = w.trackUnsubscribe(req, msg)
+			if res != nil {
+				if err := w.writeClientConn(msgType, mustMarshalJSON(res)); err != nil {
+					errC <- err
+					return
+				}
+				continue
+			}
+		}
+
+		RecordRPCForward(ctx, w.currentBackend().Name, req.Method, RPCRequestSourceWS)
 		log.Info(
 			"forwarded WS message to backend",
 			"method", req.Method,
@@ -1178,8 +1519,20 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 
 		err = w.writeBackendConn(msgType, msg)
 		if err != nil {
-			errC <- err
-			return
+			if !w.canFailover() {
+				errC <- err
+				return
+			}
+			// Pending subscriptions are replayed by the failover, other
+			// calls are answered here unless the failover already did.
+			if req.Method == "eth_subscribe" || !w.untrackCall(req.ID) {
+				continue
+			}
+			msg = mustMarshalJSON(NewRPCErrorRes(req.ID, ErrBackendOffline))
+			if err := w.writeClientConn(msgType, msg); err != nil {
+				errC <- err
+				return
+			}
 		}
 	}
 }
@@ -1188,6 +1541,18 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 	for {
 		// Block until we get a message.
 		msgType, msg, err := w.backendConn.ReadMessage()
+		if err != nil && w.canFailover() {
+			failoverErr := w.failover(ctx, err)
+			if failoverErr == nil {
+				continue
+			}
+			log.Error("ws backend failover failed", "backend_group", w.bg.Name, "req_id", GetReqID(ctx), "err", failoverErr)
+			if err := w.writeClientConn(websocket.CloseMessage, formatWSError(err)); err != nil {
+				log.Error("error writing clientConn message", "err", err)
+			}
+			errC <- err
+			return
+		}
 		if err != nil {
 			if err := w.writeClientConn(websocket.CloseMessage, formatWSError(err)); err != nil {
 				log.Error("error writing clientConn message", "err", err)
@@ -1196,7 +1561,8 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 			}
 		}
 
-		RecordWSMessage(ctx, w.backend.Name, SourceBackend)
+		backend := w.currentBackend()
+		RecordWSMessage(ctx, backend.Name, SourceBackend)
 
 		// Route control messages directly to the client.
 		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
@@ -1208,6 +1574,11 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 			continue
 		}
 
+		msg = w.trackBackendMsg(msg)
+		if msg == nil {
+			continue
+		}
+
 		res, err := w.parseBackendMsg(msg)
 		if err != nil {
 			var id json.RawMessage
@@ -1226,7 +1597,7 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 					"auth", GetAuthCtx(ctx),
 					"req_id", GetReqID(ctx),
 				)
-				RecordRPCError(ctx, w.backend.Name, MethodUnknown, res.Error)
+				RecordRPCError(ctx, backend.Name, MethodUnknown, res.Error)
 			} else {
 				log.Info(
 					"forwarded WS message to client",
@@ -1245,21 +1616,42 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 }
 
 func (w *WSProxier) close() {
+	w.closing.Store(true)
 	w.clientConn.Close()
-	w.backendConn.Close()
-	activeBackendWsConnsGauge.WithLabelValues(w.backend.Name).Dec()
+	w.backendConnMu.Lock()
+	defer w.backendConnMu.Unlock()
+	if w.backendConn != nil {
+		w.backendConn.Close()
+		activeBackendWsConnsGauge.WithLabelValues(w.backend.Name).Dec()
+	}
+}
+
+func (w *WSProxier) prepareClientMsg(ctx context.Context, msg []byte) (*RPCReq, error) {
+	return prepareWSClientMsg(ctx, msg, w.methodWhitelist)
 }
 
-func (w *WSProxier) prepareClientMsg(msg []byte) (*RPCReq, error) {
+// prepareWSClientMsg parses a websocket message of a client, and checks
+// the method against the whitelist and the API key of the client
+func prepareWSClientMsg(ctx context.Context, msg []byte, methodWhitelist *StringSet) (*RPCReq, error) {
 	req, err := ParseRPCReq(msg)
 	if err != nil {
 		return nil, err
 	}
 
-	if !w.methodWhitelist.Has(req.Method) {
+	if !methodWhitelist.Has(req.Method) {
 		return req, ErrMethodNotWhitelisted
 	}
 
+	if apiKey := GetAPIKey(ctx); apiKey != nil {
+		if !apiKey.AllowsMethod(req.Method) {
+			RecordAPIKeyRejection(apiKey.Name, "method")
+			return req, ErrMethodNotWhitelisted
+		}
+		if err := apiKey.Take(ctx); err != nil {
+			return req, err
+		}
+	}
+
 	return req, nil
 }
 
@@ -1286,6 +1678,9 @@ func (w *WSProxier) writeClientConn(msgType int, msg []byte) error {
 func (w *WSProxier) writeBackendConn(msgType int, msg []byte) error {
 	w.backendConnMu.Lock()
 	defer w.backendConnMu.Unlock()
+	if w.backendConn == nil {
+		return ErrBackendOffline
+	}
 	if err := w.backendConn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
 		log.Error("ws backend write timeout", "err", err)
 		return err
@@ -1389,6 +1784,8 @@ type BackendGroupRPCResponse struct {
 	RPCRes   []*RPCRes
 	ServedBy string
 	error    error
+	// backend served the response, it is only set when a single backend did
+	backend *Backend
 }
 
 func (bg *BackendGroup) ForwardRequestToBackendGroup(
@@ -1406,6 +1803,13 @@ func (bg *BackendGroup) ForwardRequestToBackendGroup(
 		if len(rpcReqs) > 0 {
 
 			res, err = back.Forward(ctx, rpcReqs, isBatch)
+			if err != nil && lostHedge(ctx) {
+				return &BackendGroupRPCResponse{
+					RPCRes:   nil,
+					ServedBy: "",
+					error:    err,
+				}
+			}
 
 			if errors.Is(err, ErrConsensusGetReceiptsCantBeBatched) ||
 				errors.Is(err, ErrConsensusGetReceiptsInvalidTarget) ||
@@ -1457,6 +1861,7 @@ func (bg *BackendGroup) ForwardRequestToBackendGroup(
 			RPCRes:   res,
 			ServedBy: servedBy,
 			error:    nil,
+			backend:  back,
 		}
 	}
 
@@ -1482,12 +1887,7 @@ func OverrideResponses(res []*RPCRes, overriddenResponses []*indexedReqRes) []*R
 }
 
 func (bg *BackendGroup) OverwriteConsensusResponses(rpcReqs []*RPCReq, overriddenResponses []*indexedReqRes, rewrittenReqs []*RPCReq) ([]*RPCReq, []*indexedReqRes) {
-	rctx := RewriteContext{
-		latest:        bg.Consensus.GetLatestBlockNumber(),
-		safe:          bg.Consensus.GetSafeBlockNumber(),
-		finalized:     bg.Consensus.GetFinalizedBlockNumber(),
-		maxBlockRange: bg.Consensus.maxBlockRange,
-	}
+	rctx := bg.Consensus.rewriteContext()
 
 	for i, req := range rpcReqs {
 		res := RPCRes{JSONRPC: JSONRPCVersion, ID: req.ID}
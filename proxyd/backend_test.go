@@ -2,6 +2,7 @@ package proxyd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -20,3 +21,46 @@ func TestStripXFF(t *testing.T) {
 		assert.Equal(t, test.out, actual)
 	}
 }
+
+func TestRankBackends(t *testing.T) {
+	newBackend := func(name string, latency time.Duration, outstanding int64) *Backend {
+		b := NewBackend(name, "http://localhost", "", nil, WithStrippedTrailingXFF())
+		if latency > 0 {
+			b.latencySlidingWindow.Add(float64(latency))
+		}
+		b.outstandingRequests.Store(outstanding)
+		return b
+	}
+	names := func(backends []*Backend) []string {
+		out := make([]string, 0, len(backends))
+		for _, b := range backends {
+			out = append(out, b.Name)
+		}
+		return out
+	}
+
+	a := newBackend("a", 30*time.Millisecond, 0)
+	b := newBackend("b", 10*time.Millisecond, 5)
+	c := newBackend("c", 20*time.Millisecond, 2)
+
+	backends := []*Backend{a, b, c}
+	rankBackends(LeastLatencyRoutingStrategy, backends)
+	assert.Equal(t, []string{"b", "c", "a"}, names(backends))
+
+	backends = []*Backend{a, b, c}
+	rankBackends(LeastOutstandingRoutingStrategy, backends)
+	assert.Equal(t, []string{"a", "c", "b"}, names(backends))
+
+	// with two backends the sample always contains both
+	for i := 0; i < 10; i++ {
+		backends = []*Backend{b, c}
+		rankBackends(PowerOfTwoChoicesRoutingStrategy, backends)
+		assert.Equal(t, []string{"c", "b"}, names(backends))
+	}
+
+	// ties on in-flight requests are broken by latency
+	d := newBackend("d", 5*time.Millisecond, 2)
+	backends = []*Backend{c, d}
+	rankBackends(PowerOfTwoChoicesRoutingStrategy, backends)
+	assert.Equal(t, []string{"d", "c"}, names(backends))
+}
@@ -3,9 +3,13 @@ package proxyd
 import (
 	"context"
 	"encoding/json"
+	"math"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/redis/go-redis/v9"
 
@@ -16,6 +20,7 @@ import (
 type Cache interface {
 	Get(ctx context.Context, key string) (string, error)
 	Put(ctx context.Context, key string, value string) error
+	Delete(ctx context.Context, key string) error
 }
 
 const (
@@ -25,22 +30,47 @@ const (
 
 type cache struct {
 	lru *lru.Cache
+	ttl time.Duration
+}
+
+type memoryCacheEntry struct {
+	value     string
+	expiresAt time.Time
 }
 
 func newMemoryCache() *cache {
+	return newMemoryCacheWithTTL(0)
+}
+
+// newMemoryCacheWithTTL creates an in-memory cache whose entries expire after ttl, they never expire if ttl is 0
+func newMemoryCacheWithTTL(ttl time.Duration) *cache {
 	rep, _ := lru.New(memoryCacheLimit)
-	return &cache{rep}
+	return &cache{rep, ttl}
 }
 
 func (c *cache) Get(ctx context.Context, key string) (string, error) {
 	if val, ok := c.lru.Get(key); ok {
-		return val.(string), nil
+		entry := val.(memoryCacheEntry)
+		if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+			c.lru.Remove(key)
+			return "", nil
+		}
+		return entry.value, nil
 	}
 	return "", nil
 }
 
 func (c *cache) Put(ctx context.Context, key string, value string) error {
-	c.lru.Add(key, value)
+	entry := memoryCacheEntry{value: value}
+	if c.ttl > 0 {
+		entry.expiresAt = time.Now().Add(c.ttl)
+	}
+	c.lru.Add(key, entry)
+	return nil
+}
+
+func (c *cache) Delete(ctx context.Context, key string) error {
+	c.lru.Remove(key)
 	return nil
 }
 
@@ -69,6 +99,16 @@ func (c *fallbackCache) Put(ctx context.Context, key string, value string) error
 	return nil
 }
 
+// Delete removes the key from both caches, since either may have been written to
+func (c *fallbackCache) Delete(ctx context.Context, key string) error {
+	primaryErr := c.primaryCache.Delete(ctx, key)
+	secondaryErr := c.secondaryCache.Delete(ctx, key)
+	if primaryErr != nil && secondaryErr != nil {
+		return primaryErr
+	}
+	return nil
+}
+
 type redisCache struct {
 	redisClient     redis.UniversalClient
 	redisReadClient redis.UniversalClient
@@ -81,10 +121,14 @@ func newRedisCache(redisClient redis.UniversalClient, redisReadClient redis.Univ
 }
 
 func (c *redisCache) namespaced(key string) string {
-	if c.prefix == "" {
+	return namespacedKey(c.prefix, key)
+}
+
+func namespacedKey(prefix string, key string) string {
+	if prefix == "" {
 		return key
 	}
-	return strings.Join([]string{c.prefix, key}, ":")
+	return strings.Join([]string{prefix, key}, ":")
 }
 
 func (c *redisCache) Get(ctx context.Context, key string) (string, error) {
@@ -112,6 +156,17 @@ func (c *redisCache) Put(ctx context.Context, key string, value string) error {
 	return err
 }
 
+func (c *redisCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.redisClient.Del(ctx, c.namespaced(key)).Err()
+	redisCacheDurationSumm.WithLabelValues("DEL").Observe(float64(time.Since(start).Milliseconds()))
+
+	if err != nil {
+		RecordRedisError("CacheDel")
+	}
+	return err
+}
+
 type cacheWithCompression struct {
 	cache Cache
 }
@@ -140,19 +195,38 @@ func (c *cacheWithCompression) Put(ctx context.Context, key string, value string
 	return c.cache.Put(ctx, key, string(encodedVal))
 }
 
+func (c *cacheWithCompression) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
 type RPCCache interface {
 	GetRPC(ctx context.Context, req *RPCReq) (*RPCRes, error)
 	PutRPC(ctx context.Context, req *RPCReq, res *RPCRes) error
+	// InvalidateBlocks removes the cached responses of the blocks with the given hashes,
+	// and of the blocks numbered fromNumber and above
+	InvalidateBlocks(ctx context.Context, hashes []string, fromNumber uint64) error
 }
 
 type rpcCache struct {
 	cache    Cache
 	handlers map[string]RPCMethodHandler
+	index    *blockKeyIndex
 }
 
-func newRPCCache(cache Cache) RPCCache {
-	staticHandler := &StaticMethodHandler{cache: cache}
-	debugGetRawReceiptsHandler := &StaticMethodHandler{cache: cache,
+// newRPCCache creates an RPCCache for the immutable methods, finalizedHandlers adds
+// the methods that can only be cached once their blocks are finalized. blocks stores the
+// keys of the cached blocks, they are kept in memory if nil.
+func newRPCCache(cache Cache, finalizedHandlers map[string]*FinalizedBlockMethodHandler, blocks blockKeyStore) RPCCache {
+	if blocks == nil {
+		blocks = newMemoryBlockKeyStore()
+	}
+	caches := []Cache{cache}
+	for _, handler := range finalizedHandlers {
+		caches = append(caches, handler.cache)
+	}
+	index := newBlockKeyIndex(blocks, caches)
+	staticHandler := &StaticMethodHandler{cache: cache, index: index}
+	debugGetRawReceiptsHandler := &StaticMethodHandler{cache: cache, index: index,
 		filterGet: func(req *RPCReq) bool {
 			// cache only if the request is for a block hash
 
@@ -185,9 +259,14 @@ func newRPCCache(cache Cache) RPCCache {
 		"eth_getUncleByBlockHashAndIndex":       staticHandler,
 		"debug_getRawReceipts":                  debugGetRawReceiptsHandler,
 	}
+	for method, handler := range finalizedHandlers {
+		handler.index = index
+		handlers[method] = handler
+	}
 	return &rpcCache{
 		cache:    cache,
 		handlers: handlers,
+		index:    index,
 	}
 }
 
@@ -216,3 +295,207 @@ func (c *rpcCache) PutRPC(ctx context.Context, req *RPCReq, res *RPCRes) error {
 	}
 	return handler.PutRPCMethod(ctx, req, res)
 }
+
+func (c *rpcCache) InvalidateBlocks(ctx context.Context, hashes []string, fromNumber uint64) error {
+	return c.index.invalidate(ctx, hashes, fromNumber)
+}
+
+// blockKeyIndex records the cache keys of the responses tied to a block hash or number,
+// so that they can be removed when the block is orphaned. The keys are kept in a
+// blockKeyStore next to the cache, so that with a shared Redis cache the instance
+// that detects a reorg also removes the entries written by the other instances.
+type blockKeyIndex struct {
+	store blockKeyStore
+	// caches are the caches of the handlers, which may use different ones
+	caches []Cache
+}
+
+// blockKeyStore stores the cache keys of a blockKeyIndex by block
+type blockKeyStore interface {
+	addHash(ctx context.Context, hash string, key string) error
+	addNumber(ctx context.Context, number uint64, key string) error
+	// take removes and returns the keys of the blocks with the given hashes,
+	// and of the blocks numbered fromNumber and above
+	take(ctx context.Context, hashes []string, fromNumber uint64) ([]string, error)
+}
+
+func newBlockKeyIndex(store blockKeyStore, caches []Cache) *blockKeyIndex {
+	return &blockKeyIndex{store: store, caches: caches}
+}
+
+func (i *blockKeyIndex) addHash(ctx context.Context, hash string, key string) {
+	if err := i.store.addHash(ctx, strings.ToLower(hash), key); err != nil {
+		log.Error("error indexing cache key", "key", key, "block_hash", hash, "err", err)
+	}
+}
+
+func (i *blockKeyIndex) addNumber(ctx context.Context, number uint64, key string) {
+	if err := i.store.addNumber(ctx, number, key); err != nil {
+		log.Error("error indexing cache key", "key", key, "block_number", number, "err", err)
+	}
+}
+
+func (i *blockKeyIndex) invalidate(ctx context.Context, hashes []string, fromNumber uint64) error {
+	lowerHashes := make([]string, len(hashes))
+	for j, hash := range hashes {
+		lowerHashes[j] = strings.ToLower(hash)
+	}
+	keys, err := i.store.take(ctx, lowerHashes, fromNumber)
+	if err != nil {
+		return err
+	}
+
+	// the keys are unique to their method, so they are deleted from every cache
+	var lastErr error
+	for _, key := range keys {
+		for _, cache := range i.caches {
+			if err := cache.Delete(ctx, key); err != nil {
+				log.Error("error deleting from cache", "key", key, "err", err)
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+// memoryBlockKeyStore keeps the keys of the most recently cached blocks in memory
+type memoryBlockKeyStore struct {
+	mtx      sync.Mutex
+	byHash   *lru.Cache
+	byNumber *lru.Cache
+}
+
+func newMemoryBlockKeyStore() *memoryBlockKeyStore {
+	byHash, _ := lru.New(memoryCacheLimit)
+	byNumber, _ := lru.New(memoryCacheLimit)
+	return &memoryBlockKeyStore{byHash: byHash, byNumber: byNumber}
+}
+
+func (s *memoryBlockKeyStore) addHash(ctx context.Context, hash string, key string) error {
+	s.add(s.byHash, hash, key)
+	return nil
+}
+
+func (s *memoryBlockKeyStore) addNumber(ctx context.Context, number uint64, key string) error {
+	s.add(s.byNumber, number, key)
+	return nil
+}
+
+func (s *memoryBlockKeyStore) add(l *lru.Cache, block interface{}, key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var keys []string
+	if val, ok := l.Get(block); ok {
+		keys = val.([]string)
+		for _, existing := range keys {
+			if existing == key {
+				return
+			}
+		}
+	}
+	l.Add(block, append(keys, key))
+}
+
+func (s *memoryBlockKeyStore) take(ctx context.Context, hashes []string, fromNumber uint64) ([]string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var keys []string
+	for _, hash := range hashes {
+		if val, ok := s.byHash.Peek(hash); ok {
+			keys = append(keys, val.([]string)...)
+			s.byHash.Remove(hash)
+		}
+	}
+	for _, number := range s.byNumber.Keys() {
+		if number.(uint64) < fromNumber {
+			continue
+		}
+		if val, ok := s.byNumber.Peek(number); ok {
+			keys = append(keys, val.([]string)...)
+			s.byNumber.Remove(number)
+		}
+	}
+	return keys, nil
+}
+
+// redisBlockKeyStore keeps the keys of each block in a Redis set that expires with the
+// cache entries, and the numbers of the indexed blocks in a sorted set, so that the
+// blocks above a fork can be found.
+type redisBlockKeyStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisBlockKeyStore(client redis.UniversalClient, prefix string, ttl time.Duration) *redisBlockKeyStore {
+	return &redisBlockKeyStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (s *redisBlockKeyStore) hashKey(hash string) string {
+	return namespacedKey(s.prefix, "cache:blocks:hash:"+hash)
+}
+
+func (s *redisBlockKeyStore) numberKey(number string) string {
+	return namespacedKey(s.prefix, "cache:blocks:number:"+number)
+}
+
+func (s *redisBlockKeyStore) numbersKey() string {
+	return namespacedKey(s.prefix, "cache:blocks:numbers")
+}
+
+func (s *redisBlockKeyStore) addHash(ctx context.Context, hash string, key string) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, s.hashKey(hash), key)
+		pipe.PExpire(ctx, s.hashKey(hash), s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *redisBlockKeyStore) addNumber(ctx context.Context, number uint64, key string) error {
+	member := strconv.FormatUint(number, 10)
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, s.numberKey(member), key)
+		pipe.PExpire(ctx, s.numberKey(member), s.ttl)
+		pipe.ZAdd(ctx, s.numbersKey(), redis.Z{Score: float64(number), Member: member})
+		pipe.PExpire(ctx, s.numbersKey(), s.ttl)
+		// only recent blocks are reorged, keep the highest numbers like the in-memory store
+		pipe.ZRemRangeByRank(ctx, s.numbersKey(), 0, -memoryCacheLimit-1)
+		return nil
+	})
+	return err
+}
+
+func (s *redisBlockKeyStore) take(ctx context.Context, hashes []string, fromNumber uint64) ([]string, error) {
+	min := strconv.FormatUint(fromNumber, 10)
+	numbers, err := s.client.ZRangeByScore(ctx, s.numbersKey(), &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]string, 0, len(hashes)+len(numbers))
+	for _, hash := range hashes {
+		sets = append(sets, s.hashKey(hash))
+	}
+	for _, number := range numbers {
+		sets = append(sets, s.numberKey(number))
+	}
+	// SPOP removes the keys it returns, so keys added concurrently are left for the next reorg
+	cmds := make([]*redis.StringSliceCmd, len(sets))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for j, set := range sets {
+			cmds[j] = pipe.SPopN(ctx, set, math.MaxInt32)
+		}
+		pipe.ZRemRangeByScore(ctx, s.numbersKey(), min, "+inf")
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, cmd := range cmds {
+		keys = append(keys, cmd.Val()...)
+	}
+	return keys, nil
+}
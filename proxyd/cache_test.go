@@ -2,10 +2,13 @@ package proxyd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -13,7 +16,7 @@ import (
 func TestRPCCacheImmutableRPCs(t *testing.T) {
 	ctx := context.Background()
 
-	cache := newRPCCache(newMemoryCache())
+	cache := newRPCCache(newMemoryCache(), nil, nil)
 	ID := []byte(strconv.Itoa(1))
 
 	rpcs := []struct {
@@ -134,7 +137,7 @@ func TestRPCCacheImmutableRPCs(t *testing.T) {
 func TestRPCCacheUnsupportedMethod(t *testing.T) {
 	ctx := context.Background()
 
-	cache := newRPCCache(newMemoryCache())
+	cache := newRPCCache(newMemoryCache(), nil, nil)
 	ID := []byte(strconv.Itoa(1))
 
 	rpcs := []struct {
@@ -224,6 +227,10 @@ func (c *errorCache) Put(ctx context.Context, key string, value string) error {
 	return errors.New("test error")
 }
 
+func (c *errorCache) Delete(ctx context.Context, key string) error {
+	return errors.New("test error")
+}
+
 func TestFallbackCache(t *testing.T) {
 	ctx := context.Background()
 
@@ -261,3 +268,194 @@ func TestFallbackCache(t *testing.T) {
 		})
 	}
 }
+
+func TestFinalizedBlockMethodHandler(t *testing.T) {
+	cp := NewConsensusPoller(&BackendGroup{Name: "test"}, WithAsyncHandler(NewNoopAsyncHandler()))
+	cp.tracker.SetLatestBlockNumber(0x200)
+	cp.tracker.SetSafeBlockNumber(0x150)
+	cp.tracker.SetFinalizedBlockNumber(0x100)
+	ctx := context.WithValue(context.Background(), ContextKeyConsensusPoller, cp) // nolint:staticcheck
+
+	handlers := map[string]*FinalizedBlockMethodHandler{}
+	for _, method := range []string{"eth_getBlockByNumber", "eth_call", "eth_getLogs", "eth_getBlockReceipts"} {
+		handlers[method] = NewFinalizedBlockMethodHandler(newMemoryCache(), 64)
+	}
+	cache := newRPCCache(newMemoryCache(), handlers, nil)
+	ID := []byte(strconv.Itoa(1))
+
+	tests := []struct {
+		name   string
+		method string
+		params string
+		cached bool
+	}{
+		{"block below finalized", "eth_getBlockByNumber", `["0x99", false]`, true},
+		{"finalized block", "eth_getBlockByNumber", `["0x100", false]`, true},
+		{"finalized tag", "eth_getBlockByNumber", `["finalized", false]`, true},
+		{"earliest tag", "eth_getBlockByNumber", `["earliest", false]`, true},
+		{"block above finalized", "eth_getBlockByNumber", `["0x101", false]`, false},
+		{"safe tag", "eth_getBlockByNumber", `["safe", false]`, false},
+		{"latest tag", "eth_getBlockByNumber", `["latest", false]`, false},
+		{"pending tag", "eth_getBlockByNumber", `["pending", false]`, false},
+		{"call at finalized block", "eth_call", `[{"to": "0x0"}, "0x50"]`, true},
+		{"call by number object", "eth_call", `[{"to": "0x0"}, {"blockNumber": "0x50"}]`, true},
+		{"call by block hash", "eth_call", `[{"to": "0x0"}, {"blockHash": "0xc6ef2fc5426d6ad6fd9e2a26abeab0aa2411b7ab17f30a99d3cb96aed1d1055b"}]`, false},
+		{"call without block", "eth_call", `[{"to": "0x0"}]`, false},
+		{"logs in finalized range", "eth_getLogs", `[{"fromBlock": "0x10", "toBlock": "0x100"}]`, true},
+		{"logs crossing finalized", "eth_getLogs", `[{"fromBlock": "0x10", "toBlock": "0x101"}]`, false},
+		{"logs without range", "eth_getLogs", `[{"address": "0x0"}]`, false},
+		{"logs by block hash", "eth_getLogs", `[{"blockHash": "0xc6ef2fc5426d6ad6fd9e2a26abeab0aa2411b7ab17f30a99d3cb96aed1d1055b"}]`, false},
+		{"receipts below finalized", "eth_getBlockReceipts", `["0x99"]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &RPCReq{JSONRPC: "2.0", Method: tt.method, Params: json.RawMessage(tt.params), ID: ID}
+			require.NoError(t, cache.PutRPC(ctx, req, &RPCRes{JSONRPC: "2.0", Result: tt.name, ID: ID}))
+
+			cachedRes, err := cache.GetRPC(ctx, req)
+			require.NoError(t, err)
+			if tt.cached {
+				require.NotNil(t, cachedRes)
+				require.Equal(t, tt.name, cachedRes.Result)
+			} else {
+				require.Nil(t, cachedRes)
+			}
+		})
+	}
+
+	t.Run("finalized tag follows the consensus", func(t *testing.T) {
+		// the finalized tag shares its entry with the block it resolves to
+		req := &RPCReq{JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x100", false]`), ID: ID}
+		cachedRes, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, "finalized tag", cachedRes.Result)
+
+		cp.tracker.SetFinalizedBlockNumber(0x110)
+		defer cp.tracker.SetFinalizedBlockNumber(0x100)
+		req = &RPCReq{JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["finalized", false]`), ID: ID}
+		cachedRes, err = cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		require.Nil(t, cachedRes)
+	})
+
+	t.Run("responses over the size limit are not cached", func(t *testing.T) {
+		req := &RPCReq{JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x1", true]`), ID: ID}
+		require.NoError(t, cache.PutRPC(ctx, req, &RPCRes{JSONRPC: "2.0", Result: strings.Repeat("a", 65), ID: ID}))
+		cachedRes, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		require.Nil(t, cachedRes)
+	})
+
+	t.Run("groups without consensus are not cached", func(t *testing.T) {
+		req := &RPCReq{JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x2", false]`), ID: ID}
+		require.NoError(t, cache.PutRPC(context.Background(), req, &RPCRes{JSONRPC: "2.0", Result: "0x2", ID: ID}))
+		cachedRes, err := cache.GetRPC(context.Background(), req)
+		require.NoError(t, err)
+		require.Nil(t, cachedRes)
+	})
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemoryCacheWithTTL(10 * time.Millisecond)
+	require.NoError(t, cache.Put(ctx, "foo", "bar"))
+
+	val, err := cache.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.Equal(t, "bar", val)
+
+	time.Sleep(20 * time.Millisecond)
+	val, err = cache.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.Empty(t, val)
+}
+
+func TestRPCCacheInvalidateBlocks(t *testing.T) {
+	cp := NewConsensusPoller(&BackendGroup{Name: "test"}, WithAsyncHandler(NewNoopAsyncHandler()))
+	cp.tracker.SetLatestBlockNumber(0x200)
+	cp.tracker.SetFinalizedBlockNumber(0x100)
+	ctx := context.WithValue(context.Background(), ContextKeyConsensusPoller, cp) // nolint:staticcheck
+
+	handlers := map[string]*FinalizedBlockMethodHandler{
+		"eth_getBlockByNumber": NewFinalizedBlockMethodHandler(newMemoryCache(), 0),
+	}
+	cache := newRPCCache(newMemoryCache(), handlers, nil)
+	ID := []byte(strconv.Itoa(1))
+	orphanedHash := "0xC6EF2FC5426D6AD6FD9E2A26ABEAB0AA2411B7AB17F30A99D3CB96AED1D1055B"
+	canonicalHash := "0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6"
+
+	reqs := map[string]*RPCReq{
+		"orphaned hash":   {JSONRPC: "2.0", Method: "eth_getBlockByHash", Params: json.RawMessage(`["` + orphanedHash + `", false]`), ID: ID},
+		"canonical hash":  {JSONRPC: "2.0", Method: "eth_getBlockByHash", Params: json.RawMessage(`["` + canonicalHash + `", false]`), ID: ID},
+		"orphaned number": {JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x100", false]`), ID: ID},
+		"older number":    {JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0xff", false]`), ID: ID},
+		"chain id":        {JSONRPC: "2.0", Method: "eth_chainId", ID: ID},
+	}
+	for name, req := range reqs {
+		require.NoError(t, cache.PutRPC(ctx, req, &RPCRes{JSONRPC: "2.0", Result: name, ID: ID}))
+	}
+
+	require.NoError(t, cache.InvalidateBlocks(ctx, []string{strings.ToLower(orphanedHash)}, 0x100))
+
+	for name, req := range reqs {
+		res, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		if strings.HasPrefix(name, "orphaned") {
+			require.Nil(t, res, name)
+		} else {
+			require.NotNil(t, res, name)
+		}
+	}
+}
+
+func TestRPCCacheInvalidateBlocksSharedRedis(t *testing.T) {
+	cp := NewConsensusPoller(&BackendGroup{Name: "test"}, WithAsyncHandler(NewNoopAsyncHandler()))
+	cp.tracker.SetLatestBlockNumber(0x200)
+	cp.tracker.SetFinalizedBlockNumber(0x100)
+	ctx := context.WithValue(context.Background(), ContextKeyConsensusPoller, cp) // nolint:staticcheck
+
+	// two instances sharing the same redis cache
+	redisClient := newTestRedisClient(t)
+	newInstanceCache := func() RPCCache {
+		newCache := func() Cache {
+			return newCacheWithCompression(newRedisCache(redisClient, redisClient, "ns", time.Minute))
+		}
+		handlers := map[string]*FinalizedBlockMethodHandler{
+			"eth_getBlockByNumber": NewFinalizedBlockMethodHandler(newCache(), 0),
+		}
+		return newRPCCache(newCache(), handlers, newRedisBlockKeyStore(redisClient, "ns", time.Minute))
+	}
+	writer := newInstanceCache()
+	// the instance detecting the reorg didn't cache any of the blocks
+	detector := newInstanceCache()
+
+	ID := []byte(strconv.Itoa(1))
+	orphanedHash := "0xC6EF2FC5426D6AD6FD9E2A26ABEAB0AA2411B7AB17F30A99D3CB96AED1D1055B"
+	canonicalHash := "0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6"
+	reqs := map[string]*RPCReq{
+		"orphaned hash":   {JSONRPC: "2.0", Method: "eth_getBlockByHash", Params: json.RawMessage(`["` + orphanedHash + `", false]`), ID: ID},
+		"canonical hash":  {JSONRPC: "2.0", Method: "eth_getBlockByHash", Params: json.RawMessage(`["` + canonicalHash + `", false]`), ID: ID},
+		"orphaned number": {JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x100", false]`), ID: ID},
+		"older number":    {JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0xff", false]`), ID: ID},
+	}
+	for name, req := range reqs {
+		require.NoError(t, writer.PutRPC(ctx, req, &RPCRes{JSONRPC: "2.0", Result: name, ID: ID}))
+	}
+	require.NoError(t, detector.InvalidateBlocks(ctx, []string{orphanedHash}, 0x100))
+
+	for name, req := range reqs {
+		for _, instance := range []RPCCache{writer, detector} {
+			res, err := instance.GetRPC(ctx, req)
+			require.NoError(t, err)
+			if strings.HasPrefix(name, "orphaned") {
+				require.Nil(t, res, name)
+			} else {
+				require.NotNil(t, res, name)
+			}
+		}
+	}
+
+	// the indexes of the invalidated blocks are removed
+	require.Equal(t, int64(0), redisClient.Exists(ctx, "ns:cache:blocks:hash:"+strings.ToLower(orphanedHash), "ns:cache:blocks:number:256").Val())
+	require.Equal(t, []string{"255"}, redisClient.ZRange(ctx, "ns:cache:blocks:numbers", 0, -1).Val())
+}
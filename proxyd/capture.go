@@ -0,0 +1,249 @@
+package proxyd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultCaptureSampleRate       = 0.01
+	defaultCaptureMaxFileSizeBytes = 100 * 1024 * 1024
+	defaultCaptureMaxFiles         = 10
+	captureQueueSize               = 1024
+	captureFilePrefix              = "capture-"
+	captureFileSuffix              = ".jsonl"
+)
+
+// CaptureEntry is a request and the response proxyd returned for it. Only the bodies
+// are captured, so that the auth key in the path and the headers are left out.
+type CaptureEntry struct {
+	Time       time.Time       `json:"time"`
+	ReqID      string          `json:"req_id"`
+	DurationMs int64           `json:"duration_ms"`
+	StatusCode int             `json:"status_code"`
+	ServedBy   string          `json:"served_by,omitempty"`
+	Request    json.RawMessage `json:"request"`
+	Response   json.RawMessage `json:"response"`
+}
+
+// Capturer writes a sample of the requests and responses to rotating JSONL files, from
+// a background goroutine so that requests never wait on the disk
+type Capturer struct {
+	dir              string
+	sampleRate       float64
+	maxFileSizeBytes int64
+	maxFiles         int
+
+	entriesMtx sync.RWMutex
+	entries    chan *CaptureEntry
+	stopped    bool
+	done       chan struct{}
+
+	file     *os.File
+	fileSize int64
+}
+
+func NewCapturer(cfg CaptureConfig) (*Capturer, error) {
+	if err := validateCaptureConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating capture dir: %w", err)
+	}
+	c := &Capturer{
+		dir:              cfg.Dir,
+		sampleRate:       cfg.SampleRate,
+		maxFileSizeBytes: cfg.MaxFileSizeBytes,
+		maxFiles:         cfg.MaxFiles,
+		entries:          make(chan *CaptureEntry, captureQueueSize),
+		done:             make(chan struct{}),
+	}
+	if c.sampleRate == 0 {
+		c.sampleRate = defaultCaptureSampleRate
+	}
+	if c.maxFileSizeBytes <= 0 {
+		c.maxFileSizeBytes = defaultCaptureMaxFileSizeBytes
+	}
+	if c.maxFiles <= 0 {
+		c.maxFiles = defaultCaptureMaxFiles
+	}
+	go c.loop()
+	return c, nil
+}
+
+func validateCaptureConfig(cfg CaptureConfig) error {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return fmt.Errorf("capture sample_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// Sample decides if a request is captured
+func (c *Capturer) Sample() bool {
+	return c.sampleRate >= 1 || rand.Float64() < c.sampleRate
+}
+
+// Capture queues the entry of a request, it is dropped if the queue is full
+func (c *Capturer) Capture(req []byte, w *captureResponseWriter, reqID string, start time.Time) {
+	entry := &CaptureEntry{
+		Time:       start,
+		ReqID:      reqID,
+		DurationMs: time.Since(start).Milliseconds(),
+		StatusCode: w.statusCode,
+		ServedBy:   w.servedBy,
+		Request:    captureJSON(req),
+		Response:   captureJSON(w.body.Bytes()),
+	}
+	c.entriesMtx.RLock()
+	defer c.entriesMtx.RUnlock()
+	if c.stopped {
+		return
+	}
+	select {
+	case c.entries <- entry:
+	default:
+		RecordCaptureDropped()
+	}
+}
+
+// Stop writes the queued entries and closes the current file
+func (c *Capturer) Stop() {
+	c.entriesMtx.Lock()
+	c.stopped = true
+	close(c.entries)
+	c.entriesMtx.Unlock()
+	<-c.done
+}
+
+func (c *Capturer) loop() {
+	defer close(c.done)
+	for entry := range c.entries {
+		if err := c.write(entry); err != nil {
+			log.Error("error writing capture", "err", err)
+			RecordCaptureDropped()
+			continue
+		}
+		RecordCaptureEntry()
+	}
+	if c.file != nil {
+		_ = c.file.Close()
+	}
+}
+
+func (c *Capturer) write(entry *CaptureEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if c.file == nil || c.fileSize+int64(len(line)) > c.maxFileSizeBytes {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := c.file.Write(line)
+	c.fileSize += int64(n)
+	return err
+}
+
+// rotate opens a new file and removes the oldest ones over max_files
+func (c *Capturer) rotate() error {
+	if c.file != nil {
+		if err := c.file.Close(); err != nil {
+			log.Warn("error closing capture file", "err", err)
+		}
+		c.file = nil
+	}
+	name := filepath.Join(c.dir, captureFilePrefix+time.Now().UTC().Format("20060102T150405.000000000")+captureFileSuffix)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening capture file: %w", err)
+	}
+	c.file = f
+	c.fileSize = 0
+
+	files, err := filepath.Glob(filepath.Join(c.dir, captureFilePrefix+"*"+captureFileSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for len(files) > c.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			log.Warn("error removing old capture file", "file", files[0], "err", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// captureJSON keeps valid JSON as is, and captures anything else as a string
+func captureJSON(b []byte) json.RawMessage {
+	b = bytes.TrimSpace(b)
+	if json.Valid(b) {
+		return append(json.RawMessage(nil), b...)
+	}
+	return mustMarshalJSON(string(b))
+}
+
+// captureResponseWriter keeps a copy of the response written to the client
+type captureResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	servedBy   string
+	body       bytes.Buffer
+}
+
+func newCaptureResponseWriter(w http.ResponseWriter) *captureResponseWriter {
+	return &captureResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+func (w *captureResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func setCaptureServedBy(w http.ResponseWriter, servedBy string) {
+	if cw, ok := w.(*captureResponseWriter); ok {
+		cw.servedBy = servedBy
+	}
+}
+
+// ReadCapture reads the entries of a capture file
+func ReadCapture(path string) ([]*CaptureEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*CaptureEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := new(CaptureEntry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
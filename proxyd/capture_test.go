@@ -0,0 +1,62 @@
+package proxyd
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapturerRotation(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCapturer(CaptureConfig{
+		Dir:              dir,
+		SampleRate:       1,
+		MaxFileSizeBytes: 300,
+		MaxFiles:         2,
+	})
+	require.NoError(t, err)
+	require.True(t, c.Sample())
+
+	for i := 0; i < 10; i++ {
+		w := newCaptureResponseWriter(httptest.NewRecorder())
+		setCaptureServedBy(w, "main/node1")
+		_, err := w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}` + "\n"))
+		require.NoError(t, err)
+		c.Capture([]byte(`{"jsonrpc":"2.0","method":"eth_chainId","params":[],"id":1}`), w, "req", time.Now())
+		// give every entry its own file name timestamp
+		time.Sleep(time.Millisecond)
+	}
+	c.Stop()
+
+	files, err := filepath.Glob(filepath.Join(dir, "capture-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	entries, err := ReadCapture(files[1])
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	entry := entries[len(entries)-1]
+	require.Equal(t, "req", entry.ReqID)
+	require.Equal(t, 200, entry.StatusCode)
+	require.Equal(t, "main/node1", entry.ServedBy)
+	require.Equal(t, "eth_chainId", captureMethod(entry.Request))
+	require.Equal(t, `{"jsonrpc":"2.0","result":"0x1","id":1}`, string(entry.Response))
+
+	// entries captured after stopping are dropped
+	c.Capture([]byte(`{}`), newCaptureResponseWriter(httptest.NewRecorder()), "req", time.Now())
+}
+
+func TestCaptureJSON(t *testing.T) {
+	require.Equal(t, `{"a":1}`, string(captureJSON([]byte(" {\"a\":1}\n"))))
+	require.Equal(t, `"invalid"`, string(captureJSON([]byte("invalid"))))
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	require.Equal(t, canonicalJSON([]byte(`{"b": 1, "a": [1, 2]}`)), canonicalJSON([]byte(`{"a":[1,2],"b":1}`)))
+	require.NotEqual(t, canonicalJSON([]byte(`{"a":[2,1]}`)), canonicalJSON([]byte(`{"a":[1,2]}`)))
+	require.True(t, strings.HasPrefix(canonicalJSON([]byte("invalid\n")), "invalid"))
+}
@@ -0,0 +1,252 @@
+package proxyd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultCircuitBreakerOpenDuration     = 10 * time.Second
+	defaultCircuitBreakerHalfOpenRequests = 1
+	defaultCircuitBreakerSuccessThreshold = 3
+	defaultCircuitBreakerProbeInterval    = time.Second
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit
+	FailureThreshold int
+	OpenDuration     time.Duration
+	// HalfOpenRequests is the number of trial requests admitted at a time once the circuit is half open,
+	// and SuccessThreshold the number of consecutive successful ones closing it
+	HalfOpenRequests int
+	SuccessThreshold int
+	// ProbeMethod is sent to half open backends every ProbeInterval, so that they recover without
+	// waiting for real traffic. Only real requests are admitted when it is empty.
+	ProbeMethod   string
+	ProbeInterval time.Duration
+}
+
+// circuitTicket is handed out by allow and passed back to record, so that the results
+// of requests admitted before a state change are ignored
+type circuitTicket struct {
+	generation uint64
+	trial      bool
+}
+
+// circuitBreaker stops sending traffic to a backend after consecutive failures. Once the
+// open duration elapsed, it admits a trickle of trial requests and closes again after a
+// streak of successful ones, or opens again on the first failure.
+type circuitBreaker struct {
+	backend *Backend
+	cfg     CircuitBreakerConfig
+	now     func() time.Time
+
+	mtx        sync.Mutex
+	state      CircuitState
+	generation uint64
+	failures   int
+	successes  int
+	inflight   int
+	openedAt   time.Time
+}
+
+func newCircuitBreaker(backend *Backend, cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = defaultCircuitBreakerOpenDuration
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = defaultCircuitBreakerHalfOpenRequests
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = defaultCircuitBreakerSuccessThreshold
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = defaultCircuitBreakerProbeInterval
+	}
+	RecordBackendCircuitState(backend, CircuitClosed)
+	return &circuitBreaker{
+		backend: backend,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// State returns the current state of the circuit, an open circuit whose open
+// duration elapsed is reported as half open
+func (cb *circuitBreaker) State() CircuitState {
+	if cb == nil {
+		return CircuitClosed
+	}
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	cb.maybeHalfOpen()
+	return cb.state
+}
+
+// allow checks if a request can be sent to the backend, it always does when
+// the circuit breaker is disabled
+func (cb *circuitBreaker) allow() (circuitTicket, bool) {
+	if cb == nil {
+		return circuitTicket{}, true
+	}
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	cb.maybeHalfOpen()
+	switch cb.state {
+	case CircuitClosed:
+		return circuitTicket{generation: cb.generation}, true
+	case CircuitHalfOpen:
+		if cb.inflight >= cb.cfg.HalfOpenRequests {
+			return circuitTicket{}, false
+		}
+		cb.inflight++
+		return circuitTicket{generation: cb.generation, trial: true}, true
+	default:
+		return circuitTicket{}, false
+	}
+}
+
+// release gives back the slot of a request that didn't reach the backend
+func (cb *circuitBreaker) release(ticket circuitTicket) {
+	if cb == nil {
+		return
+	}
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	if ticket.trial && ticket.generation == cb.generation {
+		cb.inflight--
+	}
+}
+
+// record updates the circuit with the result of a request, err being the network error if any
+func (cb *circuitBreaker) record(ticket circuitTicket, err error) {
+	if cb == nil {
+		return
+	}
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	if ticket.generation != cb.generation {
+		return
+	}
+	switch cb.state {
+	case CircuitClosed:
+		if err == nil {
+			cb.failures = 0
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.cfg.FailureThreshold {
+			cb.open(err)
+		}
+	case CircuitHalfOpen:
+		if !ticket.trial {
+			return
+		}
+		cb.inflight--
+		if err != nil {
+			cb.open(err)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.cfg.SuccessThreshold {
+			log.Info("backend circuit closed", "backend", cb.backend.Name, "successes", cb.successes)
+			cb.transition(CircuitClosed)
+		}
+	}
+}
+
+// admits checks if the circuit is still in the state the ticket was handed out in
+func (cb *circuitBreaker) admits(ticket circuitTicket) bool {
+	if cb == nil {
+		return true
+	}
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	return ticket.generation == cb.generation
+}
+
+func (cb *circuitBreaker) open(err error) {
+	log.Warn("backend circuit opened",
+		"backend", cb.backend.Name,
+		"from", cb.state,
+		"consecutive_failures", cb.failures,
+		"open_duration", cb.cfg.OpenDuration,
+		"err", err,
+	)
+	cb.transition(CircuitOpen)
+	cb.openedAt = cb.now()
+	if cb.cfg.ProbeMethod != "" {
+		go cb.probe(cb.generation)
+	}
+}
+
+func (cb *circuitBreaker) maybeHalfOpen() {
+	if cb.state == CircuitOpen && cb.now().Sub(cb.openedAt) >= cb.cfg.OpenDuration {
+		cb.transition(CircuitHalfOpen)
+		log.Info("backend circuit half open",
+			"backend", cb.backend.Name,
+			"half_open_requests", cb.cfg.HalfOpenRequests,
+			"success_threshold", cb.cfg.SuccessThreshold,
+		)
+	}
+}
+
+func (cb *circuitBreaker) transition(to CircuitState) {
+	RecordBackendCircuitTransition(cb.backend, cb.state, to)
+	cb.state = to
+	cb.generation++
+	cb.failures = 0
+	cb.successes = 0
+	cb.inflight = 0
+}
+
+// probe sends ProbeMethod to the backend while the circuit opened in the given generation
+// is half open, until it closes or opens again, or the backend is closed
+func (cb *circuitBreaker) probe(opened uint64) {
+	ctx := cb.backend.ctx
+	sleepContext(ctx, cb.cfg.OpenDuration)
+	for ctx.Err() == nil {
+		cb.mtx.Lock()
+		cb.maybeHalfOpen()
+		active := cb.state == CircuitHalfOpen && cb.generation == opened+1
+		cb.mtx.Unlock()
+		if !active {
+			return
+		}
+
+		if ticket, ok := cb.allow(); ok {
+			var res RPCRes
+			err := cb.backend.ForwardRPC(ctx, &res, "67", cb.cfg.ProbeMethod)
+			log.Debug("probed half open backend", "backend", cb.backend.Name, "method", cb.cfg.ProbeMethod, "err", err)
+			if ctx.Err() != nil {
+				cb.release(ticket)
+				return
+			}
+			cb.record(ticket, err)
+		}
+		sleepContext(ctx, cb.cfg.ProbeInterval)
+	}
+}
@@ -0,0 +1,102 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	be := NewBackend("test", "http://localhost", "", nil, WithCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenDuration:     time.Minute,
+		HalfOpenRequests: 1,
+		SuccessThreshold: 2,
+	}))
+	cb := be.circuitBreaker
+	cb.now = func() time.Time { return now }
+	errNetwork := errors.New("connection refused")
+
+	// a success resets the consecutive failures
+	ticket, ok := cb.allow()
+	require.True(t, ok)
+	cb.record(ticket, errNetwork)
+	ticket, _ = cb.allow()
+	cb.record(ticket, nil)
+	ticket, _ = cb.allow()
+	cb.record(ticket, errNetwork)
+	require.Equal(t, CircuitClosed, cb.State())
+
+	// requests admitted before the circuit opened don't count anymore
+	stale, _ := cb.allow()
+	ticket, _ = cb.allow()
+	cb.record(ticket, errNetwork)
+	require.Equal(t, CircuitOpen, cb.State())
+	require.False(t, be.IsHealthy())
+	cb.record(stale, nil)
+	_, ok = cb.allow()
+	require.False(t, ok)
+
+	// half open admits a single trial request at a time
+	now = now.Add(time.Minute)
+	require.Equal(t, CircuitHalfOpen, cb.State())
+	require.True(t, be.IsHealthy())
+	ticket, ok = cb.allow()
+	require.True(t, ok)
+	_, ok = cb.allow()
+	require.False(t, ok)
+	cb.release(ticket)
+	ticket, ok = cb.allow()
+	require.True(t, ok)
+
+	// a failed trial opens the circuit again
+	cb.record(ticket, errNetwork)
+	require.Equal(t, CircuitOpen, cb.State())
+
+	// and a streak of successful trials closes it
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, CircuitHalfOpen, cb.State())
+		ticket, ok = cb.allow()
+		require.True(t, ok)
+		cb.record(ticket, nil)
+	}
+	require.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	be := NewBackend("test", "http://localhost", "", nil)
+	require.Nil(t, be.circuitBreaker)
+	ticket, ok := be.circuitBreaker.allow()
+	require.True(t, ok)
+	be.circuitBreaker.record(ticket, errors.New("connection refused"))
+	require.Equal(t, CircuitClosed, be.circuitBreaker.State())
+}
+
+func TestCircuitBreakerCountsRetries(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	be := NewBackend("test", server.URL, "", semaphore.NewWeighted(1), WithMaxRetries(3), WithCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenDuration:     time.Minute,
+	}))
+	defer be.Close()
+
+	// each failed attempt counts, and the retries stop once the circuit opened
+	_, err := be.Forward(context.Background(), []*RPCReq{{JSONRPC: "2.0", Method: "eth_chainId", ID: []byte("1")}}, false)
+	require.Error(t, err)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, CircuitOpen, be.circuitBreaker.State())
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+)
+
+// runExplain implements `proxyd explain`, it returns the exit code
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	params := fs.String("params", "", "JSON params of the call, e.g. '[\"latest\", false]'")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: proxyd explain [-params <json>] <config.toml> <method>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	if *params != "" && !json.Valid([]byte(*params)) {
+		fmt.Fprintf(os.Stderr, "params must be valid JSON\n")
+		return 2
+	}
+
+	config, ok := readConfig(fs.Arg(0))
+	if !ok {
+		return 1
+	}
+	explanation, err := proxyd.Explain(config, fs.Arg(1), json.RawMessage(*params))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Print(explanation)
+	return 0
+}
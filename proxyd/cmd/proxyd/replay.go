@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+)
+
+// runReplay implements `proxyd replay`, it returns the exit code
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "", "URL of the proxyd or backend to replay the capture against")
+	speed := fs.Float64("speed", 1, "pace of the replay relative to the capture, 0 sends the requests one after the other as fast as possible")
+	var headers headerFlags
+	fs.Var(&headers, "header", "header to add to the requests, as name:value, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: proxyd replay -target <url> [-speed <speed>] [-header <name:value>] <capture.jsonl>...\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *target == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var entries []*proxyd.CaptureEntry
+	for _, file := range fs.Args() {
+		fileEntries, err := proxyd.ReadCapture(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading capture: %v\n", err)
+			return 1
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	report, err := proxyd.Replay(ctx, proxyd.ReplayConfig{
+		Target:  *target,
+		Speed:   *speed,
+		Headers: headers,
+		Diffs:   os.Stdout,
+	}, entries)
+	if report != nil {
+		fmt.Println(report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error replaying capture: %v\n", err)
+		return 1
+	}
+	if report.Mismatched > 0 || report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+type headerFlags map[string]string
+
+func (h *headerFlags) String() string {
+	var headers []string
+	for name, value := range *h {
+		headers = append(headers, name+":"+value)
+	}
+	return strings.Join(headers, ",")
+}
+
+func (h *headerFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("header must be name:value")
+	}
+	if *h == nil {
+		*h = make(headerFlags)
+	}
+	(*h)[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+)
+
+// runValidate implements `proxyd validate`, it returns the exit code
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: proxyd validate <config.toml>\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	config, ok := readConfig(fs.Arg(0))
+	if !ok {
+		return 1
+	}
+	errs := proxyd.ValidateConfig(config)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	if len(errs) > 0 {
+		fmt.Printf("%s: %d problems found\n", fs.Arg(0), len(errs))
+		return 1
+	}
+	fmt.Printf("%s: ok\n", fs.Arg(0))
+	return 0
+}
+
+// readConfig decodes a config for the subcommands checking it offline. The keys that don't
+// match any setting are reported, as they are ignored by proxyd.
+func readConfig(file string) (*proxyd.Config, bool) {
+	// the checks log the problems they find, they are printed once instead
+	proxyd.SetLogLevel(log.LevelCrit)
+
+	config := new(proxyd.Config)
+	md, err := toml.DecodeFile(file, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading config file: %v\n", err)
+		return nil, false
+	}
+	for _, key := range md.Undecoded() {
+		fmt.Fprintf(os.Stderr, "warning: unknown setting %s\n", key)
+	}
+	return config, true
+}
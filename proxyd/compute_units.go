@@ -0,0 +1,153 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultComputeUnitsInterval = time.Second
+	defaultGetLogsMaxBlocks     = 10000
+)
+
+func ErrOverComputeUnits(cost int, remaining int) *RPCErr {
+	return &RPCErr{
+		Code:          ErrOverRateLimit.Code,
+		Message:       fmt.Sprintf("over compute unit limit: request costs %d compute units, %d remaining", cost, remaining),
+		HTTPErrorCode: 429,
+	}
+}
+
+// computeUnitLimits charges calls by their cost in compute units
+type computeUnitLimits struct {
+	lim                 WeightedFrontendRateLimiter
+	defaultCost         int
+	methodCosts         map[string]int
+	getLogsCostPerBlock float64
+	getLogsMaxBlocks    uint64
+}
+
+func buildComputeUnitLimits(cfg ComputeUnitsConfig, limiterFactory limiterFactoryFunc) (*computeUnitLimits, error) {
+	if cfg.Budget == 0 {
+		return nil, nil
+	}
+	if cfg.Budget < 0 || cfg.DefaultCost < 0 || cfg.GetLogsCostPerBlock < 0 {
+		return nil, errors.New("compute units budget and costs must be >= 0")
+	}
+	for method, cost := range cfg.MethodCosts {
+		if cost < 0 {
+			return nil, fmt.Errorf("compute unit cost of %s must be >= 0", method)
+		}
+	}
+
+	interval := time.Duration(cfg.Interval)
+	if interval == 0 {
+		interval = defaultComputeUnitsInterval
+	}
+	lim, ok := limiterFactory(interval, cfg.Budget, "compute_units", FixedWindowRateLimitAlgorithm).(WeightedFrontendRateLimiter)
+	if !ok {
+		return nil, errors.New("rate limiter does not support compute units")
+	}
+
+	c := &computeUnitLimits{
+		lim:                 lim,
+		defaultCost:         cfg.DefaultCost,
+		methodCosts:         cfg.MethodCosts,
+		getLogsCostPerBlock: cfg.GetLogsCostPerBlock,
+		getLogsMaxBlocks:    cfg.GetLogsMaxBlocks,
+	}
+	if c.defaultCost == 0 {
+		c.defaultCost = 1
+	}
+	if c.getLogsMaxBlocks == 0 {
+		c.getLogsMaxBlocks = defaultGetLogsMaxBlocks
+	}
+	return c, nil
+}
+
+// cost returns the compute units of a call. Block tags in eth_getLogs ranges are
+// resolved with the consensus of the serving backend group, if it has one.
+func (c *computeUnitLimits) cost(req *RPCReq, cp *ConsensusPoller) int {
+	cost, ok := c.methodCosts[req.Method]
+	if !ok {
+		cost = c.defaultCost
+	}
+	if req.Method == "eth_getLogs" && c.getLogsCostPerBlock > 0 {
+		blocks, ok := getLogsBlockRange(req, cp)
+		if !ok || blocks > c.getLogsMaxBlocks {
+			blocks = c.getLogsMaxBlocks
+		}
+		cost += int(math.Ceil(float64(blocks) * c.getLogsCostPerBlock))
+	}
+	return cost
+}
+
+// take charges units to the key, returning whether they could be taken and the units left
+func (c *computeUnitLimits) take(ctx context.Context, key string, units int) (bool, int, error) {
+	return c.lim.TakeN(ctx, key, units)
+}
+
+// getLogsBlockRange returns the number of blocks queried by an eth_getLogs call
+func getLogsBlockRange(req *RPCReq, cp *ConsensusPoller) (uint64, bool) {
+	var p []map[string]interface{}
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+		return 0, false
+	}
+	if _, ok := p[0]["blockHash"]; ok {
+		return 1, true
+	}
+
+	from, to := "latest", "latest"
+	if v, ok := p[0]["fromBlock"]; ok {
+		if from, ok = v.(string); !ok {
+			return 0, false
+		}
+	}
+	if v, ok := p[0]["toBlock"]; ok {
+		if to, ok = v.(string); !ok {
+			return 0, false
+		}
+	}
+	if from == to {
+		return 1, true
+	}
+
+	fromBlock, ok := resolveBlockTag(from, cp)
+	if !ok {
+		return 0, false
+	}
+	toBlock, ok := resolveBlockTag(to, cp)
+	if !ok {
+		return 0, false
+	}
+	if toBlock < fromBlock {
+		return 1, true
+	}
+	return toBlock - fromBlock + 1, true
+}
+
+func resolveBlockTag(tag string, cp *ConsensusPoller) (uint64, bool) {
+	if tag == "earliest" {
+		return 0, true
+	}
+	if bn, ok := blockNumberParam(mustMarshalJSON(tag)); ok {
+		return bn, true
+	}
+	if cp == nil {
+		return 0, false
+	}
+	rctx := cp.rewriteContext()
+	switch tag {
+	case "latest", "pending":
+		return uint64(rctx.latest), true
+	case "safe":
+		return uint64(rctx.safe), true
+	case "finalized":
+		return uint64(rctx.finalized), true
+	}
+	return 0, false
+}
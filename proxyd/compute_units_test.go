@@ -0,0 +1,56 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeUnitCost(t *testing.T) {
+	limits, err := buildComputeUnitLimits(ComputeUnitsConfig{
+		Budget: 100,
+		MethodCosts: map[string]int{
+			"debug_traceTransaction": 50,
+			"eth_getLogs":            10,
+		},
+		GetLogsCostPerBlock: 0.5,
+		GetLogsMaxBlocks:    100,
+	}, func(dur time.Duration, max int, prefix string, algorithm string) FrontendRateLimiter {
+		return NewMemoryFrontendRateLimit(dur, max)
+	})
+	require.NoError(t, err)
+
+	cp := &ConsensusPoller{tracker: NewInMemoryConsensusTracker()}
+	cp.tracker.SetLatestBlockNumber(1000)
+	cp.tracker.SetSafeBlockNumber(990)
+	cp.tracker.SetFinalizedBlockNumber(980)
+
+	getLogs := func(filter string) *RPCReq {
+		return &RPCReq{Method: "eth_getLogs", Params: json.RawMessage(`[` + filter + `]`)}
+	}
+
+	tests := []struct {
+		name string
+		req  *RPCReq
+		cp   *ConsensusPoller
+		cost int
+	}{
+		{"default cost", &RPCReq{Method: "eth_chainId"}, nil, 1},
+		{"method cost", &RPCReq{Method: "debug_traceTransaction"}, nil, 50},
+		{"getLogs numeric range", getLogs(`{"fromBlock": "0x1", "toBlock": "0x14"}`), nil, 20},
+		{"getLogs defaults to latest", getLogs(`{}`), nil, 11},
+		{"getLogs single tag", getLogs(`{"fromBlock": "safe", "toBlock": "safe"}`), nil, 11},
+		{"getLogs block hash", getLogs(`{"blockHash": "0x4ab3a1c29de3fa5b5bbd8bef2e23ba0fb2a4b85a8a6d1a2e2b3d2c6d5e4f3a2b"}`), nil, 11},
+		{"getLogs unresolved tags are charged the max range", getLogs(`{"fromBlock": "0x1", "toBlock": "latest"}`), nil, 60},
+		{"getLogs tags resolved by consensus", getLogs(`{"fromBlock": "finalized", "toBlock": "latest"}`), cp, 21},
+		{"getLogs earliest to latest is capped", getLogs(`{"fromBlock": "earliest", "toBlock": "latest"}`), cp, 60},
+		{"getLogs invalid params", getLogs(`"0x1"`), nil, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.cost, limits.cost(tt.req, tt.cp))
+		})
+	}
+}
@@ -29,11 +29,27 @@ type ServerConfig struct {
 	EnablePprof           bool `toml:"enable_pprof"`
 	EnableXServedByHeader bool `toml:"enable_served_by_header"`
 	AllowAllOrigins       bool `toml:"allow_all_origins"`
+
+	// WSMultiplexSubscriptions shares upstream subscriptions between websocket clients.
+	// Client websockets then don't hold a backend connection, other calls are forwarded over HTTP.
+	WSMultiplexSubscriptions bool `toml:"ws_multiplex_subscriptions"`
+
+	// ConfigReloadInterval enables polling the config file for changes. Reloads can also be triggered with SIGHUP.
+	ConfigReloadInterval TOMLDuration `toml:"config_reload_interval"`
 }
 
 type CacheConfig struct {
 	Enabled bool         `toml:"enabled"`
 	TTL     TOMLDuration `toml:"ttl"`
+	// FinalizedMethods caches these methods in consensus aware backend groups
+	// when the requested blocks are at or below the finalized block
+	FinalizedMethods map[string]*FinalizedCacheMethodConfig `toml:"finalized_methods"`
+}
+
+type FinalizedCacheMethodConfig struct {
+	TTL TOMLDuration `toml:"ttl"`
+	// MaxSizeBytes skips caching responses larger than this, no limit if 0
+	MaxSizeBytes int `toml:"max_size_bytes"`
 }
 
 type RedisConfig struct {
@@ -55,21 +71,150 @@ type MetricsConfig struct {
 	Port    int    `toml:"port"`
 }
 
+// TracingConfig exports OpenTelemetry spans of the stages of each request
+type TracingConfig struct {
+	// Exporter is one of "otlp", "stdout" or "none", tracing is disabled if empty.
+	// With "none", the trace context is still propagated to the backends.
+	Exporter string `toml:"exporter"`
+	// Endpoint is the base URL of the OTLP/HTTP collector, defaults to http://localhost:4318
+	Endpoint string            `toml:"endpoint"`
+	Headers  map[string]string `toml:"headers"`
+	// ServiceName is the service.name resource attribute, defaults to proxyd
+	ServiceName string `toml:"service_name"`
+	// SampleRatio is the fraction of new traces that are recorded, defaults to 1.
+	// Requests continuing a trace follow the sampling decision of their caller.
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+// CaptureConfig writes a sample of the requests and responses to rotating JSONL files,
+// which can be replayed with `proxyd replay`
+type CaptureConfig struct {
+	// Dir enables the capture, files are written to this directory
+	Dir string `toml:"dir"`
+	// SampleRate is the fraction of requests captured, defaults to 0.01
+	SampleRate float64 `toml:"sample_rate"`
+	// MaxFileSizeBytes rotates the file once it reaches this size, defaults to 100MB
+	MaxFileSizeBytes int64 `toml:"max_file_size_bytes"`
+	// MaxFiles is the number of files kept, the oldest ones are removed, defaults to 10
+	MaxFiles int `toml:"max_files"`
+}
+
+type AdminConfig struct {
+	Host string `toml:"host"`
+	Port int    `toml:"port"`
+	// Authentication maps admin tokens to the operator name used in logs and metrics
+	Authentication map[string]string `toml:"authentication"`
+}
+
 type RateLimitConfig struct {
 	UseRedis         bool                                `toml:"use_redis"`
 	BaseRate         int                                 `toml:"base_rate"`
 	BaseInterval     TOMLDuration                        `toml:"base_interval"`
+	BaseAlgorithm    string                              `toml:"base_algorithm"`
 	ExemptOrigins    []string                            `toml:"exempt_origins"`
 	ExemptUserAgents []string                            `toml:"exempt_user_agents"`
 	ErrorMessage     string                              `toml:"error_message"`
 	MethodOverrides  map[string]*RateLimitMethodOverride `toml:"method_overrides"`
 	IPHeaderOverride string                              `toml:"ip_header_override"`
+	ComputeUnits     ComputeUnitsConfig                  `toml:"compute_units"`
 }
 
-type RateLimitMethodOverride struct {
-	Limit    int          `toml:"limit"`
+// ComputeUnitsConfig charges each call its cost in compute units against a
+// budget per IP, or per auth key for authenticated requests.
+type ComputeUnitsConfig struct {
+	// Budget is the number of compute units that can be spent per Interval, disabled if 0
+	Budget   int          `toml:"budget"`
 	Interval TOMLDuration `toml:"interval"`
-	Global   bool         `toml:"global"`
+	// DefaultCost is the cost of methods missing from MethodCosts, defaults to 1
+	DefaultCost int            `toml:"default_cost"`
+	MethodCosts map[string]int `toml:"method_costs"`
+	// GetLogsCostPerBlock is added to the eth_getLogs cost for every block in the queried range
+	GetLogsCostPerBlock float64 `toml:"get_logs_cost_per_block"`
+	// GetLogsMaxBlocks caps the charged range, and is charged for ranges that can't be resolved. Defaults to 10000
+	GetLogsMaxBlocks uint64 `toml:"get_logs_max_blocks"`
+}
+
+// APIKeysConfig configures the API keys clients authenticate with. Keys are
+// accepted as the URL path, as an "Authorization: Bearer" token or in Header.
+type APIKeysConfig struct {
+	// Header is an additional request header keys are read from, e.g. X-API-Key
+	Header string `toml:"header"`
+	// UseRedis also loads keys from the <namespace>:api_keys redis hash, which maps
+	// key names to their JSON encoded APIKeyConfig
+	UseRedis bool `toml:"use_redis"`
+	// RefreshInterval is how often keys are reloaded from redis, defaults to 30s
+	RefreshInterval TOMLDuration             `toml:"refresh_interval"`
+	Keys            map[string]*APIKeyConfig `toml:"keys"`
+}
+
+func (c APIKeysConfig) Enabled() bool {
+	return len(c.Keys) > 0 || c.UseRedis
+}
+
+type APIKeyConfig struct {
+	Key string `toml:"key" json:"key"`
+	// RateLimit is the number of calls the key can make per RateLimitInterval, no limit if 0
+	RateLimit         int          `toml:"rate_limit" json:"rate_limit"`
+	RateLimitInterval TOMLDuration `toml:"rate_limit_interval" json:"rate_limit_interval"`
+	// DailyQuota is the number of calls the key can make per UTC day, no limit if 0
+	DailyQuota int `toml:"daily_quota" json:"daily_quota"`
+	// AllowedMethods restricts the key to these methods, all mapped methods are allowed if empty
+	AllowedMethods []string `toml:"allowed_methods" json:"allowed_methods"`
+	// AllowedPathRoutes restricts the key to these path routes. If empty, keys with
+	// AllowedMethods can't use path routes and other keys can use all of them.
+	AllowedPathRoutes []string `toml:"allowed_path_routes" json:"allowed_path_routes"`
+	// BackendGroup serves all HTTP requests of the key instead of the rpc_method_mappings group
+	BackendGroup string `toml:"backend_group" json:"backend_group"`
+}
+
+// JWTAuthConfig configures the signed JWTs clients authenticate with, as an
+// "Authorization: Bearer" token or as the URL path. The claims of a valid token
+// select one of Policies.
+type JWTAuthConfig struct {
+	// Secret verifies HS256 tokens, it can be read from the environment with $NAME
+	Secret string `toml:"secret"`
+	// JWKSFile is a local JSON Web Key Set, its RSA and P-256 keys verify RS256 and ES256 tokens
+	JWKSFile string `toml:"jwks_file"`
+	// Issuer and Audience, if set, must match the iss and aud claims of the tokens
+	Issuer   string `toml:"issuer"`
+	Audience string `toml:"audience"`
+	// Leeway is the clock skew tolerated when checking the exp and nbf claims
+	Leeway TOMLDuration `toml:"leeway"`
+	// PolicyClaim is the claim naming the policy of a token, defaults to "policy"
+	PolicyClaim string `toml:"policy_claim"`
+	// DefaultPolicy applies to tokens without the policy claim, which are rejected if it is empty
+	DefaultPolicy string                      `toml:"default_policy"`
+	Policies      map[string]*JWTPolicyConfig `toml:"policies"`
+}
+
+func (c JWTAuthConfig) Enabled() bool {
+	return c.Secret != "" || c.JWKSFile != ""
+}
+
+// JWTPolicyConfig is what a JWT is allowed to do. Its limits apply to every subject
+// (the sub claim) separately, tokens without a subject share them.
+type JWTPolicyConfig struct {
+	// Label identifies the clients of the policy in logs and metrics, defaults to the policy name
+	Label string `toml:"label"`
+	// RateLimit is the number of calls a subject can make per RateLimitInterval, no limit if 0
+	RateLimit         int          `toml:"rate_limit"`
+	RateLimitInterval TOMLDuration `toml:"rate_limit_interval"`
+	// DailyQuota is the number of calls a subject can make per UTC day, no limit if 0
+	DailyQuota int `toml:"daily_quota"`
+	// AllowedMethods restricts the policy to these methods, all mapped methods are allowed if empty
+	AllowedMethods []string `toml:"allowed_methods"`
+	// AllowedPathRoutes restricts the policy to these path routes. If empty, policies with
+	// AllowedMethods can't use path routes and other policies can use all of them.
+	AllowedPathRoutes []string `toml:"allowed_path_routes"`
+	// BackendGroup serves all HTTP requests of the policy instead of the rpc_method_mappings group
+	BackendGroup string `toml:"backend_group"`
+}
+
+type RateLimitMethodOverride struct {
+	Limit     int          `toml:"limit"`
+	Interval  TOMLDuration `toml:"interval"`
+	Global    bool         `toml:"global"`
+	Algorithm string       `toml:"algorithm"`
 }
 
 type TOMLDuration time.Duration
@@ -92,6 +237,15 @@ type BackendOptions struct {
 	MaxDegradedLatencyThreshold TOMLDuration `toml:"max_degraded_latency_threshold"`
 	MaxLatencyThreshold         TOMLDuration `toml:"max_latency_threshold"`
 	MaxErrorRateThreshold       float64      `toml:"max_error_rate_threshold"`
+
+	// CircuitBreakerFailureThreshold enables the circuit breaker of the backends, opening
+	// it after this many consecutive failed requests
+	CircuitBreakerFailureThreshold int          `toml:"circuit_breaker_failure_threshold"`
+	CircuitBreakerOpenDuration     TOMLDuration `toml:"circuit_breaker_open_duration"`
+	CircuitBreakerHalfOpenRequests int          `toml:"circuit_breaker_half_open_requests"`
+	CircuitBreakerSuccessThreshold int          `toml:"circuit_breaker_success_threshold"`
+	CircuitBreakerProbeMethod      string       `toml:"circuit_breaker_probe_method"`
+	CircuitBreakerProbeInterval    TOMLDuration `toml:"circuit_breaker_probe_interval"`
 }
 
 type BackendConfig struct {
@@ -107,6 +261,9 @@ type BackendConfig struct {
 	ClientKeyFile    string            `toml:"client_key_file"`
 	StripTrailingXFF bool              `toml:"strip_trailing_xff"`
 	Headers          map[string]string `toml:"headers"`
+	// JWTSecret is the hex encoded 32 byte secret of a backend using engine API style JWT auth,
+	// proxyd signs a token with it for every request. It can be read from the environment with $NAME
+	JWTSecret string `toml:"jwt_secret"`
 
 	Weight int `toml:"weight"`
 
@@ -120,11 +277,21 @@ type BackendsConfig map[string]*BackendConfig
 type RoutingStrategy string
 
 func (b *BackendGroupConfig) ValidateRoutingStrategy(bgName string) bool {
+	if err := b.resolveRoutingStrategy(bgName); err != nil {
+		log.Error("invalid routing strategy for backend_group", "name", bgName, "err", err)
+		return false
+	}
+	return true
+}
+
+// resolveRoutingStrategy checks the routing settings of the group, and resolves the deprecated
+// consensus_aware flag and the default strategy in place
+func (b *BackendGroupConfig) resolveRoutingStrategy(bgName string) error {
 
 	// If Consensus Aware is Set and Routing RoutingStrategy is populated fail
 	if b.ConsensusAware && b.RoutingStrategy != "" {
 		log.Warn("consensus_aware is now deprecated, please use routing_strategy = consensus_aware")
-		log.Crit("Exiting consensus_aware and routing strategy are mutually exclusive, they cannot both be defined")
+		return fmt.Errorf("consensus_aware and routing_strategy are mutually exclusive, they cannot both be defined for backend group %s", bgName)
 	}
 
 	// If Consensus Aware is Set set RoutingStrategy to consensus_aware
@@ -133,19 +300,41 @@ func (b *BackendGroupConfig) ValidateRoutingStrategy(bgName string) bool {
 		log.Info("consensus_aware is now deprecated, please use routing_strategy = consenus_aware in the future")
 	}
 
+	if b.ConsensusRoutingStrategy != "" {
+		if b.RoutingStrategy != ConsensusAwareRoutingStrategy {
+			return fmt.Errorf("consensus_routing_strategy requires routing_strategy = consensus_aware for backend group %s", bgName)
+		}
+		if !b.ConsensusRoutingStrategy.IsLoadAware() {
+			return fmt.Errorf("invalid consensus_routing_strategy %q provided for backend group %s. Valid options: least_latency, least_outstanding, power_of_two_choices", b.ConsensusRoutingStrategy, bgName)
+		}
+	}
+
+	if b.ConsensusScoring {
+		if b.RoutingStrategy != ConsensusAwareRoutingStrategy {
+			return fmt.Errorf("consensus_scoring requires routing_strategy = consensus_aware for backend group %s", bgName)
+		}
+		if b.ConsensusRoutingStrategy != "" {
+			return fmt.Errorf("consensus_scoring can't be combined with consensus_routing_strategy for backend group %s", bgName)
+		}
+	}
+
 	switch b.RoutingStrategy {
 	case ConsensusAwareRoutingStrategy:
-		return true
+		return nil
 	case MulticallRoutingStrategy:
-		return true
+		return nil
+	case QuorumRoutingStrategy:
+		return nil
 	case FallbackRoutingStrategy:
-		return true
+		return nil
+	case LeastLatencyRoutingStrategy, LeastOutstandingRoutingStrategy, PowerOfTwoChoicesRoutingStrategy:
+		return nil
 	case "":
 		log.Info("Empty routing strategy provided for backend_group, using fallback strategy ", "name", bgName)
 		b.RoutingStrategy = FallbackRoutingStrategy
-		return true
+		return nil
 	default:
-		return false
+		return fmt.Errorf("invalid routing strategy %q provided for backend group %s. Valid options: fallback, multicall, quorum, consensus_aware, least_latency, least_outstanding, power_of_two_choices, \"\"", b.RoutingStrategy, bgName)
 	}
 }
 
@@ -153,8 +342,27 @@ const (
 	ConsensusAwareRoutingStrategy RoutingStrategy = "consensus_aware"
 	MulticallRoutingStrategy      RoutingStrategy = "multicall"
 	FallbackRoutingStrategy       RoutingStrategy = "fallback"
+	// QuorumRoutingStrategy sends reads to several backends and only returns the results enough of them agree on
+	QuorumRoutingStrategy RoutingStrategy = "quorum"
+
+	// LeastLatencyRoutingStrategy prefers the backends with the lowest average latency
+	LeastLatencyRoutingStrategy RoutingStrategy = "least_latency"
+	// LeastOutstandingRoutingStrategy prefers the backends with the fewest in-flight requests
+	LeastOutstandingRoutingStrategy RoutingStrategy = "least_outstanding"
+	// PowerOfTwoChoicesRoutingStrategy samples two backends and prefers the least loaded one
+	PowerOfTwoChoicesRoutingStrategy RoutingStrategy = "power_of_two_choices"
 )
 
+// IsLoadAware returns true for the strategies that rank backends by their current load
+func (r RoutingStrategy) IsLoadAware() bool {
+	switch r {
+	case LeastLatencyRoutingStrategy, LeastOutstandingRoutingStrategy, PowerOfTwoChoicesRoutingStrategy:
+		return true
+	default:
+		return false
+	}
+}
+
 type BackendGroupConfig struct {
 	Backends []string `toml:"backends"`
 
@@ -164,6 +372,41 @@ type BackendGroupConfig struct {
 
 	MulticallRPCErrorCheck bool `toml:"multicall_rpc_error_check"`
 
+	// HedgeDelay sends idempotent reads to the next backend as well when the first
+	// one hasn't answered in time, HedgeLatencyPercentile derives the delay from the
+	// latency of the first backend instead
+	HedgeDelay             TOMLDuration `toml:"hedge_delay"`
+	HedgeLatencyPercentile float64      `toml:"hedge_latency_percentile"`
+	HedgeMethods           []string     `toml:"hedge_methods"`
+
+	// GetLogsSplitRange splits eth_getLogs calls over more blocks into chunks of
+	// this many blocks, fetched in parallel and merged back in order. The total
+	// range is still limited by consensus_max_block_range.
+	GetLogsSplitRange       uint64 `toml:"get_logs_split_range"`
+	GetLogsSplitConcurrency int    `toml:"get_logs_split_concurrency"`
+	GetLogsSplitMaxChunks   int    `toml:"get_logs_split_max_chunks"`
+	// GetLogsMaxResults is the maximum number of logs returned by a split call
+	GetLogsMaxResults int `toml:"get_logs_max_results"`
+
+	// QuorumSize is the number of backends queried by the quorum routing strategy,
+	// and QuorumThreshold the number of them that must return the same result
+	QuorumSize      int      `toml:"quorum_size"`
+	QuorumThreshold int      `toml:"quorum_threshold"`
+	QuorumMethods   []string `toml:"quorum_methods"`
+
+	// HealthCheckInterval enables active health checks of the backends, calling
+	// HealthCheckMethod on each of them at this interval
+	HealthCheckInterval    TOMLDuration `toml:"health_check_interval"`
+	HealthCheckMethod      string       `toml:"health_check_method"`
+	HealthCheckMaxBlockLag uint64       `toml:"health_check_max_block_lag"`
+	HealthCheckMaxLatency  TOMLDuration `toml:"health_check_max_latency"`
+
+	// StickySessionKey pins the clients identified by their ip, auth or StickySessionHeader
+	// to the backend that last served them, for StickySessionTTL
+	StickySessionKey    string       `toml:"sticky_session_key"`
+	StickySessionHeader string       `toml:"sticky_session_header"`
+	StickySessionTTL    TOMLDuration `toml:"sticky_session_ttl"`
+
 	/*
 		Deprecated: Use routing_strategy config to create a consensus_aware proxyd instance
 	*/
@@ -171,17 +414,35 @@ type BackendGroupConfig struct {
 	ConsensusAsyncHandler   string       `toml:"consensus_handler"`
 	ConsensusPollerInterval TOMLDuration `toml:"consensus_poller_interval"`
 
+	// ConsensusRoutingStrategy ranks the consensus group with a load aware strategy
+	// instead of shuffling it
+	ConsensusRoutingStrategy RoutingStrategy `toml:"consensus_routing_strategy"`
+
+	// ConsensusScoring weights the traffic of the consensus group by the score of its members
+	ConsensusScoring bool `toml:"consensus_scoring"`
+
 	ConsensusBanPeriod          TOMLDuration `toml:"consensus_ban_period"`
 	ConsensusMaxUpdateThreshold TOMLDuration `toml:"consensus_max_update_threshold"`
 	ConsensusMaxBlockLag        uint64       `toml:"consensus_max_block_lag"`
 	ConsensusMaxBlockRange      uint64       `toml:"consensus_max_block_range"`
 	ConsensusMinPeerCount       int          `toml:"consensus_min_peer_count"`
 
+	// ConsensusReorgTrackingDepth is the number of blocks behind the consensus head checked for reorgs,
+	// reorg events are also posted to ConsensusReorgWebhookURL when set
+	ConsensusReorgTrackingDepth uint64 `toml:"consensus_reorg_tracking_depth"`
+	ConsensusReorgWebhookURL    string `toml:"consensus_reorg_webhook_url"`
+
 	ConsensusHA                  bool         `toml:"consensus_ha"`
 	ConsensusHAHeartbeatInterval TOMLDuration `toml:"consensus_ha_heartbeat_interval"`
 	ConsensusHALockPeriod        TOMLDuration `toml:"consensus_ha_lock_period"`
 	ConsensusHARedis             RedisConfig  `toml:"consensus_ha_redis"`
 
+	// ConsensusHAPeers shares the consensus between these proxyd instances instead of Redis. It lists the
+	// URLs of their RPC servers, ConsensusHAPeerURL is the URL of this instance among them.
+	ConsensusHAPeers     []string `toml:"consensus_ha_peers"`
+	ConsensusHAPeerURL   string   `toml:"consensus_ha_peer_url"`
+	ConsensusHAPeerToken string   `toml:"consensus_ha_peer_token"`
+
 	Fallbacks []string `toml:"fallbacks"`
 }
 
@@ -189,6 +450,44 @@ type BackendGroupsConfig map[string]*BackendGroupConfig
 
 type MethodMappingsConfig map[string]string
 
+// PathRouteConfig passes the HTTP requests under Path through to a backend group as is,
+// for the endpoints that aren't JSON-RPC such as geth's /graphql
+type PathRouteConfig struct {
+	// Path is the prefix the route serves, e.g. /graphql. It is also served under /<auth key>/<path>.
+	Path         string `toml:"path"`
+	BackendGroup string `toml:"backend_group"`
+	// BackendPath replaces Path in the URL sent to the backends, defaults to Path
+	BackendPath string `toml:"backend_path"`
+	// AllowedPaths are the paths under Path that can be requested, all of them if empty
+	AllowedPaths []string `toml:"allowed_paths"`
+	// AllowedMethods are the allowed HTTP methods, defaults to GET and POST
+	AllowedMethods []string `toml:"allowed_methods"`
+	// MaxBodySizeBytes defaults to server.max_body_size_bytes
+	MaxBodySizeBytes int64 `toml:"max_body_size_bytes"`
+	// RateLimit is the number of requests per RateLimitInterval per IP or auth key, disabled if 0
+	RateLimit         int          `toml:"rate_limit"`
+	RateLimitInterval TOMLDuration `toml:"rate_limit_interval"`
+}
+
+type PathRoutesConfig map[string]*PathRouteConfig
+
+// RoutingRuleConfig routes the calls matching all of its conditions to BackendGroup instead of
+// the rpc_method_mappings group. Rules are evaluated in order and the first match wins.
+type RoutingRuleConfig struct {
+	// Name labels the rule in metrics, defaults to rule_<index>
+	Name string `toml:"name"`
+	// Methods are the matched methods, a trailing * matches any suffix, e.g. debug_trace*
+	Methods []string `toml:"methods"`
+	// BlockTags matches the calls reading one of these tags, e.g. latest. Calls without
+	// a block param read latest.
+	BlockTags []string `toml:"block_tags"`
+	// MinBlockAge matches the calls reading a block at least this many blocks behind the
+	// head of HeadBackendGroup, which must be consensus aware
+	MinBlockAge      uint64 `toml:"min_block_age"`
+	HeadBackendGroup string `toml:"head_backend_group"`
+	BackendGroup     string `toml:"backend_group"`
+}
+
 type BatchConfig struct {
 	MaxSize      int    `toml:"max_size"`
 	ErrorMessage string `toml:"error_message"`
@@ -201,7 +500,26 @@ type SenderRateLimitConfig struct {
 	Enabled         bool
 	Interval        TOMLDuration
 	Limit           int
+	Algorithm       string     `toml:"algorithm"`
 	AllowedChainIds []*big.Int `toml:"allowed_chain_ids"`
+	// MaxInflightNonces caps the distinct nonces a sender can use within InflightNonceWindow,
+	// which defaults to Interval. Disabled if 0.
+	MaxInflightNonces   int          `toml:"max_inflight_nonces"`
+	InflightNonceWindow TOMLDuration `toml:"inflight_nonce_window"`
+}
+
+// TxPolicyConfig configures the checks eth_sendRawTransaction requests go through
+// before they are forwarded.
+type TxPolicyConfig struct {
+	Enabled         bool
+	AllowedChainIds []*big.Int   `toml:"allowed_chain_ids"`
+	MinGasPriceWei  uint64       `toml:"min_gas_price_wei"`
+	MinTipWei       uint64       `toml:"min_tip_wei"`
+	MaxSizeBytes    uint64       `toml:"max_size_bytes"`
+	AllowBlobs      bool         `toml:"allow_blobs"`
+	DeniedSenders   []string     `toml:"denied_senders"`
+	DedupeWindow    TOMLDuration `toml:"dedupe_window"`
+	MeteredSenders  []string     `toml:"metered_senders"`
 }
 
 type Config struct {
@@ -210,16 +528,24 @@ type Config struct {
 	Cache                 CacheConfig           `toml:"cache"`
 	Redis                 RedisConfig           `toml:"redis"`
 	Metrics               MetricsConfig         `toml:"metrics"`
+	Tracing               TracingConfig         `toml:"tracing"`
+	Capture               CaptureConfig         `toml:"capture"`
+	Admin                 AdminConfig           `toml:"admin"`
 	RateLimit             RateLimitConfig       `toml:"rate_limit"`
 	BackendOptions        BackendOptions        `toml:"backend"`
 	Backends              BackendsConfig        `toml:"backends"`
 	BatchConfig           BatchConfig           `toml:"batch"`
 	Authentication        map[string]string     `toml:"authentication"`
+	APIKeys               APIKeysConfig         `toml:"api_keys"`
+	JWTAuth               JWTAuthConfig         `toml:"jwt_auth"`
 	BackendGroups         BackendGroupsConfig   `toml:"backend_groups"`
 	RPCMethodMappings     map[string]string     `toml:"rpc_method_mappings"`
+	RoutingRules          []*RoutingRuleConfig  `toml:"routing_rules"`
+	PathRoutes            PathRoutesConfig      `toml:"path_routes"`
 	WSMethodWhitelist     []string              `toml:"ws_method_whitelist"`
 	WhitelistErrorMessage string                `toml:"whitelist_error_message"`
 	SenderRateLimit       SenderRateLimitConfig `toml:"sender_rate_limit"`
+	TxPolicy              TxPolicyConfig        `toml:"tx_policy"`
 }
 
 func ReadFromEnvOrConfig(value string) (string, error) {
@@ -0,0 +1,332 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// peerConsensusStatus is what a PeerConsensusTracker tells its peers about itself
+type peerConsensusStatus struct {
+	Name   string `json:"name"`
+	Leader bool   `json:"leader"`
+	// State is the local state collected by the pollers of the peer, it is the shared state if the peer leads
+	State ConsensusTrackerState `json:"state"`
+}
+
+// PeerConsensusTracker shares the consensus state between a static list of proxyd instances over HTTP,
+// without Redis. Every heartbeat each instance reads the status of its peers, and follows the lowest
+// named peer claiming the leadership. If none does, the lowest named peer whose local state is valid
+// and not behind the shared state claims it. A leader that stops answering loses the leadership at the
+// next heartbeat of its followers. Instances only lead while they reach a majority of the peers, so
+// that a network partition can't elect a leader on each side.
+type PeerConsensusTracker struct {
+	ctx          context.Context
+	cancelFunc   context.CancelFunc
+	done         chan struct{}
+	backendGroup *BackendGroup
+
+	name              string
+	peers             []string
+	token             string
+	client            *http.Client
+	heartbeatInterval time.Duration
+
+	mtx        sync.Mutex
+	leader     bool
+	leaderName string
+
+	// holds the state collected by local pollers
+	local *InMemoryConsensusTracker
+
+	// holds a copy of the shared state, the local state when leader
+	remote *InMemoryConsensusTracker
+}
+
+type PeerConsensusTrackerOpt func(ct *PeerConsensusTracker)
+
+func WithPeerHeartbeatInterval(heartbeatInterval time.Duration) PeerConsensusTrackerOpt {
+	return func(ct *PeerConsensusTracker) {
+		ct.heartbeatInterval = heartbeatInterval
+	}
+}
+
+// WithPeerToken sets the bearer token peers must present, and that is presented to them
+func WithPeerToken(token string) PeerConsensusTrackerOpt {
+	return func(ct *PeerConsensusTracker) {
+		ct.token = token
+	}
+}
+
+// NewPeerConsensusTracker creates a tracker for the instance named name, its URL in peers.
+// The status of the other peers is read from <peer URL>/consensus_ha/<backend group>.
+func NewPeerConsensusTracker(ctx context.Context,
+	bg *BackendGroup,
+	name string,
+	peers []string,
+	opts ...PeerConsensusTrackerOpt) (*PeerConsensusTracker, error) {
+
+	others := make([]string, 0, len(peers))
+	found := false
+	for _, peer := range peers {
+		if peer == name {
+			found = true
+			continue
+		}
+		others = append(others, peer)
+	}
+	if !found {
+		return nil, fmt.Errorf("consensus HA peer %s of backend group %s is not in its list of peers", name, bg.Name)
+	}
+
+	ctx, cancelFunc := context.WithCancel(ctx)
+	tracker := &PeerConsensusTracker{
+		ctx:          ctx,
+		cancelFunc:   cancelFunc,
+		done:         make(chan struct{}),
+		backendGroup: bg,
+		name:         name,
+		peers:        others,
+
+		heartbeatInterval: 2 * time.Second,
+		local:             NewInMemoryConsensusTracker().(*InMemoryConsensusTracker),
+		remote:            NewInMemoryConsensusTracker().(*InMemoryConsensusTracker),
+	}
+
+	for _, opt := range opts {
+		opt(tracker)
+	}
+	// a peer that doesn't answer within a heartbeat is considered down
+	tracker.client = &http.Client{Timeout: tracker.heartbeatInterval}
+
+	return tracker, nil
+}
+
+func (ct *PeerConsensusTracker) Init() {
+	go func() {
+		defer close(ct.done)
+		for {
+			timer := time.NewTimer(ct.heartbeatInterval)
+			ct.stateHeartbeat()
+
+			select {
+			case <-timer.C:
+				continue
+			case <-ct.ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the heartbeat, the peers elect a new leader once they notice this instance is gone
+func (ct *PeerConsensusTracker) Shutdown() {
+	ct.cancelFunc()
+	<-ct.done
+
+	ct.mtx.Lock()
+	ct.leader = false
+	ct.mtx.Unlock()
+}
+
+func (ct *PeerConsensusTracker) IsLeader() bool {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	return ct.leader
+}
+
+func (ct *PeerConsensusTracker) LeaderName() string {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	return ct.leaderName
+}
+
+func (ct *PeerConsensusTracker) status() *peerConsensusStatus {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	return &peerConsensusStatus{
+		Name:   ct.name,
+		Leader: ct.leader,
+		State:  ct.local.getState(),
+	}
+}
+
+// ServeHTTP answers the status requests of the peers
+func (ct *PeerConsensusTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ct.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ct.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(mustMarshalJSON(ct.status()))
+}
+
+func (ct *PeerConsensusTracker) fetchStatus(peer string) (*peerConsensusStatus, error) {
+	req, err := http.NewRequestWithContext(ct.ctx, http.MethodGet, fmt.Sprintf("%s/consensus_ha/%s", strings.TrimSuffix(peer, "/"), ct.backendGroup.Name), nil)
+	if err != nil {
+		return nil, err
+	}
+	if ct.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ct.token)
+	}
+	res, err := ct.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	status := new(peerConsensusStatus)
+	if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+		return nil, err
+	}
+	if status.Name != peer {
+		return nil, fmt.Errorf("peer %s answered as %s", peer, status.Name)
+	}
+	return status, nil
+}
+
+// fetchStatuses reads the status of every peer, the peers that can't be reached are left out
+func (ct *PeerConsensusTracker) fetchStatuses() []*peerConsensusStatus {
+	statuses := make([]*peerConsensusStatus, len(ct.peers))
+	var wg sync.WaitGroup
+	for i, peer := range ct.peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			status, err := ct.fetchStatus(peer)
+			if err != nil {
+				if !errors.Is(ct.ctx.Err(), context.Canceled) {
+					log.Debug("failed to read the status of a peer", "peer", peer, "err", err)
+					RecordGroupConsensusError(ct.backendGroup, "read_peer_status", err)
+				}
+				return
+			}
+			statuses[i] = status
+		}(i, peer)
+	}
+	wg.Wait()
+
+	reachable := make([]*peerConsensusStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if status != nil {
+			reachable = append(reachable, status)
+		}
+	}
+	return reachable
+}
+
+// hasQuorum returns whether the reachable peers, this instance included, are a majority of the peers
+func (ct *PeerConsensusTracker) hasQuorum(reachable int) bool {
+	return reachable > (len(ct.peers)+1)/2
+}
+
+func (ct *PeerConsensusTracker) stateHeartbeat() {
+	statuses := append(ct.fetchStatuses(), ct.status())
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	quorum := ct.hasQuorum(len(statuses))
+
+	// follow the lowest named leader, the others step down once they see it. This
+	// instance keeps the leadership only while it reaches a majority of the peers.
+	var leader *peerConsensusStatus
+	for _, status := range statuses {
+		if status.Leader && (quorum || status.Name != ct.name) {
+			leader = status
+			break
+		}
+	}
+	if leader == nil && !quorum {
+		log.Warn("can't reach a majority of the consensus peers, not electing a leader",
+			"backend_group", ct.backendGroup.Name, "reachable", len(statuses), "peers", len(ct.peers)+1)
+		RecordGroupConsensusError(ct.backendGroup, "peer_quorum", errors.New("no majority of peers reachable"))
+		ct.mtx.Lock()
+		if ct.leader {
+			log.Info("giving up the consensus leadership", "backend_group", ct.backendGroup.Name, "name", ct.name)
+		}
+		ct.leader = false
+		ct.mtx.Unlock()
+		return
+	}
+	if leader == nil {
+		for _, status := range statuses {
+			state := &InMemoryConsensusTracker{state: &status.State}
+			if state.Valid() && !(ct.remote.Valid() && state.Behind(ct.remote)) {
+				leader = status
+				break
+			}
+		}
+	}
+	if leader == nil {
+		log.Warn("no peer has a valid state, skipping")
+		return
+	}
+
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	if leader.Name == ct.name {
+		if !ct.leader {
+			log.Info("taking the consensus leadership", "backend_group", ct.backendGroup.Name, "name", ct.name)
+		}
+		ct.leader = true
+		ct.leaderName = ct.name
+		ct.remote.update(&leader.State)
+	} else {
+		if ct.leader {
+			log.Info("giving up the consensus leadership", "backend_group", ct.backendGroup.Name, "name", ct.name, "leader", leader.Name)
+		}
+		ct.leader = false
+		if !leader.Leader {
+			// the elected peer claims the leadership on its own heartbeat
+			log.Debug("waiting for the peer to take the leadership", "leader", leader.Name)
+			return
+		}
+		ct.leaderName = leader.Name
+		ct.remote.update(&leader.State)
+		log.Debug("updated state from peer", "leader", leader.Name)
+	}
+
+	RecordGroupConsensusHALatestBlock(ct.backendGroup, ct.leaderName, ct.remote.GetLatestBlockNumber())
+	RecordGroupConsensusHASafeBlock(ct.backendGroup, ct.leaderName, ct.remote.GetSafeBlockNumber())
+	RecordGroupConsensusHAFinalizedBlock(ct.backendGroup, ct.leaderName, ct.remote.GetFinalizedBlockNumber())
+}
+
+func (ct *PeerConsensusTracker) GetLatestBlockNumber() hexutil.Uint64 {
+	return ct.remote.GetLatestBlockNumber()
+}
+
+func (ct *PeerConsensusTracker) SetLatestBlockNumber(blockNumber hexutil.Uint64) {
+	ct.local.SetLatestBlockNumber(blockNumber)
+}
+
+func (ct *PeerConsensusTracker) GetSafeBlockNumber() hexutil.Uint64 {
+	return ct.remote.GetSafeBlockNumber()
+}
+
+func (ct *PeerConsensusTracker) SetSafeBlockNumber(blockNumber hexutil.Uint64) {
+	ct.local.SetSafeBlockNumber(blockNumber)
+}
+
+func (ct *PeerConsensusTracker) GetFinalizedBlockNumber() hexutil.Uint64 {
+	return ct.remote.GetFinalizedBlockNumber()
+}
+
+func (ct *PeerConsensusTracker) SetFinalizedBlockNumber(blockNumber hexutil.Uint64) {
+	ct.local.SetFinalizedBlockNumber(blockNumber)
+}
@@ -0,0 +1,158 @@
+package proxyd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testPeer struct {
+	url     string
+	server  *httptest.Server
+	tracker *PeerConsensusTracker
+}
+
+// startTestPeers starts trackers sharing the consensus over loopback, sorted by name
+func startTestPeers(t *testing.T, n int, opts ...PeerConsensusTrackerOpt) []*testPeer {
+	peers := make([]*testPeer, n)
+	urls := make([]string, n)
+	for i := range peers {
+		server := httptest.NewUnstartedServer(nil)
+		peers[i] = &testPeer{url: "http://" + server.Listener.Addr().String(), server: server}
+		urls[i] = peers[i].url
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].url < peers[j].url
+	})
+
+	bg := &BackendGroup{Name: "main"}
+	opts = append(opts, WithPeerHeartbeatInterval(50*time.Millisecond))
+	for _, peer := range peers {
+		tracker, err := NewPeerConsensusTracker(context.Background(), bg, peer.url, urls, opts...)
+		require.NoError(t, err)
+		peer.tracker = tracker
+		peer.server.Config.Handler = tracker
+		peer.server.Start()
+		t.Cleanup(peer.server.Close)
+	}
+	return peers
+}
+
+func setTestPeerState(ct ConsensusTracker, latest, safe, finalized hexutil.Uint64) {
+	ct.SetLatestBlockNumber(latest)
+	ct.SetSafeBlockNumber(safe)
+	ct.SetFinalizedBlockNumber(finalized)
+}
+
+func TestPeerConsensusTracker(t *testing.T) {
+	peers := startTestPeers(t, 3)
+	for i, peer := range peers {
+		setTestPeerState(peer.tracker, hexutil.Uint64(0x100+i), 0xe0, 0xc0)
+		peer.tracker.Init()
+	}
+	defer func() {
+		for _, peer := range peers[1:] {
+			peer.tracker.Shutdown()
+		}
+	}()
+
+	// the lowest named peer leads, and shares its state
+	sharedState := func(peer *testPeer) bool {
+		return peer.tracker.GetLatestBlockNumber() == peers[0].tracker.local.GetLatestBlockNumber() &&
+			peer.tracker.LeaderName() == peers[0].url
+	}
+	require.Eventually(t, func() bool {
+		return peers[0].tracker.IsLeader() && sharedState(peers[1]) && sharedState(peers[2])
+	}, 2*time.Second, 10*time.Millisecond)
+	require.False(t, peers[1].tracker.IsLeader())
+	require.False(t, peers[2].tracker.IsLeader())
+	require.Equal(t, hexutil.Uint64(0xe0), peers[2].tracker.GetSafeBlockNumber())
+	require.Equal(t, hexutil.Uint64(0xc0), peers[2].tracker.GetFinalizedBlockNumber())
+
+	// the followers get the updates of the leader
+	setTestPeerState(peers[0].tracker, 0x110, 0xf0, 0xd0)
+	require.Eventually(t, func() bool {
+		return sharedState(peers[1]) && sharedState(peers[2])
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the next peer takes over once the leader is gone, as long as its state isn't behind
+	peers[0].tracker.Shutdown()
+	peers[0].server.Close()
+	setTestPeerState(peers[1].tracker, 0x111, 0xf0, 0xd0)
+	require.Eventually(t, func() bool {
+		return peers[1].tracker.IsLeader() &&
+			peers[2].tracker.LeaderName() == peers[1].url &&
+			peers[2].tracker.GetLatestBlockNumber() == 0x111
+	}, 2*time.Second, 10*time.Millisecond)
+	require.False(t, peers[2].tracker.IsLeader())
+}
+
+func TestPeerConsensusTrackerBehindPeerDoesNotLead(t *testing.T) {
+	peers := startTestPeers(t, 3)
+	for _, peer := range peers {
+		setTestPeerState(peer.tracker, 0x100, 0xe0, 0xc0)
+		peer.tracker.Init()
+		defer peer.tracker.Shutdown()
+	}
+	require.Eventually(t, func() bool {
+		return peers[0].tracker.IsLeader() && peers[1].tracker.LeaderName() == peers[0].url
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the follower can't take over with a state behind the shared one
+	setTestPeerState(peers[0].tracker, 0x110, 0xe0, 0xc0)
+	require.Eventually(t, func() bool {
+		return peers[1].tracker.GetLatestBlockNumber() == 0x110
+	}, 2*time.Second, 10*time.Millisecond)
+	peers[0].server.Close()
+	require.Never(t, peers[1].tracker.IsLeader, 300*time.Millisecond, 10*time.Millisecond)
+
+	setTestPeerState(peers[1].tracker, 0x110, 0xe0, 0xc0)
+	require.Eventually(t, peers[1].tracker.IsLeader, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestPeerConsensusTrackerToken(t *testing.T) {
+	peers := startTestPeers(t, 2, WithPeerToken("secret"))
+
+	res, err := http.Get(peers[0].url + "/consensus_ha/main")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	status, err := peers[1].tracker.fetchStatus(peers[0].url)
+	require.NoError(t, err)
+	require.Equal(t, peers[0].url, status.Name)
+}
+
+func TestNewPeerConsensusTrackerUnknownPeer(t *testing.T) {
+	_, err := NewPeerConsensusTracker(context.Background(), &BackendGroup{Name: "main"},
+		"http://127.0.0.1:1", []string{"http://127.0.0.1:2", "http://127.0.0.1:3"})
+	require.Error(t, err)
+}
+
+func TestPeerConsensusTrackerQuorum(t *testing.T) {
+	peers := startTestPeers(t, 3)
+	for _, peer := range peers {
+		setTestPeerState(peer.tracker, 0x100, 0xe0, 0xc0)
+		peer.tracker.Init()
+		defer peer.tracker.Shutdown()
+	}
+	require.Eventually(t, peers[0].tracker.IsLeader, 2*time.Second, 10*time.Millisecond)
+
+	// once the peers can't reach each other, the leader steps down and none of them
+	// leads without a majority
+	for _, peer := range peers {
+		peer.server.Close()
+	}
+	require.Eventually(t, func() bool {
+		return !peers[0].tracker.IsLeader()
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool {
+		return peers[0].tracker.IsLeader() || peers[1].tracker.IsLeader() || peers[2].tracker.IsLeader()
+	}, 300*time.Millisecond, 10*time.Millisecond)
+}
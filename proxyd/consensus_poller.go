@@ -26,10 +26,16 @@ type ConsensusPoller struct {
 	cancelFunc context.CancelFunc
 	listeners  []OnConsensusBroken
 
+	chain              *canonicalChain
+	reorgListeners     []OnReorg
+	reorgTrackingDepth uint64
+
 	backendGroup      *BackendGroup
 	backendState      map[*Backend]*backendState
 	consensusGroupMux sync.Mutex
 	consensusGroup    []*Backend
+	scores            map[*Backend]float64
+	scoring           bool
 
 	tracker      ConsensusTracker
 	asyncHandler ConsensusAsyncHandler
@@ -106,8 +112,24 @@ func (ct *ConsensusPoller) GetFinalizedBlockNumber() hexutil.Uint64 {
 	return ct.tracker.GetFinalizedBlockNumber()
 }
 
+// rewriteContext returns the block tags agreed in the consensus, used to rewrite requests
+func (cp *ConsensusPoller) rewriteContext() RewriteContext {
+	return RewriteContext{
+		latest:        cp.GetLatestBlockNumber(),
+		safe:          cp.GetSafeBlockNumber(),
+		finalized:     cp.GetFinalizedBlockNumber(),
+		maxBlockRange: cp.maxBlockRange,
+	}
+}
+
 func (cp *ConsensusPoller) Shutdown() {
 	cp.asyncHandler.Shutdown()
+	switch tracker := cp.tracker.(type) {
+	case *RedisConsensusTracker:
+		tracker.Shutdown()
+	case *PeerConsensusTracker:
+		tracker.Shutdown()
+	}
 }
 
 // ConsensusAsyncHandler controls the asynchronous polling mechanism, interval and shutdown
@@ -230,6 +252,33 @@ func (cp *ConsensusPoller) ClearListeners() {
 	cp.listeners = []OnConsensusBroken{}
 }
 
+func WithReorgListener(listener OnReorg) ConsensusOpt {
+	return func(cp *ConsensusPoller) {
+		cp.AddReorgListener(listener)
+	}
+}
+
+func (cp *ConsensusPoller) AddReorgListener(listener OnReorg) {
+	cp.reorgListeners = append(cp.reorgListeners, listener)
+}
+
+func (cp *ConsensusPoller) ClearReorgListeners() {
+	cp.reorgListeners = []OnReorg{}
+}
+
+func WithReorgTrackingDepth(depth uint64) ConsensusOpt {
+	return func(cp *ConsensusPoller) {
+		cp.reorgTrackingDepth = depth
+	}
+}
+
+// WithScoring weights the traffic of the members of the consensus group by their score
+func WithScoring(scoring bool) ConsensusOpt {
+	return func(cp *ConsensusPoller) {
+		cp.scoring = scoring
+	}
+}
+
 func WithBanPeriod(banPeriod time.Duration) ConsensusOpt {
 	return func(cp *ConsensusPoller) {
 		cp.banPeriod = banPeriod
@@ -282,12 +331,15 @@ func NewConsensusPoller(bg *BackendGroup, opts ...ConsensusOpt) *ConsensusPoller
 		maxBlockLag:        8, // 8*12 seconds = 96 seconds ~ 1.6 minutes
 		minPeerCount:       3,
 		interval:           DefaultPollerInterval,
+		reorgTrackingDepth: DefaultReorgTrackingDepth,
 	}
 
 	for _, opt := range opts {
 		opt(cp)
 	}
 
+	cp.chain = newCanonicalChain(cp.reorgTrackingDepth)
+
 	if cp.tracker == nil {
 		cp.tracker = NewInMemoryConsensusTracker()
 	}
@@ -313,7 +365,7 @@ func (cp *ConsensusPoller) UpdateBackend(ctx context.Context, be *Backend) {
 	}
 
 	// if backend is not healthy state we'll only resume checking it after ban
-	if !be.IsHealthy() && !be.forcedCandidate {
+	if !be.IsHealthy() && !be.IsForcedCandidate() {
 		log.Warn("backend banned - not healthy", "backend", be.Name)
 		cp.Ban(be)
 		return
@@ -406,7 +458,7 @@ func (cp *ConsensusPoller) UpdateBackend(ctx context.Context, be *Backend) {
 
 	RecordBackendUnexpectedBlockTags(be, !expectedBlockTags)
 
-	if !expectedBlockTags && !be.forcedCandidate {
+	if !expectedBlockTags && !be.IsForcedCandidate() {
 		log.Warn("backend banned - unexpected block tags",
 			"backend", be.Name,
 			"oldFinalized", bs.finalizedBlockNumber,
@@ -522,6 +574,10 @@ func (cp *ConsensusPoller) UpdateBackendGroupConsensus(ctx context.Context) {
 			"proposedBlockHash", proposedBlockHash)
 	}
 
+	if hasConsensus && proposedBlockHash != "" {
+		cp.checkReorg(ctx, candidates, proposedBlock, proposedBlockHash)
+	}
+
 	// update tracker
 	cp.tracker.SetLatestBlockNumber(proposedBlock)
 	cp.tracker.SetSafeBlockNumber(lowestSafeBlock)
@@ -541,8 +597,11 @@ func (cp *ConsensusPoller) UpdateBackendGroupConsensus(ctx context.Context) {
 		}
 	}
 
+	scores := cp.updateScores(candidates)
+
 	cp.consensusGroupMux.Lock()
 	cp.consensusGroup = group
+	cp.scores = scores
 	cp.consensusGroupMux.Unlock()
 
 	RecordGroupConsensusLatestBlock(cp.backendGroup, proposedBlock)
@@ -577,14 +636,19 @@ func (cp *ConsensusPoller) BannedUntil(be *Backend) time.Time {
 
 // Ban bans a specific backend
 func (cp *ConsensusPoller) Ban(be *Backend) {
-	if be.forcedCandidate {
+	cp.BanFor(be, cp.banPeriod)
+}
+
+// BanFor bans a specific backend for the given period
+func (cp *ConsensusPoller) BanFor(be *Backend, period time.Duration) {
+	if be.IsForcedCandidate() {
 		return
 	}
 
 	bs := cp.backendState[be]
 	defer bs.backendStateMux.Unlock()
 	bs.backendStateMux.Lock()
-	bs.bannedUntil = time.Now().Add(cp.banPeriod)
+	bs.bannedUntil = time.Now().Add(period)
 
 	// when we ban a node, we give it the chance to start from any block when it is back
 	bs.latestBlockNumber = 0
@@ -602,8 +666,24 @@ func (cp *ConsensusPoller) Unban(be *Backend) {
 
 // Reset reset all backend states
 func (cp *ConsensusPoller) Reset() {
+	cp.chain.reset()
+	// existing states are reset in place since the pollers may be reading them concurrently
 	for _, be := range cp.backendGroup.Backends {
-		cp.backendState[be] = &backendState{}
+		bs, ok := cp.backendState[be]
+		if !ok {
+			cp.backendState[be] = &backendState{}
+			continue
+		}
+		bs.backendStateMux.Lock()
+		bs.latestBlockNumber = 0
+		bs.latestBlockHash = ""
+		bs.safeBlockNumber = 0
+		bs.finalizedBlockNumber = 0
+		bs.peerCount = 0
+		bs.inSync = false
+		bs.lastUpdate = time.Time{}
+		bs.bannedUntil = time.Time{}
+		bs.backendStateMux.Unlock()
 	}
 }
 
@@ -736,7 +816,7 @@ func (cp *ConsensusPoller) getConsensusCandidates() map[*Backend]*backendState {
 //   - with minimum peer count
 //   - in sync
 //   - updated recently
-//   - not lagging latest block
+//   - not lagging latest block, by more than half the max lag to rejoin the group with scoring
 func (cp *ConsensusPoller) FilterCandidates(backends []*Backend) map[*Backend]*backendState {
 
 	candidates := make(map[*Backend]*backendState, len(cp.backendGroup.Backends))
@@ -744,7 +824,7 @@ func (cp *ConsensusPoller) FilterCandidates(backends []*Backend) map[*Backend]*b
 	for _, be := range backends {
 
 		bs := cp.GetBackendState(be)
-		if be.forcedCandidate {
+		if be.IsForcedCandidate() {
 			candidates[be] = bs
 			continue
 		}
@@ -780,11 +860,26 @@ func (cp *ConsensusPoller) FilterCandidates(backends []*Backend) map[*Backend]*b
 		}
 	}
 
+	// with scoring, once the consensus group is formed, backends out of it only join it
+	// within half the max block lag, so that a backend lagging around the max doesn't
+	// flap in and out
+	var members map[*Backend]bool
+	if cp.scoring {
+		members = make(map[*Backend]bool)
+		for _, be := range cp.GetConsensusGroup() {
+			members[be] = true
+		}
+	}
+
 	// find the highest common ancestor block
 	lagging := make([]*Backend, 0, len(candidates))
 	for be, bs := range candidates {
+		maxBlockLag := cp.maxBlockLag
+		if len(members) > 0 && !members[be] {
+			maxBlockLag /= 2
+		}
 		// check if backend is lagging behind the highest block
-		if uint64(highestLatestBlock-bs.latestBlockNumber) > cp.maxBlockLag {
+		if uint64(highestLatestBlock-bs.latestBlockNumber) > maxBlockLag {
 			lagging = append(lagging, be)
 		}
 	}
@@ -0,0 +1,100 @@
+package proxyd
+
+import (
+	"math"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/xaionaro-go/weightedshuffle"
+)
+
+const (
+	// consensusScoreLatencyPercentile is the latency percentile compared between the members of the group
+	consensusScoreLatencyPercentile = 0.9
+	// consensusScoreLatencyFloor is added to the latencies before comparing them, so that
+	// differences of a few milliseconds don't matter
+	consensusScoreLatencyFloor = 10 * time.Millisecond
+	// minConsensusScore keeps every member of the consensus group in rotation
+	minConsensusScore = 0.01
+	// bannedScore is the score of a backend right after its ban, it recovers over a ban period
+	bannedScore = 0.1
+)
+
+// scoreBackend rates a member of the consensus group from 0 to 1, as the product of:
+//   - its block lag behind the highest member, 0 at max_block_lag + 1
+//   - the ratio of the lowest latency percentile of the group to its own, plus a floor
+//   - its error rate, 0 at the max error rate of the backend
+//   - the time since its last ban ended, from bannedScore back to 1 over a ban period
+func (cp *ConsensusPoller) scoreBackend(be *Backend, bs *backendState, highestBlock hexutil.Uint64, bestLatency time.Duration, now time.Time) float64 {
+	score := 1.0
+
+	lag := float64(highestBlock - bs.latestBlockNumber)
+	score *= 1 - lag/float64(cp.maxBlockLag+1)
+
+	if latency, ok := be.LatencyPercentile(consensusScoreLatencyPercentile); ok && bestLatency > 0 {
+		score *= float64(bestLatency+consensusScoreLatencyFloor) / float64(latency+consensusScoreLatencyFloor)
+	}
+
+	if be.maxErrorRateThreshold > 0 {
+		score *= 1 - be.ErrorRate()/be.maxErrorRateThreshold
+	}
+
+	if sinceBan := now.Sub(bs.bannedUntil); sinceBan >= 0 && sinceBan < cp.banPeriod {
+		score *= bannedScore + (1-bannedScore)*float64(sinceBan)/float64(cp.banPeriod)
+	}
+
+	return math.Max(minConsensusScore, math.Min(1, score))
+}
+
+// updateScores scores the members of the new consensus group
+func (cp *ConsensusPoller) updateScores(candidates map[*Backend]*backendState) map[*Backend]float64 {
+	var highestBlock hexutil.Uint64
+	var bestLatency time.Duration
+	for be, bs := range candidates {
+		if bs.latestBlockNumber > highestBlock {
+			highestBlock = bs.latestBlockNumber
+		}
+		if latency, ok := be.LatencyPercentile(consensusScoreLatencyPercentile); ok && latency > 0 {
+			if bestLatency == 0 || latency < bestLatency {
+				bestLatency = latency
+			}
+		}
+	}
+
+	now := time.Now()
+	scores := make(map[*Backend]float64, len(candidates))
+	for be, bs := range candidates {
+		scores[be] = cp.scoreBackend(be, bs, highestBlock, bestLatency, now)
+		RecordConsensusBackendScore(be, scores[be])
+	}
+	return scores
+}
+
+// GetScore returns the score of a member of the consensus group, 0 for other backends
+func (cp *ConsensusPoller) GetScore(be *Backend) float64 {
+	cp.consensusGroupMux.Lock()
+	defer cp.consensusGroupMux.Unlock()
+	return cp.scores[be]
+}
+
+// scoredShuffle orders the backends randomly, proportionally to their score,
+// times their weight if weighted is set
+func (cp *ConsensusPoller) scoredShuffle(backends []*Backend, weighted bool) {
+	cp.consensusGroupMux.Lock()
+	weights := make(map[*Backend]float64, len(backends))
+	for _, be := range backends {
+		weights[be] = math.Max(minConsensusScore, cp.scores[be])
+		if weighted {
+			weights[be] *= float64(be.weight)
+		}
+	}
+	cp.consensusGroupMux.Unlock()
+
+	// whole weights keep the sums of the shuffle exact
+	for be, weight := range weights {
+		weights[be] = math.Ceil(weight * 1000)
+	}
+	weightedshuffle.ShuffleInplace(backends, func(i int) float64 {
+		return weights[backends[i]]
+	}, nil)
+}
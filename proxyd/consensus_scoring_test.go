@@ -0,0 +1,100 @@
+package proxyd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusScoreBackend(t *testing.T) {
+	be := NewBackend("a", "http://localhost", "", nil, WithMaxErrorRateThreshold(0.5))
+	cp := NewConsensusPoller(&BackendGroup{Name: "test", Backends: []*Backend{be}},
+		WithAsyncHandler(NewNoopAsyncHandler()), WithMaxBlockLag(3), WithBanPeriod(time.Minute))
+	now := time.Now()
+
+	require.Equal(t, 1.0, cp.scoreBackend(be, &backendState{latestBlockNumber: 100}, 100, 0, now))
+
+	// each block of lag costs a quarter with a max lag of 3
+	require.InDelta(t, 0.5, cp.scoreBackend(be, &backendState{latestBlockNumber: 98}, 100, 0, now), 1e-9)
+
+	// a backend twice as slow as the fastest member gets half the score
+	for i := 0; i < 10; i++ {
+		be.latencySamples.Add(190 * time.Millisecond)
+	}
+	require.InDelta(t, 0.5, cp.scoreBackend(be, &backendState{latestBlockNumber: 100}, 100, 90*time.Millisecond, now), 1e-9)
+	require.Equal(t, 1.0, cp.scoreBackend(be, &backendState{latestBlockNumber: 100}, 100, 190*time.Millisecond, now))
+
+	// the score recovers over a ban period after a ban
+	bannedUntil := now.Add(-30 * time.Second)
+	require.InDelta(t, 0.55, cp.scoreBackend(be, &backendState{latestBlockNumber: 100, bannedUntil: bannedUntil}, 100, 190*time.Millisecond, now), 1e-9)
+	require.Equal(t, 1.0, cp.scoreBackend(be, &backendState{latestBlockNumber: 100, bannedUntil: now.Add(-time.Hour)}, 100, 190*time.Millisecond, now))
+
+	// half of the max error rate halves the score
+	for i := 0; i < 8; i++ {
+		be.networkRequestsSlidingWindow.Incr()
+	}
+	for i := 0; i < 2; i++ {
+		be.networkRequestsSlidingWindow.Incr()
+		be.intermittentErrorsSlidingWindow.Incr()
+	}
+	require.InDelta(t, 0.6, cp.scoreBackend(be, &backendState{latestBlockNumber: 100}, 100, 190*time.Millisecond, now), 1e-9)
+
+	// the score never drops to 0
+	require.Equal(t, minConsensusScore, cp.scoreBackend(be, &backendState{latestBlockNumber: 96}, 100, 190*time.Millisecond, now))
+}
+
+func TestConsensusScoredShuffle(t *testing.T) {
+	a := NewBackend("a", "http://localhost", "", nil)
+	b := NewBackend("b", "http://localhost", "", nil)
+	cp := NewConsensusPoller(&BackendGroup{Name: "test", Backends: []*Backend{a, b}}, WithAsyncHandler(NewNoopAsyncHandler()))
+	cp.scores = map[*Backend]float64{a: 0.9, b: 0.1}
+
+	first := make(map[*Backend]int)
+	for i := 0; i < 1000; i++ {
+		backends := []*Backend{a, b}
+		cp.scoredShuffle(backends, false)
+		require.ElementsMatch(t, []*Backend{a, b}, backends)
+		first[backends[0]]++
+	}
+	// a is picked first about 90% of the time, but b still gets traffic
+	require.InDelta(t, 900, first[a], 60)
+	require.Greater(t, first[b], 0)
+}
+
+func TestConsensusScoringMembershipHysteresis(t *testing.T) {
+	for _, scoring := range []bool{true, false} {
+		a := NewBackend("a", "http://localhost", "", nil)
+		b := NewBackend("b", "http://localhost", "", nil)
+		cp := NewConsensusPoller(&BackendGroup{Name: "test", Backends: []*Backend{a, b}},
+			WithAsyncHandler(NewNoopAsyncHandler()), WithMaxBlockLag(4), WithMinPeerCount(0), WithScoring(scoring))
+
+		// poll sets the heads of the backends and updates the consensus group, it returns whether b is in it
+		poll := func(headA, headB hexutil.Uint64) bool {
+			cp.setBackendState(a, 0, true, headA, headA.String(), 0, 0)
+			cp.setBackendState(b, 0, true, headB, headB.String(), 0, 0)
+			candidates := cp.FilterCandidates(cp.backendGroup.Backends)
+			group := make([]*Backend, 0, len(candidates))
+			for be := range candidates {
+				group = append(group, be)
+			}
+			cp.consensusGroup = group
+			return candidates[b] != nil
+		}
+
+		require.True(t, poll(100, 100))
+		// members stay in the group up to the max lag
+		require.True(t, poll(104, 100))
+		require.False(t, poll(105, 100))
+		if scoring {
+			// a backend lagging around the max lag doesn't flap back in
+			require.False(t, poll(105, 101))
+			require.False(t, poll(106, 102))
+			require.False(t, poll(106, 103))
+			require.True(t, poll(106, 104))
+		} else {
+			require.True(t, poll(105, 101))
+		}
+	}
+}
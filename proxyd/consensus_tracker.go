@@ -42,6 +42,13 @@ func (ct *InMemoryConsensusTracker) update(o *ConsensusTrackerState) {
 	ct.state.Finalized = o.Finalized
 }
 
+func (ct *InMemoryConsensusTracker) getState() ConsensusTrackerState {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+
+	return *ct.state
+}
+
 // InMemoryConsensusTracker store and retrieve in memory, async-safe
 type InMemoryConsensusTracker struct {
 	mutex sync.Mutex
@@ -112,6 +119,8 @@ func (ct *InMemoryConsensusTracker) SetFinalizedBlockNumber(blockNumber hexutil.
 // RedisConsensusTracker store and retrieve in a shared Redis cluster, with leader election
 type RedisConsensusTracker struct {
 	ctx          context.Context
+	cancelFunc   context.CancelFunc
+	done         chan struct{}
 	client       redis.UniversalClient
 	namespace    string
 	backendGroup *BackendGroup
@@ -150,8 +159,11 @@ func NewRedisConsensusTracker(ctx context.Context,
 	namespace string,
 	opts ...RedisConsensusTrackerOpt) ConsensusTracker {
 
+	ctx, cancelFunc := context.WithCancel(ctx)
 	tracker := &RedisConsensusTracker{
 		ctx:          ctx,
+		cancelFunc:   cancelFunc,
+		done:         make(chan struct{}),
 		client:       redisClient,
 		backendGroup: bg,
 		namespace:    namespace,
@@ -171,6 +183,7 @@ func NewRedisConsensusTracker(ctx context.Context,
 
 func (ct *RedisConsensusTracker) Init() {
 	go func() {
+		defer close(ct.done)
 		for {
 			timer := time.NewTimer(ct.heartbeatInterval)
 			ct.stateHeartbeat()
@@ -186,6 +199,23 @@ func (ct *RedisConsensusTracker) Init() {
 	}()
 }
 
+// Shutdown stops the heartbeat, gives up the leadership if held and closes the Redis client,
+// so that a retired tracker doesn't keep competing for the lock of its backend group
+func (ct *RedisConsensusTracker) Shutdown() {
+	ct.cancelFunc()
+	<-ct.done
+
+	if ct.leader {
+		if ok, err := ct.redlock.Unlock(); err != nil || !ok {
+			log.Warn("failed to release the lock on shutdown", "err", err)
+		}
+		ct.leader = false
+	}
+	if err := ct.client.Close(); err != nil {
+		log.Warn("error closing consensus tracker redis client", "err", err)
+	}
+}
+
 func (ct *RedisConsensusTracker) stateHeartbeat() {
 	pool := goredis.NewPool(ct.client)
 	rs := redsync.New(pool)
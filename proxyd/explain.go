@@ -0,0 +1,250 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Explanation describes how proxyd handles a call, as far as it can be told from its config.
+// The health of the backends, the consensus and the usage of the rate limits are only known
+// at runtime.
+type Explanation struct {
+	Method string
+	// Answer is why proxyd answers the call itself without forwarding it, empty if it's forwarded
+	Answer string
+	// RateLimits are the limits the call is counted against, per IP or auth key
+	RateLimits []string
+	Cache      string
+	// RoutingRule is the name of the routing rule that matched the call, if any
+	RoutingRule     string
+	BackendGroup    string
+	RoutingStrategy RoutingStrategy
+	// Backends are the candidate backends, in the order of the config
+	Backends []string
+	Notes    []string
+}
+
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "method: %s\n", e.Method)
+	if e.Answer != "" {
+		fmt.Fprintf(&sb, "answered by proxyd: %s\n", e.Answer)
+	}
+	if len(e.RateLimits) > 0 {
+		sb.WriteString("rate limits:\n")
+		for _, lim := range e.RateLimits {
+			fmt.Fprintf(&sb, "  - %s\n", lim)
+		}
+	}
+	if e.Cache != "" {
+		fmt.Fprintf(&sb, "cache: %s\n", e.Cache)
+	}
+	if e.RoutingRule != "" {
+		fmt.Fprintf(&sb, "routing rule: %s\n", e.RoutingRule)
+	}
+	if e.BackendGroup != "" {
+		fmt.Fprintf(&sb, "backend group: %s\n", e.BackendGroup)
+		fmt.Fprintf(&sb, "routing strategy: %s\n", e.RoutingStrategy)
+		fmt.Fprintf(&sb, "backends: %s\n", strings.Join(e.Backends, ", "))
+	}
+	if len(e.Notes) > 0 {
+		sb.WriteString("notes:\n")
+		for _, note := range e.Notes {
+			fmt.Fprintf(&sb, "  - %s\n", note)
+		}
+	}
+	return sb.String()
+}
+
+// Explain tells how a call of method with params, which may be empty, would be handled with
+// config. The config must be valid, see ValidateConfig. Like Start, it resolves the routing
+// strategies of the backend groups in place.
+func Explain(config *Config, method string, params json.RawMessage) (*Explanation, error) {
+	srv, errs := buildDryServer(config)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return srv.explain(method, params), nil
+}
+
+func (s *Server) explain(method string, params json.RawMessage) *Explanation {
+	e := &Explanation{Method: method}
+	req := &RPCReq{JSONRPC: JSONRPCVersion, Method: method, Params: params, ID: json.RawMessage("1")}
+
+	if method == proxydHealthzMethod {
+		e.Answer = "health check, when it is the only call of the request"
+		return e
+	}
+	if err := ValidateRPCReq(req); err != nil {
+		e.Answer = err.Error()
+		return e
+	}
+	if method == "eth_accounts" {
+		e.Answer = "always an empty list"
+		return e
+	}
+
+	var group string
+	for _, rule := range s.routingRules {
+		if rule.minBlockAge > 0 {
+			// the age of the block is only known at runtime
+			static := *rule
+			static.minBlockAge = 0
+			if static.matches(req, s.BackendGroups) {
+				e.Notes = append(e.Notes, fmt.Sprintf("routing rule %s sends the call to %s instead when its block is at least %d blocks behind the head of %s",
+					rule.name, rule.backendGroup, rule.minBlockAge, rule.headBackendGroup))
+			}
+			continue
+		}
+		if rule.matches(req, s.BackendGroups) {
+			e.RoutingRule = rule.name
+			group = rule.backendGroup
+			break
+		}
+	}
+	if group == "" {
+		group = s.rpcMethodMappings[method]
+	}
+	if group == "" {
+		e.Answer = ErrMethodNotWhitelisted.Message
+		return e
+	}
+
+	e.RateLimits = s.explainRateLimits(req)
+	e.Notes = append(e.Notes, s.explainAPIKeys(method)...)
+	if method == "eth_sendRawTransaction" {
+		if s.txPolicy != nil {
+			e.Notes = append(e.Notes, "the transaction is checked by the tx policy before it is forwarded")
+		}
+		if s.senderLim != nil {
+			e.RateLimits = append(e.RateLimits, fmt.Sprintf("sender rate limit: %d transactions per %s per sender",
+				s.config.SenderRateLimit.Limit, time.Duration(s.config.SenderRateLimit.Interval)))
+		}
+	}
+	e.Cache = s.explainCache(req)
+
+	bg := s.BackendGroups[group]
+	e.BackendGroup = group
+	e.RoutingStrategy = bg.routingStrategy
+	for _, be := range bg.Backends {
+		name := be.Name
+		if bg.FallbackBackends[be.Name] {
+			name += " (fallback)"
+		}
+		if bg.WeightedRouting {
+			name += fmt.Sprintf(" (weight %d)", be.weight)
+		}
+		e.Backends = append(e.Backends, name)
+	}
+	e.Notes = append(e.Notes, explainBackendGroup(bg, s.config.BackendGroups[group], req)...)
+	return e
+}
+
+func (s *Server) explainRateLimits(req *RPCReq) []string {
+	cfg := s.config.RateLimit
+	var lims []string
+	exempt := ""
+	if !s.frontendLims.isGlobalLimit(req.Method) && (len(cfg.ExemptOrigins) > 0 || len(cfg.ExemptUserAgents) > 0) {
+		exempt = ", except for the exempt origins and user agents"
+	}
+	if cfg.BaseRate > 0 {
+		lims = append(lims, fmt.Sprintf("base rate limit: %d calls per %s (%s)%s",
+			cfg.BaseRate, time.Duration(cfg.BaseInterval), rateLimitAlgorithmName(cfg.BaseAlgorithm), exempt))
+	}
+	if override := cfg.MethodOverrides[req.Method]; override != nil {
+		lims = append(lims, fmt.Sprintf("method rate limit: %d calls per %s (%s)%s",
+			override.Limit, time.Duration(override.Interval), rateLimitAlgorithmName(override.Algorithm), exempt))
+	}
+	if cu := s.frontendLims.computeUnits; cu != nil {
+		interval := time.Duration(cfg.ComputeUnits.Interval)
+		if interval == 0 {
+			interval = defaultComputeUnitsInterval
+		}
+		lims = append(lims, fmt.Sprintf("compute units: costs %d of a budget of %d per %s%s",
+			cu.cost(req, nil), cfg.ComputeUnits.Budget, interval, exempt))
+	}
+	return lims
+}
+
+func rateLimitAlgorithmName(algorithm string) string {
+	if algorithm == "" {
+		return FixedWindowRateLimitAlgorithm
+	}
+	return algorithm
+}
+
+func (s *Server) explainAPIKeys(method string) []string {
+	var notes []string
+	for _, name := range sortedKeys(s.config.APIKeys.Keys) {
+		key := s.config.APIKeys.Keys[name]
+		if len(key.AllowedMethods) > 0 && !NewStringSetFromStrings(key.AllowedMethods).Has(method) {
+			notes = append(notes, fmt.Sprintf("api key %s is not allowed to call %s", name, method))
+		} else if key.BackendGroup != "" {
+			notes = append(notes, fmt.Sprintf("the calls of api key %s go to backend group %s", name, key.BackendGroup))
+		}
+	}
+	for _, name := range sortedKeys(s.config.JWTAuth.Policies) {
+		policy := s.config.JWTAuth.Policies[name]
+		if len(policy.AllowedMethods) > 0 && !NewStringSetFromStrings(policy.AllowedMethods).Has(method) {
+			notes = append(notes, fmt.Sprintf("jwt policy %s is not allowed to call %s", name, method))
+		} else if policy.BackendGroup != "" {
+			notes = append(notes, fmt.Sprintf("the calls of jwt policy %s go to backend group %s", name, policy.BackendGroup))
+		}
+	}
+	return notes
+}
+
+func (s *Server) explainCache(req *RPCReq) string {
+	cache, ok := s.cache.(*rpcCache)
+	if !ok {
+		return "disabled"
+	}
+	switch handler := cache.handlers[req.Method].(type) {
+	case *StaticMethodHandler:
+		if handler.filterGet != nil && !handler.filterGet(req) {
+			return "not cached with these params"
+		}
+		return "cached"
+	case *FinalizedBlockMethodHandler:
+		return "cached when the block is at or below the finalized block of the backend group"
+	default:
+		return "not cached"
+	}
+}
+
+func explainBackendGroup(bg *BackendGroup, bgcfg *BackendGroupConfig, req *RPCReq) []string {
+	var notes []string
+	reqs := []*RPCReq{req}
+	switch {
+	case bg.routingStrategy == ConsensusAwareRoutingStrategy:
+		notes = append(notes, "only the backends in consensus are candidates, and block tags are rewritten to the consensus blocks")
+		if bgcfg.ConsensusScoring {
+			notes = append(notes, "the traffic is weighted by the score of the backends")
+		}
+	case bg.routingStrategy == MulticallRoutingStrategy && isValidMulticallTx(reqs):
+		notes = append(notes, "sent to every backend, the first successful response is returned")
+	case bg.canQuorum(reqs):
+		notes = append(notes, fmt.Sprintf("sent to %d backends, %d of them must return the same result", bg.quorumSize, bg.quorumThreshold))
+	}
+	if bg.rankingStrategy != "" {
+		notes = append(notes, fmt.Sprintf("the healthy backends are ranked by %s", bg.rankingStrategy))
+	} else if bg.WeightedRouting {
+		notes = append(notes, "the healthy backends are shuffled by weight")
+	}
+	if bg.canHedge(reqs) {
+		notes = append(notes, "hedged to the next backend when the first one is slow to answer")
+	}
+	if req.Method == "eth_getLogs" && bg.getLogsSplitRange > 0 {
+		notes = append(notes, fmt.Sprintf("split into ranges of %d blocks fetched in parallel", bg.getLogsSplitRange))
+	}
+	if bgcfg.StickySessionKey != "" {
+		notes = append(notes, fmt.Sprintf("clients are pinned to the backend that last served them, by %s", bgcfg.StickySessionKey))
+	}
+	if bgcfg.HealthCheckInterval > 0 {
+		notes = append(notes, fmt.Sprintf("the backends are health checked every %s", time.Duration(bgcfg.HealthCheckInterval)))
+	}
+	return notes
+}
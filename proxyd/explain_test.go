@@ -0,0 +1,92 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const explainTestConfig = `
+[backends.a]
+rpc_url = "http://a"
+[backends.b]
+rpc_url = "http://b"
+[backends.archive]
+rpc_url = "http://archive"
+
+[backend_groups.main]
+backends = ["a", "b"]
+routing_strategy = "quorum"
+quorum_methods = ["eth_call"]
+hedge_delay = "100ms"
+hedge_methods = ["eth_getBalance"]
+[backend_groups.archive]
+backends = ["archive"]
+
+[rpc_method_mappings]
+eth_call = "main"
+eth_getBalance = "main"
+eth_getBlockByHash = "main"
+debug_getRawReceipts = "main"
+
+[[routing_rules]]
+name = "archive"
+methods = ["eth_getBalance"]
+block_tags = ["earliest"]
+backend_group = "archive"
+
+[rate_limit]
+base_rate = 10
+base_interval = "1s"
+exempt_origins = ["foo"]
+[rate_limit.method_overrides.eth_call]
+limit = 2
+interval = "1s"
+algorithm = "token_bucket"
+global = true
+
+[cache]
+enabled = true
+`
+
+func TestExplain(t *testing.T) {
+	explain := func(method string, params string) *Explanation {
+		e, err := Explain(decodeTestConfig(t, explainTestConfig), method, json.RawMessage(params))
+		require.NoError(t, err)
+		return e
+	}
+
+	e := explain("eth_call", `[{}, "latest"]`)
+	require.Empty(t, e.Answer)
+	require.Equal(t, []string{
+		"base rate limit: 10 calls per 1s (fixed_window)",
+		"method rate limit: 2 calls per 1s (token_bucket)",
+	}, e.RateLimits)
+	require.Equal(t, "not cached", e.Cache)
+	require.Equal(t, "main", e.BackendGroup)
+	require.Equal(t, QuorumRoutingStrategy, e.RoutingStrategy)
+	require.Equal(t, []string{"a", "b"}, e.Backends)
+	require.Equal(t, []string{"sent to 2 backends, 2 of them must return the same result"}, e.Notes)
+
+	e = explain("eth_getBalance", `["0x0", "latest"]`)
+	require.Empty(t, e.RoutingRule)
+	require.Equal(t, []string{"base rate limit: 10 calls per 1s (fixed_window), except for the exempt origins and user agents"}, e.RateLimits)
+	require.Equal(t, []string{"hedged to the next backend when the first one is slow to answer"}, e.Notes)
+
+	e = explain("eth_getBalance", `["0x0", "earliest"]`)
+	require.Equal(t, "archive", e.RoutingRule)
+	require.Equal(t, "archive", e.BackendGroup)
+	require.Equal(t, FallbackRoutingStrategy, e.RoutingStrategy)
+	require.Equal(t, []string{"archive"}, e.Backends)
+
+	require.Equal(t, "cached", explain("eth_getBlockByHash", `["0x1", false]`).Cache)
+	require.Equal(t, "not cached with these params", explain("debug_getRawReceipts", `["latest"]`).Cache)
+
+	e = explain("eth_sendRawTransaction", `["0x00"]`)
+	require.Equal(t, ErrMethodNotWhitelisted.Message, e.Answer)
+	require.Empty(t, e.BackendGroup)
+
+	_, err := Explain(decodeTestConfig(t, `[backends.a]`), "eth_call", nil)
+	require.ErrorContains(t, err, "must define at least one backend group")
+}
@@ -2,6 +2,7 @@ package proxyd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -20,6 +21,18 @@ type FrontendRateLimiter interface {
 	Take(ctx context.Context, key string) (bool, error)
 }
 
+// WeightedFrontendRateLimiter is a FrontendRateLimiter that can
+// consume several units of a key at once.
+type WeightedFrontendRateLimiter interface {
+	FrontendRateLimiter
+
+	// TakeN consumes n units of a key. It returns a boolean denoting
+	// if the units could be taken, and the number of units left to
+	// the key in the current time interval. Units that could not be
+	// taken are not consumed.
+	TakeN(ctx context.Context, key string, n int) (bool, int, error)
+}
+
 // limitedKeys is a wrapper around a map that stores a truncated
 // timestamp and a mutex. The map is used to keep track of rate
 // limit keys, and their used limits.
@@ -48,6 +61,17 @@ func (l *limitedKeys) Take(key string, max int) bool {
 	return val < max
 }
 
+func (l *limitedKeys) TakeN(key string, n int, max int) (bool, int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	val := l.keys[key]
+	if val+n > max {
+		return false, remainingUnits(max, val)
+	}
+	l.keys[key] = val + n
+	return true, remainingUnits(max, val+n)
+}
+
 // MemoryFrontendRateLimiter is a rate limiter that stores
 // all rate limiting information in local memory. It works
 // by storing a limitedKeys struct that references the
@@ -71,6 +95,15 @@ func NewMemoryFrontendRateLimit(dur time.Duration, max int) FrontendRateLimiter
 }
 
 func (m *MemoryFrontendRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	return m.generation().Take(key, m.max), nil
+}
+
+func (m *MemoryFrontendRateLimiter) TakeN(ctx context.Context, key string, n int) (bool, int, error) {
+	ok, remaining := m.generation().TakeN(key, n, m.max)
+	return ok, remaining, nil
+}
+
+func (m *MemoryFrontendRateLimiter) generation() *limitedKeys {
 	m.mtx.Lock()
 	// Create truncated timestamp
 	truncTS := truncateNow(m.dur)
@@ -86,7 +119,7 @@ func (m *MemoryFrontendRateLimiter) Take(ctx context.Context, key string) (bool,
 
 	m.mtx.Unlock()
 
-	return limiter.Take(key, m.max), nil
+	return limiter
 }
 
 // RedisFrontendRateLimiter is a rate limiter that stores data in Redis.
@@ -125,6 +158,31 @@ func (r *RedisFrontendRateLimiter) Take(ctx context.Context, key string) (bool,
 	return incr.Val()-1 < int64(r.max), nil
 }
 
+func (r *RedisFrontendRateLimiter) TakeN(ctx context.Context, key string, n int) (bool, int, error) {
+	var incr *redis.IntCmd
+	truncTS := truncateNow(r.dur)
+	fullKey := fmt.Sprintf("rate_limit:%s:%s:%d", r.prefix, key, truncTS)
+	_, err := r.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, fullKey, int64(n))
+		pipe.PExpire(ctx, fullKey, r.dur-time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		frontendRateLimitTakeErrors.Inc()
+		return false, 0, err
+	}
+
+	used := int(incr.Val())
+	if used > r.max {
+		// give the units back so that a rejected call doesn't use up the budget
+		if err := r.r.DecrBy(ctx, fullKey, int64(n)).Err(); err != nil {
+			frontendRateLimitTakeErrors.Inc()
+		}
+		return false, remainingUnits(r.max, used-n), nil
+	}
+	return true, remainingUnits(r.max, used), nil
+}
+
 type noopFrontendRateLimiter struct{}
 
 var NoopFrontendRateLimiter = &noopFrontendRateLimiter{}
@@ -133,6 +191,13 @@ func (n *noopFrontendRateLimiter) Take(ctx context.Context, key string) (bool, e
 	return true, nil
 }
 
+func remainingUnits(max int, used int) int {
+	if used >= max {
+		return 0
+	}
+	return max - used
+}
+
 // truncateNow truncates the current timestamp
 // to the specified duration.
 func truncateNow(dur time.Duration) int64 {
@@ -162,3 +227,19 @@ func (r *FallbackRateLimiter) Take(ctx context.Context, key string) (bool, error
 		return ok, err
 	}
 }
+
+func (r *FallbackRateLimiter) TakeN(ctx context.Context, key string, n int) (bool, int, error) {
+	primary, ok := r.primary.(WeightedFrontendRateLimiter)
+	if !ok {
+		return false, 0, errors.New("primary rate limiter does not support weighted limits")
+	}
+	secondary, ok := r.secondary.(WeightedFrontendRateLimiter)
+	if !ok {
+		return false, 0, errors.New("secondary rate limiter does not support weighted limits")
+	}
+	if ok, remaining, err := primary.TakeN(ctx, key, n); err != nil {
+		return secondary.TakeN(ctx, key, n)
+	} else {
+		return ok, remaining, err
+	}
+}
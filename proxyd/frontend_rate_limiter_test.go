@@ -84,3 +84,52 @@ func TestFallbackRateLimiter(t *testing.T) {
 		require.False(t, ok)
 	}
 }
+
+func TestWeightedFrontendRateLimiter(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("127.0.0.1:%s", redisServer.Port()),
+	})
+
+	lims := []struct {
+		name string
+		frl  WeightedFrontendRateLimiter
+	}{
+		{"memory", NewMemoryFrontendRateLimit(time.Hour, 10).(WeightedFrontendRateLimiter)},
+		{"redis", NewRedisFrontendRateLimiter(redisClient, time.Hour, 10, "weighted").(WeightedFrontendRateLimiter)},
+		{"fallback", NewFallbackRateLimiter(
+			NewRedisFrontendRateLimiter(redisClient, time.Hour, 10, "fallback"),
+			NewMemoryFrontendRateLimit(time.Hour, 10),
+		).(WeightedFrontendRateLimiter)},
+	}
+
+	for _, cfg := range lims {
+		frl := cfg.frl
+		ctx := context.Background()
+		t.Run(cfg.name, func(t *testing.T) {
+			ok, remaining, err := frl.TakeN(ctx, "foo", 6)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, 4, remaining)
+
+			// rejected units are not consumed
+			ok, remaining, err = frl.TakeN(ctx, "foo", 5)
+			require.NoError(t, err)
+			require.False(t, ok)
+			require.Equal(t, 4, remaining)
+
+			ok, remaining, err = frl.TakeN(ctx, "foo", 4)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, 0, remaining)
+
+			ok, remaining, err = frl.TakeN(ctx, "bar", 10)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, 0, remaining)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultGetLogsSplitConcurrency = 4
+	defaultGetLogsSplitMaxChunks   = 100
+	defaultGetLogsMaxResults       = 10000
+)
+
+// ErrGetLogsTooManyResults uses the limit exceeded code of EIP-1474, which
+// clients commonly handle by querying smaller ranges
+func ErrGetLogsTooManyResults(max int) *RPCErr {
+	return &RPCErr{
+		Code:    -32005,
+		Message: fmt.Sprintf("query returned more than %d results", max),
+	}
+}
+
+type getLogsSplit struct {
+	index  int
+	req    *RPCReq
+	filter map[string]interface{}
+	chunks [][2]uint64
+}
+
+// getLogsSplitChunks returns the block ranges to fetch an eth_getLogs call in, or
+// false if the call doesn't need to be split. The total range of a split call is only
+// bounded by get_logs_split_max_chunks, consensus_max_block_range applies to the chunks.
+// The chunks are nil if there would be more than get_logs_split_max_chunks of them.
+func (bg *BackendGroup) getLogsSplitChunks(req *RPCReq) (map[string]interface{}, [][2]uint64, bool) {
+	if req.Method != "eth_getLogs" {
+		return nil, nil, false
+	}
+	var p []map[string]interface{}
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+		return nil, nil, false
+	}
+	if _, ok := p[0]["blockHash"]; ok {
+		return nil, nil, false
+	}
+
+	from, to := "latest", "latest"
+	if v, ok := p[0]["fromBlock"]; ok {
+		if from, ok = v.(string); !ok {
+			return nil, nil, false
+		}
+	}
+	if v, ok := p[0]["toBlock"]; ok {
+		if to, ok = v.(string); !ok {
+			return nil, nil, false
+		}
+	}
+	fromBlock, ok := resolveBlockTag(from, bg.Consensus)
+	if !ok {
+		return nil, nil, false
+	}
+	toBlock, ok := resolveBlockTag(to, bg.Consensus)
+	if !ok || toBlock < fromBlock || toBlock-fromBlock < bg.getLogsSplitRange {
+		return nil, nil, false
+	}
+	// ranges past the consensus block are rejected by the rewrite as usual
+	if bg.Consensus != nil && toBlock > uint64(bg.Consensus.GetLatestBlockNumber()) {
+		return nil, nil, false
+	}
+
+	if (toBlock-fromBlock)/bg.getLogsSplitRange >= uint64(bg.getLogsSplitMaxChunks) {
+		return p[0], nil, true
+	}
+	var chunks [][2]uint64
+	for start := fromBlock; start <= toBlock; start += bg.getLogsSplitRange {
+		end := start + bg.getLogsSplitRange - 1
+		if end > toBlock || end < start {
+			end = toBlock
+		}
+		chunks = append(chunks, [2]uint64{start, end})
+		if end == toBlock {
+			break
+		}
+	}
+	return p[0], chunks, true
+}
+
+// forwardSplitLogs serves the eth_getLogs calls over more blocks than get_logs_split_range
+// by fetching their range in chunks, and forwards the other calls as usual. It returns
+// false if there is no call to split.
+func (bg *BackendGroup) forwardSplitLogs(ctx context.Context, rpcReqs []*RPCReq, isBatch bool) ([]*RPCRes, string, bool, error) {
+	var splits []getLogsSplit
+	rest := make([]*RPCReq, 0, len(rpcReqs))
+	restIndexes := make([]int, 0, len(rpcReqs))
+	for i, req := range rpcReqs {
+		if filter, chunks, ok := bg.getLogsSplitChunks(req); ok {
+			splits = append(splits, getLogsSplit{index: i, req: req, filter: filter, chunks: chunks})
+			continue
+		}
+		rest = append(rest, req)
+		restIndexes = append(restIndexes, i)
+	}
+	if len(splits) == 0 {
+		return nil, "", false, nil
+	}
+
+	res := make([]*RPCRes, len(rpcReqs))
+	servedBy := make(map[string]bool)
+	if len(rest) > 0 {
+		restRes, sb, err := bg.forward(ctx, rest, isBatch)
+		if err != nil {
+			return nil, "", true, err
+		}
+		for i, r := range restRes {
+			res[restIndexes[i]] = r
+		}
+		servedBy[sb] = true
+	}
+	for _, split := range splits {
+		res[split.index] = bg.splitLogs(ctx, split, servedBy)
+	}
+
+	servedByNames := make([]string, 0, len(servedBy))
+	for sb := range servedBy {
+		if sb != "" {
+			servedByNames = append(servedByNames, sb)
+		}
+	}
+	return res, strings.Join(servedByNames, ", "), true, nil
+}
+
+// splitLogs fetches the chunks of a call in parallel and merges their logs in block order
+func (bg *BackendGroup) splitLogs(ctx context.Context, split getLogsSplit, servedBy map[string]bool) *RPCRes {
+	if split.chunks == nil {
+		return NewRPCErrorRes(split.req.ID, ErrInvalidParams(
+			fmt.Sprintf("block range greater than %d max", bg.getLogsSplitRange*uint64(bg.getLogsSplitMaxChunks)),
+		))
+	}
+
+	results := make([][]interface{}, len(split.chunks))
+	chunkServedBy := make([]string, len(split.chunks))
+	var total atomic.Int64
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(bg.getLogsSplitConcurrency)
+	for i, chunk := range split.chunks {
+		i, chunk := i, chunk
+		g.Go(func() error {
+			filter := make(map[string]interface{}, len(split.filter))
+			for k, v := range split.filter {
+				filter[k] = v
+			}
+			filter["fromBlock"] = hexutil.Uint64(chunk[0]).String()
+			filter["toBlock"] = hexutil.Uint64(chunk[1]).String()
+			chunkReq := &RPCReq{
+				JSONRPC: split.req.JSONRPC,
+				Method:  split.req.Method,
+				Params:  mustMarshalJSON([]interface{}{filter}),
+				ID:      split.req.ID,
+			}
+
+			res, sb, err := bg.forward(gctx, []*RPCReq{chunkReq}, false)
+			if err != nil {
+				return err
+			}
+			if len(res) != 1 {
+				return ErrBackendUnexpectedJSONRPC
+			}
+			if res[0].IsError() {
+				return res[0].Error
+			}
+			logs, ok := res[0].Result.([]interface{})
+			if !ok && res[0].Result != nil {
+				return ErrBackendBadResponse
+			}
+			if total.Add(int64(len(logs))) > int64(bg.getLogsMaxResults) {
+				return ErrGetLogsTooManyResults(bg.getLogsMaxResults)
+			}
+			results[i] = logs
+			chunkServedBy[i] = sb
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		log.Debug(
+			"error fetching split eth_getLogs",
+			"backend_group", bg.Name,
+			"req_id", GetReqID(ctx),
+			"chunks", len(split.chunks),
+			"err", err,
+		)
+		RecordGetLogsSplit(bg, len(split.chunks), false)
+		return NewRPCErrorRes(split.req.ID, err)
+	}
+
+	merged := make([]interface{}, 0, total.Load())
+	for _, logs := range results {
+		merged = append(merged, logs...)
+	}
+	for _, sb := range chunkServedBy {
+		servedBy[sb] = true
+	}
+	RecordGetLogsSplit(bg, len(split.chunks), true)
+	return NewRPCRes(split.req.ID, merged)
+}
@@ -0,0 +1,50 @@
+package proxyd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLogsSplitChunks(t *testing.T) {
+	bg := &BackendGroup{
+		getLogsSplitRange:     10,
+		getLogsSplitMaxChunks: 3,
+	}
+
+	tests := []struct {
+		name   string
+		params string
+		split  bool
+		chunks [][2]uint64
+	}{
+		{"within the split range", `[{"fromBlock":"0x0","toBlock":"0x9"}]`, false, nil},
+		{"reversed range", `[{"fromBlock":"0x20","toBlock":"0x0"}]`, false, nil},
+		{"block hash", `[{"blockHash":"0x1234"}]`, false, nil},
+		{"tags need consensus", `[{"fromBlock":"0x0","toBlock":"latest"}]`, false, nil},
+		{"uneven split", `[{"fromBlock":"0x5","toBlock":"0x1b"}]`, true, [][2]uint64{{5, 14}, {15, 24}, {25, 27}}},
+		{"even split", `[{"fromBlock":"earliest","toBlock":"0x1d"}]`, true, [][2]uint64{{0, 9}, {10, 19}, {20, 29}}},
+		{"too many chunks", `[{"fromBlock":"0x0","toBlock":"0x1e"}]`, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, chunks, split := bg.getLogsSplitChunks(&RPCReq{Method: "eth_getLogs", Params: []byte(tt.params)})
+			require.Equal(t, tt.split, split)
+			require.Equal(t, tt.chunks, chunks)
+		})
+	}
+
+	t.Run("ranges over consensus_max_block_range are split", func(t *testing.T) {
+		bg.Consensus = &ConsensusPoller{tracker: NewInMemoryConsensusTracker(), maxBlockRange: 9}
+		bg.Consensus.tracker.SetLatestBlockNumber(0x1d)
+		defer func() { bg.Consensus = nil }()
+
+		_, chunks, split := bg.getLogsSplitChunks(&RPCReq{Method: "eth_getLogs", Params: []byte(`[{"fromBlock":"0x0","toBlock":"latest"}]`)})
+		require.True(t, split)
+		require.Equal(t, [][2]uint64{{0, 9}, {10, 19}, {20, 29}}, chunks)
+
+		// past the consensus block, the call gets the usual error
+		_, _, split = bg.getLogsSplitChunks(&RPCReq{Method: "eth_getLogs", Params: []byte(`[{"fromBlock":"0x0","toBlock":"0x1e"}]`)})
+		require.False(t, split)
+	})
+}
@@ -0,0 +1,210 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const DefaultHealthCheckMethod = "eth_blockNumber"
+
+// HealthChecker periodically calls a method on every backend of a group that isn't consensus
+// aware, and marks the backends that fail it, lag behind their peers or answer too slowly as
+// unhealthy, so that they are tried last
+type HealthChecker struct {
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+
+	backendGroup *BackendGroup
+	method       string
+	interval     time.Duration
+	maxBlockLag  uint64
+	maxLatency   time.Duration
+
+	statesMtx sync.RWMutex
+	states    map[*Backend]*healthCheckState
+}
+
+type healthCheckState struct {
+	Healthy     bool
+	Reason      string
+	BlockNumber uint64
+	Latency     time.Duration
+	LastCheck   time.Time
+}
+
+type HealthCheckerConfig struct {
+	Method string
+	// Interval between checks, each check times out after the interval
+	Interval time.Duration
+	// MaxBlockLag is the number of blocks a backend can be behind the highest one, it
+	// requires the eth_blockNumber method
+	MaxBlockLag uint64
+	MaxLatency  time.Duration
+}
+
+func NewHealthChecker(bg *BackendGroup, cfg HealthCheckerConfig) *HealthChecker {
+	if cfg.Method == "" {
+		cfg.Method = DefaultHealthCheckMethod
+	}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	return &HealthChecker{
+		ctx:          ctx,
+		cancelFunc:   cancelFunc,
+		done:         make(chan struct{}),
+		backendGroup: bg,
+		method:       cfg.Method,
+		interval:     cfg.Interval,
+		maxBlockLag:  cfg.MaxBlockLag,
+		maxLatency:   cfg.MaxLatency,
+		states:       make(map[*Backend]*healthCheckState),
+	}
+}
+
+// Start checks the backends right away, then every interval
+func (hc *HealthChecker) Start() {
+	go func() {
+		defer close(hc.done)
+		ticker := time.NewTicker(hc.interval)
+		defer ticker.Stop()
+		for {
+			hc.CheckBackends(hc.ctx)
+			select {
+			case <-ticker.C:
+			case <-hc.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (hc *HealthChecker) Shutdown() {
+	hc.cancelFunc()
+	<-hc.done
+}
+
+// IsHealthy returns false if the backend failed its last check. Backends that weren't
+// checked yet, or groups without health checks, are healthy.
+func (hc *HealthChecker) IsHealthy(be *Backend) bool {
+	if hc == nil {
+		return true
+	}
+	hc.statesMtx.RLock()
+	defer hc.statesMtx.RUnlock()
+	state, ok := hc.states[be]
+	return !ok || state.Healthy
+}
+
+// GetState returns the result of the last check of the backend, if any
+func (hc *HealthChecker) GetState(be *Backend) (healthCheckState, bool) {
+	hc.statesMtx.RLock()
+	defer hc.statesMtx.RUnlock()
+	state, ok := hc.states[be]
+	if !ok {
+		return healthCheckState{}, false
+	}
+	return *state, true
+}
+
+// CheckBackends checks all the backends of the group in parallel, and updates their state
+// once they all answered, so that the block lag is computed against the same round
+func (hc *HealthChecker) CheckBackends(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, hc.interval)
+	defer cancel()
+
+	states := make([]*healthCheckState, len(hc.backendGroup.Backends))
+	var wg sync.WaitGroup
+	for i, be := range hc.backendGroup.Backends {
+		wg.Add(1)
+		go func(i int, be *Backend) {
+			defer wg.Done()
+			states[i] = hc.checkBackend(ctx, be)
+		}(i, be)
+	}
+	wg.Wait()
+	if hc.ctx.Err() != nil {
+		// shutting down
+		return
+	}
+
+	var highestBlock uint64
+	for _, state := range states {
+		if state.Healthy {
+			highestBlock = max(highestBlock, state.BlockNumber)
+		}
+	}
+	if hc.maxBlockLag > 0 {
+		for _, state := range states {
+			if state.Healthy && highestBlock-state.BlockNumber > hc.maxBlockLag {
+				state.Healthy = false
+				state.Reason = fmt.Sprintf("block %d is more than %d blocks behind %d", state.BlockNumber, hc.maxBlockLag, highestBlock)
+			}
+		}
+	}
+
+	hc.statesMtx.Lock()
+	defer hc.statesMtx.Unlock()
+	for i, be := range hc.backendGroup.Backends {
+		state := states[i]
+		prev, ok := hc.states[be]
+		if state.Healthy && ok && !prev.Healthy {
+			log.Info("backend passed health check", "backend_group", hc.backendGroup.Name, "backend", be.Name)
+		}
+		if !state.Healthy {
+			if !ok || prev.Healthy {
+				log.Warn("backend failed health check",
+					"backend_group", hc.backendGroup.Name,
+					"backend", be.Name,
+					"method", hc.method,
+					"reason", state.Reason,
+				)
+			}
+			RecordBackendHealthCheckFailure(hc.backendGroup, be)
+		}
+		RecordBackendHealthCheck(hc.backendGroup, be, state.Healthy, state.Latency)
+		hc.states[be] = state
+	}
+}
+
+func (hc *HealthChecker) checkBackend(ctx context.Context, be *Backend) *healthCheckState {
+	state := &healthCheckState{LastCheck: time.Now()}
+	var res RPCRes
+	start := time.Now()
+	err := be.ForwardRPC(ctx, &res, "67", hc.method)
+	state.Latency = time.Since(start)
+	if err != nil {
+		state.Reason = fmt.Sprintf("%s failed: %s", hc.method, err)
+		return state
+	}
+	if hc.maxLatency > 0 && state.Latency > hc.maxLatency {
+		state.Reason = fmt.Sprintf("latency %s is over %s", state.Latency.Round(time.Millisecond), hc.maxLatency)
+		return state
+	}
+
+	switch hc.method {
+	case "eth_blockNumber":
+		s, ok := res.Result.(string)
+		if !ok {
+			state.Reason = "unexpected response to eth_blockNumber"
+			return state
+		}
+		blockNumber, err := hexutil.DecodeUint64(s)
+		if err != nil {
+			state.Reason = "unexpected response to eth_blockNumber"
+			return state
+		}
+		state.BlockNumber = blockNumber
+	case "eth_syncing":
+		if syncing, ok := res.Result.(bool); !ok || syncing {
+			state.Reason = "backend is syncing"
+			return state
+		}
+	}
+	state.Healthy = true
+	return state
+}
@@ -0,0 +1,224 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// errHedgeLost cancels the request that lost a hedging race,
+// failures caused by it are not held against the backend
+var errHedgeLost = errors.New("another backend answered first")
+
+// idempotentReadMethods are the methods that can be sent to several backends at once, by
+// hedging, quorum reads and health checks. Hedging uses all of them when hedge_methods is
+// not set. Any other method is never sent twice.
+var idempotentReadMethods = []string{
+	"eth_blockNumber",
+	"eth_call",
+	"eth_chainId",
+	"eth_estimateGas",
+	"eth_feeHistory",
+	"eth_gasPrice",
+	"eth_getBalance",
+	"eth_getBlockByHash",
+	"eth_getBlockByNumber",
+	"eth_getBlockReceipts",
+	"eth_getBlockTransactionCountByHash",
+	"eth_getBlockTransactionCountByNumber",
+	"eth_getCode",
+	"eth_getLogs",
+	"eth_getProof",
+	"eth_getStorageAt",
+	"eth_getTransactionByBlockHashAndIndex",
+	"eth_getTransactionByBlockNumberAndIndex",
+	"eth_getTransactionByHash",
+	"eth_getTransactionCount",
+	"eth_getTransactionReceipt",
+	"eth_getUncleByBlockHashAndIndex",
+	"eth_getUncleByBlockNumberAndIndex",
+	"eth_getUncleCountByBlockHash",
+	"eth_getUncleCountByBlockNumber",
+	"eth_maxPriorityFeePerGas",
+	"eth_syncing",
+	"net_version",
+	"web3_clientVersion",
+	"debug_getRawReceipts",
+	"consensus_getReceipts",
+}
+
+var idempotentReadMethodSet = NewStringSetFromStrings(idempotentReadMethods)
+
+// buildHedgeMethods returns the methods hedged by a backend group, or nil if hedging is disabled
+func buildHedgeMethods(bgName string, bg *BackendGroupConfig) (*StringSet, error) {
+	if bg.HedgeDelay == 0 && bg.HedgeLatencyPercentile == 0 {
+		return nil, nil
+	}
+	if bg.HedgeLatencyPercentile < 0 || bg.HedgeLatencyPercentile > 1 {
+		return nil, fmt.Errorf("hedge_latency_percentile must be between 0 and 1 for backend group %s", bgName)
+	}
+	if len(bg.HedgeMethods) == 0 {
+		return idempotentReadMethodSet, nil
+	}
+	for _, method := range bg.HedgeMethods {
+		if !idempotentReadMethodSet.Has(method) {
+			return nil, fmt.Errorf("method %s cannot be hedged in backend group %s, only idempotent reads can", method, bgName)
+		}
+	}
+	return NewStringSetFromStrings(bg.HedgeMethods), nil
+}
+
+// lostHedge checks if the request was cancelled because another backend answered first
+func lostHedge(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errHedgeLost)
+}
+
+func (bg *BackendGroup) canHedge(rpcReqs []*RPCReq) bool {
+	if bg.hedgeMethods == nil {
+		return false
+	}
+	for _, req := range rpcReqs {
+		if !bg.hedgeMethods.Has(req.Method) {
+			return false
+		}
+	}
+	return true
+}
+
+// hedgeDelayFor returns how long to wait for a backend before hedging
+func (bg *BackendGroup) hedgeDelayFor(be *Backend) time.Duration {
+	if bg.hedgeLatencyPercentile > 0 {
+		if delay, ok := be.LatencyPercentile(bg.hedgeLatencyPercentile); ok {
+			return delay
+		}
+	}
+	return bg.hedgeDelay
+}
+
+type hedgeResult struct {
+	resp  *BackendGroupRPCResponse
+	hedge bool
+}
+
+// ForwardHedged forwards the requests like ForwardRequestToBackendGroup, but if the first backend
+// hasn't answered within the hedge delay, a copy is sent to the next backend. The first successful
+// response is returned, and the other request is cancelled. The hedge backend is left out of the
+// backends the primary request fails over to, so that it never gets the same request twice.
+func (bg *BackendGroup) ForwardHedged(
+	rpcReqs []*RPCReq,
+	backends []*Backend,
+	ctx context.Context,
+	isBatch bool,
+) *BackendGroupRPCResponse {
+	if len(backends) < 2 {
+		return bg.ForwardRequestToBackendGroup(rpcReqs, backends, ctx, isBatch)
+	}
+	delay := bg.hedgeDelayFor(backends[0])
+	if delay <= 0 {
+		return bg.ForwardRequestToBackendGroup(rpcReqs, backends, ctx, isBatch)
+	}
+
+	// requests are rewritten while being forwarded, so the hedge needs its own copy
+	hedgeReqs := make([]*RPCReq, len(rpcReqs))
+	for i, req := range rpcReqs {
+		reqCopy := *req
+		hedgeReqs[i] = &reqCopy
+	}
+	hedgeBackend := backends[1]
+	primaries := append([]*Backend{backends[0]}, backends[2:]...)
+
+	results := make(chan hedgeResult, 2)
+	primaryCtx, cancelPrimary := context.WithCancelCause(ctx)
+	defer cancelPrimary(errHedgeLost)
+	go func() {
+		results <- hedgeResult{resp: bg.ForwardRequestToBackendGroup(rpcReqs, primaries, primaryCtx, isBatch)}
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case res := <-results:
+		if res.resp.error == nil {
+			return res.resp
+		}
+		// the primaries failed before the hedge delay, fail over to the hedge backend
+		return bg.ForwardRequestToBackendGroup(hedgeReqs, []*Backend{hedgeBackend}, ctx, isBatch)
+	case <-timer.C:
+	}
+
+	log.Debug("hedging slow request",
+		"req_id", GetReqID(ctx),
+		"auth", GetAuthCtx(ctx),
+		"backend_group", bg.Name,
+		"backend", backends[0].Name,
+		"hedge_backend", hedgeBackend.Name,
+		"delay", delay,
+	)
+	RecordBackendGroupHedge(bg, hedgeBackend.Name)
+
+	hedgeCtx, cancelHedge := context.WithCancelCause(ctx)
+	defer cancelHedge(errHedgeLost)
+	go func() {
+		results <- hedgeResult{
+			resp:  bg.ForwardRequestToBackendGroup(hedgeReqs, []*Backend{hedgeBackend}, hedgeCtx, isBatch),
+			hedge: true,
+		}
+	}()
+
+	// wait for the first success, or for both to fail
+	var res hedgeResult
+	for i := 0; i < 2; i++ {
+		res = <-results
+		if res.resp.error == nil {
+			break
+		}
+	}
+	if res.hedge && res.resp.error == nil {
+		RecordBackendGroupHedgeWon(bg, hedgeBackend.Name)
+	}
+	return res.resp
+}
+
+const maxLatencySamples = 256
+
+// latencySamples keeps the latest request latencies of a backend to compute percentiles
+type latencySamples struct {
+	mtx     sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencySamples) Add(d time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % maxLatencySamples
+}
+
+// Percentile returns the p-th percentile (0 < p <= 1) of the samples, or false if there are none
+func (l *latencySamples) Percentile(p float64) (time.Duration, bool) {
+	l.mtx.Lock()
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	l.mtx.Unlock()
+
+	if len(sorted) == 0 {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx], true
+}
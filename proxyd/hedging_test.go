@@ -0,0 +1,56 @@
+package proxyd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencySamplesPercentile(t *testing.T) {
+	var samples latencySamples
+	_, ok := samples.Percentile(0.5)
+	require.False(t, ok)
+
+	for i := 1; i <= 100; i++ {
+		samples.Add(time.Duration(i) * time.Millisecond)
+	}
+	p50, ok := samples.Percentile(0.5)
+	require.True(t, ok)
+	require.Equal(t, 50*time.Millisecond, p50)
+	p99, _ := samples.Percentile(0.99)
+	require.Equal(t, 99*time.Millisecond, p99)
+	p100, _ := samples.Percentile(1)
+	require.Equal(t, 100*time.Millisecond, p100)
+
+	// only the latest samples are kept
+	for i := 0; i < maxLatencySamples; i++ {
+		samples.Add(time.Second)
+	}
+	p50, _ = samples.Percentile(0.5)
+	require.Equal(t, time.Second, p50)
+}
+
+func TestBuildHedgeMethods(t *testing.T) {
+	methods, err := buildHedgeMethods("test", &BackendGroupConfig{})
+	require.NoError(t, err)
+	require.Nil(t, methods)
+
+	methods, err = buildHedgeMethods("test", &BackendGroupConfig{HedgeDelay: TOMLDuration(time.Second)})
+	require.NoError(t, err)
+	require.True(t, methods.Has("eth_call"))
+	require.False(t, methods.Has("eth_sendRawTransaction"))
+
+	methods, err = buildHedgeMethods("test", &BackendGroupConfig{HedgeLatencyPercentile: 0.9, HedgeMethods: []string{"eth_getLogs"}})
+	require.NoError(t, err)
+	require.True(t, methods.Has("eth_getLogs"))
+	require.False(t, methods.Has("eth_call"))
+
+	_, err = buildHedgeMethods("test", &BackendGroupConfig{HedgeLatencyPercentile: 1.5})
+	require.Error(t, err)
+	_, err = buildHedgeMethods("test", &BackendGroupConfig{HedgeDelay: TOMLDuration(time.Second), HedgeMethods: []string{"eth_sendRawTransaction"}})
+	require.Error(t, err)
+	// only known reads can be hedged, not just the methods known to write
+	_, err = buildHedgeMethods("test", &BackendGroupConfig{HedgeDelay: TOMLDuration(time.Second), HedgeMethods: []string{"custom_sendBundle"}})
+	require.Error(t, err)
+}
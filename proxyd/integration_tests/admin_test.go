@@ -0,0 +1,188 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	ms "github.com/ethereum-optimism/infra/proxyd/tools/mockserver/handler"
+	"github.com/stretchr/testify/require"
+)
+
+const adminToken = "s3cret"
+
+type adminBackend struct {
+	Name            string `json:"name"`
+	Draining        bool   `json:"draining"`
+	ForcedCandidate bool   `json:"forced_candidate"`
+	State           struct {
+		LatestBlockNumber string `json:"latest_block_number"`
+		Banned            bool   `json:"banned"`
+	} `json:"state"`
+}
+
+type adminBackendGroup struct {
+	Name      string `json:"name"`
+	Consensus struct {
+		Backends []string `json:"backends"`
+	} `json:"consensus"`
+	Backends []adminBackend `json:"backends"`
+}
+
+func sendAdminRequest(t *testing.T, method, url, token string, out interface{}) int {
+	if token != "" {
+		token = "Bearer " + token
+	}
+	return sendAdminRequestWithAuthorization(t, method, url, token, out)
+}
+
+func sendAdminRequestWithAuthorization(t *testing.T, method, url, authorization string, out interface{}) int {
+	req, err := http.NewRequest(method, "http://127.0.0.1:8547"+url, nil)
+	require.NoError(t, err)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	if out != nil && res.StatusCode == http.StatusOK {
+		require.NoError(t, json.Unmarshal(body, out))
+	}
+	return res.StatusCode
+}
+
+func TestAdmin(t *testing.T) {
+	node1 := NewMockBackend(nil)
+	defer node1.Close()
+	node2 := NewMockBackend(nil)
+	defer node2.Close()
+
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	responses := path.Join(dir, "testdata/consensus_responses.yml")
+	h1 := ms.MockedHandler{Overrides: []*ms.MethodTemplate{}, Autoload: true, AutoloadFile: responses}
+	h2 := ms.MockedHandler{Overrides: []*ms.MethodTemplate{}, Autoload: true, AutoloadFile: responses}
+	node1.SetHandler(http.HandlerFunc(h1.Handler))
+	node2.SetHandler(http.HandlerFunc(h2.Handler))
+
+	require.NoError(t, os.Setenv("NODE1_URL", node1.URL()))
+	require.NoError(t, os.Setenv("NODE2_URL", node2.URL()))
+	require.NoError(t, os.Setenv("ADMIN_TOKEN", adminToken))
+
+	config := ReadConfig("admin")
+	svr, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+	bg := svr.BackendGroups["node"]
+	require.NotNil(t, bg)
+
+	ctx := context.Background()
+	update := func() {
+		for _, be := range bg.Backends {
+			bg.Consensus.UpdateBackend(ctx, be)
+		}
+		bg.Consensus.UpdateBackendGroupConsensus(ctx)
+	}
+	update()
+
+	t.Run("rejects unauthenticated requests", func(t *testing.T) {
+		require.Equal(t, http.StatusUnauthorized, sendAdminRequest(t, "GET", "/backend_groups", "", nil))
+		require.Equal(t, http.StatusUnauthorized, sendAdminRequest(t, "GET", "/backend_groups", "wrong", nil))
+		require.Equal(t, http.StatusUnauthorized, sendAdminRequestWithAuthorization(t, "GET", "/backend_groups", adminToken, nil))
+	})
+
+	t.Run("lists backend groups", func(t *testing.T) {
+		var groups []adminBackendGroup
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "GET", "/backend_groups", adminToken, &groups))
+		require.Len(t, groups, 2)
+
+		var group adminBackendGroup
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "GET", "/backend_groups/node", adminToken, &group))
+		require.Equal(t, "node", group.Name)
+		require.ElementsMatch(t, []string{"node1", "node2"}, group.Consensus.Backends)
+		require.Len(t, group.Backends, 2)
+		require.Equal(t, "0x101", group.Backends[0].State.LatestBlockNumber)
+
+		require.Equal(t, http.StatusNotFound, sendAdminRequest(t, "GET", "/backend_groups/unknown", adminToken, nil))
+	})
+
+	t.Run("bans and unbans a backend", func(t *testing.T) {
+		var be adminBackend
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/ban?duration=1h", adminToken, &be))
+		require.True(t, be.State.Banned)
+		require.True(t, bg.Consensus.IsBanned(bg.Backends[0]))
+
+		update()
+		require.Equal(t, []*proxyd.Backend{bg.Backends[1]}, bg.Consensus.GetConsensusGroup())
+
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/unban", adminToken, &be))
+		require.False(t, be.State.Banned)
+		update()
+		require.Len(t, bg.Consensus.GetConsensusGroup(), 2)
+
+		require.Equal(t, http.StatusBadRequest, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/ban?duration=soon", adminToken, nil))
+		require.Equal(t, http.StatusNotFound, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node3/ban", adminToken, nil))
+	})
+
+	t.Run("drains a backend", func(t *testing.T) {
+		var be adminBackend
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node2/drain", adminToken, &be))
+		require.True(t, be.Draining)
+
+		node1.Reset()
+		node2.Reset()
+		for i := 0; i < 10; i++ {
+			_, code, err := client.SendRPC("eth_getBlockByNumber", []interface{}{"0x101", false})
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+		}
+		require.Len(t, node1.Requests(), 10)
+		require.Len(t, node2.Requests(), 0)
+
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node2/undrain", adminToken, &be))
+		require.False(t, be.Draining)
+	})
+
+	t.Run("toggles forced candidate", func(t *testing.T) {
+		var be adminBackend
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/forced_candidate?enabled=true", adminToken, &be))
+		require.True(t, be.ForcedCandidate)
+		require.Equal(t, http.StatusConflict, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/ban", adminToken, nil))
+
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/forced_candidate?enabled=false", adminToken, &be))
+		require.False(t, be.ForcedCandidate)
+		require.Equal(t, http.StatusBadRequest, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node1/forced_candidate", adminToken, nil))
+		require.Equal(t, http.StatusBadRequest, sendAdminRequest(t, "POST", "/backend_groups/plain/backends/node1/forced_candidate?enabled=true", adminToken, nil))
+	})
+
+	t.Run("drains survive a reload that rebuilds the backend", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/backends/node2/drain", adminToken, nil))
+
+		updated := ReadConfig("admin")
+		updated.Backends["node2"].Headers = map[string]string{"X-Reloaded": "true"}
+		require.NoError(t, svr.Reload(updated))
+		require.NotSame(t, bg, svr.BackendGroups["node"])
+
+		var group adminBackendGroup
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "GET", "/backend_groups/node", adminToken, &group))
+		require.Equal(t, "node2", group.Backends[1].Name)
+		require.True(t, group.Backends[1].Draining)
+	})
+
+	t.Run("resets consensus", func(t *testing.T) {
+		var group adminBackendGroup
+		require.Equal(t, http.StatusOK, sendAdminRequest(t, "POST", "/backend_groups/node/consensus/reset", adminToken, &group))
+		for _, be := range group.Backends {
+			require.Equal(t, "0x0", be.State.LatestBlockNumber)
+		}
+	})
+}
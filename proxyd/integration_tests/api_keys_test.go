@@ -0,0 +1,152 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	hdlr := NewBatchRPCResponseRouter()
+	hdlr.SetRoute("eth_chainId", "999", "0x420")
+	hdlr.SetRoute("eth_chainId", "1", "0x420")
+	hdlr.SetRoute("eth_chainId", "2", "0x420")
+	hdlr.SetRoute("eth_blockNumber", "999", "0x1")
+	goodBackend := NewMockBackend(hdlr)
+	defer goodBackend.Close()
+	premiumBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer premiumBackend.Close()
+
+	require.NoError(t, os.Setenv("REDIS_URL", "redis://127.0.0.1:"+redis.Port()))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("PREMIUM_BACKEND_RPC_URL", premiumBackend.URL()))
+	require.NoError(t, os.Setenv("PREMIUM_API_KEY", "premium_key"))
+
+	config := ReadConfig("api_keys")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	errCode := func(t *testing.T, res []byte) int {
+		var rpcRes proxyd.RPCRes
+		require.NoError(t, json.Unmarshal(res, &rpcRes))
+		require.NotNil(t, rpcRes.Error)
+		return rpcRes.Error.Code
+	}
+
+	t.Run("requests without a valid key are rejected", func(t *testing.T) {
+		for _, client := range []*ProxydHTTPClient{
+			NewProxydClient("http://127.0.0.1:8545"),
+			NewProxydClient("http://127.0.0.1:8545/unknown_key"),
+			NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"Authorization": []string{"quota_key"}}),
+		} {
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 401, code)
+		}
+	})
+
+	t.Run("keys are accepted in the path, as bearer token and in the custom header", func(t *testing.T) {
+		for _, client := range []*ProxydHTTPClient{
+			NewProxydClient("http://127.0.0.1:8545/premium_key"),
+			NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"Authorization": []string{"Bearer premium_key"}}),
+			NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"X-Api-Key": []string{"premium_key"}}),
+		} {
+			res, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(goodResponse), res)
+		}
+	})
+
+	t.Run("keys are served by their backend group", func(t *testing.T) {
+		require.Len(t, premiumBackend.Requests(), 3)
+		require.Empty(t, goodBackend.Requests())
+	})
+
+	t.Run("methods outside of the allowlist are rejected", func(t *testing.T) {
+		client := NewProxydClient("http://127.0.0.1:8545/limited_key")
+		res, code, err := client.SendRPC("eth_call", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		require.Equal(t, proxyd.ErrMethodNotWhitelisted.Code, errCode(t, res))
+	})
+
+	t.Run("keys have their own rate limit", func(t *testing.T) {
+		limited := NewProxydClient("http://127.0.0.1:8545/limited_key")
+		for i := 0; i < 2; i++ {
+			_, code, err := limited.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+		}
+		res, code, err := limited.SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 429, code)
+		require.Equal(t, proxyd.ErrOverRateLimit.Code, errCode(t, res))
+
+		// other keys are not affected
+		_, code, err = NewProxydClient("http://127.0.0.1:8545/quota_key").SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("keys have a daily quota that covers batch calls", func(t *testing.T) {
+		client := NewProxydClient("http://127.0.0.1:8545/quota_key")
+		res, code, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_chainId", nil),
+			NewRPCReq("2", "eth_chainId", nil),
+			NewRPCReq("3", "eth_chainId", nil),
+		)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		var batchRes []proxyd.RPCRes
+		require.NoError(t, json.Unmarshal(res, &batchRes))
+		require.Len(t, batchRes, 3)
+		require.Nil(t, batchRes[0].Error)
+		require.Nil(t, batchRes[1].Error)
+		require.Equal(t, proxyd.ErrOverAPIKeyQuota.Code, batchRes[2].Error.Code)
+	})
+
+	t.Run("keys are loaded from redis", func(t *testing.T) {
+		client := NewProxydClient("http://127.0.0.1:8545/dynamic_key")
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 401, code)
+
+		redis.HSet("proxyd:api_keys", "dynamic", `{"key": "dynamic_key", "allowed_methods": ["eth_chainId"]}`)
+		require.Eventually(t, func() bool {
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			return err == nil && code == 200
+		}, 2*time.Second, 50*time.Millisecond)
+
+		res, code, err := client.SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		require.Equal(t, proxyd.ErrMethodNotWhitelisted.Code, errCode(t, res))
+
+		redis.HDel("proxyd:api_keys", "dynamic")
+		require.Eventually(t, func() bool {
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			return err == nil && code == 401
+		}, 2*time.Second, 50*time.Millisecond)
+	})
+}
+
+func TestAPIKeyUndefinedBackendGroup(t *testing.T) {
+	config := ReadConfig("api_keys")
+	config.APIKeys.UseRedis = false
+	config.APIKeys.Keys["premium"].BackendGroup = "missing"
+	_, _, err := proxyd.Start(config)
+	require.ErrorContains(t, err, "undefined backend group missing for api key premium")
+}
@@ -304,8 +304,11 @@ func TestCachingWithReadReplica(t *testing.T) {
 	RequireEqualJSON(t, resRaw, resCache)
 	require.Equal(t, 2, countRequests(backend, "eth_getBlockByHash"))
 
-	// replicate cache data
+	// replicate cache data, skipping the sets of the block key index
 	for _, key := range primary.Keys() {
+		if primary.Type(key) != "string" {
+			continue
+		}
 		value, err := primary.Get(key)
 		require.NoError(t, err)
 
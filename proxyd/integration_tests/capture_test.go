@@ -0,0 +1,91 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	ms "github.com/ethereum-optimism/infra/proxyd/tools/mockserver/handler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureAndReplay(t *testing.T) {
+	router := NewBatchRPCResponseRouter()
+	router.SetFallbackRoute("eth_chainId", "0xa")
+	router.SetFallbackRoute("eth_blockNumber", "0x100")
+	goodBackend := NewMockBackend(router)
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("capture")
+	config.Capture.Dir = t.TempDir()
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+
+	_, _, err = client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	_, _, err = client.SendBatchRPC(
+		NewRPCReq("1", "eth_chainId", nil),
+		NewRPCReq("2", "eth_blockNumber", nil),
+	)
+	require.NoError(t, err)
+	_, _, err = client.SendRPC("eth_notWhitelisted", nil)
+	require.NoError(t, err)
+	// the capture is flushed on shutdown
+	shutdown()
+
+	files, err := filepath.Glob(filepath.Join(config.Capture.Dir, "capture-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	entries, err := proxyd.ReadCapture(files[0])
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "main/good", entries[0].ServedBy)
+	require.Equal(t, 200, entries[0].StatusCode)
+	require.Equal(t, 403, entries[2].StatusCode)
+
+	t.Run("replay against proxyd", func(t *testing.T) {
+		config.Capture.Dir = ""
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		report, err := proxyd.Replay(context.Background(), proxyd.ReplayConfig{
+			Target: "http://127.0.0.1:8545",
+		}, entries)
+		require.NoError(t, err)
+		require.Equal(t, proxyd.ReplayReport{Total: 3, Matched: 3}, *report)
+
+		router.SetFallbackRoute("eth_blockNumber", "0x101")
+		var diffs bytes.Buffer
+		report, err = proxyd.Replay(context.Background(), proxyd.ReplayConfig{
+			Target: "http://127.0.0.1:8545",
+			Speed:  0,
+			Diffs:  &diffs,
+		}, entries)
+		require.NoError(t, err)
+		require.Equal(t, proxyd.ReplayReport{Total: 3, Matched: 2, Mismatched: 1}, *report)
+		require.Contains(t, diffs.String(), "<batch>")
+		require.Contains(t, diffs.String(), "0x101")
+	})
+
+	t.Run("mockserver serves the capture", func(t *testing.T) {
+		h := &ms.MockedHandler{Autoload: true, AutoloadFile: files[0]}
+		mockServer := httptest.NewServer(http.HandlerFunc(h.Handler))
+		defer mockServer.Close()
+
+		report, err := proxyd.Replay(context.Background(), proxyd.ReplayConfig{
+			Target: mockServer.URL,
+			Speed:  0,
+		}, entries[:2])
+		require.NoError(t, err)
+		require.Equal(t, proxyd.ReplayReport{Total: 2, Matched: 2}, *report)
+	})
+}
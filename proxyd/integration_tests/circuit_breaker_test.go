@@ -0,0 +1,90 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, `{"jsonrpc": "2.0", "result": "0x1", "id": 999}`))
+	defer goodBackend.Close()
+	badBackend := NewMockBackend(SingleResponseHandler(503, "unavailable"))
+	defer badBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("BAD_BACKEND_RPC_URL", badBackend.URL()))
+
+	config := ReadConfig("circuit_breaker")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("consecutive failures open the circuit", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			res, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, code)
+			RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","result":"0x1","id":999}`), res)
+		}
+		require.Len(t, badBackend.Requests(), 2)
+		require.Len(t, goodBackend.Requests(), 3)
+	})
+
+	t.Run("half open backends are probed until the circuit closes", func(t *testing.T) {
+		recovered := NewBatchRPCResponseRouter()
+		recovered.SetFallbackRoute("eth_chainId", "0x2")
+		badBackend.SetHandler(recovered)
+		require.Eventually(t, func() bool {
+			return len(badBackend.Requests()) >= 4
+		}, 2*time.Second, 10*time.Millisecond)
+		for _, req := range badBackend.Requests()[2:4] {
+			require.Contains(t, string(req.Body), `"id":67`)
+		}
+
+		// the last probe may still be in flight
+		require.Eventually(t, func() bool {
+			res, _, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			var rpcRes proxyd.RPCRes
+			require.NoError(t, json.Unmarshal(res, &rpcRes))
+			return rpcRes.Result == "0x2"
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestCircuitBreakerRetiredBackend(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, `{"jsonrpc": "2.0", "result": "0x1", "id": 999}`))
+	defer goodBackend.Close()
+	badBackend := NewMockBackend(SingleResponseHandler(503, "unavailable"))
+	defer badBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("BAD_BACKEND_RPC_URL", badBackend.URL()))
+
+	config := ReadConfig("circuit_breaker")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	for i := 0; i < 2; i++ {
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+	}
+	require.Len(t, badBackend.Requests(), 2)
+
+	// rebuilding the backend retires the one whose circuit is open, it must stop probing
+	updated := ReadConfig("circuit_breaker")
+	updated.Backends["bad"].MaxRPS = 100
+	require.NoError(t, srv.Reload(updated))
+	time.Sleep(500 * time.Millisecond)
+	require.Len(t, badBackend.Requests(), 2)
+}
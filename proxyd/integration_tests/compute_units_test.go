@@ -0,0 +1,66 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeUnits(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("compute_units")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	getLogs := []interface{}{map[string]string{"fromBlock": "0x1", "toBlock": "0x4"}}
+
+	// 6 units
+	res, code, err := client.SendRPC("debug_traceTransaction", []interface{}{"0x1234"})
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(goodResponse), res)
+
+	// batches are charged the sum of their calls: 1 + 2 + 4 * 0.5
+	res, code, err = client.SendBatchRPC(
+		NewRPCReq("1", "eth_chainId", nil),
+		NewRPCReq("2", "eth_getLogs", getLogs),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	var batchRes []proxyd.RPCRes
+	require.NoError(t, json.Unmarshal(res, &batchRes))
+	require.Len(t, batchRes, 2)
+	for _, r := range batchRes {
+		require.Equal(t, proxyd.ErrOverRateLimit.Code, r.Error.Code)
+		require.Equal(t, "over compute unit limit: request costs 5 compute units, 4 remaining", r.Error.Message)
+	}
+	require.Len(t, goodBackend.Requests(), 1)
+
+	// 4 units
+	_, code, err = client.SendRPC("eth_getLogs", getLogs)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+
+	res, code, err = client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+	var rpcRes proxyd.RPCRes
+	require.NoError(t, json.Unmarshal(res, &rpcRes))
+	require.Equal(t, "over compute unit limit: request costs 1 compute units, 0 remaining", rpcRes.Error.Message)
+
+	// the budget is per IP
+	otherClient := NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"X-Forwarded-For": []string{"1.2.3.4"}})
+	_, code, err = otherClient.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+}
@@ -0,0 +1,71 @@
+package integration_tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	ms "github.com/ethereum-optimism/infra/proxyd/tools/mockserver/handler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusHAPeers(t *testing.T) {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	h := ms.MockedHandler{
+		Overrides:    []*ms.MethodTemplate{},
+		Autoload:     true,
+		AutoloadFile: path.Join(dir, "testdata/consensus_responses.yml"),
+	}
+	node1 := NewMockBackend(http.HandlerFunc(h.Handler))
+	defer node1.Close()
+	require.NoError(t, os.Setenv("NODE1_URL", node1.URL()))
+
+	// the other instance is a bare tracker
+	peerServer := httptest.NewUnstartedServer(nil)
+	peerURL := "http://" + peerServer.Listener.Addr().String()
+
+	config := ReadConfig("consensus_ha_peers")
+	peers := []string{"http://127.0.0.1:8545", peerURL}
+	config.BackendGroups["node"].ConsensusHAPeers = peers
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	peer, err := proxyd.NewPeerConsensusTracker(context.Background(), &proxyd.BackendGroup{Name: "node"}, peerURL, peers,
+		proxyd.WithPeerHeartbeatInterval(50*time.Millisecond), proxyd.WithPeerToken("secret"))
+	require.NoError(t, err)
+	peerServer.Config.Handler = peer
+	peerServer.Start()
+	defer peerServer.Close()
+	peer.Init()
+	defer peer.Shutdown()
+
+	// only proxyd has a valid state, so it leads
+	bg := srv.BackendGroups["node"]
+	bg.Consensus.UpdateBackend(context.Background(), bg.Backends[0])
+	bg.Consensus.UpdateBackendGroupConsensus(context.Background())
+	require.Eventually(t, func() bool {
+		return bg.Consensus.GetLatestBlockNumber() == 0x101 && peer.LeaderName() == "http://127.0.0.1:8545"
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, "0x101", peer.GetLatestBlockNumber().String())
+	require.Equal(t, "0xe1", peer.GetSafeBlockNumber().String())
+	require.Equal(t, "0xc1", peer.GetFinalizedBlockNumber().String())
+	require.False(t, peer.IsLeader())
+
+	// the state is only shared with the peers
+	res, err := http.Get("http://127.0.0.1:8545/consensus_ha/node")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, err = http.Get("http://127.0.0.1:8545/consensus_ha/unknown")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,65 @@
+package integration_tests
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	ms "github.com/ethereum-optimism/infra/proxyd/tools/mockserver/handler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusScoring(t *testing.T) {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	responses := path.Join(dir, "testdata/consensus_responses.yml")
+	h1 := ms.MockedHandler{Overrides: []*ms.MethodTemplate{}, Autoload: true, AutoloadFile: responses}
+	h2 := ms.MockedHandler{Overrides: []*ms.MethodTemplate{}, Autoload: true, AutoloadFile: responses}
+	node1 := NewMockBackend(http.HandlerFunc(h1.Handler))
+	defer node1.Close()
+	node2 := NewMockBackend(http.HandlerFunc(h2.Handler))
+	defer node2.Close()
+	require.NoError(t, os.Setenv("NODE1_URL", node1.URL()))
+	require.NoError(t, os.Setenv("NODE2_URL", node2.URL()))
+
+	// node1 lags 2 blocks behind node2, within the max block lag of 3
+	h2.AddOverride(&ms.MethodTemplate{
+		Method:   "eth_getBlockByNumber",
+		Block:    "latest",
+		Response: buildResponse(map[string]string{"number": "0x103", "hash": "hash_0x103"}),
+	})
+
+	srv, shutdown, err := proxyd.Start(ReadConfig("consensus_scoring"))
+	require.NoError(t, err)
+	defer shutdown()
+
+	bg := srv.BackendGroups["node"]
+	ctx := context.Background()
+	for _, be := range bg.Backends {
+		bg.Consensus.UpdateBackend(ctx, be)
+	}
+	bg.Consensus.UpdateBackendGroupConsensus(ctx)
+	require.Equal(t, "0x101", bg.Consensus.GetLatestBlockNumber().String())
+	require.Len(t, bg.Consensus.GetConsensusGroup(), 2)
+	// the lag halves the score of node1, the latencies of the mocks only differ slightly
+	require.InDelta(t, 1, bg.Consensus.GetScore(bg.Backends[1]), 0.2)
+	require.InDelta(t, 0.5, bg.Consensus.GetScore(bg.Backends[0]), 0.1)
+
+	node1.Reset()
+	node2.Reset()
+	client := NewProxydClient("http://127.0.0.1:8545")
+	for i := 0; i < 300; i++ {
+		_, code, err := client.SendRPC("eth_getBlockByNumber", []interface{}{"0x101", false})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	}
+
+	// the lagging node still serves a share of the traffic
+	n1, n2 := len(node1.Requests()), len(node2.Requests())
+	require.Equal(t, 300, n1+n2)
+	require.Greater(t, n1, 50)
+	require.Greater(t, n2, n1)
+}
@@ -105,6 +105,7 @@ func TestConsensus(t *testing.T) {
 			node.backend.ClearSlidingWindows()
 		}
 		bg.Consensus.ClearListeners()
+		bg.Consensus.ClearReorgListeners()
 		bg.Consensus.Reset()
 
 	}
@@ -998,6 +999,42 @@ func TestConsensus(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, 400, statusCode)
 	})
+
+	t.Run("reorg of the consensus head", func(t *testing.T) {
+		reset()
+		var events []*proxyd.ReorgEvent
+		bg.Consensus.AddReorgListener(func(event *proxyd.ReorgEvent) {
+			events = append(events, event)
+		})
+		update()
+
+		// advance latest on both nodes to 0x102
+		overrideBlock("node1", "latest", "0x102")
+		overrideBlock("node2", "latest", "0x102")
+		update()
+		require.Equal(t, "0x102", bg.Consensus.GetLatestBlockNumber().String())
+		require.Empty(t, events)
+
+		// both nodes replace 0x102
+		for _, node := range []string{"node1", "node2"} {
+			overrideBlockHash(node, "0x102", "0x102", "reorg_0x102")
+			overrideBlockHash(node, "latest", "0x102", "reorg_0x102")
+		}
+		update()
+		require.Equal(t, "0x102", bg.Consensus.GetLatestBlockNumber().String())
+
+		require.Len(t, events, 1)
+		require.Equal(t, "node", events[0].BackendGroup)
+		require.Equal(t, uint64(1), events[0].Depth)
+		require.Equal(t, "0x101", events[0].ForkBlockNumber.String())
+		require.Equal(t, "hash_0x102", events[0].OldHeadHash)
+		require.Equal(t, "reorg_0x102", events[0].NewHeadHash)
+		require.Equal(t, []string{"hash_0x102"}, events[0].OrphanedHashes)
+
+		// the new head isn't reported again
+		update()
+		require.Len(t, events, 1)
+	})
 }
 
 func buildResponse(result interface{}) string {
@@ -0,0 +1,92 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	ms "github.com/ethereum-optimism/infra/proxyd/tools/mockserver/handler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinalizedCache(t *testing.T) {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+
+	h := ms.MockedHandler{
+		Overrides:    []*ms.MethodTemplate{},
+		Autoload:     true,
+		AutoloadFile: path.Join(dir, "testdata/consensus_responses.yml"),
+	}
+	node1 := NewMockBackend(http.HandlerFunc(h.Handler))
+	defer node1.Close()
+	require.NoError(t, os.Setenv("NODE1_URL", node1.URL()))
+
+	config := ReadConfig("finalized_cache")
+	svr, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+	client := NewProxydClient("http://127.0.0.1:8545")
+
+	bg := svr.BackendGroups["node"]
+	ctx := context.Background()
+	for _, be := range bg.Backends {
+		bg.Consensus.UpdateBackend(ctx, be)
+	}
+	bg.Consensus.UpdateBackendGroupConsensus(ctx)
+	require.Equal(t, "0xc1", bg.Consensus.GetFinalizedBlockNumber().String())
+
+	countRequests := func(block string) int {
+		n := 0
+		for _, req := range node1.Requests() {
+			var rpcReq proxyd.RPCReq
+			require.NoError(t, json.Unmarshal(req.Body, &rpcReq))
+			if rpcReq.Method == "eth_getBlockByNumber" && string(rpcReq.Params) == `["`+block+`",false]` {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("finalized blocks are cached", func(t *testing.T) {
+		node1.Reset()
+		for i := 0; i < 3; i++ {
+			res, code, err := client.SendRPC("eth_getBlockByNumber", []interface{}{"0xc1", false})
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			require.Contains(t, string(res), "hash_0xc1")
+		}
+		require.Equal(t, 1, countRequests("0xc1"))
+	})
+
+	t.Run("finalized tag is resolved against the consensus", func(t *testing.T) {
+		node1.Reset()
+		res, code, err := client.SendRPC("eth_getBlockByNumber", []interface{}{"finalized", false})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		require.Contains(t, string(res), "hash_0xc1")
+		require.Empty(t, node1.Requests())
+	})
+
+	t.Run("blocks above finalized are not cached", func(t *testing.T) {
+		node1.Reset()
+		for i := 0; i < 3; i++ {
+			res, code, err := client.SendRPC("eth_getBlockByNumber", []interface{}{"0xd1", false})
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			require.Contains(t, string(res), "hash_0xd1")
+		}
+		require.Equal(t, 3, countRequests("0xd1"))
+	})
+}
+
+func TestFinalizedCacheUnsupportedMethod(t *testing.T) {
+	config := ReadConfig("finalized_cache")
+	config.Cache.FinalizedMethods["eth_sendRawTransaction"] = &proxyd.FinalizedCacheMethodConfig{}
+	_, _, err := proxyd.Start(config)
+	require.Error(t, err)
+}
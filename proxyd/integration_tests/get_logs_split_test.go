@@ -0,0 +1,125 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+// logsHandler returns a log for the first and the last block of the range of each eth_getLogs call
+func logsHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		panic(err)
+	}
+	var reqs []*proxyd.RPCReq
+	if proxyd.IsBatch(body) {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		reqs = make([]*proxyd.RPCReq, 1)
+		err = json.Unmarshal(body, &reqs[0])
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	res := make([]*proxyd.RPCRes, len(reqs))
+	for i, req := range reqs {
+		var result interface{} = "0x420"
+		if req.Method == "eth_getLogs" {
+			var params []map[string]string
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				panic(err)
+			}
+			result = []map[string]string{
+				{"blockNumber": params[0]["fromBlock"], "address": params[0]["address"]},
+				{"blockNumber": params[0]["toBlock"], "address": params[0]["address"]},
+			}
+		}
+		res[i] = proxyd.NewRPCRes(req.ID, result)
+	}
+	if proxyd.IsBatch(body) {
+		_, _ = w.Write([]byte(mustMarshal(res)))
+	} else {
+		_, _ = w.Write([]byte(mustMarshal(res[0])))
+	}
+}
+
+func TestGetLogsSplit(t *testing.T) {
+	goodBackend := NewMockBackend(http.HandlerFunc(logsHandler))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("get_logs_split")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	getLogs := func(from, to string) []interface{} {
+		return []interface{}{map[string]string{"fromBlock": from, "toBlock": to, "address": "0x1234"}}
+	}
+
+	t.Run("small ranges are forwarded as is", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRPC("eth_getLogs", getLogs("0x0", "0x9"))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":999,"result":[{"address":"0x1234","blockNumber":"0x0"},{"address":"0x1234","blockNumber":"0x9"}]}`), res)
+		require.Len(t, goodBackend.Requests(), 1)
+	})
+
+	t.Run("large ranges are split and merged in order", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRPC("eth_getLogs", getLogs("0x0", "0x18"))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":999,"result":[
+			{"address":"0x1234","blockNumber":"0x0"},{"address":"0x1234","blockNumber":"0x9"},
+			{"address":"0x1234","blockNumber":"0xa"},{"address":"0x1234","blockNumber":"0x13"},
+			{"address":"0x1234","blockNumber":"0x14"},{"address":"0x1234","blockNumber":"0x18"}
+		]}`), res)
+		require.Len(t, goodBackend.Requests(), 3)
+	})
+
+	t.Run("split calls in a batch keep their position", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_chainId", nil),
+			NewRPCReq("2", "eth_getLogs", getLogs("0xa", "0x1d")),
+			NewRPCReq("3", "eth_chainId", nil),
+		)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`[
+			{"jsonrpc":"2.0","id":1,"result":"0x420"},
+			{"jsonrpc":"2.0","id":2,"result":[
+				{"address":"0x1234","blockNumber":"0xa"},{"address":"0x1234","blockNumber":"0x13"},
+				{"address":"0x1234","blockNumber":"0x14"},{"address":"0x1234","blockNumber":"0x1d"}
+			]},
+			{"jsonrpc":"2.0","id":3,"result":"0x420"}
+		]`), res)
+	})
+
+	t.Run("too many results", func(t *testing.T) {
+		res, code, err := client.SendRPC("eth_getLogs", getLogs("0x0", "0x3b"))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":999,"error":{"code":-32005,"message":"query returned more than 10 results"}}`), res)
+	})
+
+	t.Run("too many chunks", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRPC("eth_getLogs", getLogs("0x0", "0x63"))
+		require.NoError(t, err)
+		require.Equal(t, 400, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":999,"error":{"code":-32602,"message":"block range greater than 80 max"}}`), res)
+		require.Empty(t, goodBackend.Requests())
+	})
+}
@@ -0,0 +1,68 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthChecks(t *testing.T) {
+	lagging := NewBatchRPCResponseRouter()
+	lagging.SetFallbackRoute("eth_blockNumber", "0x10")
+	lagging.SetFallbackRoute("eth_chainId", "lagging")
+	good := NewBatchRPCResponseRouter()
+	good.SetFallbackRoute("eth_blockNumber", "0x100")
+	good.SetFallbackRoute("eth_chainId", "good")
+
+	laggingBackend := NewMockBackend(lagging)
+	defer laggingBackend.Close()
+	downBackend := NewMockBackend(SingleResponseHandler(503, "unavailable"))
+	defer downBackend.Close()
+	goodBackend := NewMockBackend(good)
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("LAGGING_BACKEND_RPC_URL", laggingBackend.URL()))
+	require.NoError(t, os.Setenv("DOWN_BACKEND_RPC_URL", downBackend.URL()))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("health_checks")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	servedBy := func() string {
+		res, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		var rpcRes proxyd.RPCRes
+		require.NoError(t, json.Unmarshal(res, &rpcRes))
+		return rpcRes.Result.(string)
+	}
+
+	t.Run("lagging and failing backends are tried last", func(t *testing.T) {
+		require.Eventually(t, func() bool {
+			return servedBy() == "good"
+		}, time.Second, 20*time.Millisecond)
+		downBackend.Reset()
+		for i := 0; i < 5; i++ {
+			require.Equal(t, "good", servedBy())
+		}
+		// the down backend only gets health checks
+		for _, req := range downBackend.Requests() {
+			require.Contains(t, string(req.Body), "eth_blockNumber")
+		}
+	})
+
+	t.Run("backends are healthy again once they catch up", func(t *testing.T) {
+		lagging.SetFallbackRoute("eth_blockNumber", "0x100")
+		require.Eventually(t, func() bool {
+			return servedBy() == "lagging"
+		}, time.Second, 20*time.Millisecond)
+	})
+}
@@ -0,0 +1,107 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedging(t *testing.T) {
+	slowBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		BatchedResponseHandler(200, goodResponse)(w, r)
+	}))
+	defer slowBackend.Close()
+	fastBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer fastBackend.Close()
+
+	require.NoError(t, os.Setenv("SLOW_BACKEND_RPC_URL", slowBackend.URL()))
+	require.NoError(t, os.Setenv("FAST_BACKEND_RPC_URL", fastBackend.URL()))
+
+	config := ReadConfig("hedging")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	svr, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("slow reads are hedged to the next backend", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			start := time.Now()
+			res, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(goodResponse), res)
+			require.Less(t, time.Since(start), 300*time.Millisecond)
+		}
+		require.Len(t, fastBackend.Requests(), 10)
+
+		// cancelled requests don't count against the slow backend
+		require.Zero(t, svr.BackendGroups["main"].Backends[0].ErrorRate())
+	})
+
+	t.Run("writes are never hedged", func(t *testing.T) {
+		// the mock backend serves one request at a time, wait for the cancelled ones
+		require.Eventually(t, func() bool {
+			return len(slowBackend.Requests()) == 10
+		}, 5*time.Second, 50*time.Millisecond)
+		slowBackend.Reset()
+		fastBackend.Reset()
+		start := time.Now()
+		_, code, err := client.SendRPC("eth_sendRawTransaction", []interface{}{"0x00"})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+		require.Len(t, slowBackend.Requests(), 1)
+		require.Empty(t, fastBackend.Requests())
+	})
+}
+
+func TestHedgingRejectsWriteMethods(t *testing.T) {
+	config := ReadConfig("hedging")
+	config.BackendGroups["main"].HedgeMethods = []string{"eth_call", "eth_sendRawTransaction"}
+	_, _, err := proxyd.Start(config)
+	require.Error(t, err)
+}
+
+func TestHedgingFailoverSkipsHedgeBackend(t *testing.T) {
+	failingBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		SingleResponseHandler(503, "unavailable")(w, r)
+	}))
+	defer failingBackend.Close()
+	hedgeBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1800 * time.Millisecond)
+		BatchedResponseHandler(200, goodResponse)(w, r)
+	}))
+	defer hedgeBackend.Close()
+	spareBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer spareBackend.Close()
+
+	require.NoError(t, os.Setenv("SLOW_BACKEND_RPC_URL", failingBackend.URL()))
+	require.NoError(t, os.Setenv("FAST_BACKEND_RPC_URL", hedgeBackend.URL()))
+
+	config := ReadConfig("hedging")
+	config.Backends["spare"] = &proxyd.BackendConfig{RPCURL: spareBackend.URL()}
+	config.BackendGroups["main"].Backends = []string{"slow", "fast", "spare"}
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	// the first backend fails after the request was hedged to the second one,
+	// it fails over to the third one instead of sending the request to the second one again
+	start := time.Now()
+	res, code, err := NewProxydClient("http://127.0.0.1:8545").SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(goodResponse), res)
+	require.Len(t, failingBackend.Requests(), 1)
+	require.Len(t, spareBackend.Requests(), 1)
+	require.Less(t, time.Since(start), 1800*time.Millisecond)
+	// the mock backend serves one request at a time, a second one would only be recorded once the first is done
+	time.Sleep(time.Until(start.Add(2200 * time.Millisecond)))
+	require.Len(t, hedgeBackend.Requests(), 1)
+}
@@ -0,0 +1,118 @@
+package integration_tests
+
+import (
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func signHS256JWT(t *testing.T, secret []byte, claims map[string]interface{}) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims)).SignedString(secret)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestJWTAuth(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	engineBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer engineBackend.Close()
+
+	clientSecret := []byte("client_secret")
+	engineSecret := []byte(strings.Repeat("\x42", 32))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("ENGINE_BACKEND_RPC_URL", engineBackend.URL()))
+	require.NoError(t, os.Setenv("JWT_AUTH_SECRET", string(clientSecret)))
+	require.NoError(t, os.Setenv("ENGINE_JWT_SECRET", "0x"+hex.EncodeToString(engineSecret)))
+
+	config := ReadConfig("jwt_auth")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	token := func(sub string, claims map[string]interface{}) string {
+		c := map[string]interface{}{
+			"sub": sub,
+			"aud": "proxyd",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		return signHS256JWT(t, clientSecret, c)
+	}
+	bearer := func(token string) *ProxydHTTPClient {
+		return NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"Authorization": []string{"Bearer " + token}})
+	}
+
+	t.Run("requests without a valid token are rejected", func(t *testing.T) {
+		for _, client := range []*ProxydHTTPClient{
+			NewProxydClient("http://127.0.0.1:8545"),
+			bearer(signHS256JWT(t, []byte("other_secret"), map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})),
+			bearer(token("alice", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+			bearer(token("alice", map[string]interface{}{"aud": "other"})),
+		} {
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 401, code)
+		}
+	})
+
+	t.Run("tokens are accepted as bearer token and in the path", func(t *testing.T) {
+		for _, client := range []*ProxydHTTPClient{
+			bearer(token("alice", nil)),
+			NewProxydClient("http://127.0.0.1:8545/" + token("alice", nil)),
+		} {
+			res, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(goodResponse), res)
+		}
+	})
+
+	t.Run("the policy restricts methods and limits every subject", func(t *testing.T) {
+		_, code, err := bearer(token("bob", nil)).SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+
+		for i := 0; i < 2; i++ {
+			_, code, err := bearer(token("bob", nil)).SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+		}
+		_, code, err = bearer(token("bob", nil)).SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 429, code)
+
+		_, code, err = bearer(token("carol", nil)).SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("backends get a token minted with their secret", func(t *testing.T) {
+		engineBackend.Reset()
+		_, code, err := bearer(token("engine", map[string]interface{}{"policy": "engine"})).SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		reqs := engineBackend.Requests()
+		require.Len(t, reqs, 1)
+		minted, ok := strings.CutPrefix(reqs[0].Headers.Get("Authorization"), "Bearer ")
+		require.True(t, ok)
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(minted, claims, func(*jwt.Token) (interface{}, error) {
+			return engineSecret, nil
+		}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuedAt())
+		require.NoError(t, err)
+		iat, err := claims.GetIssuedAt()
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), iat.Time, 5*time.Second)
+	})
+}
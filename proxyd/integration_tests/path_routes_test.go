@@ -0,0 +1,168 @@
+package integration_tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathRoutes(t *testing.T) {
+	downBackend := NewMockBackend(SingleResponseHandler(503, "unavailable"))
+	defer downBackend.Close()
+	goodBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","query":"` + r.URL.RawQuery + `"}`))
+	}))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("DOWN_BACKEND_RPC_URL", downBackend.URL()))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("path_routes")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	send := func(method, path, body string) (int, string, http.Header) {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8545"+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(bytes.TrimSpace(resBody)), res.Header
+	}
+
+	t.Run("graphql is passed through to a healthy backend", func(t *testing.T) {
+		downBackend.Reset()
+		goodBackend.Reset()
+		code, body, header := send("POST", "/graphql?x=1", `{"query":"{block{number}}"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, `{"path":"/graphql","query":"x=1"}`, body)
+		require.Equal(t, "application/json", header.Get("Content-Type"))
+
+		require.Len(t, downBackend.Requests(), 1)
+		requests := goodBackend.Requests()
+		require.Len(t, requests, 1)
+		require.Equal(t, "POST", requests[0].Method)
+		require.Equal(t, `{"query":"{block{number}}"}`, string(requests[0].Body))
+		require.Equal(t, "node-key", requests[0].Headers.Get("x-node-key"))
+		username, password, ok := (&http.Request{Header: requests[0].Headers}).BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "proxyd", username)
+		require.Equal(t, "secret", password)
+	})
+
+	t.Run("policy is enforced", func(t *testing.T) {
+		goodBackend.Reset()
+		code, _, _ := send("GET", "/graphql", "")
+		require.Equal(t, http.StatusMethodNotAllowed, code)
+		code, _, _ = send("POST", "/graphql", `{"query":"`+strings.Repeat("a", 64)+`"}`)
+		require.Equal(t, http.StatusRequestEntityTooLarge, code)
+		code, _, _ = send("GET", "/opnode/admin", "")
+		require.Equal(t, http.StatusForbidden, code)
+		require.Empty(t, goodBackend.Requests())
+	})
+
+	t.Run("rest paths are rewritten and rate limited", func(t *testing.T) {
+		code, body, _ := send("GET", "/opnode/healthz", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, `{"path":"/healthz","query":""}`, body)
+		code, body, _ = send("GET", "/opnode/eth/v1/node/version", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, `{"path":"/eth/v1/node/version","query":""}`, body)
+		// client errors are returned as is
+		code, _, _ = send("GET", "/opnode/eth/v1/missing", "")
+		require.Equal(t, http.StatusNotFound, code)
+		code, _, _ = send("GET", "/opnode/healthz", "")
+		require.Equal(t, http.StatusTooManyRequests, code)
+	})
+
+	t.Run("json-rpc is still served", func(t *testing.T) {
+		code, _, _ := send("POST", "/", `{"jsonrpc":"2.0","method":"eth_chainId","id":1}`)
+		require.Equal(t, http.StatusOK, code)
+	})
+}
+
+func TestPathRoutesAPIKeys(t *testing.T) {
+	pathHandler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name + " " + r.URL.Path))
+		})
+	}
+	goodBackend := NewMockBackend(pathHandler("good"))
+	defer goodBackend.Close()
+	premiumBackend := NewMockBackend(pathHandler("premium"))
+	defer premiumBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("KEYED_BACKEND_RPC_URL", goodBackend.URL()+"/v2/node-key"))
+	require.NoError(t, os.Setenv("PREMIUM_BACKEND_RPC_URL", premiumBackend.URL()))
+
+	config := ReadConfig("path_routes_api_keys")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	send := func(key, path string) (int, string) {
+		req, err := http.NewRequest("GET", "http://127.0.0.1:8545"+path, nil)
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(bytes.TrimSpace(body))
+	}
+
+	t.Run("the path of the backend url is kept", func(t *testing.T) {
+		code, body := send("open_key", "/opnode/eth/v1/node/version")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "good /v2/node-key/eth/v1/node/version", body)
+		code, body = send("open_key", "/graphql")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "good /v2/node-key/graphql", body)
+	})
+
+	t.Run("keys restricted to some methods only use the routes they list", func(t *testing.T) {
+		code, _ := send("restricted_key", "/graphql")
+		require.Equal(t, http.StatusForbidden, code)
+		code, _ = send("limited_key", "/opnode/healthz")
+		require.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("requests count against the quota of the key", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			code, _ := send("limited_key", "/graphql")
+			require.Equal(t, http.StatusOK, code)
+		}
+		code, _ := send("limited_key", "/graphql")
+		require.Equal(t, http.StatusTooManyRequests, code)
+	})
+
+	t.Run("the backend group of the key serves its requests", func(t *testing.T) {
+		code, body := send("premium_key", "/graphql")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "premium /graphql", body)
+	})
+
+	t.Run("requests without a key are rejected", func(t *testing.T) {
+		code, _ := send("", "/graphql")
+		require.Equal(t, http.StatusUnauthorized, code)
+	})
+}
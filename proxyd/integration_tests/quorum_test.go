@@ -0,0 +1,98 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuorum(t *testing.T) {
+	routers := make([]*BatchRPCResponseRouter, 3)
+	backends := make([]*MockBackend, 3)
+	for i, name := range []string{"FIRST", "SECOND", "THIRD"} {
+		routers[i] = NewBatchRPCResponseRouter()
+		routers[i].SetFallbackRoute("eth_chainId", "0x10")
+		backends[i] = NewMockBackend(routers[i])
+		defer backends[i].Close()
+		require.NoError(t, os.Setenv(name+"_BACKEND_RPC_URL", backends[i].URL()))
+	}
+
+	config := ReadConfig("quorum")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	reset := func() {
+		for _, be := range backends {
+			be.Reset()
+		}
+	}
+
+	t.Run("returns the result the quorum agrees on", func(t *testing.T) {
+		reset()
+		routers[0].SetFallbackRoute("eth_getBalance", "0xABCD")
+		routers[1].SetFallbackRoute("eth_getBalance", "0x1")
+		routers[2].SetFallbackRoute("eth_getBalance", "0xabcd")
+
+		res, code, err := client.SendRPC("eth_getBalance", []interface{}{"0x0000000000000000000000000000000000000000", "finalized"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","result":"0xABCD","id":999}`), res)
+	})
+
+	t.Run("returns an error without a quorum", func(t *testing.T) {
+		reset()
+		routers[0].SetFallbackRoute("eth_getBalance", "0x1")
+		routers[1].SetFallbackRoute("eth_getBalance", "0x2")
+		routers[2].SetFallbackRoute("eth_getBalance", "0x3")
+
+		res, code, err := client.SendRPC("eth_getBalance", []interface{}{"0x0000000000000000000000000000000000000000", "finalized"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadGateway, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32023,"message":"backends did not reach quorum"},"id":999}`), res)
+		for _, be := range backends {
+			require.Len(t, be.Requests(), 1)
+		}
+	})
+
+	t.Run("calls of a batch are decided separately", func(t *testing.T) {
+		reset()
+		routers[0].SetFallbackRoute("eth_getBalance", "0x1")
+		routers[1].SetFallbackRoute("eth_getBalance", "0x1")
+		routers[2].SetFallbackRoute("eth_getBalance", "0x1")
+		routers[0].SetFallbackRoute("eth_call", "0x1")
+		routers[1].SetFallbackRoute("eth_call", "0x2")
+		routers[2].SetFallbackRoute("eth_call", "0x3")
+
+		res, code, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_getBalance", []interface{}{"0x0000000000000000000000000000000000000000", "finalized"}),
+			NewRPCReq("2", "eth_call", []interface{}{map[string]string{"to": "0x0000000000000000000000000000000000000000"}, "finalized"}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(`[
+			{"jsonrpc":"2.0","result":"0x1","id":1},
+			{"jsonrpc":"2.0","error":{"code":-32023,"message":"backends did not reach quorum"},"id":2}
+		]`), res)
+	})
+
+	t.Run("other methods are sent to a single backend", func(t *testing.T) {
+		reset()
+		res, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","result":"0x10","id":999}`), res)
+		// give a chance to any stray request to land
+		time.Sleep(50 * time.Millisecond)
+		total := 0
+		for _, be := range backends {
+			total += len(be.Requests())
+		}
+		require.Equal(t, 1, total)
+	})
+}
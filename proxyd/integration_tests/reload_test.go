@@ -0,0 +1,307 @@
+package integration_tests
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	firstResponse  = `{"jsonrpc": "2.0", "result": "first", "id": 999}`
+	secondResponse = `{"jsonrpc": "2.0", "result": "second", "id": 999}`
+)
+
+func TestConfigReload(t *testing.T) {
+	firstBackend := NewMockBackend(SingleResponseHandler(200, firstResponse))
+	defer firstBackend.Close()
+	secondBackend := NewMockBackend(SingleResponseHandler(200, secondResponse))
+	defer secondBackend.Close()
+
+	require.NoError(t, os.Setenv("FIRST_BACKEND_RPC_URL", firstBackend.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_RPC_URL", secondBackend.URL()))
+
+	config := ReadConfig("reload")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	res, code, err := client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(firstResponse), res)
+
+	firstGroup := srv.BackendGroups["first"]
+
+	t.Run("method mappings are swapped", func(t *testing.T) {
+		require.NoError(t, srv.Reload(ReadConfig("reload_updated")))
+
+		res, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(secondResponse), res)
+
+		res, code, err = client.SendRPC("net_version", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(firstResponse), res)
+	})
+
+	t.Run("unchanged backend groups are kept", func(t *testing.T) {
+		require.Same(t, firstGroup, srv.BackendGroups["first"])
+	})
+
+	t.Run("invalid config is rejected", func(t *testing.T) {
+		require.Error(t, srv.Reload(ReadConfig("reload_invalid")))
+
+		res, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(secondResponse), res)
+	})
+
+	t.Run("rate limit changes take effect", func(t *testing.T) {
+		limited := ReadConfig("reload")
+		limited.RateLimit = proxyd.RateLimitConfig{
+			BaseRate:     1,
+			BaseInterval: proxyd.TOMLDuration(time.Minute),
+		}
+		require.NoError(t, srv.Reload(limited))
+
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		_, code, err = client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 429, code)
+
+		require.NoError(t, srv.Reload(ReadConfig("reload")))
+		_, code, err = client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("admin overrides are kept when a backend is rebuilt", func(t *testing.T) {
+		be := srv.BackendGroups["first"].Backends[0]
+		be.SetDraining(true)
+		be.SetForcedCandidate(true)
+
+		rebuilt := ReadConfig("reload")
+		rebuilt.Backends["first"].MaxRPS = 100
+		require.NoError(t, srv.Reload(rebuilt))
+		be = srv.BackendGroups["first"].Backends[0]
+		require.True(t, be.IsDraining())
+		require.True(t, be.IsForcedCandidate())
+		be.SetDraining(false)
+		be.SetForcedCandidate(false)
+
+		// without an override, forced candidates follow the config
+		forced := ReadConfig("reload")
+		forced.Backends["first"].ConsensusForcedCandidate = true
+		require.NoError(t, srv.Reload(forced))
+		require.True(t, srv.BackendGroups["first"].Backends[0].IsForcedCandidate())
+		require.NoError(t, srv.Reload(ReadConfig("reload")))
+		require.False(t, srv.BackendGroups["first"].Backends[0].IsForcedCandidate())
+		require.False(t, srv.BackendGroups["first"].Backends[0].IsDraining())
+	})
+
+	t.Run("config is reloaded on SIGHUP", func(t *testing.T) {
+		dir, err := os.Getwd()
+		require.NoError(t, err)
+		configPath := path.Join(t.TempDir(), "proxyd.toml")
+		updated, err := os.ReadFile(path.Join(dir, "testdata/reload_updated.toml"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(configPath, updated, 0600))
+
+		// no polling, the reload can only be triggered by the signal
+		reloader := proxyd.NewConfigReloader(configPath, srv, 0)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP, syscall.SIGUSR1)
+		defer signal.Stop(sig)
+		done := make(chan os.Signal, 1)
+		go func() {
+			done <- reloader.WaitForSignals(sig)
+		}()
+
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+		require.Eventually(t, func() bool {
+			res, _, err := client.SendRPC("eth_chainId", nil)
+			return err == nil && string(canonicalizeJSON(t, res)) == string(canonicalizeJSON(t, []byte(secondResponse)))
+		}, 2*time.Second, 50*time.Millisecond)
+
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+		select {
+		case recvSig := <-done:
+			require.Equal(t, syscall.SIGUSR1, recvSig)
+		case <-time.After(2 * time.Second):
+			t.Fatal("reloader did not return on a non-reload signal")
+		}
+		require.NoError(t, srv.Reload(ReadConfig("reload")))
+	})
+
+	t.Run("config file changes are picked up", func(t *testing.T) {
+		dir, err := os.Getwd()
+		require.NoError(t, err)
+		original, err := os.ReadFile(path.Join(dir, "testdata/reload.toml"))
+		require.NoError(t, err)
+
+		configPath := path.Join(t.TempDir(), "proxyd.toml")
+		updated, err := os.ReadFile(path.Join(dir, "testdata/reload_updated.toml"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(configPath, updated, 0600))
+
+		reloader := proxyd.NewConfigReloader(configPath, srv, 50*time.Millisecond)
+		reloader.Start()
+		defer reloader.Stop()
+
+		require.NoError(t, os.WriteFile(configPath, original, 0600))
+		require.Eventually(t, func() bool {
+			res, _, err := client.SendRPC("eth_chainId", nil)
+			return err == nil && string(canonicalizeJSON(t, res)) == string(canonicalizeJSON(t, []byte(firstResponse)))
+		}, 2*time.Second, 50*time.Millisecond)
+	})
+}
+
+func TestConfigReloadConsensusHA(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	node1 := NewMockBackend(SingleResponseHandler(200, firstResponse))
+	defer node1.Close()
+	require.NoError(t, os.Setenv("NODE1_URL", node1.URL()))
+
+	readConfig := func(maxBlockLag uint64) *proxyd.Config {
+		config := ReadConfig("reload_ha")
+		config.BackendGroups["node"].ConsensusHARedis.URL = fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())
+		config.BackendGroups["node"].ConsensusMaxBlockLag = maxBlockLag
+		return config
+	}
+
+	srv, shutdown, err := proxyd.Start(readConfig(8))
+	require.NoError(t, err)
+	defer shutdown()
+
+	oldGroup := srv.BackendGroups["node"]
+	require.Eventually(t, func() bool {
+		return redis.CurrentConnectionCount() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the deprecated flag can't be combined with routing_strategy, even for a group that would be reused
+	conflicting := readConfig(8)
+	conflicting.BackendGroups["node"].ConsensusAware = true
+	require.Error(t, srv.Reload(conflicting))
+	require.Same(t, oldGroup, srv.BackendGroups["node"])
+
+	require.NoError(t, srv.Reload(readConfig(16)))
+	require.NotSame(t, oldGroup, srv.BackendGroups["node"])
+
+	// the retired tracker must stop its heartbeat and close its client,
+	// leaving only the connection of the new tracker
+	require.Eventually(t, func() bool {
+		return redis.CurrentConnectionCount() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool {
+		return redis.CurrentConnectionCount() > 1
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	srv.Shutdown()
+	require.Eventually(t, func() bool {
+		return redis.CurrentConnectionCount() == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigReloadInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		SingleResponseHandler(200, firstResponse)(w, r)
+	}))
+	defer slowBackend.Close()
+	secondBackend := NewMockBackend(SingleResponseHandler(200, secondResponse))
+	defer secondBackend.Close()
+
+	require.NoError(t, os.Setenv("FIRST_BACKEND_RPC_URL", slowBackend.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_RPC_URL", secondBackend.URL()))
+
+	srv, shutdown, err := proxyd.Start(ReadConfig("reload"))
+	require.NoError(t, err)
+	defer shutdown()
+	client := NewProxydClient("http://127.0.0.1:8545")
+	oldGroup := srv.BackendGroups["first"]
+
+	type result struct {
+		res  []byte
+		code int
+		err  error
+	}
+	resC := make(chan result, 1)
+	go func() {
+		res, code, err := client.SendRPC("eth_chainId", nil)
+		resC <- result{res, code, err}
+	}()
+	<-started
+
+	// changing the backend replaces it and its group while the request is in flight
+	updated := ReadConfig("reload")
+	updated.Backends["first"].Headers = map[string]string{"X-Reloaded": "true"}
+	require.NoError(t, srv.Reload(updated))
+	require.NotSame(t, oldGroup, srv.BackendGroups["first"])
+	close(release)
+
+	r := <-resC
+	require.NoError(t, r.err)
+	require.Equal(t, 200, r.code)
+	RequireEqualJSON(t, []byte(firstResponse), r.res)
+}
+
+func TestConfigReloadWSSessions(t *testing.T) {
+	backend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}, nil)
+	defer backend.Close()
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	srv, shutdown, err := proxyd.Start(ReadConfig("ws"))
+	require.NoError(t, err)
+	defer shutdown()
+
+	msgC := make(chan []byte, 1)
+	client, err := NewProxydWSClient("ws://127.0.0.1:8546", func(msgType int, data []byte) {
+		msgC <- data
+	}, nil)
+	require.NoError(t, err)
+	defer client.HardClose()
+
+	subscribe := func() {
+		require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(`{"id": 1, "method": "eth_subscribe", "params": ["newHeads"]}`)))
+		select {
+		case msg := <-msgC:
+			RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`), msg)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no response on websocket session")
+		}
+	}
+	subscribe()
+
+	oldGroup := srv.BackendGroups["main"]
+	updated := ReadConfig("ws")
+	updated.Backends["good"].Headers = map[string]string{"X-Reloaded": "true"}
+	require.NoError(t, srv.Reload(updated))
+	require.NotSame(t, oldGroup, srv.BackendGroups["main"])
+
+	// the session opened before the reload keeps proxying to its backend
+	subscribe()
+}
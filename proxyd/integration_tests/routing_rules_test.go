@@ -0,0 +1,67 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingRules(t *testing.T) {
+	newBackend := func(name string) *MockBackend {
+		router := NewBatchRPCResponseRouter()
+		router.SetFallbackRoute("eth_getBalance", name)
+		router.SetFallbackRoute("debug_traceTransaction", name)
+		router.SetFallbackRoute("debug_traceCall", name)
+		return NewMockBackend(router)
+	}
+	mainBackend := newBackend("main")
+	defer mainBackend.Close()
+	archiveBackend := newBackend("archive")
+	defer archiveBackend.Close()
+	tracingBackend := newBackend("tracing")
+	defer tracingBackend.Close()
+
+	require.NoError(t, os.Setenv("MAIN_BACKEND_RPC_URL", mainBackend.URL()))
+	require.NoError(t, os.Setenv("ARCHIVE_BACKEND_RPC_URL", archiveBackend.URL()))
+	require.NoError(t, os.Setenv("TRACING_BACKEND_RPC_URL", tracingBackend.URL()))
+
+	config := ReadConfig("routing_rules")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("every call of a batch is routed by the rules", func(t *testing.T) {
+		res, code, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_getBalance", []interface{}{"0x01", "latest"}),
+			NewRPCReq("2", "eth_getBalance", []interface{}{"0x01", "0x10"}),
+			NewRPCReq("3", "eth_getBalance", []interface{}{"0x01"}),
+			NewRPCReq("4", "debug_traceTransaction", []interface{}{"0x01"}),
+			NewRPCReq("5", "debug_traceCall", []interface{}{map[string]string{}, "latest"}),
+			NewRPCReq("6", "eth_sign", []interface{}{}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(`[
+			{"jsonrpc": "2.0", "result": "main", "id": 1},
+			{"jsonrpc": "2.0", "result": "archive", "id": 2},
+			{"jsonrpc": "2.0", "result": "main", "id": 3},
+			{"jsonrpc": "2.0", "result": "tracing", "id": 4},
+			{"jsonrpc": "2.0", "result": "tracing", "id": 5},
+			{"jsonrpc": "2.0", "error": {"code": -32601, "message": "rpc method is not whitelisted"}, "id": 6}
+		]`), res)
+	})
+
+	t.Run("rules are reloaded", func(t *testing.T) {
+		newConfig := ReadConfig("routing_rules")
+		newConfig.RoutingRules = newConfig.RoutingRules[:1]
+		require.NoError(t, srv.Reload(newConfig))
+
+		res, _, err := client.SendRPC("eth_getBalance", []interface{}{"0x01", "latest"})
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "archive", "id": 999}`), res)
+	})
+}
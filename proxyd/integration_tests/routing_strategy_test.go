@@ -0,0 +1,106 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAwareRoutingStrategies(t *testing.T) {
+	slowBackend := NewMockBackend(nil)
+	defer slowBackend.Close()
+	fastBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer fastBackend.Close()
+
+	require.NoError(t, os.Setenv("SLOW_BACKEND_RPC_URL", slowBackend.URL()))
+	require.NoError(t, os.Setenv("FAST_BACKEND_RPC_URL", fastBackend.URL()))
+
+	config := ReadConfig("routing_strategies")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("least_latency prefers the fastest backend", func(t *testing.T) {
+		slowBackend.SetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(50 * time.Millisecond)
+			BatchedResponseHandler(200, goodResponse)(w, r)
+		}))
+		slowBackend.Reset()
+		fastBackend.Reset()
+
+		// backends without latency samples are ranked first, so both get a sample
+		for i := 0; i < 20 && (len(slowBackend.Requests()) == 0 || len(fastBackend.Requests()) == 0); i++ {
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+		}
+		require.NotEmpty(t, slowBackend.Requests())
+		require.NotEmpty(t, fastBackend.Requests())
+
+		slowBackend.Reset()
+		fastBackend.Reset()
+		for i := 0; i < 10; i++ {
+			res, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(goodResponse), res)
+		}
+		require.Empty(t, slowBackend.Requests())
+		require.Len(t, fastBackend.Requests(), 10)
+	})
+
+	t.Run("least_outstanding avoids busy backends", func(t *testing.T) {
+		var once sync.Once
+		started := make(chan struct{})
+		release := make(chan struct{})
+		slowBackend.SetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			once.Do(func() { close(started) })
+			<-release
+			BatchedResponseHandler(200, goodResponse)(w, r)
+		}))
+
+		// keep sending requests until one of them is stuck on the slow backend
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-started:
+					return
+				default:
+				}
+				_, _, _ = client.SendRPC("eth_blockNumber", nil)
+			}
+		}()
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a request on the slow backend")
+		}
+
+		fastBackend.Reset()
+		for i := 0; i < 10; i++ {
+			res, code, err := client.SendRPC("eth_blockNumber", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(goodResponse), res)
+		}
+		require.Len(t, fastBackend.Requests(), 10)
+
+		close(release)
+		<-done
+	})
+}
+
+func TestConsensusRoutingStrategyRequiresConsensusAware(t *testing.T) {
+	config := ReadConfig("routing_strategies")
+	config.BackendGroups["latency"].ConsensusRoutingStrategy = proxyd.LeastLatencyRoutingStrategy
+	_, _, err := proxyd.Start(config)
+	require.Error(t, err)
+}
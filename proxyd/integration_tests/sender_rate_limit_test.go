@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"fmt"
 	"math"
+	"math/big"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -121,6 +125,47 @@ func TestSenderRateLimitLimiting(t *testing.T) {
 	)), res)
 }
 
+func TestSenderRateLimitInflightNonces(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("sender_rate_limit")
+	config.SenderRateLimit.Limit = math.MaxInt
+	config.SenderRateLimit.Algorithm = proxyd.SlidingWindowRateLimitAlgorithm
+	config.SenderRateLimit.MaxInflightNonces = 2
+	config.SenderRateLimit.InflightNonceWindow = proxyd.TOMLDuration(time.Minute)
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(big.NewInt(420))
+	sendNonce := func(nonce uint64) []byte {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{ChainID: big.NewInt(420), Nonce: nonce})
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		res, _, err := client.SendRequest(makeSendRawTransaction(hexutil.Encode(data)))
+		require.NoError(t, err)
+		return res
+	}
+
+	RequireEqualJSON(t, []byte(dummyRes), sendNonce(0))
+	RequireEqualJSON(t, []byte(dummyRes), sendNonce(1))
+	// a nonce already in flight can be resent
+	RequireEqualJSON(t, []byte(dummyRes), sendNonce(0))
+	RequireEqualJSON(t, []byte(limRes), sendNonce(2))
+
+	// other senders have their own nonces
+	res, _, err := client.SendRequest(makeSendRawTransaction(txHex1))
+	require.NoError(t, err)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+}
+
 func makeSendRawTransaction(dataHex string) []byte {
 	return []byte(`{"jsonrpc":"2.0","method":"eth_sendRawTransaction","params":["` + dataHex + `"],"id":1}`)
 }
@@ -0,0 +1,102 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStickySessions(t *testing.T) {
+	newBackend := func(name string, filterID string) *MockBackend {
+		router := NewBatchRPCResponseRouter()
+		router.SetFallbackRoute("eth_chainId", name)
+		router.SetFallbackRoute("eth_newFilter", filterID)
+		router.SetFallbackRoute("eth_getFilterChanges", name)
+		router.SetFallbackRoute("eth_uninstallFilter", "uninstalled")
+		return NewMockBackend(router)
+	}
+	aBackend := newBackend("a", "0x1")
+	defer aBackend.Close()
+	bBackend := newBackend("b", "0x2")
+	defer bBackend.Close()
+
+	require.NoError(t, os.Setenv("A_BACKEND_RPC_URL", aBackend.URL()))
+	require.NoError(t, os.Setenv("B_BACKEND_RPC_URL", bBackend.URL()))
+
+	config := ReadConfig("sticky_sessions")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	bg := srv.BackendGroups["main"]
+	a, b := bg.Backends[0], bg.Backends[1]
+	defer a.SetDraining(false)
+
+	t.Run("filter calls go to the backend that created the filter", func(t *testing.T) {
+		a.SetDraining(true)
+		res, _, err := client.SendRPC("eth_newFilter", []interface{}{map[string]string{}})
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "0x2", "id": 999}`), res)
+		a.SetDraining(false)
+
+		res, _, err = client.SendBatchRPC(
+			NewRPCReq("1", "eth_getFilterChanges", []interface{}{"0x2"}),
+			NewRPCReq("2", "eth_chainId", nil),
+		)
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`[
+			{"jsonrpc": "2.0", "result": "b", "id": 1},
+			{"jsonrpc": "2.0", "result": "a", "id": 2}
+		]`), res)
+
+		res, _, err = client.SendRPC("eth_uninstallFilter", []interface{}{"0x2"})
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "uninstalled", "id": 999}`), res)
+	})
+
+	t.Run("unavailable filter backend returns filter not found", func(t *testing.T) {
+		res, _, err := client.SendRPC("eth_newFilter", []interface{}{map[string]string{}})
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "0x1", "id": 999}`), res)
+
+		a.SetDraining(true)
+		res, code, err := client.SendRPC("eth_getFilterChanges", []interface{}{"0x1"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "error": {"code": -32024, "message": "filter not found"}, "id": 999}`), res)
+		a.SetDraining(false)
+
+		// the filter is forgotten, the backend answers for itself
+		res, _, err = client.SendRPC("eth_getFilterChanges", []interface{}{"0x1"})
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "a", "id": 999}`), res)
+	})
+
+	t.Run("clients stick to a backend", func(t *testing.T) {
+		pinned := NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"X-Session-Id": []string{"client"}})
+
+		a.SetDraining(true)
+		res, _, err := pinned.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "b", "id": 999}`), res)
+		a.SetDraining(false)
+
+		res, _, err = pinned.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "b", "id": 999}`), res)
+		res, _, err = client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "a", "id": 999}`), res)
+
+		// a drained backend releases its clients
+		b.SetDraining(true)
+		defer b.SetDraining(false)
+		res, _, err = pinned.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "a", "id": 999}`), res)
+	})
+}
@@ -0,0 +1,82 @@
+package integration_tests
+
+import (
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTracing(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, `{"jsonrpc": "2.0", "result": "0x420", "id": 1}`))
+	defer goodBackend.Close()
+	collector := NewMockBackend(SingleResponseHandler(200, `{}`))
+	defer collector.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("OTLP_COLLECTOR_URL", collector.URL()))
+
+	config := ReadConfig("tracing")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID := "00f067aa0ba902b7"
+	client := NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{
+		"Traceparent": []string{"00-" + traceID + "-" + parentID + "-01"},
+	})
+	_, code, err := client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+
+	require.Len(t, goodBackend.Requests(), 1)
+	traceParent := strings.Split(goodBackend.Requests()[0].Headers.Get("traceparent"), "-")
+	require.Len(t, traceParent, 4)
+	require.Equal(t, traceID, traceParent[1])
+	require.Equal(t, "01", traceParent[3])
+
+	// spans are flushed on shutdown
+	shutdown()
+	require.NotEmpty(t, collector.Requests())
+
+	spans := make(map[string]*tracepb.Span)
+	for _, req := range collector.Requests() {
+		require.Equal(t, "/v1/traces", req.Path)
+		var body coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(req.Body, &body))
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					require.Equal(t, traceID, hex.EncodeToString(span.TraceId))
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+
+	// the spans form a single chain from the caller to the backend
+	chain := []string{
+		"proxyd.HandleRPC",
+		"proxyd.handle_batch",
+		"proxyd.backend_group.forward",
+		"proxyd.backend.request",
+	}
+	parent := parentID
+	for _, name := range chain {
+		span, ok := spans[name]
+		require.True(t, ok, "missing span %s", name)
+		require.Equal(t, parent, hex.EncodeToString(span.ParentSpanId), "parent of span %s", name)
+		// spans of successful stages leave their status unset
+		require.Equal(t, tracepb.Status_STATUS_CODE_UNSET, span.Status.GetCode(), "status of span %s", name)
+		parent = hex.EncodeToString(span.SpanId)
+	}
+	require.Equal(t, traceParent[2], parent)
+	require.Contains(t, spans, "proxyd.cache.get")
+}
@@ -0,0 +1,68 @@
+package integration_tests
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxPolicy(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	tx := new(types.Transaction)
+	require.NoError(t, tx.UnmarshalBinary(hexutil.MustDecode(txHex2)))
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	require.NoError(t, err)
+
+	config := ReadConfig("tx_policy")
+	config.TxPolicy.DeniedSenders = []string{from.Hex()}
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("retries are deduplicated", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRequest(makeSendRawTransaction(txHex1))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+		for i := 0; i < 2; i++ {
+			res, code, err := client.SendRequest(makeSendRawTransaction(txHex1))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, code)
+			RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "result": "dummy", "id": 1}`), res)
+		}
+		require.Len(t, goodBackend.Requests(), 1)
+	})
+
+	t.Run("denied senders are rejected", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRequest(makeSendRawTransaction(txHex2))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusForbidden, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc": "2.0", "error": {"code": -32025, "message": "sender is not allowed"}, "id": 1}`), res)
+		require.Empty(t, goodBackend.Requests())
+	})
+
+	t.Run("calls of a batch are checked separately", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRequest([]byte(fmt.Sprintf(`[%s, %s]`, makeSendRawTransaction(txHex1), makeSendRawTransaction(txHex2))))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		RequireEqualJSON(t, []byte(`[
+			{"jsonrpc": "2.0", "result": "dummy", "id": 1},
+			{"jsonrpc": "2.0", "error": {"code": -32025, "message": "sender is not allowed"}, "id": 1}
+		]`), res)
+		require.Empty(t, goodBackend.Requests())
+	})
+}
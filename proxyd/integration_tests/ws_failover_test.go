@@ -0,0 +1,71 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSFailover(t *testing.T) {
+	rpcBackend := NewMockBackend(SingleResponseHandler(200, `{"jsonrpc": "2.0", "result": "0x420", "id": 1}`))
+	defer rpcBackend.Close()
+	first := newSubscriptionBackend("first")
+	first.mute = "eth_chainId"
+	defer first.Close()
+	second := newSubscriptionBackend("second")
+	defer second.Close()
+
+	require.NoError(t, os.Setenv("RPC_BACKEND_URL", rpcBackend.URL()))
+	require.NoError(t, os.Setenv("FIRST_WS_BACKEND_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_WS_BACKEND_URL", second.URL()))
+
+	config := ReadConfig("ws_failover")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := newWSTestClient(t)
+	defer client.HardClose()
+
+	subID := client.Call(t, "eth_subscribe", "newHeads")["result"].(string)
+	require.Equal(t, "0xfirst1", subID)
+	first.Notify(t, subID, "head1")
+	require.Equal(t, "head1", client.Next(t)["params"].(map[string]interface{})["result"])
+
+	t.Run("subscriptions are replayed on the next backend", func(t *testing.T) {
+		require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc": "2.0", "method": "eth_chainId", "params": [], "id": 2}`)))
+		require.Eventually(t, func() bool {
+			return len(first.Calls()) == 2
+		}, 5*time.Second, 50*time.Millisecond)
+		first.Close()
+
+		// the call written to the failed backend is answered by proxyd
+		res := client.Next(t)
+		require.Equal(t, float64(2), res["id"])
+		require.Equal(t, "backend offline", res["error"].(map[string]interface{})["message"])
+
+		require.Eventually(t, func() bool {
+			return len(second.Calls()) == 1
+		}, 5*time.Second, 50*time.Millisecond)
+		require.JSONEq(t, `["newHeads"]`, string(second.Requests()[0].Params))
+
+		second.Notify(t, "0xsecond1", "head2")
+		params := client.Next(t)["params"].(map[string]interface{})
+		require.Equal(t, subID, params["subscription"])
+		require.Equal(t, "head2", params["result"])
+	})
+
+	t.Run("the client keeps its connection", func(t *testing.T) {
+		require.Equal(t, true, client.Call(t, "eth_unsubscribe", subID)["result"])
+		reqs := second.Requests()
+		require.Equal(t, "eth_unsubscribe", reqs[len(reqs)-1].Method)
+		var params []string
+		require.NoError(t, json.Unmarshal(reqs[len(reqs)-1].Params, &params))
+		require.Equal(t, []string{"0xsecond1"}, params)
+	})
+}
@@ -0,0 +1,239 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/infra/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriptionBackend is a websocket backend that accepts subscriptions
+// and lets the test push notifications for them
+type subscriptionBackend struct {
+	*MockWSBackend
+	name  string
+	mtx   sync.Mutex
+	conn  *websocket.Conn
+	calls []string
+	reqs  []proxyd.RPCReq
+	subs  int
+	// early is sent as a notification of new subscriptions before their ID
+	early string
+	// mute is a method the backend never responds to
+	mute string
+}
+
+func newSubscriptionBackend(name string) *subscriptionBackend {
+	b := &subscriptionBackend{name: name}
+	b.MockWSBackend = NewMockWSBackend(func(conn *websocket.Conn) {
+		b.mtx.Lock()
+		b.conn = conn
+		b.mtx.Unlock()
+	}, func(conn *websocket.Conn, msgType int, data []byte) {
+		var req proxyd.RPCReq
+		if err := json.Unmarshal(data, &req); err != nil {
+			panic(err)
+		}
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		b.calls = append(b.calls, req.Method)
+		b.reqs = append(b.reqs, req)
+		if req.Method == b.mute {
+			return
+		}
+		var result interface{} = true
+		if req.Method == "eth_subscribe" {
+			b.subs++
+			result = fmt.Sprintf("0x%s%d", b.name, b.subs)
+			if b.early != "" {
+				b.notify(result.(string), b.early)
+			}
+		}
+		if err := conn.WriteJSON(proxyd.NewRPCRes(req.ID, result)); err != nil {
+			panic(err)
+		}
+	}, nil)
+	return b
+}
+
+func (b *subscriptionBackend) Calls() []string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return append([]string{}, b.calls...)
+}
+
+func (b *subscriptionBackend) Requests() []proxyd.RPCReq {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return append([]proxyd.RPCReq{}, b.reqs...)
+}
+
+func (b *subscriptionBackend) Notify(t *testing.T, subID string, result string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	require.NoError(t, b.notify(subID, result))
+}
+
+func (b *subscriptionBackend) notify(subID string, result string) error {
+	return b.conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscription",
+		"params": map[string]interface{}{
+			"subscription": subID,
+			"result":       result,
+		},
+	})
+}
+
+type wsTestClient struct {
+	*ProxydWSClient
+	msgs chan map[string]interface{}
+}
+
+func newWSTestClient(t *testing.T) *wsTestClient {
+	c := &wsTestClient{msgs: make(chan map[string]interface{}, 16)}
+	client, err := NewProxydWSClient("ws://127.0.0.1:8546", func(msgType int, data []byte) {
+		var msg map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &msg))
+		c.msgs <- msg
+	}, nil)
+	require.NoError(t, err)
+	c.ProxydWSClient = client
+	return c
+}
+
+func (c *wsTestClient) Call(t *testing.T, method string, params ...interface{}) map[string]interface{} {
+	if params == nil {
+		params = []interface{}{}
+	}
+	require.NoError(t, c.WriteMessage(websocket.TextMessage, []byte(
+		fmt.Sprintf(`{"jsonrpc": "2.0", "method": %q, "params": %s, "id": 1}`, method, mustMarshal(params)),
+	)))
+	return c.Next(t)
+}
+
+func (c *wsTestClient) Next(t *testing.T) map[string]interface{} {
+	select {
+	case msg := <-c.msgs:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ws message")
+		return nil
+	}
+}
+
+func mustMarshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func TestWSMultiplexSubscriptions(t *testing.T) {
+	rpcBackend := NewMockBackend(SingleResponseHandler(200, `{"jsonrpc": "2.0", "result": "0x420", "id": 1}`))
+	defer rpcBackend.Close()
+	first := newSubscriptionBackend("first")
+	defer first.Close()
+	second := newSubscriptionBackend("second")
+	defer second.Close()
+
+	require.NoError(t, os.Setenv("RPC_BACKEND_URL", rpcBackend.URL()))
+	require.NoError(t, os.Setenv("FIRST_WS_BACKEND_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_WS_BACKEND_URL", second.URL()))
+
+	config := ReadConfig("ws_multiplex")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	alice := newWSTestClient(t)
+	defer alice.HardClose()
+	bob := newWSTestClient(t)
+	defer bob.HardClose()
+
+	aliceSub := alice.Call(t, "eth_subscribe", "newHeads")["result"].(string)
+	bobSub := bob.Call(t, "eth_subscribe", "newHeads")["result"].(string)
+	require.NotEqual(t, aliceSub, bobSub)
+
+	t.Run("clients share the upstream subscription", func(t *testing.T) {
+		require.Equal(t, []string{"eth_subscribe"}, first.Calls())
+
+		first.Notify(t, "0xfirst1", "head1")
+		for client, subID := range map[*wsTestClient]string{alice: aliceSub, bob: bobSub} {
+			params := client.Next(t)["params"].(map[string]interface{})
+			require.Equal(t, subID, params["subscription"])
+			require.Equal(t, "head1", params["result"])
+		}
+	})
+
+	t.Run("other calls are forwarded over http", func(t *testing.T) {
+		require.Equal(t, "0x420", alice.Call(t, "eth_chainId")["result"])
+		require.Len(t, rpcBackend.Requests(), 1)
+	})
+
+	t.Run("subscriptions survive a backend failure", func(t *testing.T) {
+		first.Close()
+		require.Eventually(t, func() bool {
+			return len(second.Calls()) == 1
+		}, 5*time.Second, 50*time.Millisecond)
+
+		second.Notify(t, "0xsecond1", "head2")
+		for client, subID := range map[*wsTestClient]string{alice: aliceSub, bob: bobSub} {
+			params := client.Next(t)["params"].(map[string]interface{})
+			require.Equal(t, subID, params["subscription"])
+			require.Equal(t, "head2", params["result"])
+		}
+	})
+
+	t.Run("the upstream subscription is cancelled with its last client", func(t *testing.T) {
+		require.Equal(t, true, alice.Call(t, "eth_unsubscribe", aliceSub)["result"])
+		require.Equal(t, false, alice.Call(t, "eth_unsubscribe", bobSub)["result"])
+		require.Equal(t, []string{"eth_subscribe"}, second.Calls())
+
+		bob.HardClose()
+		require.Eventually(t, func() bool {
+			calls := second.Calls()
+			return len(calls) == 2 && calls[1] == "eth_unsubscribe"
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+}
+
+func TestWSMultiplexEarlyNotifications(t *testing.T) {
+	rpcBackend := NewMockBackend(SingleResponseHandler(200, `{"jsonrpc": "2.0", "result": "0x420", "id": 1}`))
+	defer rpcBackend.Close()
+	first := newSubscriptionBackend("first")
+	first.early = "head0"
+	defer first.Close()
+	second := newSubscriptionBackend("second")
+	defer second.Close()
+
+	require.NoError(t, os.Setenv("RPC_BACKEND_URL", rpcBackend.URL()))
+	require.NoError(t, os.Setenv("FIRST_WS_BACKEND_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_WS_BACKEND_URL", second.URL()))
+
+	config := ReadConfig("ws_multiplex")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := newWSTestClient(t)
+	defer client.HardClose()
+
+	// the notification sent before the subscription ID is delivered after the response
+	subID := client.Call(t, "eth_subscribe", "newHeads")["result"].(string)
+	params := client.Next(t)["params"].(map[string]interface{})
+	require.Equal(t, subID, params["subscription"])
+	require.Equal(t, "head0", params["result"])
+
+	first.Notify(t, "0xfirst1", "head1")
+	params = client.Next(t)["params"].(map[string]interface{})
+	require.Equal(t, subID, params["subscription"])
+	require.Equal(t, "head1", params["result"])
+}
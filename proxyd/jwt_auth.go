@@ -0,0 +1,230 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultJWTPolicyClaim = "policy"
+	engineJWTSecretLength = 32
+)
+
+var errJWTPolicy = errors.New("no valid policy")
+
+// jwtMethods are the signing algorithms accepted from clients, so that "none" and the
+// algorithms without a configured key are rejected
+var jwtMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+}
+
+// JWTAuthenticator resolves the signed JWTs of clients to the API key of their policy
+type JWTAuthenticator struct {
+	secret        []byte
+	jwks          keyfunc.Keyfunc
+	issuer        string
+	audience      string
+	leeway        time.Duration
+	policyClaim   string
+	defaultPolicy string
+	policies      map[string]*APIKey
+	now           func() time.Time
+}
+
+func NewJWTAuthenticator(cfg JWTAuthConfig, limiterFactory limiterFactoryFunc) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		issuer:        cfg.Issuer,
+		audience:      cfg.Audience,
+		leeway:        time.Duration(cfg.Leeway),
+		policyClaim:   cfg.PolicyClaim,
+		defaultPolicy: cfg.DefaultPolicy,
+		policies:      make(map[string]*APIKey),
+		now:           time.Now,
+	}
+	if a.policyClaim == "" {
+		a.policyClaim = defaultJWTPolicyClaim
+	}
+
+	if cfg.Secret != "" {
+		secret, err := ReadFromEnvOrConfig(cfg.Secret)
+		if err != nil {
+			return nil, err
+		}
+		a.secret = []byte(secret)
+	}
+	if cfg.JWKSFile != "" {
+		jwks, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwks = jwks
+	}
+	if len(a.secret) == 0 && a.jwks == nil {
+		return nil, errors.New("jwt_auth requires a secret or a jwks file with at least one key")
+	}
+
+	if len(cfg.Policies) == 0 {
+		return nil, errors.New("jwt_auth requires at least one policy")
+	}
+	for name, policy := range cfg.Policies {
+		if policy.RateLimit < 0 || policy.DailyQuota < 0 {
+			return nil, fmt.Errorf("jwt policy %s has a negative limit", name)
+		}
+		key := newLimitedKey("jwt:"+name, APIKeyConfig{
+			RateLimit:         policy.RateLimit,
+			RateLimitInterval: policy.RateLimitInterval,
+			DailyQuota:        policy.DailyQuota,
+			AllowedMethods:    policy.AllowedMethods,
+			AllowedPathRoutes: policy.AllowedPathRoutes,
+			BackendGroup:      policy.BackendGroup,
+		}, "jwt:"+name, limiterFactory)
+		key.Label = name
+		if policy.Label != "" {
+			key.Label = policy.Label
+		}
+		a.policies[name] = key
+	}
+	if a.defaultPolicy != "" && a.policies[a.defaultPolicy] == nil {
+		return nil, fmt.Errorf("default jwt policy %s is not defined", a.defaultPolicy)
+	}
+	return a, nil
+}
+
+// Authenticate returns the key of the policy of the JWT presented by the request as a
+// bearer token or in the URL path. It returns nil without an error if the request
+// presents no JWT at all.
+func (a *JWTAuthenticator) Authenticate(r *http.Request, pathSecret string) (*APIKey, error) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !isJWT(token) {
+		token = pathSecret
+	}
+	if !isJWT(token) {
+		return nil, nil
+	}
+	key, err := a.authenticate(token)
+	if err != nil {
+		RecordJWTAuthRejection(jwtRejectionReason(err))
+		return nil, err
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) authenticate(token string) (*APIKey, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.leeway),
+		jwt.WithTimeFunc(a.now),
+	}
+	if a.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		opts = append(opts, jwt.WithAudience(a.audience))
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, a.key, opts...); err != nil {
+		return nil, err
+	}
+
+	policyName := a.defaultPolicy
+	if claim, ok := claims[a.policyClaim]; ok {
+		policyName, _ = claim.(string)
+	}
+	policy := a.policies[policyName]
+	if policy == nil {
+		return nil, fmt.Errorf("%w: %q", errJWTPolicy, policyName)
+	}
+
+	key := *policy
+	if sub, _ := claims.GetSubject(); sub != "" {
+		key.client = sub
+	}
+	return &key, nil
+}
+
+// key returns the key verifying the token: the secret for HS256, and the key of the
+// jwks file selected by the kid of the token for the other algorithms
+func (a *JWTAuthenticator) key(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(a.secret) == 0 {
+			return nil, errors.New("no secret for HS256 tokens")
+		}
+		return a.secret, nil
+	}
+	if a.jwks == nil {
+		return nil, fmt.Errorf("no jwks file for %s tokens", token.Method.Alg())
+	}
+	return a.jwks.Keyfunc(token)
+}
+
+func jwtRejectionReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return "signature"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "not_yet_valid"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "audience"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "issuer"
+	case errors.Is(err, errJWTPolicy):
+		return "policy"
+	default:
+		return "malformed"
+	}
+}
+
+// isJWT tells whether s has the shape of a compact JWT, so that other credentials
+// aren't reported as invalid tokens
+func isJWT(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+// loadJWKS reads the keys of a local JSON Web Key Set, it returns nil if the set has no keys
+func loadJWKS(path string) (keyfunc.Keyfunc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading jwks file: %w", err)
+	}
+	jwks, err := keyfunc.NewJWKSetJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks file %s: %w", path, err)
+	}
+	keys, err := jwks.Storage().KeyReadAll(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks file %s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return jwks, nil
+}
+
+// parseEngineJWTSecret decodes the hex encoded secret of a backend using engine API
+// style JWT auth, with or without a 0x prefix
+func parseEngineJWTSecret(s string) ([engineJWTSecretLength]byte, error) {
+	var secret [engineJWTSecretLength]byte
+	decoded, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return secret, fmt.Errorf("invalid jwt secret: %w", err)
+	}
+	if len(decoded) != engineJWTSecretLength {
+		return secret, fmt.Errorf("invalid jwt secret: must be %d bytes, got %d", engineJWTSecretLength, len(decoded))
+	}
+	copy(secret[:], decoded)
+	return secret, nil
+}
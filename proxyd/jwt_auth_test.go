@@ -0,0 +1,244 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func writeTestJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	b64 := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	]}`,
+		b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		b64(ecKey.X.FillBytes(make([]byte, 32))), b64(ecKey.Y.FillBytes(make([]byte, 32))))
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(jwks), 0o600))
+	return path
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("hmac_secret")
+	require.NoError(t, os.Setenv("JWT_AUTH_TEST_SECRET", string(secret)))
+
+	limiterFactory := func(dur time.Duration, max int, prefix string, algorithm string) FrontendRateLimiter {
+		return NewMemoryRateLimiter(algorithm, dur, max)
+	}
+	auth, err := NewJWTAuthenticator(JWTAuthConfig{
+		Secret:        "$JWT_AUTH_TEST_SECRET",
+		JWKSFile:      writeTestJWKS(t, rsaKey, ecKey),
+		Issuer:        "issuer",
+		Audience:      "proxyd",
+		Leeway:        TOMLDuration(time.Minute),
+		DefaultPolicy: "basic",
+		Policies: map[string]*JWTPolicyConfig{
+			"basic": {RateLimit: 1, RateLimitInterval: TOMLDuration(time.Hour)},
+			"premium": {
+				Label:          "premium_clients",
+				AllowedMethods: []string{"eth_call"},
+				BackendGroup:   "premium",
+			},
+		},
+	}, limiterFactory)
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	auth.now = func() time.Time { return now }
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": "issuer",
+			"aud": "proxyd",
+			"sub": "alice",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	hs256 := func(c jwt.MapClaims) string {
+		return signTestJWT(t, jwt.SigningMethodHS256, "", secret, c)
+	}
+
+	t.Run("tokens signed with each algorithm are accepted", func(t *testing.T) {
+		for _, token := range []string{
+			hs256(claims(nil)),
+			signTestJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil)),
+			signTestJWT(t, jwt.SigningMethodES256, "ec-1", ecKey, claims(nil)),
+		} {
+			key, err := auth.authenticate(token)
+			require.NoError(t, err)
+			require.Equal(t, "jwt:basic", key.Name)
+			require.Equal(t, "basic", key.Label)
+			require.Equal(t, "alice", key.client)
+		}
+	})
+
+	t.Run("invalid tokens are rejected", func(t *testing.T) {
+		unsigned := signTestJWT(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil))
+		tests := []struct {
+			name   string
+			token  string
+			err    error
+			reason string
+		}{
+			{"wrong secret", signTestJWT(t, jwt.SigningMethodHS256, "", []byte("other"), claims(nil)), jwt.ErrTokenSignatureInvalid, "signature"},
+			{"wrong key", signTestJWT(t, jwt.SigningMethodES256, "ec-1", otherECKey, claims(nil)), jwt.ErrTokenSignatureInvalid, "signature"},
+			{"unknown kid", signTestJWT(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, claims(nil)), jwt.ErrTokenUnverifiable, "signature"},
+			{"key of another type", signTestJWT(t, jwt.SigningMethodRS256, "ec-1", rsaKey, claims(nil)), jwt.ErrTokenSignatureInvalid, "signature"},
+			{"unsupported alg", signTestJWT(t, jwt.SigningMethodHS512, "", secret, claims(nil)), jwt.ErrTokenSignatureInvalid, "signature"},
+			{"alg none", strings.TrimSuffix(unsigned, "."), jwt.ErrTokenMalformed, "malformed"},
+			{"unsigned alg none", unsigned, jwt.ErrTokenSignatureInvalid, "signature"},
+			{"expired", hs256(claims(jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()})), jwt.ErrTokenExpired, "expired"},
+			{"no exp", hs256(claims(jwt.MapClaims{"exp": nil})), jwt.ErrTokenRequiredClaimMissing, "malformed"},
+			{"not yet valid", hs256(claims(jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()})), jwt.ErrTokenNotValidYet, "not_yet_valid"},
+			{"wrong audience", hs256(claims(jwt.MapClaims{"aud": []string{"other"}})), jwt.ErrTokenInvalidAudience, "audience"},
+			{"wrong issuer", hs256(claims(jwt.MapClaims{"iss": "other"})), jwt.ErrTokenInvalidIssuer, "issuer"},
+			{"unknown policy", hs256(claims(jwt.MapClaims{"policy": "gold"})), errJWTPolicy, "policy"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := auth.authenticate(tt.token)
+				require.ErrorIs(t, err, tt.err)
+				require.Equal(t, tt.reason, jwtRejectionReason(err))
+			})
+		}
+	})
+
+	t.Run("leeway and audience lists are accepted", func(t *testing.T) {
+		_, err := auth.authenticate(hs256(claims(jwt.MapClaims{
+			"exp": now.Add(-30 * time.Second).Unix(),
+			"aud": []string{"other", "proxyd"},
+		})))
+		require.NoError(t, err)
+	})
+
+	t.Run("the policy claim selects the policy", func(t *testing.T) {
+		key, err := auth.authenticate(hs256(claims(jwt.MapClaims{"policy": "premium"})))
+		require.NoError(t, err)
+		require.Equal(t, "premium_clients", key.Label)
+		require.Equal(t, "premium", key.BackendGroup)
+		require.True(t, key.AllowsMethod("eth_call"))
+		require.False(t, key.AllowsMethod("eth_chainId"))
+	})
+
+	t.Run("limits are per subject", func(t *testing.T) {
+		take := func(sub string) error {
+			key, err := auth.authenticate(hs256(claims(jwt.MapClaims{"sub": sub})))
+			require.NoError(t, err)
+			return key.Take(context.Background())
+		}
+		require.NoError(t, take("bob"))
+		require.ErrorIs(t, take("bob"), ErrOverRateLimit)
+		require.NoError(t, take("carol"))
+	})
+
+	t.Run("tokens are read from the bearer token or the path", func(t *testing.T) {
+		token := hs256(claims(jwt.MapClaims{"sub": "dave"}))
+		r, err := http.NewRequest(http.MethodPost, "/", nil)
+		require.NoError(t, err)
+
+		key, err := auth.Authenticate(r, "not_a_jwt")
+		require.NoError(t, err)
+		require.Nil(t, key)
+
+		key, err = auth.Authenticate(r, token)
+		require.NoError(t, err)
+		require.Equal(t, "dave", key.client)
+
+		r.Header.Set("Authorization", "Bearer "+signTestJWT(t, jwt.SigningMethodHS256, "", []byte("other"), claims(nil)))
+		_, err = auth.Authenticate(r, "")
+		require.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+}
+
+func TestNewJWTAuthenticatorErrors(t *testing.T) {
+	policies := map[string]*JWTPolicyConfig{"basic": {}}
+	tests := []struct {
+		name string
+		cfg  JWTAuthConfig
+		err  string
+	}{
+		{"no keys", JWTAuthConfig{JWKSFile: writeEmptyJWKS(t), Policies: policies}, "requires a secret or a jwks file"},
+		{"no policies", JWTAuthConfig{Secret: "secret"}, "at least one policy"},
+		{"undefined default", JWTAuthConfig{Secret: "secret", DefaultPolicy: "gold", Policies: policies}, "default jwt policy gold"},
+		{"negative limit", JWTAuthConfig{Secret: "secret", Policies: map[string]*JWTPolicyConfig{"basic": {RateLimit: -1}}}, "negative limit"},
+		{"missing jwks", JWTAuthConfig{JWKSFile: "/nonexistent/jwks.json", Policies: policies}, "error reading jwks file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWTAuthenticator(tt.cfg, nil)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func writeEmptyJWKS(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": []}`), 0o600))
+	return path
+}
+
+func TestBackendJWTAuth(t *testing.T) {
+	_, err := parseEngineJWTSecret("0x1234")
+	require.ErrorContains(t, err, "must be 32 bytes")
+	secret, err := parseEngineJWTSecret("0x" + strings.Repeat("ab", 32))
+	require.NoError(t, err)
+
+	be := NewBackend("engine", "http://localhost", "", nil, WithJWTSecret(secret))
+	r, err := http.NewRequest(http.MethodPost, "/", nil)
+	require.NoError(t, err)
+	be.setAuth(r)
+
+	for _, header := range []http.Header{r.Header, be.wsHeader()} {
+		token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer ")
+		require.True(t, ok)
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return secret[:], nil
+		}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuedAt())
+		require.NoError(t, err)
+		iat, err := claims.GetIssuedAt()
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), iat.Time, 5*time.Second)
+	}
+}
@@ -1,6 +1,7 @@
 package proxyd
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type RPCMethodHandler interface {
@@ -18,6 +20,7 @@ type RPCMethodHandler interface {
 
 type StaticMethodHandler struct {
 	cache     Cache
+	index     *blockKeyIndex
 	m         sync.RWMutex
 	filterGet func(*RPCReq) bool
 	filterPut func(*RPCReq, *RPCRes) bool
@@ -88,5 +91,195 @@ func (e *StaticMethodHandler) PutRPCMethod(ctx context.Context, req *RPCReq, res
 		log.Error("error putting into cache", "key", key, "method", req.Method, "err", err)
 		return err
 	}
+	if e.index != nil {
+		if hash, ok := blockHashParam(req.Params); ok {
+			e.index.addHash(ctx, hash, key)
+		}
+	}
 	return nil
 }
+
+// blockHashParam returns the block hash a request reads from, if its first parameter is one
+func blockHashParam(params json.RawMessage) (string, bool) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) == 0 {
+		return "", false
+	}
+	var bnh rpc.BlockNumberOrHash
+	if err := bnh.UnmarshalJSON(p[0]); err != nil {
+		return "", false
+	}
+	hash, ok := bnh.Hash()
+	if !ok {
+		return "", false
+	}
+	return hash.Hex(), true
+}
+
+// finalizedCacheBlockParams maps the methods supported by FinalizedBlockMethodHandler
+// to the position of their block parameter. eth_getLogs is handled separately.
+var finalizedCacheBlockParams = map[string]int{
+	"eth_getBlockByNumber":                    0,
+	"eth_getBlockReceipts":                    0,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+	"eth_getUncleCountByBlockNumber":          0,
+	"eth_getUncleByBlockNumberAndIndex":       0,
+	"eth_getBalance":                          1,
+	"eth_getCode":                             1,
+	"eth_getTransactionCount":                 1,
+	"eth_call":                                1,
+	"eth_getStorageAt":                        2,
+	"eth_getProof":                            2,
+}
+
+// IsFinalizedCacheMethod checks if the method can be cached by FinalizedBlockMethodHandler
+func IsFinalizedCacheMethod(method string) bool {
+	_, ok := finalizedCacheBlockParams[method]
+	return ok || method == "eth_getLogs"
+}
+
+// FinalizedBlockMethodHandler caches responses of requests for blocks at or below
+// the finalized block of the consensus group serving them. Block tags are resolved
+// against the consensus before building the key, so `finalized` can be cached too.
+type FinalizedBlockMethodHandler struct {
+	cache        Cache
+	maxSizeBytes int
+	index        *blockKeyIndex
+}
+
+func NewFinalizedBlockMethodHandler(cache Cache, maxSizeBytes int) *FinalizedBlockMethodHandler {
+	return &FinalizedBlockMethodHandler{cache: cache, maxSizeBytes: maxSizeBytes}
+}
+
+// key returns the cache key of the request and the highest block it reads from,
+// or false if the request isn't finalized
+func (e *FinalizedBlockMethodHandler) key(ctx context.Context, req *RPCReq) (string, uint64, bool) {
+	cp := GetConsensusPoller(ctx)
+	if cp == nil {
+		return "", 0, false
+	}
+	rctx := cp.rewriteContext()
+	if rctx.finalized == 0 {
+		return "", 0, false
+	}
+
+	// resolve the tags on a copy, the request is rewritten again when it's forwarded
+	resolved := *req
+	result, err := RewriteRequest(rctx, &resolved, &RPCRes{})
+	if err != nil || result == RewriteOverrideError || result == RewriteOverrideResponse {
+		return "", 0, false
+	}
+	highest, ok := highestRequestedBlock(&resolved)
+	if !ok || highest > uint64(rctx.finalized) {
+		return "", 0, false
+	}
+
+	// rewritten params are re-marshalled, so compact them to get the same key either way
+	var params bytes.Buffer
+	if err := json.Compact(&params, resolved.Params); err != nil {
+		return "", 0, false
+	}
+	h := sha256.New()
+	h.Write(params.Bytes())
+	signature := fmt.Sprintf("%x", h.Sum(nil))
+	return strings.Join([]string{"cache", "finalized", req.Method, signature}, ":"), highest, true
+}
+
+func (e *FinalizedBlockMethodHandler) GetRPCMethod(ctx context.Context, req *RPCReq) (*RPCRes, error) {
+	key, _, ok := e.key(ctx, req)
+	if !ok {
+		return nil, nil
+	}
+
+	val, err := e.cache.Get(ctx, key)
+	if err != nil {
+		log.Error("error reading from cache", "key", key, "method", req.Method, "err", err)
+		return nil, err
+	}
+	if val == "" {
+		return nil, nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(val), &result); err != nil {
+		log.Error("error unmarshalling value from cache", "key", key, "method", req.Method, "err", err)
+		return nil, err
+	}
+	return &RPCRes{
+		JSONRPC: req.JSONRPC,
+		Result:  result,
+		ID:      req.ID,
+	}, nil
+}
+
+func (e *FinalizedBlockMethodHandler) PutRPCMethod(ctx context.Context, req *RPCReq, res *RPCRes) error {
+	key, highest, ok := e.key(ctx, req)
+	if !ok {
+		return nil
+	}
+
+	value := mustMarshalJSON(res.Result)
+	if e.maxSizeBytes > 0 && len(value) > e.maxSizeBytes {
+		return nil
+	}
+
+	err := e.cache.Put(ctx, key, string(value))
+	if err != nil {
+		log.Error("error putting into cache", "key", key, "method", req.Method, "err", err)
+		return err
+	}
+	if e.index != nil {
+		e.index.addNumber(ctx, highest, key)
+	}
+	return nil
+}
+
+// highestRequestedBlock returns the highest block number a request reads from,
+// or false if it reads from a tag or a block hash
+func highestRequestedBlock(req *RPCReq) (uint64, bool) {
+	if req.Method == "eth_getLogs" {
+		var p []map[string]interface{}
+		if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+			return 0, false
+		}
+		if _, ok := p[0]["blockHash"]; ok {
+			return 0, false
+		}
+		var highest uint64
+		for _, field := range []string{"fromBlock", "toBlock"} {
+			s, ok := p[0][field].(string)
+			if !ok {
+				return 0, false
+			}
+			bn, ok := blockNumberParam(mustMarshalJSON(s))
+			if !ok {
+				return 0, false
+			}
+			highest = max(highest, bn)
+		}
+		return highest, true
+	}
+
+	pos, ok := finalizedCacheBlockParams[req.Method]
+	if !ok {
+		return 0, false
+	}
+	var p []json.RawMessage
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) <= pos {
+		return 0, false
+	}
+	return blockNumberParam(p[pos])
+}
+
+func blockNumberParam(raw json.RawMessage) (uint64, bool) {
+	var bnh rpc.BlockNumberOrHash
+	if err := bnh.UnmarshalJSON(raw); err != nil {
+		return 0, false
+	}
+	bn, ok := bnh.Number()
+	if !ok || bn < 0 {
+		return 0, false
+	}
+	return uint64(bn), true
+}
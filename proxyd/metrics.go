@@ -375,6 +375,14 @@ var (
 		"backend_name",
 	})
 
+	consensusBackendScore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "consensus_backend_score",
+		Help:      "Score of a member of the consensus group, from 0 to 1",
+	}, []string{
+		"backend_name",
+	})
+
 	consensusPeerCountBackend = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: MetricsNamespace,
 		Name:      "consensus_backend_peer_count",
@@ -450,6 +458,314 @@ var (
 		"backend_name",
 	})
 
+	configReloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "config_reloads_total",
+		Help:      "Count of config reloads by result.",
+	}, []string{
+		"success",
+	})
+
+	configLastReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Bool gauge for whether the last config reload attempt was successful.",
+	})
+
+	backendDraining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_draining",
+		Help:      "Bool gauge for backends taken out of rotation by an operator",
+	}, []string{
+		"backend_name",
+	})
+
+	consensusForcedCandidateBackends = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "consensus_backend_forced_candidate",
+		Help:      "Bool gauge for backends forced into the consensus group",
+	}, []string{
+		"backend_name",
+	})
+
+	adminActionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "admin_actions_total",
+		Help:      "Count of admin API actions by operator.",
+	}, []string{
+		"operator",
+		"action",
+		"backend_group",
+		"backend_name",
+	})
+
+	backendOutstandingRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_outstanding_requests",
+		Help:      "Number of requests currently in flight per backend",
+	}, []string{
+		"backend_name",
+	})
+
+	backendGroupHedgesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_group_hedges_total",
+		Help:      "Count of hedged requests sent to a second backend",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	backendGroupHedgesWonTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_group_hedges_won_total",
+		Help:      "Count of hedged requests answered before the original request",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	backendGroupQuorumRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_group_quorum_requests_total",
+		Help:      "Count of RPC calls sent to a quorum of backends, and whether the quorum was reached",
+	}, []string{
+		"backend_group",
+		"method",
+		"success",
+	})
+
+	backendQuorumDisagreementsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_quorum_disagreements_total",
+		Help:      "Count of quorum requests where a backend returned a different result than the quorum",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	apiKeyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "api_key_requests_total",
+		Help:      "Count of RPC calls counted against the quota of an API key",
+	}, []string{
+		"key",
+	})
+
+	apiKeyRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "api_key_rejections_total",
+		Help:      "Count of RPC calls of an API key rejected by its limits",
+	}, []string{
+		"key",
+		"reason",
+	})
+
+	apiKeysLoaded = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "api_keys_loaded",
+		Help:      "Number of API keys currently accepted",
+	})
+
+	wsMultiplexedUpstreamSubscriptions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_multiplexed_upstream_subscriptions",
+		Help:      "Number of upstream websocket subscriptions shared between clients",
+	}, []string{
+		"backend_group",
+	})
+
+	wsMultiplexedClientSubscriptions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_multiplexed_client_subscriptions",
+		Help:      "Number of client websocket subscriptions served from shared upstream subscriptions",
+	}, []string{
+		"backend_group",
+	})
+
+	wsMultiplexedResubscriptionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_multiplexed_resubscriptions_total",
+		Help:      "Count of times the shared subscriptions were recreated on a new upstream connection",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	wsFailoversTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_failovers_total",
+		Help:      "Count of client websockets moved to a new backend after their backend connection failed",
+	}, []string{
+		"backend_group",
+		"from_backend",
+		"to_backend",
+	})
+
+	wsFailoverErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_failover_errors_total",
+		Help:      "Count of client websockets closed because no backend was available to fail over to",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	tracingSpansExportedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tracing_spans_exported_total",
+		Help:      "Count of trace spans exported",
+	})
+
+	tracingSpansDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tracing_spans_dropped_total",
+		Help:      "Count of trace spans dropped because the export failed",
+	})
+
+	getLogsSplitRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "get_logs_split_requests_total",
+		Help:      "Count of eth_getLogs calls split into chunks",
+	}, []string{
+		"backend_group",
+		"success",
+	})
+
+	getLogsSplitChunks = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "get_logs_split_chunks",
+		Help:      "Number of chunks split eth_getLogs calls are fetched in",
+		Buckets:   []float64{2, 4, 8, 16, 32, 64, 128, 256},
+	}, []string{
+		"backend_group",
+	})
+
+	backendCircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_circuit_breaker_state",
+		Help:      "State of the circuit breaker of a backend: 0 closed, 1 open, 2 half open",
+	}, []string{
+		"backend_name",
+	})
+
+	backendCircuitBreakerTransitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_circuit_breaker_transitions_total",
+		Help:      "Count of state transitions of the circuit breaker of a backend",
+	}, []string{
+		"backend_name",
+		"from",
+		"to",
+	})
+
+	backendHealthCheckHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_health_check_healthy",
+		Help:      "Whether the backend passed its last health check (1) or not (0)",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	backendHealthCheckLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_health_check_latency",
+		Help:      "Latency of the last health check of the backend",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	backendHealthCheckFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_health_check_failures_total",
+		Help:      "Count of failed health checks",
+	}, []string{
+		"backend_group",
+		"backend_name",
+	})
+
+	captureEntriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "capture_entries_total",
+		Help:      "Count of requests written to the capture files",
+	})
+
+	captureDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "capture_dropped_total",
+		Help:      "Count of sampled requests that couldn't be written to the capture files",
+	})
+
+	pathRouteRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "path_route_requests_total",
+		Help:      "Count of requests served by path routes, by HTTP status code",
+	}, []string{
+		"path_route",
+		"status_code",
+	})
+
+	routingRuleMatchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "routing_rule_matches_total",
+		Help:      "Count of calls routed by a routing rule",
+	}, []string{
+		"rule",
+		"backend_group",
+	})
+
+	stickyFilterMissesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "sticky_filter_misses_total",
+		Help:      "Count of filter calls that failed because the backend that created the filter was unavailable",
+	}, []string{
+		"backend_group",
+	})
+
+	txPolicyTransactionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tx_policy_transactions_total",
+		Help:      "Count of transactions checked by the tx policy, by sender and result. Only metered senders have their own label.",
+	}, []string{
+		"sender",
+		"result",
+	})
+
+	consensusReorgsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "group_consensus_reorgs_total",
+		Help:      "Count of reorgs of the consensus head",
+	}, []string{
+		"backend_group_name",
+	})
+
+	consensusReorgDepth = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "group_consensus_reorg_depth",
+		Help:      "Histogram of the number of blocks replaced by reorgs of the consensus head",
+		Buckets:   []float64{1, 2, 3, 5, 10, 20, 64, 128},
+	}, []string{
+		"backend_group_name",
+	})
+
+	consensusReorgWebhookErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "group_consensus_reorg_webhook_errors_total",
+		Help:      "Count of reorg events that couldn't be posted to the reorg webhook",
+	}, []string{
+		"backend_group_name",
+	})
+
+	jwtAuthRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "jwt_auth_rejections_total",
+		Help:      "Count of requests rejected because of an invalid JWT",
+	}, []string{
+		"reason",
+	})
+
 	backendGroupMulticallCompletionCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: MetricsNamespace,
 		Name:      "backend_group_multicall_completion_counter",
@@ -590,6 +906,10 @@ func RecordConsensusBackendBanned(b *Backend, banned bool) {
 	consensusBannedBackends.WithLabelValues(b.Name).Set(boolToFloat64(banned))
 }
 
+func RecordConsensusBackendScore(b *Backend, score float64) {
+	consensusBackendScore.WithLabelValues(b.Name).Set(score)
+}
+
 func RecordHealthyCandidates(b *BackendGroup, candidates int) {
 	healthyPrimaryCandidates.WithLabelValues(b.Name).Set(float64(candidates))
 }
@@ -632,6 +952,140 @@ func RecordBackendGroupMulticallCompletion(bg *BackendGroup, backendName string,
 	backendGroupMulticallCompletionCounter.WithLabelValues(bg.Name, backendName, error).Inc()
 }
 
+func RecordConfigReload(success bool) {
+	configReloadsTotal.WithLabelValues(strconv.FormatBool(success)).Inc()
+	configLastReloadSuccess.Set(boolToFloat64(success))
+}
+
+func RecordBackendDraining(b *Backend, draining bool) {
+	backendDraining.WithLabelValues(b.Name).Set(boolToFloat64(draining))
+}
+
+func RecordConsensusBackendForcedCandidate(b *Backend, forced bool) {
+	consensusForcedCandidateBackends.WithLabelValues(b.Name).Set(boolToFloat64(forced))
+}
+
+func RecordAdminAction(operator, action, backendGroup, backendName string) {
+	adminActionsTotal.WithLabelValues(operator, action, backendGroup, backendName).Inc()
+}
+
+func RecordBackendOutstandingRequests(b *Backend, outstanding int64) {
+	backendOutstandingRequests.WithLabelValues(b.Name).Set(float64(outstanding))
+}
+
+func RecordBackendGroupHedge(bg *BackendGroup, backendName string) {
+	backendGroupHedgesTotal.WithLabelValues(bg.Name, backendName).Inc()
+}
+
+func RecordBackendGroupHedgeWon(bg *BackendGroup, backendName string) {
+	backendGroupHedgesWonTotal.WithLabelValues(bg.Name, backendName).Inc()
+}
+
+func RecordBackendGroupQuorum(bg *BackendGroup, method string, success bool) {
+	backendGroupQuorumRequestsTotal.WithLabelValues(bg.Name, method, strconv.FormatBool(success)).Inc()
+}
+
+func RecordBackendQuorumDisagreement(bg *BackendGroup, backendName string) {
+	backendQuorumDisagreementsTotal.WithLabelValues(bg.Name, backendName).Inc()
+}
+
+func RecordAPIKeyRequest(key string) {
+	apiKeyRequestsTotal.WithLabelValues(key).Inc()
+}
+
+func RecordAPIKeyRejection(key string, reason string) {
+	apiKeyRejectionsTotal.WithLabelValues(key, reason).Inc()
+}
+
+func RecordAPIKeysLoaded(n int) {
+	apiKeysLoaded.Set(float64(n))
+}
+
+func RecordWSMultiplexedSubscriptions(bg *BackendGroup, upstream int, clients int) {
+	wsMultiplexedUpstreamSubscriptions.WithLabelValues(bg.Name).Set(float64(upstream))
+	wsMultiplexedClientSubscriptions.WithLabelValues(bg.Name).Set(float64(clients))
+}
+
+func RecordWSMultiplexedResubscription(bg *BackendGroup, backend *Backend) {
+	wsMultiplexedResubscriptionsTotal.WithLabelValues(bg.Name, backend.Name).Inc()
+}
+
+func RecordWSFailover(bg *BackendGroup, from *Backend, to *Backend) {
+	wsFailoversTotal.WithLabelValues(bg.Name, from.Name, to.Name).Inc()
+}
+
+func RecordWSFailoverError(bg *BackendGroup, backend *Backend) {
+	wsFailoverErrorsTotal.WithLabelValues(bg.Name, backend.Name).Inc()
+}
+
+func RecordTracingSpansExported(n int) {
+	tracingSpansExportedTotal.Add(float64(n))
+}
+
+func RecordTracingSpansDropped(n int) {
+	tracingSpansDroppedTotal.Add(float64(n))
+}
+
+func RecordGetLogsSplit(bg *BackendGroup, chunks int, success bool) {
+	getLogsSplitRequestsTotal.WithLabelValues(bg.Name, strconv.FormatBool(success)).Inc()
+	getLogsSplitChunks.WithLabelValues(bg.Name).Observe(float64(chunks))
+}
+
+func RecordBackendCircuitState(b *Backend, state CircuitState) {
+	backendCircuitBreakerState.WithLabelValues(b.Name).Set(float64(state))
+}
+
+func RecordBackendCircuitTransition(b *Backend, from, to CircuitState) {
+	backendCircuitBreakerTransitionsTotal.WithLabelValues(b.Name, from.String(), to.String()).Inc()
+	RecordBackendCircuitState(b, to)
+}
+
+func RecordBackendHealthCheck(bg *BackendGroup, b *Backend, healthy bool, latency time.Duration) {
+	backendHealthCheckHealthy.WithLabelValues(bg.Name, b.Name).Set(boolToFloat64(healthy))
+	backendHealthCheckLatency.WithLabelValues(bg.Name, b.Name).Set(float64(latency.Milliseconds()))
+}
+
+func RecordBackendHealthCheckFailure(bg *BackendGroup, b *Backend) {
+	backendHealthCheckFailuresTotal.WithLabelValues(bg.Name, b.Name).Inc()
+}
+
+func RecordCaptureEntry() {
+	captureEntriesTotal.Inc()
+}
+
+func RecordCaptureDropped() {
+	captureDroppedTotal.Inc()
+}
+
+func RecordPathRouteRequest(route string, statusCode int) {
+	pathRouteRequestsTotal.WithLabelValues(route, strconv.Itoa(statusCode)).Inc()
+}
+
+func RecordRoutingRuleMatch(rule string, backendGroup string) {
+	routingRuleMatchesTotal.WithLabelValues(rule, backendGroup).Inc()
+}
+
+func RecordStickyFilterMiss(bg *BackendGroup) {
+	stickyFilterMissesTotal.WithLabelValues(bg.Name).Inc()
+}
+
+func RecordTxPolicyTransaction(sender string, result string) {
+	txPolicyTransactionsTotal.WithLabelValues(sender, result).Inc()
+}
+
+func RecordReorg(bg *BackendGroup, depth uint64) {
+	consensusReorgsTotal.WithLabelValues(bg.Name).Inc()
+	consensusReorgDepth.WithLabelValues(bg.Name).Observe(float64(depth))
+}
+
+func RecordReorgWebhookError(backendGroup string) {
+	consensusReorgWebhookErrorsTotal.WithLabelValues(backendGroup).Inc()
+}
+
+func RecordJWTAuthRejection(reason string) {
+	jwtAuthRejectionsTotal.WithLabelValues(reason).Inc()
+}
+
 func boolToFloat64(b bool) float64 {
 	if b {
 		return 1
@@ -0,0 +1,377 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/mux"
+)
+
+var defaultPathRouteMethods = []string{http.MethodGet, http.MethodPost}
+
+// passthroughRequestHeaders are the client headers forwarded to the backends
+var passthroughRequestHeaders = []string{"Accept", "Content-Type"}
+
+// hopHeaders are not copied from the backend response
+var hopHeaders = []string{"Connection", "Content-Length", "Keep-Alive", "Transfer-Encoding", "Upgrade"}
+
+// pathRoute passes HTTP requests under a path through to a backend group as is
+type pathRoute struct {
+	name           string
+	path           string
+	backendGroup   string
+	backendPath    string
+	allowedPaths   []string
+	allowedMethods *StringSet
+	maxBodySize    int64
+	lim            FrontendRateLimiter
+}
+
+func buildPathRoutes(config PathRoutesConfig, maxBodySize int64, limiterFactory limiterFactoryFunc) ([]*pathRoute, error) {
+	routes := make([]*pathRoute, 0, len(config))
+	paths := make(map[string]string)
+	for name, cfg := range config {
+		path := strings.TrimSuffix(cfg.Path, "/")
+		if !strings.HasPrefix(path, "/") || path == "/healthz" {
+			return nil, fmt.Errorf("invalid path %q for path route %s", cfg.Path, name)
+		}
+		if other, ok := paths[path]; ok {
+			return nil, fmt.Errorf("path routes %s and %s have the same path %s", name, other, path)
+		}
+		paths[path] = name
+
+		route := &pathRoute{
+			name:         name,
+			path:         path,
+			backendGroup: cfg.BackendGroup,
+			backendPath:  path,
+			allowedPaths: cfg.AllowedPaths,
+			maxBodySize:  cfg.MaxBodySizeBytes,
+		}
+		if cfg.BackendPath != "" {
+			route.backendPath = strings.TrimSuffix(cfg.BackendPath, "/")
+		}
+		if route.maxBodySize == 0 {
+			route.maxBodySize = maxBodySize
+		}
+		methods := cfg.AllowedMethods
+		if len(methods) == 0 {
+			methods = defaultPathRouteMethods
+		}
+		route.allowedMethods = NewStringSet()
+		for _, method := range methods {
+			route.allowedMethods.Add(strings.ToUpper(method))
+		}
+		if cfg.RateLimit > 0 {
+			if cfg.RateLimitInterval == 0 {
+				return nil, fmt.Errorf("path route %s must set rate_limit_interval", name)
+			}
+			route.lim = limiterFactory(time.Duration(cfg.RateLimitInterval), cfg.RateLimit, "path_route:"+name, FixedWindowRateLimitAlgorithm)
+		}
+		routes = append(routes, route)
+	}
+	// register the longest paths first, so that nested routes take precedence
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].path) > len(routes[j].path)
+	})
+	return routes, nil
+}
+
+// subPath returns the part of the request path under the route, e.g. /v1/status for
+// /opnode/v1/status, and false if the request path isn't under the route
+func (r *pathRoute) subPath(req *http.Request) (string, bool) {
+	reqPath := req.URL.Path
+	if authorization := mux.Vars(req)["authorization"]; authorization != "" {
+		reqPath = strings.TrimPrefix(reqPath, "/"+authorization)
+	}
+	rest, ok := strings.CutPrefix(reqPath, r.path)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", false
+	}
+	return rest, true
+}
+
+// isAllowedPath checks the sub path against allowed_paths, where a trailing * matches any suffix
+func (r *pathRoute) isAllowedPath(subPath string) bool {
+	if len(r.allowedPaths) == 0 {
+		return true
+	}
+	for _, allowed := range r.allowedPaths {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(subPath, prefix) {
+				return true
+			}
+		} else if subPath == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handlePathRoute(route *pathRoute, w http.ResponseWriter, r *http.Request) {
+	subPath, ok := route.subPath(r)
+	if !ok {
+		writePathRouteError(route, w, http.StatusNotFound, "not found")
+		return
+	}
+
+	ctx := s.populateContext(w, r)
+	if ctx == nil {
+		return
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	ctx, span := StartSpan(ContextWithTraceContext(ctx, r.Header), "proxyd.HandlePathRoute", SpanKindServer)
+	defer span.End()
+	span.SetAttributes("proxyd.req_id", GetReqID(ctx), "proxyd.path_route", route.name, "http.method", r.Method)
+
+	if !route.allowedMethods.Has(r.Method) {
+		writePathRouteError(route, w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !route.isAllowedPath(subPath) {
+		log.Info("rejected path not allowed by path route", "req_id", GetReqID(ctx), "path_route", route.name, "path", subPath)
+		writePathRouteError(route, w, http.StatusForbidden, "path not allowed")
+		return
+	}
+
+	apiKey := GetAPIKey(ctx)
+	if apiKey != nil && !apiKey.AllowsPathRoute(route.name) {
+		log.Info("blocked path route not allowed for api key", "req_id", GetReqID(ctx), "api_key", apiKey.Name, "path_route", route.name)
+		RecordAPIKeyRejection(apiKey.Name, "path_route")
+		writePathRouteError(route, w, http.StatusForbidden, "path route not allowed")
+		return
+	}
+
+	if route.lim != nil {
+		ok, err := route.lim.Take(ctx, rateLimitKey(ctx))
+		if err != nil {
+			log.Warn("error taking rate limit", "err", err)
+		}
+		if err != nil || !ok {
+			writePathRouteError(route, w, http.StatusTooManyRequests, "over rate limit")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(LimitReader(r.Body, route.maxBodySize))
+	if errors.Is(err, ErrLimitReaderOverLimit) {
+		writePathRouteError(route, w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	if err != nil {
+		log.Error("error reading request body", "err", err)
+		writePathRouteError(route, w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	// count the request against the api key last, so that requests rejected above
+	// don't use up its quota
+	groupName := route.backendGroup
+	if apiKey != nil {
+		if err := apiKey.Take(ctx); err != nil {
+			log.Debug("api key over limit", "req_id", GetReqID(ctx), "api_key", apiKey.Name, "path_route", route.name)
+			writePathRouteError(route, w, http.StatusTooManyRequests, "over rate limit")
+			return
+		}
+		if apiKey.BackendGroup != "" {
+			groupName = apiKey.BackendGroup
+		}
+	}
+
+	s.stateMu.RLock()
+	bg := s.BackendGroups[groupName]
+	s.stateMu.RUnlock()
+	if bg == nil {
+		log.Error("path route uses an undefined backend group", "req_id", GetReqID(ctx), "path_route", route.name, "backend_group", groupName)
+		writePathRouteError(route, w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	res, servedBy, err := bg.forwardPassthrough(ctx, &passthroughRequest{
+		method: r.Method,
+		path:   route.backendPath + subPath,
+		query:  r.URL.RawQuery,
+		header: r.Header,
+		body:   body,
+	})
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			writePathRouteError(route, w, http.StatusGatewayTimeout, "gateway timeout")
+			return
+		}
+		writePathRouteError(route, w, http.StatusBadGateway, "bad gateway")
+		return
+	}
+
+	for name, values := range res.header {
+		w.Header()[name] = values
+	}
+	for _, name := range hopHeaders {
+		w.Header().Del(name)
+	}
+	if s.enableServedByHeader {
+		w.Header().Set("x-served-by", servedBy)
+	}
+	span.SetAttributes("http.status_code", res.statusCode)
+	RecordPathRouteRequest(route.name, res.statusCode)
+	httpResponseCodesTotal.WithLabelValues(strconv.Itoa(res.statusCode)).Inc()
+	w.WriteHeader(res.statusCode)
+	if _, err := w.Write(res.body); err != nil {
+		log.Error("error writing path route response", "req_id", GetReqID(ctx), "err", err)
+	}
+}
+
+func writePathRouteError(route *pathRoute, w http.ResponseWriter, statusCode int, msg string) {
+	RecordPathRouteRequest(route.name, statusCode)
+	httpResponseCodesTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+	http.Error(w, msg, statusCode)
+}
+
+// passthroughRequest is an HTTP request sent to the backends as is
+type passthroughRequest struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+type passthroughResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// forwardPassthrough sends the request to the backends of the group in order, until one of
+// them answers without a network error or a 5xx status code
+func (bg *BackendGroup) forwardPassthrough(ctx context.Context, req *passthroughRequest) (*passthroughResponse, string, error) {
+	for _, be := range bg.orderedBackendsForRequest() {
+		res, err := be.forwardPassthrough(ctx, req)
+		if errors.Is(err, ErrBackendOffline) {
+			log.Warn("skipping offline backend", "name", be.Name, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+			continue
+		}
+		if errors.Is(err, ErrBackendResponseTooLarge) {
+			return nil, "", err
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			log.Error("error forwarding passthrough request to backend",
+				"name", be.Name,
+				"req_id", GetReqID(ctx),
+				"auth", GetAuthCtx(ctx),
+				"path", req.path,
+				"err", err,
+			)
+			continue
+		}
+		return res, fmt.Sprintf("%s/%s", bg.Name, be.Name), nil
+	}
+	RecordUnserviceableRequest(ctx, RPCRequestSourceHTTP)
+	return nil, "", ErrNoBackends
+}
+
+// forwardPassthrough sends the request under the URL of the backend's rpc_url, with the
+// backend's auth, headers and TLS config. Network errors and 5xx responses count against the backend.
+func (b *Backend) forwardPassthrough(ctx context.Context, req *passthroughRequest) (*passthroughResponse, error) {
+	ticket, ok := b.circuitBreaker.allow()
+	if !ok {
+		return nil, ErrBackendOffline
+	}
+
+	b.networkRequestsSlidingWindow.Incr()
+	RecordBackendOutstandingRequests(b, b.outstandingRequests.Add(1))
+	defer func() {
+		RecordBackendOutstandingRequests(b, b.outstandingRequests.Add(-1))
+	}()
+
+	ctx, span := StartSpan(ctx, "proxyd.backend.request", SpanKindClient)
+	defer span.End()
+	span.SetAttributes("proxyd.backend", b.Name, "http.method", req.method)
+
+	fail := func(err error) (*passthroughResponse, error) {
+		span.RecordError(err)
+		b.intermittentErrorsSlidingWindow.Incr()
+		RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
+		b.circuitBreaker.record(ticket, err)
+		return nil, err
+	}
+
+	u, err := url.Parse(b.rpcURL)
+	if err != nil {
+		return fail(wrapErr(err, "error parsing backend url"))
+	}
+	// keep the path of the rpc_url, which carries the key of some node providers
+	u.Path = strings.TrimSuffix(u.Path, "/") + req.path
+	u.RawPath = ""
+	u.RawQuery = req.query
+
+	var body io.Reader
+	if len(req.body) > 0 {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return fail(wrapErr(err, "error creating backend request"))
+	}
+	for _, name := range passthroughRequestHeaders {
+		if value := req.header.Get(name); value != "" {
+			httpReq.Header.Set(name, value)
+		}
+	}
+	b.setAuth(httpReq)
+	httpReq.Header.Set("X-Forwarded-For", b.forwardedFor(ctx))
+	for name, value := range b.headers {
+		httpReq.Header.Set(name, value)
+	}
+	InjectTraceContext(ctx, httpReq.Header)
+
+	start := time.Now()
+	httpRes, err := b.client.DoLimited(httpReq)
+	if err != nil {
+		return fail(wrapErr(err, "error in backend request"))
+	}
+	defer httpRes.Body.Close()
+	span.SetAttributes("http.status_code", httpRes.StatusCode)
+
+	resB, err := io.ReadAll(LimitReader(httpRes.Body, b.maxResponseSize))
+	if errors.Is(err, ErrLimitReaderOverLimit) {
+		b.circuitBreaker.release(ticket)
+		return nil, ErrBackendResponseTooLarge
+	}
+	if err != nil {
+		return fail(wrapErr(err, "error reading response body"))
+	}
+	if httpRes.StatusCode >= 500 {
+		return fail(fmt.Errorf("response code %d", httpRes.StatusCode))
+	}
+
+	duration := time.Since(start)
+	b.latencySlidingWindow.Add(float64(duration))
+	b.latencySamples.Add(duration)
+	RecordBackendNetworkLatencyAverageSlidingWindow(b, time.Duration(b.latencySlidingWindow.Avg()))
+	RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
+	b.circuitBreaker.record(ticket, nil)
+
+	return &passthroughResponse{
+		statusCode: httpRes.StatusCode,
+		header:     httpRes.Header,
+		body:       resB,
+	}, nil
+}
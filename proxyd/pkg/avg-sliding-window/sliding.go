@@ -169,6 +169,8 @@ func (sw *AvgSlidingWindow) advance() {
 // Avg retrieves the current average for the sliding window
 func (sw *AvgSlidingWindow) Avg() float64 {
 	sw.advance()
+	defer sw.mux.Unlock()
+	sw.mux.Lock()
 	if sw.qty == 0 {
 		return 0
 	}
@@ -178,12 +180,16 @@ func (sw *AvgSlidingWindow) Avg() float64 {
 // Sum retrieves the current sum for the sliding window
 func (sw *AvgSlidingWindow) Sum() float64 {
 	sw.advance()
+	defer sw.mux.Unlock()
+	sw.mux.Lock()
 	return sw.sum
 }
 
 // Count retrieves the data point count for the sliding window
 func (sw *AvgSlidingWindow) Count() uint {
 	sw.advance()
+	defer sw.mux.Unlock()
+	sw.mux.Lock()
 	return sw.qty
 }
 
@@ -22,20 +22,46 @@ func SetLogLevel(logLevel slog.Leveler) {
 		os.Stdout, &slog.HandlerOptions{Level: logLevel})))
 }
 
-func Start(config *Config) (*Server, func(), error) {
-	if len(config.Backends) == 0 {
-		return nil, nil, errors.New("must define at least one backend")
+// serverConfigErrors returns every problem found by the static checks Start runs on the
+// server wide sections of a config
+func serverConfigErrors(config *Config) []error {
+	var errs []error
+	for _, authKey := range sortedKeys(config.Authentication) {
+		if authKey == "none" {
+			errs = append(errs, errors.New("cannot use none as an auth key"))
+		}
 	}
-	if len(config.BackendGroups) == 0 {
-		return nil, nil, errors.New("must define at least one backend group")
+	if config.Redis.ReadURL != "" && config.Redis.URL == "" {
+		errs = append(errs, errors.New("must specify a Redis primary URL. only read endpoint is set"))
 	}
-	if len(config.RPCMethodMappings) == 0 {
-		return nil, nil, errors.New("must define at least one RPC method mapping")
+	if config.Redis.URL == "" && config.RateLimit.UseRedis {
+		errs = append(errs, errors.New("must specify a Redis URL if UseRedis is true in rate limit config"))
+	}
+	if config.SenderRateLimit.Enabled {
+		if config.SenderRateLimit.Limit <= 0 {
+			errs = append(errs, errors.New("limit in sender_rate_limit must be > 0"))
+		}
+		if time.Duration(config.SenderRateLimit.Interval) < time.Second {
+			errs = append(errs, errors.New("interval in sender_rate_limit must be >= 1s"))
+		}
 	}
+	return errs
+}
 
-	for authKey := range config.Authentication {
-		if authKey == "none" {
-			return nil, nil, errors.New("cannot use none as an auth key")
+func Start(config *Config) (*Server, func(), error) {
+	if err := validateRoutingConfig(config); err != nil {
+		return nil, nil, err
+	}
+	if errs := serverConfigErrors(config); len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+
+	var tracer *Tracer
+	if config.Tracing.Exporter != "" {
+		var err error
+		tracer, err = NewTracer(config.Tracing)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
@@ -63,9 +89,6 @@ func Start(config *Config) (*Server, func(), error) {
 	// if read endpoint is not set, use primary endpoint
 	var redisReadClient = redisClient
 	if config.Redis.ReadURL != "" {
-		if redisClient == nil {
-			return nil, nil, errors.New("must specify a Redis primary URL. only read endpoint is set")
-		}
 		rURL, err := ReadFromEnvOrConfig(config.Redis.ReadURL)
 		if err != nil {
 			return nil, nil, err
@@ -84,10 +107,6 @@ func Start(config *Config) (*Server, func(), error) {
 		}
 	}
 
-	if redisClient == nil && config.RateLimit.UseRedis {
-		return nil, nil, errors.New("must specify a Redis URL if UseRedis is true in rate limit config")
-	}
-
 	// While modifying shared globals is a bad practice, the alternative
 	// is to clone these errors on every invocation. This is inefficient.
 	// We'd also have to make sure that errors.Is and errors.As continue
@@ -102,186 +121,25 @@ func Start(config *Config) (*Server, func(), error) {
 		ErrTooManyBatchRequests.Message = config.BatchConfig.ErrorMessage
 	}
 
-	if config.SenderRateLimit.Enabled {
-		if config.SenderRateLimit.Limit <= 0 {
-			return nil, nil, errors.New("limit in sender_rate_limit must be > 0")
-		}
-		if time.Duration(config.SenderRateLimit.Interval) < time.Second {
-			return nil, nil, errors.New("interval in sender_rate_limit must be >= 1s")
-		}
-	}
-
 	maxConcurrentRPCs := config.Server.MaxConcurrentRPCs
 	if maxConcurrentRPCs == 0 {
 		maxConcurrentRPCs = math.MaxInt64
 	}
 	rpcRequestSemaphore := semaphore.NewWeighted(maxConcurrentRPCs)
 
-	backendNames := make([]string, 0)
-	backendsByName := make(map[string]*Backend)
-	for name, cfg := range config.Backends {
-		opts := make([]BackendOpt, 0)
-
-		rpcURL, err := ReadFromEnvOrConfig(cfg.RPCURL)
-		if err != nil {
-			return nil, nil, err
-		}
-		wsURL, err := ReadFromEnvOrConfig(cfg.WSURL)
-		if err != nil {
-			return nil, nil, err
-		}
-		if rpcURL == "" {
-			return nil, nil, fmt.Errorf("must define an RPC URL for backend %s", name)
-		}
-
-		if config.BackendOptions.ResponseTimeoutSeconds != 0 {
-			timeout := secondsToDuration(config.BackendOptions.ResponseTimeoutSeconds)
-			opts = append(opts, WithTimeout(timeout))
-		}
-		if config.BackendOptions.MaxRetries != 0 {
-			opts = append(opts, WithMaxRetries(config.BackendOptions.MaxRetries))
-		}
-		if config.BackendOptions.MaxResponseSizeBytes != 0 {
-			opts = append(opts, WithMaxResponseSize(config.BackendOptions.MaxResponseSizeBytes))
-		}
-		if config.BackendOptions.OutOfServiceSeconds != 0 {
-			opts = append(opts, WithOutOfServiceDuration(secondsToDuration(config.BackendOptions.OutOfServiceSeconds)))
-		}
-		if config.BackendOptions.MaxDegradedLatencyThreshold > 0 {
-			opts = append(opts, WithMaxDegradedLatencyThreshold(time.Duration(config.BackendOptions.MaxDegradedLatencyThreshold)))
-		}
-		if config.BackendOptions.MaxLatencyThreshold > 0 {
-			opts = append(opts, WithMaxLatencyThreshold(time.Duration(config.BackendOptions.MaxLatencyThreshold)))
-		}
-		if config.BackendOptions.MaxErrorRateThreshold > 0 {
-			opts = append(opts, WithMaxErrorRateThreshold(config.BackendOptions.MaxErrorRateThreshold))
-		}
-		if cfg.MaxRPS != 0 {
-			opts = append(opts, WithMaxRPS(cfg.MaxRPS))
-		}
-		if cfg.MaxWSConns != 0 {
-			opts = append(opts, WithMaxWSConns(cfg.MaxWSConns))
-		}
-		if cfg.Password != "" {
-			passwordVal, err := ReadFromEnvOrConfig(cfg.Password)
-			if err != nil {
-				return nil, nil, err
-			}
-			opts = append(opts, WithBasicAuth(cfg.Username, passwordVal))
-		}
-
-		headers := map[string]string{}
-		for headerName, headerValue := range cfg.Headers {
-			headerValue, err := ReadFromEnvOrConfig(headerValue)
-			if err != nil {
-				return nil, nil, err
-			}
-
-			headers[headerName] = headerValue
-		}
-		opts = append(opts, WithHeaders(headers))
-
-		tlsConfig, err := configureBackendTLS(cfg)
-		if err != nil {
-			return nil, nil, err
-		}
-		if tlsConfig != nil {
-			log.Info("using custom TLS config for backend", "name", name)
-			opts = append(opts, WithTLSConfig(tlsConfig))
-		}
-		if cfg.StripTrailingXFF {
-			opts = append(opts, WithStrippedTrailingXFF())
-		}
-		opts = append(opts, WithProxydIP(os.Getenv("PROXYD_IP")))
-		opts = append(opts, WithConsensusSkipPeerCountCheck(cfg.ConsensusSkipPeerCountCheck))
-		opts = append(opts, WithConsensusForcedCandidate(cfg.ConsensusForcedCandidate))
-		opts = append(opts, WithWeight(cfg.Weight))
-
-		receiptsTarget, err := ReadFromEnvOrConfig(cfg.ConsensusReceiptsTarget)
-		if err != nil {
-			return nil, nil, err
-		}
-		receiptsTarget, err = validateReceiptsTarget(receiptsTarget)
-		if err != nil {
-			return nil, nil, err
-		}
-		opts = append(opts, WithConsensusReceiptTarget(receiptsTarget))
-
-		back := NewBackend(name, rpcURL, wsURL, rpcRequestSemaphore, opts...)
-		backendNames = append(backendNames, name)
-		backendsByName[name] = back
-		log.Info("configured backend",
-			"name", name,
-			"backend_names", backendNames,
-			"rpc_url", rpcURL,
-			"ws_url", wsURL)
-	}
-
-	backendGroups := make(map[string]*BackendGroup)
-	for bgName, bg := range config.BackendGroups {
-		backends := make([]*Backend, 0)
-		fallbackBackends := make(map[string]bool)
-		fallbackCount := 0
-		for _, bName := range bg.Backends {
-			if backendsByName[bName] == nil {
-				return nil, nil, fmt.Errorf("backend %s is not defined", bName)
-			}
-			backends = append(backends, backendsByName[bName])
-
-			for _, fb := range bg.Fallbacks {
-				if bName == fb {
-					fallbackBackends[bName] = true
-					log.Info("configured backend as fallback",
-						"backend_name", bName,
-						"backend_group", bgName,
-					)
-					fallbackCount++
-				}
-			}
-
-			if _, ok := fallbackBackends[bName]; !ok {
-				fallbackBackends[bName] = false
-				log.Info("configured backend as primary",
-					"backend_name", bName,
-					"backend_group", bgName,
-				)
-			}
-		}
-
-		if fallbackCount != len(bg.Fallbacks) {
-			return nil, nil,
-				fmt.Errorf(
-					"error: number of fallbacks instantiated (%d) did not match configured (%d) for backend group %s",
-					fallbackCount, len(bg.Fallbacks), bgName,
-				)
-		}
-
-		backendGroups[bgName] = &BackendGroup{
-			Name:                   bgName,
-			Backends:               backends,
-			WeightedRouting:        bg.WeightedRouting,
-			FallbackBackends:       fallbackBackends,
-			routingStrategy:        bg.RoutingStrategy,
-			multicallRPCErrorCheck: bg.MulticallRPCErrorCheck,
-		}
-	}
-
-	var wsBackendGroup *BackendGroup
-	if config.WSBackendGroup != "" {
-		wsBackendGroup = backendGroups[config.WSBackendGroup]
-		if wsBackendGroup == nil {
-			return nil, nil, fmt.Errorf("ws backend group %s does not exist", config.WSBackendGroup)
-		}
+	backendsByName, err := buildBackends(config, rpcRequestSemaphore, nil)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if wsBackendGroup == nil && config.Server.WSPort != 0 {
-		return nil, nil, fmt.Errorf("a ws port was defined, but no ws group was defined")
+	backendGroups, err := buildBackendGroups(config, backendsByName, nil)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	for _, bg := range config.RPCMethodMappings {
-		if backendGroups[bg] == nil {
-			return nil, nil, fmt.Errorf("undefined backend group %s", bg)
-		}
+	wsBackendGroup, err := resolveWSBackendGroup(config, backendGroups)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var resolvedAuth map[string]string
@@ -297,43 +155,68 @@ func Start(config *Config) (*Server, func(), error) {
 		}
 	}
 
-	var (
-		cache    Cache
-		rpcCache RPCCache
-	)
+	var rpcCache RPCCache
 	if config.Cache.Enabled {
 		if redisClient == nil {
 			log.Warn("redis is not configured, using in-memory cache")
-			cache = newMemoryCache()
-		} else {
-			ttl := defaultCacheTtl
-			if config.Cache.TTL != 0 {
-				ttl = time.Duration(config.Cache.TTL)
+		}
+		// newCache creates the storage of a set of cached methods. When ttl is 0,
+		// redis uses the configured cache ttl and in-memory entries don't expire.
+		var maxTTL time.Duration
+		newCache := func(ttl time.Duration) Cache {
+			if redisClient == nil {
+				return newCacheWithCompression(newMemoryCacheWithTTL(ttl))
 			}
-			cache = newRedisCache(redisClient, redisReadClient, config.Redis.Namespace, ttl)
-
+			if ttl == 0 {
+				ttl = defaultCacheTtl
+				if config.Cache.TTL != 0 {
+					ttl = time.Duration(config.Cache.TTL)
+				}
+			}
+			maxTTL = max(maxTTL, ttl)
+			var cache Cache = newRedisCache(redisClient, redisReadClient, config.Redis.Namespace, ttl)
 			if config.Redis.FallbackToMemory {
-				cache = newFallbackCache(cache, newMemoryCache())
+				cache = newFallbackCache(cache, newMemoryCacheWithTTL(ttl))
+			}
+			return newCacheWithCompression(cache)
+		}
+
+		finalizedHandlers := make(map[string]*FinalizedBlockMethodHandler)
+		for method, methodCfg := range config.Cache.FinalizedMethods {
+			if !IsFinalizedCacheMethod(method) {
+				return nil, nil, fmt.Errorf("method %s is not supported by the finalized cache", method)
 			}
+			finalizedHandlers[method] = NewFinalizedBlockMethodHandler(newCache(time.Duration(methodCfg.TTL)), methodCfg.MaxSizeBytes)
+		}
+		cache := newCache(0)
+		// the keys of the cached blocks are stored next to the cache, so that any
+		// instance sharing it can invalidate the blocks of a reorg
+		var blocks blockKeyStore
+		if redisClient != nil {
+			blocks = newRedisBlockKeyStore(redisClient, config.Redis.Namespace, maxTTL)
 		}
-		rpcCache = newRPCCache(newCacheWithCompression(cache))
+		rpcCache = newRPCCache(cache, finalizedHandlers, blocks)
 	}
 
-	limiterFactory := func(dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	limiterFactory := func(dur time.Duration, max int, prefix string, algorithm string) FrontendRateLimiter {
 		if config.RateLimit.UseRedis {
-			limiter := NewRedisFrontendRateLimiter(redisClient, dur, max, prefix)
+			limiter := NewRedisRateLimiter(algorithm, redisClient, dur, max, prefix)
 
 			if config.Redis.FallbackToMemory {
 				limiter = NewFallbackRateLimiter(
 					limiter,
-					NewMemoryFrontendRateLimit(dur, max),
+					NewMemoryRateLimiter(algorithm, dur, max),
 				)
 			}
 
 			return limiter
 		}
 
-		return NewMemoryFrontendRateLimit(dur, max)
+		return NewMemoryRateLimiter(algorithm, dur, max)
+	}
+
+	apiKeyStoreFactory := func(cfg APIKeysConfig) (*APIKeyStore, error) {
+		return NewAPIKeyStore(cfg, redisClient, config.Redis.Namespace, limiterFactory)
 	}
 
 	srv, err := NewServer(
@@ -357,6 +240,76 @@ func Start(config *Config) (*Server, func(), error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating server: %w", err)
 	}
+	srv.config = config
+	srv.rpcRequestSemaphore = rpcRequestSemaphore
+	srv.apiKeyStoreFactory = apiKeyStoreFactory
+	srv.wsMultiplexSubscriptions = config.Server.WSMultiplexSubscriptions
+
+	if config.SenderRateLimit.Enabled && config.SenderRateLimit.MaxInflightNonces > 0 {
+		window := time.Duration(config.SenderRateLimit.InflightNonceWindow)
+		if window == 0 {
+			window = time.Duration(config.SenderRateLimit.Interval)
+		}
+		if config.RateLimit.UseRedis {
+			srv.senderNonceLim = NewRedisSenderNonceLimiter(redisClient, window, config.SenderRateLimit.MaxInflightNonces, config.Redis.Namespace)
+		} else {
+			srv.senderNonceLim = NewMemorySenderNonceLimiter(window, config.SenderRateLimit.MaxInflightNonces)
+		}
+	}
+
+	routingRules, err := buildRoutingRules(config.RoutingRules)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv.routingRules = routingRules
+
+	pathRoutes, err := buildPathRoutes(config.PathRoutes, srv.maxBodySize, limiterFactory)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv.pathRoutes = pathRoutes
+
+	if config.TxPolicy.Enabled {
+		var dedupe Cache
+		if window := time.Duration(config.TxPolicy.DedupeWindow); window > 0 {
+			if redisClient != nil {
+				dedupe = newRedisCache(redisClient, redisReadClient, config.Redis.Namespace, window)
+			} else {
+				dedupe = newMemoryCacheWithTTL(window)
+			}
+		}
+		txPolicy, err := newTxPolicy(config.TxPolicy, dedupe)
+		if err != nil {
+			return nil, nil, err
+		}
+		srv.txPolicy = txPolicy
+	}
+
+	if config.Capture.Dir != "" {
+		capturer, err := NewCapturer(config.Capture)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Info("capturing requests", "dir", config.Capture.Dir, "sample_rate", capturer.sampleRate)
+		srv.capturer = capturer
+	}
+
+	if config.APIKeys.Enabled() {
+		apiKeys, err := apiKeyStoreFactory(config.APIKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		apiKeys.Start()
+		srv.apiKeys = apiKeys
+	}
+
+	if config.JWTAuth.Enabled() {
+		jwtAuth, err := NewJWTAuthenticator(config.JWTAuth, limiterFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		srv.jwtAuth = jwtAuth
+	}
 
 	// Enable to support browser websocket connections.
 	// See https://pkg.go.dev/github.com/gorilla/websocket#hdr-Origin_Considerations
@@ -376,11 +329,41 @@ func Start(config *Config) (*Server, func(), error) {
 		}()
 	}
 
+	var adminSrv *AdminServer
+	if config.Admin.Port != 0 {
+		if len(config.Admin.Authentication) == 0 {
+			return nil, nil, errors.New("admin server requires at least one authentication token")
+		}
+		adminAuth := make(map[string]string)
+		for secret, operator := range config.Admin.Authentication {
+			resolvedSecret, err := ReadFromEnvOrConfig(secret)
+			if err != nil {
+				return nil, nil, err
+			}
+			adminAuth[resolvedSecret] = operator
+		}
+		adminSrv = NewAdminServer(srv, adminAuth)
+		go func() {
+			if err := adminSrv.ListenAndServe(config.Admin.Host, config.Admin.Port); err != nil {
+				if errors.Is(err, http.ErrServerClosed) {
+					log.Info("admin server shut down")
+					return
+				}
+				log.Crit("error starting admin server", "err", err)
+			}
+		}()
+	}
+
 	// To allow integration tests to cleanly come up, wait
 	// 10ms to give the below goroutines enough time to
 	// encounter an error creating their servers
 	errTimer := time.NewTimer(10 * time.Millisecond)
 
+	if tracer != nil {
+		log.Info("starting tracing", "exporter", config.Tracing.Exporter)
+		tracer.Start()
+	}
+
 	if config.Server.RPCPort != 0 {
 		go func() {
 			if err := srv.RPCListenAndServe(config.Server.RPCHost, config.Server.RPCPort); err != nil {
@@ -408,93 +391,542 @@ func Start(config *Config) (*Server, func(), error) {
 	}
 
 	for bgName, bg := range backendGroups {
-		bgcfg := config.BackendGroups[bgName]
-
-		if !bgcfg.ValidateRoutingStrategy(bgName) {
-			log.Crit("Invalid routing strategy provided. Valid options: fallback, multicall, consensus_aware, \"\"", "name", bgName)
+		if err := configureConsensus(bg, config.BackendGroups[bgName], srv.handleReorg); err != nil {
+			return nil, nil, err
+		}
+		if err := configureHealthChecker(bg, config.BackendGroups[bgName]); err != nil {
+			return nil, nil, err
 		}
+	}
 
-		log.Info("configuring routing strategy for backend_group", "name", bgName, "routing_strategy", bgcfg.RoutingStrategy)
+	<-errTimer.C
+	log.Info("started proxyd")
 
-		if bgcfg.RoutingStrategy == ConsensusAwareRoutingStrategy {
-			log.Info("creating poller for consensus aware backend_group", "name", bgName)
+	shutdownFunc := func() {
+		log.Info("shutting down proxyd")
+		if adminSrv != nil {
+			adminSrv.Shutdown()
+		}
+		srv.Shutdown()
+		if srv.capturer != nil {
+			srv.capturer.Stop()
+		}
+		if tracer != nil {
+			tracer.Stop()
+		}
+		log.Info("goodbye")
+	}
 
-			copts := make([]ConsensusOpt, 0)
+	return srv, shutdownFunc, nil
+}
 
-			if bgcfg.ConsensusAsyncHandler == "noop" {
-				copts = append(copts, WithAsyncHandler(NewNoopAsyncHandler()))
-			}
-			if bgcfg.ConsensusBanPeriod > 0 {
-				copts = append(copts, WithBanPeriod(time.Duration(bgcfg.ConsensusBanPeriod)))
+// buildBackends creates a Backend for every entry in config.Backends. When
+// reuse is non-nil it is consulted first, allowing a running server to keep
+// the existing Backend (and its connections and sliding windows) for entries
+// whose configuration has not changed.
+func buildBackends(config *Config, rpcRequestSemaphore *semaphore.Weighted, reuse func(name string) *Backend) (map[string]*Backend, error) {
+	backendNames := make([]string, 0)
+	backendsByName := make(map[string]*Backend)
+	for name, cfg := range config.Backends {
+		if reuse != nil {
+			if back := reuse(name); back != nil {
+				backendsByName[name] = back
+				log.Debug("reusing unchanged backend", "name", name)
+				continue
 			}
-			if bgcfg.ConsensusMaxUpdateThreshold > 0 {
-				copts = append(copts, WithMaxUpdateThreshold(time.Duration(bgcfg.ConsensusMaxUpdateThreshold)))
+		}
+
+		back, err := buildBackend(name, cfg, config.BackendOptions, rpcRequestSemaphore)
+		if err != nil {
+			return nil, err
+		}
+		backendNames = append(backendNames, name)
+		backendsByName[name] = back
+		RecordConsensusBackendForcedCandidate(back, back.IsForcedCandidate())
+		log.Info("configured backend",
+			"name", name,
+			"backend_names", backendNames,
+			"rpc_url", back.rpcURL,
+			"ws_url", back.wsURL)
+	}
+	return backendsByName, nil
+}
+
+func buildBackend(name string, cfg *BackendConfig, backendOptions BackendOptions, rpcRequestSemaphore *semaphore.Weighted) (*Backend, error) {
+	opts := make([]BackendOpt, 0)
+
+	rpcURL, err := ReadFromEnvOrConfig(cfg.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	wsURL, err := ReadFromEnvOrConfig(cfg.WSURL)
+	if err != nil {
+		return nil, err
+	}
+	if rpcURL == "" {
+		return nil, fmt.Errorf("must define an RPC URL for backend %s", name)
+	}
+
+	if backendOptions.ResponseTimeoutSeconds != 0 {
+		timeout := secondsToDuration(backendOptions.ResponseTimeoutSeconds)
+		opts = append(opts, WithTimeout(timeout))
+	}
+	if backendOptions.MaxRetries != 0 {
+		opts = append(opts, WithMaxRetries(backendOptions.MaxRetries))
+	}
+	if backendOptions.MaxResponseSizeBytes != 0 {
+		opts = append(opts, WithMaxResponseSize(backendOptions.MaxResponseSizeBytes))
+	}
+	if backendOptions.OutOfServiceSeconds != 0 {
+		opts = append(opts, WithOutOfServiceDuration(secondsToDuration(backendOptions.OutOfServiceSeconds)))
+	}
+	if backendOptions.MaxDegradedLatencyThreshold > 0 {
+		opts = append(opts, WithMaxDegradedLatencyThreshold(time.Duration(backendOptions.MaxDegradedLatencyThreshold)))
+	}
+	if backendOptions.MaxLatencyThreshold > 0 {
+		opts = append(opts, WithMaxLatencyThreshold(time.Duration(backendOptions.MaxLatencyThreshold)))
+	}
+	if backendOptions.MaxErrorRateThreshold > 0 {
+		opts = append(opts, WithMaxErrorRateThreshold(backendOptions.MaxErrorRateThreshold))
+	}
+	if backendOptions.CircuitBreakerFailureThreshold > 0 {
+		// the circuit stays open for out_of_service_seconds unless set otherwise
+		openDuration := time.Duration(backendOptions.CircuitBreakerOpenDuration)
+		if openDuration == 0 && backendOptions.OutOfServiceSeconds != 0 {
+			openDuration = secondsToDuration(backendOptions.OutOfServiceSeconds)
+		}
+		opts = append(opts, WithCircuitBreaker(CircuitBreakerConfig{
+			FailureThreshold: backendOptions.CircuitBreakerFailureThreshold,
+			OpenDuration:     openDuration,
+			HalfOpenRequests: backendOptions.CircuitBreakerHalfOpenRequests,
+			SuccessThreshold: backendOptions.CircuitBreakerSuccessThreshold,
+			ProbeMethod:      backendOptions.CircuitBreakerProbeMethod,
+			ProbeInterval:    time.Duration(backendOptions.CircuitBreakerProbeInterval),
+		}))
+	}
+	if cfg.MaxRPS != 0 {
+		opts = append(opts, WithMaxRPS(cfg.MaxRPS))
+	}
+	if cfg.MaxWSConns != 0 {
+		opts = append(opts, WithMaxWSConns(cfg.MaxWSConns))
+	}
+	if cfg.Password != "" {
+		passwordVal, err := ReadFromEnvOrConfig(cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithBasicAuth(cfg.Username, passwordVal))
+	}
+	if cfg.JWTSecret != "" {
+		if cfg.Password != "" {
+			return nil, fmt.Errorf("backend %s cannot use both basic auth and a jwt secret", name)
+		}
+		secretVal, err := ReadFromEnvOrConfig(cfg.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := parseEngineJWTSecret(secretVal)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", name, err)
+		}
+		opts = append(opts, WithJWTSecret(secret))
+	}
+
+	headers := map[string]string{}
+	for headerName, headerValue := range cfg.Headers {
+		headerValue, err := ReadFromEnvOrConfig(headerValue)
+		if err != nil {
+			return nil, err
+		}
+
+		headers[headerName] = headerValue
+	}
+	opts = append(opts, WithHeaders(headers))
+
+	tlsConfig, err := configureBackendTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		log.Info("using custom TLS config for backend", "name", name)
+		opts = append(opts, WithTLSConfig(tlsConfig))
+	}
+	if cfg.StripTrailingXFF {
+		opts = append(opts, WithStrippedTrailingXFF())
+	}
+	opts = append(opts, WithProxydIP(os.Getenv("PROXYD_IP")))
+	opts = append(opts, WithConsensusSkipPeerCountCheck(cfg.ConsensusSkipPeerCountCheck))
+	opts = append(opts, WithConsensusForcedCandidate(cfg.ConsensusForcedCandidate))
+	opts = append(opts, WithWeight(cfg.Weight))
+
+	receiptsTarget, err := ReadFromEnvOrConfig(cfg.ConsensusReceiptsTarget)
+	if err != nil {
+		return nil, err
+	}
+	receiptsTarget, err = validateReceiptsTarget(receiptsTarget)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithConsensusReceiptTarget(receiptsTarget))
+
+	return NewBackend(name, rpcURL, wsURL, rpcRequestSemaphore, opts...), nil
+}
+
+// buildBackendGroups creates a BackendGroup for every entry in config.BackendGroups.
+// As with buildBackends, reuse lets a running server keep an existing group,
+// including its consensus poller, when neither it nor its backends changed.
+func buildBackendGroups(config *Config, backendsByName map[string]*Backend, reuse func(name string) *BackendGroup) (map[string]*BackendGroup, error) {
+	backendGroups := make(map[string]*BackendGroup)
+	for bgName, bg := range config.BackendGroups {
+		if reuse != nil {
+			if existing := reuse(bgName); existing != nil {
+				backendGroups[bgName] = existing
+				log.Debug("reusing unchanged backend group", "name", bgName)
+				continue
 			}
-			if bgcfg.ConsensusMaxBlockLag > 0 {
-				copts = append(copts, WithMaxBlockLag(bgcfg.ConsensusMaxBlockLag))
+		}
+
+		group, err := buildBackendGroup(bgName, bg, backendsByName)
+		if err != nil {
+			return nil, err
+		}
+		backendGroups[bgName] = group
+	}
+	return backendGroups, nil
+}
+
+// buildBackendGroup creates the BackendGroup of a config, without starting its consensus poller or health checks
+func buildBackendGroup(bgName string, bg *BackendGroupConfig, backendsByName map[string]*Backend) (*BackendGroup, error) {
+	log.Info("configuring routing strategy for backend_group", "name", bgName, "routing_strategy", bg.RoutingStrategy)
+
+	if len(bg.Backends) == 0 {
+		return nil, fmt.Errorf("backend group %s must have at least one backend", bgName)
+	}
+
+	backends := make([]*Backend, 0)
+	fallbackBackends := make(map[string]bool)
+	fallbackCount := 0
+	for _, bName := range bg.Backends {
+		if backendsByName[bName] == nil {
+			return nil, fmt.Errorf("backend %s is not defined", bName)
+		}
+		backends = append(backends, backendsByName[bName])
+
+		for _, fb := range bg.Fallbacks {
+			if bName == fb {
+				fallbackBackends[bName] = true
+				log.Info("configured backend as fallback",
+					"backend_name", bName,
+					"backend_group", bgName,
+				)
+				fallbackCount++
 			}
-			if bgcfg.ConsensusMinPeerCount > 0 {
-				copts = append(copts, WithMinPeerCount(uint64(bgcfg.ConsensusMinPeerCount)))
+		}
+
+		if _, ok := fallbackBackends[bName]; !ok {
+			fallbackBackends[bName] = false
+			log.Info("configured backend as primary",
+				"backend_name", bName,
+				"backend_group", bgName,
+			)
+		}
+	}
+
+	for _, fb := range bg.Fallbacks {
+		if _, ok := fallbackBackends[fb]; !ok {
+			return nil, fmt.Errorf("fallback %s of backend group %s is not one of its backends", fb, bgName)
+		}
+	}
+	if fallbackCount != len(bg.Fallbacks) {
+		return nil,
+			fmt.Errorf(
+				"error: number of fallbacks instantiated (%d) did not match configured (%d) for backend group %s",
+				fallbackCount, len(bg.Fallbacks), bgName,
+			)
+	}
+	if bg.RoutingStrategy == ConsensusAwareRoutingStrategy && fallbackCount == len(backends) {
+		return nil, fmt.Errorf("backend group %s has no primary backends, all of them are fallbacks", bgName)
+	}
+
+	if bg.RoutingStrategy == ConsensusAwareRoutingStrategy && bg.ConsensusHA {
+		if len(bg.ConsensusHAPeers) > 0 {
+			if bg.ConsensusHARedis.URL != "" {
+				return nil, fmt.Errorf("consensus_ha_redis and consensus_ha_peers can't both be set for backend group %s", bgName)
 			}
-			if bgcfg.ConsensusMaxBlockRange > 0 {
-				copts = append(copts, WithMaxBlockRange(bgcfg.ConsensusMaxBlockRange))
+			if bg.ConsensusHAPeerURL == "" {
+				return nil, fmt.Errorf("must specify consensus_ha_peer_url when consensus_ha_peers is set for backend group %s", bgName)
 			}
-			if bgcfg.ConsensusPollerInterval > 0 {
-				copts = append(copts, WithPollerInterval(time.Duration(bgcfg.ConsensusPollerInterval)))
+			// the status of the instance is served on the public RPC server, only the peers may read it
+			if bg.ConsensusHAPeerToken == "" {
+				return nil, fmt.Errorf("must specify consensus_ha_peer_token when consensus_ha_peers is set for backend group %s", bgName)
 			}
+		} else if bg.ConsensusHARedis.URL == "" {
+			return nil, fmt.Errorf("must specify a consensus_ha_redis config when consensus_ha is true for backend group %s", bgName)
+		}
+	}
 
-			for _, be := range bgcfg.Backends {
-				if fallback, ok := bg.FallbackBackends[be]; !ok {
-					log.Crit("error backend not found in backend fallback configurations", "backend_name", be)
-				} else {
-					log.Debug("configuring new backend for group", "backend_group", bgName, "backend_name", be, "fallback", fallback)
-					RecordBackendGroupFallbacks(bg, be, fallback)
-				}
-			}
+	hedgeMethods, err := buildHedgeMethods(bgName, bg)
+	if err != nil {
+		return nil, err
+	}
 
-			var tracker ConsensusTracker
-			if bgcfg.ConsensusHA {
-				if bgcfg.ConsensusHARedis.URL == "" {
-					log.Crit("must specify a consensus_ha_redis config when consensus_ha is true")
-				}
-				topts := make([]RedisConsensusTrackerOpt, 0)
-				if bgcfg.ConsensusHALockPeriod > 0 {
-					topts = append(topts, WithLockPeriod(time.Duration(bgcfg.ConsensusHALockPeriod)))
-				}
-				if bgcfg.ConsensusHAHeartbeatInterval > 0 {
-					topts = append(topts, WithHeartbeatInterval(time.Duration(bgcfg.ConsensusHAHeartbeatInterval)))
-				}
-				consensusHARedisClient, err := NewRedisClient(bgcfg.ConsensusHARedis.URL, bgcfg.ConsensusHARedis.RedisCluster)
-				if err != nil {
-					return nil, nil, err
-				}
-				if err := CheckRedisConnection(consensusHARedisClient); err != nil {
-					return nil, nil, err
-				}
-				ns := fmt.Sprintf("%s:%s", bgcfg.ConsensusHARedis.Namespace, bg.Name)
-				tracker = NewRedisConsensusTracker(context.Background(), consensusHARedisClient, bg, ns, topts...)
-				copts = append(copts, WithTracker(tracker))
-			}
+	rankingStrategy := bg.ConsensusRoutingStrategy
+	if bg.RoutingStrategy.IsLoadAware() {
+		rankingStrategy = bg.RoutingStrategy
+	}
 
-			cp := NewConsensusPoller(bg, copts...)
-			bg.Consensus = cp
+	group := &BackendGroup{
+		Name:                   bgName,
+		Backends:               backends,
+		WeightedRouting:        bg.WeightedRouting,
+		FallbackBackends:       fallbackBackends,
+		routingStrategy:        bg.RoutingStrategy,
+		multicallRPCErrorCheck: bg.MulticallRPCErrorCheck,
+		rankingStrategy:        rankingStrategy,
+		hedgeMethods:           hedgeMethods,
+		hedgeDelay:             time.Duration(bg.HedgeDelay),
+		hedgeLatencyPercentile: bg.HedgeLatencyPercentile,
+	}
+	if err := configureGetLogsSplit(group, bg); err != nil {
+		return nil, fmt.Errorf("backend group %s: %w", bgName, err)
+	}
+	if err := configureQuorum(group, bg); err != nil {
+		return nil, fmt.Errorf("backend group %s: %w", bgName, err)
+	}
+	if err := configureStickySessions(group, bg); err != nil {
+		return nil, fmt.Errorf("backend group %s: %w", bgName, err)
+	}
+	return group, nil
+}
 
-			if bgcfg.ConsensusHA {
-				tracker.(*RedisConsensusTracker).Init()
-			}
+func configureGetLogsSplit(bg *BackendGroup, bgcfg *BackendGroupConfig) error {
+	if bgcfg.GetLogsSplitRange == 0 {
+		return nil
+	}
+	if bgcfg.GetLogsSplitConcurrency < 0 || bgcfg.GetLogsSplitMaxChunks < 0 || bgcfg.GetLogsMaxResults < 0 {
+		return errors.New("get_logs_split limits must not be negative")
+	}
+	// a chunk of n blocks spans a range of n-1 blocks
+	if bgcfg.ConsensusMaxBlockRange > 0 && bgcfg.GetLogsSplitRange > bgcfg.ConsensusMaxBlockRange+1 {
+		return errors.New("get_logs_split_range must not exceed consensus_max_block_range + 1")
+	}
+	bg.getLogsSplitRange = bgcfg.GetLogsSplitRange
+	bg.getLogsSplitConcurrency = defaultGetLogsSplitConcurrency
+	if bgcfg.GetLogsSplitConcurrency > 0 {
+		bg.getLogsSplitConcurrency = bgcfg.GetLogsSplitConcurrency
+	}
+	bg.getLogsSplitMaxChunks = defaultGetLogsSplitMaxChunks
+	if bgcfg.GetLogsSplitMaxChunks > 0 {
+		bg.getLogsSplitMaxChunks = bgcfg.GetLogsSplitMaxChunks
+	}
+	bg.getLogsMaxResults = defaultGetLogsMaxResults
+	if bgcfg.GetLogsMaxResults > 0 {
+		bg.getLogsMaxResults = bgcfg.GetLogsMaxResults
+	}
+	return nil
+}
+
+func configureQuorum(bg *BackendGroup, bgcfg *BackendGroupConfig) error {
+	if bgcfg.RoutingStrategy != QuorumRoutingStrategy {
+		if bgcfg.QuorumSize != 0 || bgcfg.QuorumThreshold != 0 || len(bgcfg.QuorumMethods) > 0 {
+			return errors.New("quorum settings require routing_strategy = quorum")
 		}
+		return nil
+	}
+	if bgcfg.QuorumSize < 0 || bgcfg.QuorumThreshold < 0 {
+		return errors.New("quorum_size and quorum_threshold must not be negative")
+	}
+	bg.quorumSize = len(bg.Backends)
+	if bgcfg.QuorumSize > 0 {
+		bg.quorumSize = bgcfg.QuorumSize
+	}
+	if bg.quorumSize > len(bg.Backends) {
+		return fmt.Errorf("quorum_size %d is larger than the number of backends (%d)", bg.quorumSize, len(bg.Backends))
+	}
+	// a strict majority by default, so that there can only be one winning result
+	bg.quorumThreshold = bg.quorumSize/2 + 1
+	if bgcfg.QuorumThreshold > 0 {
+		bg.quorumThreshold = bgcfg.QuorumThreshold
+	}
+	if bg.quorumThreshold > bg.quorumSize {
+		return fmt.Errorf("quorum_threshold %d is larger than quorum_size %d", bg.quorumThreshold, bg.quorumSize)
 	}
+	if len(bgcfg.QuorumMethods) == 0 {
+		bg.quorumMethods = NewStringSetFromStrings(defaultQuorumMethods)
+		return nil
+	}
+	for _, method := range bgcfg.QuorumMethods {
+		if !idempotentReadMethodSet.Has(method) {
+			return fmt.Errorf("method %s cannot be sent to a quorum, only idempotent reads can", method)
+		}
+	}
+	bg.quorumMethods = NewStringSetFromStrings(bgcfg.QuorumMethods)
+	return nil
+}
 
-	<-errTimer.C
-	log.Info("started proxyd")
+// configureStickySessions always maps filters to the backend that created them, clients
+// are only pinned to a backend when sticky_session_key is set
+func configureStickySessions(bg *BackendGroup, bgcfg *BackendGroupConfig) error {
+	if err := validateStickySessionKey(bgcfg.StickySessionKey); err != nil {
+		return err
+	}
+	if bgcfg.StickySessionKey == StickySessionKeyHeader && bgcfg.StickySessionHeader == "" {
+		return errors.New("sticky_session_key = header requires sticky_session_header")
+	}
+	bg.stickySessions = newStickySessions(bg, bgcfg.StickySessionKey, bgcfg.StickySessionHeader, time.Duration(bgcfg.StickySessionTTL))
+	return nil
+}
 
-	shutdownFunc := func() {
-		log.Info("shutting down proxyd")
-		srv.Shutdown()
-		log.Info("goodbye")
+// configureConsensus starts the consensus poller for consensus aware backend
+// groups. It is a no-op for any other routing strategy, or for groups that
+// already have a poller running. onReorg is notified of the reorgs of the consensus head.
+func configureConsensus(bg *BackendGroup, bgcfg *BackendGroupConfig, onReorg OnReorg) error {
+	if bgcfg.RoutingStrategy != ConsensusAwareRoutingStrategy || bg.Consensus != nil {
+		return nil
 	}
 
-	return srv, shutdownFunc, nil
+	log.Info("creating poller for consensus aware backend_group", "name", bg.Name)
+
+	copts := make([]ConsensusOpt, 0)
+
+	if bgcfg.ConsensusAsyncHandler == "noop" {
+		copts = append(copts, WithAsyncHandler(NewNoopAsyncHandler()))
+	}
+	if bgcfg.ConsensusBanPeriod > 0 {
+		copts = append(copts, WithBanPeriod(time.Duration(bgcfg.ConsensusBanPeriod)))
+	}
+	if bgcfg.ConsensusMaxUpdateThreshold > 0 {
+		copts = append(copts, WithMaxUpdateThreshold(time.Duration(bgcfg.ConsensusMaxUpdateThreshold)))
+	}
+	if bgcfg.ConsensusMaxBlockLag > 0 {
+		copts = append(copts, WithMaxBlockLag(bgcfg.ConsensusMaxBlockLag))
+	}
+	if bgcfg.ConsensusMinPeerCount > 0 {
+		copts = append(copts, WithMinPeerCount(uint64(bgcfg.ConsensusMinPeerCount)))
+	}
+	if bgcfg.ConsensusMaxBlockRange > 0 {
+		copts = append(copts, WithMaxBlockRange(bgcfg.ConsensusMaxBlockRange))
+	}
+	if bgcfg.ConsensusPollerInterval > 0 {
+		copts = append(copts, WithPollerInterval(time.Duration(bgcfg.ConsensusPollerInterval)))
+	}
+	if bgcfg.ConsensusScoring {
+		copts = append(copts, WithScoring(true))
+	}
+	if bgcfg.ConsensusReorgTrackingDepth > 0 {
+		copts = append(copts, WithReorgTrackingDepth(bgcfg.ConsensusReorgTrackingDepth))
+	}
+	if onReorg != nil {
+		copts = append(copts, WithReorgListener(onReorg))
+	}
+	if bgcfg.ConsensusReorgWebhookURL != "" {
+		copts = append(copts, WithReorgListener(newReorgWebhook(bgcfg.ConsensusReorgWebhookURL)))
+	}
+
+	for _, be := range bgcfg.Backends {
+		if fallback, ok := bg.FallbackBackends[be]; !ok {
+			return fmt.Errorf("error backend %s not found in backend fallback configurations", be)
+		} else {
+			log.Debug("configuring new backend for group", "backend_group", bg.Name, "backend_name", be, "fallback", fallback)
+			RecordBackendGroupFallbacks(bg, be, fallback)
+		}
+	}
+
+	var tracker ConsensusTracker
+	if bgcfg.ConsensusHA && len(bgcfg.ConsensusHAPeers) > 0 {
+		topts := make([]PeerConsensusTrackerOpt, 0)
+		if bgcfg.ConsensusHAHeartbeatInterval > 0 {
+			topts = append(topts, WithPeerHeartbeatInterval(time.Duration(bgcfg.ConsensusHAHeartbeatInterval)))
+		}
+		token, err := ReadFromEnvOrConfig(bgcfg.ConsensusHAPeerToken)
+		if err != nil {
+			return err
+		}
+		topts = append(topts, WithPeerToken(token))
+		peerTracker, err := NewPeerConsensusTracker(context.Background(), bg, bgcfg.ConsensusHAPeerURL, bgcfg.ConsensusHAPeers, topts...)
+		if err != nil {
+			return err
+		}
+		tracker = peerTracker
+		copts = append(copts, WithTracker(tracker))
+	} else if bgcfg.ConsensusHA {
+		topts := make([]RedisConsensusTrackerOpt, 0)
+		if bgcfg.ConsensusHALockPeriod > 0 {
+			topts = append(topts, WithLockPeriod(time.Duration(bgcfg.ConsensusHALockPeriod)))
+		}
+		if bgcfg.ConsensusHAHeartbeatInterval > 0 {
+			topts = append(topts, WithHeartbeatInterval(time.Duration(bgcfg.ConsensusHAHeartbeatInterval)))
+		}
+		consensusHARedisClient, err := NewRedisClient(bgcfg.ConsensusHARedis.URL, bgcfg.ConsensusHARedis.RedisCluster)
+		if err != nil {
+			return err
+		}
+		if err := CheckRedisConnection(consensusHARedisClient); err != nil {
+			_ = consensusHARedisClient.Close()
+			return err
+		}
+		ns := fmt.Sprintf("%s:%s", bgcfg.ConsensusHARedis.Namespace, bg.Name)
+		tracker = NewRedisConsensusTracker(context.Background(), consensusHARedisClient, bg, ns, topts...)
+		copts = append(copts, WithTracker(tracker))
+	}
+
+	cp := NewConsensusPoller(bg, copts...)
+	bg.Consensus = cp
+
+	switch tracker := tracker.(type) {
+	case *RedisConsensusTracker:
+		tracker.Init()
+	case *PeerConsensusTracker:
+		tracker.Init()
+	}
+	return nil
+}
+
+// configureHealthChecker starts the health checks of backend groups setting
+// health_check_interval, unless they already run
+func configureHealthChecker(bg *BackendGroup, bgcfg *BackendGroupConfig) error {
+	method, err := validateHealthCheck(bg.Name, bgcfg)
+	if err != nil || method == "" || bg.HealthChecker != nil {
+		return err
+	}
+
+	log.Info("starting health checks for backend_group", "name", bg.Name, "method", method)
+	bg.HealthChecker = NewHealthChecker(bg, HealthCheckerConfig{
+		Method:      method,
+		Interval:    time.Duration(bgcfg.HealthCheckInterval),
+		MaxBlockLag: bgcfg.HealthCheckMaxBlockLag,
+		MaxLatency:  time.Duration(bgcfg.HealthCheckMaxLatency),
+	})
+	bg.HealthChecker.Start()
+	return nil
+}
+
+// validateHealthCheck returns the method of the health checks of a backend group,
+// or an empty string if they are disabled
+func validateHealthCheck(bgName string, bgcfg *BackendGroupConfig) (string, error) {
+	if bgcfg.HealthCheckInterval == 0 {
+		if bgcfg.HealthCheckMethod != "" || bgcfg.HealthCheckMaxBlockLag != 0 || bgcfg.HealthCheckMaxLatency != 0 {
+			return "", fmt.Errorf("health checks of backend group %s require health_check_interval", bgName)
+		}
+		return "", nil
+	}
+	if bgcfg.RoutingStrategy == ConsensusAwareRoutingStrategy {
+		return "", fmt.Errorf("backend group %s is consensus aware, its backends are already checked by the consensus poller", bgName)
+	}
+	if bgcfg.HealthCheckInterval < 0 || bgcfg.HealthCheckMaxLatency < 0 {
+		return "", fmt.Errorf("health_check_interval and health_check_max_latency of backend group %s must not be negative", bgName)
+	}
+	method := bgcfg.HealthCheckMethod
+	if method == "" {
+		method = DefaultHealthCheckMethod
+	}
+	if !idempotentReadMethodSet.Has(method) {
+		return "", fmt.Errorf("method %s cannot be used for health checks in backend group %s", method, bgName)
+	}
+	if bgcfg.HealthCheckMaxBlockLag > 0 && method != "eth_blockNumber" {
+		return "", fmt.Errorf("health_check_max_block_lag of backend group %s requires health_check_method = eth_blockNumber", bgName)
+	}
+	return method, nil
 }
 
 func validateReceiptsTarget(val string) (string, error) {
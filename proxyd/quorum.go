@@ -0,0 +1,287 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// defaultQuorumMethods are the reads sent to a quorum when quorum_methods is not set
+var defaultQuorumMethods = []string{
+	"eth_call",
+	"eth_getBalance",
+	"eth_getCode",
+	"eth_getProof",
+	"eth_getStorageAt",
+	"eth_getTransactionByHash",
+	"eth_getTransactionCount",
+	"eth_getTransactionReceipt",
+}
+
+func (bg *BackendGroup) canQuorum(rpcReqs []*RPCReq) bool {
+	if bg.quorumMethods == nil {
+		return false
+	}
+	for _, req := range rpcReqs {
+		if !bg.quorumMethods.Has(req.Method) {
+			return false
+		}
+	}
+	return true
+}
+
+type quorumResponse struct {
+	backend *Backend
+	res     []*RPCRes
+	err     error
+}
+
+// quorumVote is a result returned by one or more backends for a call
+type quorumVote struct {
+	res      *RPCRes
+	backends []*Backend
+}
+
+// quorumTally groups the responses of the backends by their normalized result, for each call
+type quorumTally struct {
+	votes [][]*quorumVote
+	keys  []map[string]*quorumVote
+}
+
+func newQuorumTally(size int) *quorumTally {
+	t := &quorumTally{
+		votes: make([][]*quorumVote, size),
+		keys:  make([]map[string]*quorumVote, size),
+	}
+	for i := range t.keys {
+		t.keys[i] = make(map[string]*quorumVote)
+	}
+	return t
+}
+
+func (t *quorumTally) add(be *Backend, res []*RPCRes) {
+	for i, r := range res {
+		key := quorumKey(r)
+		vote, ok := t.keys[i][key]
+		if !ok {
+			vote = &quorumVote{res: r}
+			t.keys[i][key] = vote
+			t.votes[i] = append(t.votes[i], vote)
+		}
+		vote.backends = append(vote.backends, be)
+	}
+}
+
+// winner returns the result of a call at least threshold backends agreed on, if any
+func (t *quorumTally) winner(i int, threshold int) *quorumVote {
+	for _, vote := range t.votes[i] {
+		if len(vote.backends) >= threshold {
+			return vote
+		}
+	}
+	return nil
+}
+
+// decided checks if every call either reached the quorum, or can't reach it anymore
+// with the responses still pending
+func (t *quorumTally) decided(threshold int, pending int) bool {
+	for i := range t.votes {
+		if t.winner(i, threshold) != nil {
+			continue
+		}
+		best := 0
+		for _, vote := range t.votes[i] {
+			best = max(best, len(vote.backends))
+		}
+		if best+pending >= threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// describe lists the backends that returned each result of a call, e.g. "a,b|c"
+func (t *quorumTally) describe(i int) string {
+	groups := make([]string, 0, len(t.votes[i]))
+	for _, vote := range t.votes[i] {
+		names := make([]string, 0, len(vote.backends))
+		for _, be := range vote.backends {
+			names = append(names, be.Name)
+		}
+		groups = append(groups, strings.Join(names, ","))
+	}
+	return strings.Join(groups, "|")
+}
+
+// quorumKey returns the normalized form of a response that backends are compared on.
+// Errors are compared on their code and message only.
+func quorumKey(res *RPCRes) string {
+	if res.IsError() {
+		return string(mustMarshalJSON(map[string]interface{}{
+			"code":    res.Error.Code,
+			"message": res.Error.Message,
+		}))
+	}
+	return string(mustMarshalJSON(map[string]interface{}{
+		"result": normalizeQuorumValue(res.Result),
+	}))
+}
+
+// normalizeQuorumValue lowercases hex strings, so that checksummed addresses and
+// hashes compare equal. Object keys are sorted when marshaling.
+func normalizeQuorumValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			return strings.ToLower(v)
+		}
+		return v
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = normalizeQuorumValue(e)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = normalizeQuorumValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// ForwardQuorum sends the requests to quorum_size backends, and returns for each call the result
+// at least quorum_threshold of them agree on, or ErrQuorumNotReached. It returns as soon as every
+// call is decided, the remaining responses are still compared in the background so that the
+// backends that disagreed with the quorum are held against their error rate.
+func (bg *BackendGroup) ForwardQuorum(
+	rpcReqs []*RPCReq,
+	backends []*Backend,
+	ctx context.Context,
+	isBatch bool,
+) *BackendGroupRPCResponse {
+	if len(backends) > bg.quorumSize {
+		backends = backends[:bg.quorumSize]
+	}
+
+	// Create ctx without cancel so the slower backends are still compared
+	// after the original request returns
+	bgCtx := context.WithoutCancel(ctx)
+	results := make(chan quorumResponse, len(backends))
+	for _, be := range backends {
+		// requests are rewritten while being forwarded, so each backend needs its own copy
+		reqs := make([]*RPCReq, len(rpcReqs))
+		for i, req := range rpcReqs {
+			reqCopy := *req
+			reqs[i] = &reqCopy
+		}
+		go func(be *Backend) {
+			res, err := be.Forward(bgCtx, reqs, isBatch)
+			if err == nil && len(res) != len(reqs) {
+				err = ErrBackendUnexpectedJSONRPC
+			}
+			results <- quorumResponse{backend: be, res: res, err: err}
+		}(be)
+	}
+
+	tally := newQuorumTally(len(rpcReqs))
+	received := 0
+	for received < len(backends) && !tally.decided(bg.quorumThreshold, len(backends)-received) {
+		resp := <-results
+		received++
+		if resp.err != nil {
+			log.Warn("error forwarding quorum request to backend",
+				"req_id", GetReqID(ctx),
+				"auth", GetAuthCtx(ctx),
+				"backend_group", bg.Name,
+				"backend", resp.backend.Name,
+				"err", resp.err,
+			)
+			continue
+		}
+		tally.add(resp.backend, resp.res)
+	}
+
+	res := make([]*RPCRes, len(rpcReqs))
+	var servedBy []string
+	for i, req := range rpcReqs {
+		vote := tally.winner(i, bg.quorumThreshold)
+		if vote == nil {
+			log.Warn("backends did not reach quorum",
+				"req_id", GetReqID(ctx),
+				"auth", GetAuthCtx(ctx),
+				"backend_group", bg.Name,
+				"method", req.Method,
+				"threshold", bg.quorumThreshold,
+				"results", tally.describe(i),
+			)
+			RecordBackendGroupQuorum(bg, req.Method, false)
+			res[i] = NewRPCErrorRes(req.ID, ErrQuorumNotReached)
+			continue
+		}
+		RecordBackendGroupQuorum(bg, req.Method, true)
+		res[i] = vote.res
+		if servedBy == nil {
+			for _, be := range vote.backends {
+				servedBy = append(servedBy, fmt.Sprintf("%s/%s", bg.Name, be.Name))
+			}
+		}
+	}
+
+	pending := len(backends) - received
+	if pending == 0 {
+		bg.recordQuorumDisagreements(ctx, rpcReqs, tally)
+	} else {
+		go func() {
+			for i := 0; i < pending; i++ {
+				if resp := <-results; resp.err == nil {
+					tally.add(resp.backend, resp.res)
+				}
+			}
+			bg.recordQuorumDisagreements(ctx, rpcReqs, tally)
+		}()
+	}
+
+	return &BackendGroupRPCResponse{
+		RPCRes:   res,
+		ServedBy: strings.Join(servedBy, ", "),
+		error:    nil,
+	}
+}
+
+// recordQuorumDisagreements counts an error against the backends that returned a different
+// result than the quorum. Nothing is counted for the calls that didn't reach it, since there
+// is no telling which backends were right.
+func (bg *BackendGroup) recordQuorumDisagreements(ctx context.Context, rpcReqs []*RPCReq, tally *quorumTally) {
+	disagreed := make(map[*Backend]bool)
+	for i, req := range rpcReqs {
+		winner := tally.winner(i, bg.quorumThreshold)
+		if winner == nil {
+			continue
+		}
+		for _, vote := range tally.votes[i] {
+			if vote == winner {
+				continue
+			}
+			for _, be := range vote.backends {
+				log.Warn("backend disagreed with the quorum",
+					"req_id", GetReqID(ctx),
+					"backend_group", bg.Name,
+					"backend", be.Name,
+					"method", req.Method,
+				)
+				disagreed[be] = true
+			}
+		}
+	}
+	for be := range disagreed {
+		be.intermittentErrorsSlidingWindow.Incr()
+		RecordBackendNetworkErrorRateSlidingWindow(be, be.ErrorRate())
+		RecordBackendQuorumDisagreement(bg, be.Name)
+	}
+}
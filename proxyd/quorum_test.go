@@ -0,0 +1,48 @@
+package proxyd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuorumKey(t *testing.T) {
+	require.Equal(t,
+		quorumKey(&RPCRes{Result: map[string]interface{}{"from": "0xABCD", "status": "0x1"}}),
+		quorumKey(&RPCRes{Result: map[string]interface{}{"status": "0x1", "from": "0xabcd"}}),
+	)
+	require.NotEqual(t, quorumKey(&RPCRes{Result: "Value"}), quorumKey(&RPCRes{Result: "value"}))
+	require.NotEqual(t, quorumKey(&RPCRes{Result: nil}), quorumKey(&RPCRes{Error: ErrParseErr}))
+	require.Equal(t,
+		quorumKey(&RPCRes{Error: &RPCErr{Code: 3, Message: "execution reverted", Data: "0x1"}}),
+		quorumKey(&RPCRes{Error: &RPCErr{Code: 3, Message: "execution reverted", Data: "0x2"}}),
+	)
+}
+
+func TestQuorumTally(t *testing.T) {
+	a := NewBackend("a", "http://localhost", "", nil)
+	b := NewBackend("b", "http://localhost", "", nil)
+	c := NewBackend("c", "http://localhost", "", nil)
+
+	tally := newQuorumTally(2)
+	tally.add(a, []*RPCRes{{Result: "0x1"}, {Result: "0x1"}})
+	require.False(t, tally.decided(2, 2))
+	tally.add(b, []*RPCRes{{Result: "0x1"}, {Result: "0x2"}})
+	require.NotNil(t, tally.winner(0, 2))
+	require.Nil(t, tally.winner(1, 2))
+	// the second call can still reach the quorum with the last response
+	require.False(t, tally.decided(2, 1))
+	require.True(t, tally.decided(2, 0))
+
+	tally.add(c, []*RPCRes{{Result: "0x2"}, {Result: "0x2"}})
+	require.Equal(t, "a,b|c", tally.describe(0))
+	require.Equal(t, []*Backend{b, c}, tally.winner(1, 2).backends)
+
+	bg := &BackendGroup{Name: "main", quorumThreshold: 2}
+	reqs := []*RPCReq{{Method: "eth_getBalance"}, {Method: "eth_call"}}
+	bg.recordQuorumDisagreements(context.Background(), reqs, tally)
+	require.Equal(t, 1.0, a.intermittentErrorsSlidingWindow.Sum())
+	require.Equal(t, 0.0, b.intermittentErrorsSlidingWindow.Sum())
+	require.Equal(t, 1.0, c.intermittentErrorsSlidingWindow.Sum())
+}
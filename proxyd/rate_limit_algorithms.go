@@ -0,0 +1,253 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// FixedWindowRateLimitAlgorithm counts the requests of fixed intervals, and allows
+	// bursts of twice the limit around the end of an interval
+	FixedWindowRateLimitAlgorithm = "fixed_window"
+	// SlidingWindowRateLimitAlgorithm weights the count of the previous interval by how much
+	// of it overlaps with the interval ending now
+	SlidingWindowRateLimitAlgorithm = "sliding_window"
+	// TokenBucketRateLimitAlgorithm refills a bucket of limit tokens at limit tokens per interval,
+	// and each request takes a token
+	TokenBucketRateLimitAlgorithm = "token_bucket"
+)
+
+func validateRateLimitAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", FixedWindowRateLimitAlgorithm, SlidingWindowRateLimitAlgorithm, TokenBucketRateLimitAlgorithm:
+		return nil
+	}
+	return fmt.Errorf("invalid rate limit algorithm %q, valid options: %s, %s, %s", algorithm,
+		FixedWindowRateLimitAlgorithm, SlidingWindowRateLimitAlgorithm, TokenBucketRateLimitAlgorithm)
+}
+
+// NewMemoryRateLimiter creates an in-memory rate limiter using the algorithm, fixed_window by default
+func NewMemoryRateLimiter(algorithm string, dur time.Duration, max int) FrontendRateLimiter {
+	switch algorithm {
+	case SlidingWindowRateLimitAlgorithm:
+		return NewMemorySlidingWindowRateLimiter(dur, max)
+	case TokenBucketRateLimitAlgorithm:
+		return NewMemoryTokenBucketRateLimiter(dur, max)
+	default:
+		return NewMemoryFrontendRateLimit(dur, max)
+	}
+}
+
+// NewRedisRateLimiter creates a rate limiter stored in Redis using the algorithm, fixed_window by default
+func NewRedisRateLimiter(algorithm string, r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	switch algorithm {
+	case SlidingWindowRateLimitAlgorithm:
+		return NewRedisSlidingWindowRateLimiter(r, dur, max, prefix)
+	case TokenBucketRateLimitAlgorithm:
+		return NewRedisTokenBucketRateLimiter(r, dur, max, prefix)
+	default:
+		return NewRedisFrontendRateLimiter(r, dur, max, prefix)
+	}
+}
+
+// slidingWindowCount estimates the number of requests of the interval ending now, assuming
+// the requests of the previous interval were evenly spread
+func slidingWindowCount(prev int, curr int, now time.Time, dur time.Duration) float64 {
+	elapsed := float64(now.Sub(now.Truncate(dur))) / float64(dur)
+	return float64(prev)*(1-elapsed) + float64(curr)
+}
+
+// MemorySlidingWindowRateLimiter keeps the counts of the current and the previous
+// interval in memory. Unlike the fixed window limiter, rejected requests aren't counted.
+type MemorySlidingWindowRateLimiter struct {
+	dur  time.Duration
+	max  int
+	mtx  sync.Mutex
+	prev *limitedKeys
+	curr *limitedKeys
+}
+
+func NewMemorySlidingWindowRateLimiter(dur time.Duration, max int) FrontendRateLimiter {
+	return &MemorySlidingWindowRateLimiter{
+		dur: dur,
+		max: max,
+	}
+}
+
+func (m *MemorySlidingWindowRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := time.Now()
+	windowTS := now.Truncate(m.dur).UnixNano()
+	if m.curr == nil || m.curr.truncTS != windowTS {
+		if m.curr != nil && m.curr.truncTS == windowTS-int64(m.dur) {
+			m.prev = m.curr
+		} else {
+			m.prev = newLimitedKeys(windowTS - int64(m.dur))
+		}
+		m.curr = newLimitedKeys(windowTS)
+	}
+
+	if slidingWindowCount(m.prev.keys[key], m.curr.keys[key], now, m.dur) >= float64(m.max) {
+		return false, nil
+	}
+	m.curr.keys[key]++
+	return true, nil
+}
+
+// slidingWindowScript takes from the count of the current interval in KEYS[1] if the weighted
+// count of the previous interval in KEYS[2] plus the current count is under the limit
+var slidingWindowScript = redis.NewScript(`
+local curr = tonumber(redis.call("GET", KEYS[1]) or "0")
+local prev = tonumber(redis.call("GET", KEYS[2]) or "0")
+if prev * tonumber(ARGV[1]) + curr >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+
+type RedisSlidingWindowRateLimiter struct {
+	r      redis.UniversalClient
+	dur    time.Duration
+	max    int
+	prefix string
+}
+
+func NewRedisSlidingWindowRateLimiter(r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	return &RedisSlidingWindowRateLimiter{
+		r:      r,
+		dur:    dur,
+		max:    max,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisSlidingWindowRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	windowTS := now.Truncate(r.dur).UnixMilli()
+	// the hash tag keeps both windows in the same slot of a cluster
+	currKey := fmt.Sprintf("rate_limit_sw:{%s:%s}:%d", r.prefix, key, windowTS)
+	prevKey := fmt.Sprintf("rate_limit_sw:{%s:%s}:%d", r.prefix, key, windowTS-r.dur.Milliseconds())
+	weight := 1 - float64(now.Sub(now.Truncate(r.dur)))/float64(r.dur)
+	// the current window is read as the previous one during the next interval
+	ttl := 2 * r.dur.Milliseconds()
+	ok, err := slidingWindowScript.Run(ctx, r.r, []string{currKey, prevKey}, weight, r.max, ttl).Int()
+	if err != nil {
+		frontendRateLimitTakeErrors.Inc()
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued since the last request, up to max
+func (b *tokenBucket) refill(now time.Time, dur time.Duration, max int) {
+	rate := float64(max) / float64(dur)
+	b.tokens = math.Min(float64(max), b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+}
+
+// MemoryTokenBucketRateLimiter keeps a bucket per key in memory. Full buckets are
+// removed every interval, since a missing bucket is full.
+type MemoryTokenBucketRateLimiter struct {
+	dur       time.Duration
+	max       int
+	mtx       sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryTokenBucketRateLimiter(dur time.Duration, max int) FrontendRateLimiter {
+	return &MemoryTokenBucketRateLimiter{
+		dur:       dur,
+		max:       max,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryTokenBucketRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= m.dur {
+		for k, b := range m.buckets {
+			if now.Sub(b.last) >= m.dur {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(m.max), last: now}
+		m.buckets[key] = b
+	}
+	b.refill(now, m.dur, m.max)
+	if b.tokens < 1 {
+		return false, nil
+	}
+	b.tokens--
+	return true, nil
+}
+
+// tokenBucketScript refills the bucket in KEYS[1] with ARGV[2] tokens per millisecond up to ARGV[1]
+// tokens, and takes a token. The time is passed by the caller in ARGV[3], so that the script is
+// deterministic. ARGV[4] is the time it takes to fill an empty bucket, after which it expires.
+var tokenBucketScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(bucket[1]) or max
+local last = tonumber(bucket[2]) or now
+tokens = math.min(max, tokens + math.max(0, now - last) * tonumber(ARGV[2]))
+local ok = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return ok
+`)
+
+type RedisTokenBucketRateLimiter struct {
+	r      redis.UniversalClient
+	dur    time.Duration
+	max    int
+	prefix string
+}
+
+func NewRedisTokenBucketRateLimiter(r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	return &RedisTokenBucketRateLimiter{
+		r:      r,
+		dur:    dur,
+		max:    max,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisTokenBucketRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	fullKey := fmt.Sprintf("rate_limit_tb:%s:%s", r.prefix, key)
+	ratePerMs := float64(r.max) / float64(r.dur.Milliseconds())
+	ok, err := tokenBucketScript.Run(ctx, r.r, []string{fullKey}, r.max, ratePerMs, time.Now().UnixMilli(), r.dur.Milliseconds()).Int()
+	if err != nil {
+		frontendRateLimitTakeErrors.Inc()
+		return false, err
+	}
+	return ok == 1, nil
+}
@@ -0,0 +1,148 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisClient(t *testing.T) redis.UniversalClient {
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(redisServer.Close)
+	return redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("127.0.0.1:%s", redisServer.Port()),
+	})
+}
+
+// sleepUntilWindow sleeps until shortly after the start of the next window, plus offset
+func sleepUntilWindow(dur time.Duration, offset time.Duration) {
+	time.Sleep(time.Until(time.Now().Truncate(dur).Add(dur + 20*time.Millisecond + offset)))
+}
+
+func takeN(t *testing.T, lim FrontendRateLimiter, key string, n int) int {
+	var taken int
+	for i := 0; i < n; i++ {
+		ok, err := lim.Take(context.Background(), key)
+		require.NoError(t, err)
+		if ok {
+			taken++
+		}
+	}
+	return taken
+}
+
+func TestSlidingWindowRateLimiter(t *testing.T) {
+	redisClient := newTestRedisClient(t)
+	dur := 500 * time.Millisecond
+	lims := []struct {
+		name string
+		frl  FrontendRateLimiter
+	}{
+		{"memory", NewMemoryRateLimiter(SlidingWindowRateLimitAlgorithm, dur, 2)},
+		{"redis", NewRedisRateLimiter(SlidingWindowRateLimitAlgorithm, redisClient, dur, 2, "test")},
+	}
+	for _, lim := range lims {
+		t.Run(lim.name, func(t *testing.T) {
+			sleepUntilWindow(dur, 0)
+			require.Equal(t, 2, takeN(t, lim.frl, "foo", 4))
+			require.Equal(t, 2, takeN(t, lim.frl, "bar", 4))
+
+			// the previous window still counts fully right after the boundary,
+			// so there is no burst
+			sleepUntilWindow(dur, 0)
+			require.Equal(t, 1, takeN(t, lim.frl, "foo", 4))
+
+			// and for half of it in the middle of the window
+			time.Sleep(dur / 2)
+			require.Equal(t, 1, takeN(t, lim.frl, "foo", 4))
+
+			// a window without requests in between resets the count
+			sleepUntilWindow(dur, dur)
+			require.Equal(t, 2, takeN(t, lim.frl, "bar", 4))
+		})
+	}
+}
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	redisClient := newTestRedisClient(t)
+	dur := time.Second
+	lims := []struct {
+		name string
+		frl  FrontendRateLimiter
+	}{
+		{"memory", NewMemoryRateLimiter(TokenBucketRateLimitAlgorithm, dur, 2)},
+		{"redis", NewRedisRateLimiter(TokenBucketRateLimitAlgorithm, redisClient, dur, 2, "test")},
+	}
+	for _, lim := range lims {
+		t.Run(lim.name, func(t *testing.T) {
+			require.Equal(t, 2, takeN(t, lim.frl, "foo", 4))
+			require.Equal(t, 2, takeN(t, lim.frl, "bar", 4))
+
+			// a token is refilled every half interval
+			time.Sleep(dur/2 + 50*time.Millisecond)
+			require.Equal(t, 1, takeN(t, lim.frl, "foo", 4))
+
+			time.Sleep(dur + 50*time.Millisecond)
+			require.Equal(t, 2, takeN(t, lim.frl, "foo", 4))
+		})
+	}
+}
+
+func TestSenderNonceLimiter(t *testing.T) {
+	redisClient := newTestRedisClient(t)
+	window := 500 * time.Millisecond
+	lims := []struct {
+		name string
+		lim  SenderNonceLimiter
+	}{
+		{"memory", NewMemorySenderNonceLimiter(window, 2)},
+		{"redis", NewRedisSenderNonceLimiter(redisClient, window, 2, "")},
+		{"namespaced redis", NewRedisSenderNonceLimiter(redisClient, window, 2, "ns")},
+	}
+	for _, lim := range lims {
+		t.Run(lim.name, func(t *testing.T) {
+			ctx := context.Background()
+			take := func(sender string, nonce uint64) bool {
+				ok, err := lim.lim.Take(ctx, sender, nonce)
+				require.NoError(t, err)
+				return ok
+			}
+			require.True(t, take("0xa", 1))
+			require.True(t, take("0xa", 2))
+			// retries of a nonce in flight are allowed
+			require.True(t, take("0xa", 1))
+			require.False(t, take("0xa", 3))
+			require.True(t, take("0xb", 3))
+
+			time.Sleep(window + 50*time.Millisecond)
+			require.True(t, take("0xa", 3))
+		})
+	}
+
+	t.Run("redis keys are namespaced", func(t *testing.T) {
+		ctx := context.Background()
+		ok, err := NewRedisSenderNonceLimiter(redisClient, window, 2, "chain_a").Take(ctx, "0xc", 1)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, int64(1), redisClient.Exists(ctx, "chain_a:sender_nonces:0xc").Val())
+		require.Equal(t, int64(0), redisClient.Exists(ctx, "sender_nonces:0xc").Val())
+
+		// instances with different namespaces don't share nonces
+		ok, err = NewRedisSenderNonceLimiter(redisClient, window, 1, "chain_b").Take(ctx, "0xc", 2)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+}
+
+func TestValidateRateLimitAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"", FixedWindowRateLimitAlgorithm, SlidingWindowRateLimitAlgorithm, TokenBucketRateLimitAlgorithm} {
+		require.NoError(t, validateRateLimitAlgorithm(algorithm))
+	}
+	require.Error(t, validateRateLimitAlgorithm("leaky_bucket"))
+}
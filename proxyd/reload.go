@@ -0,0 +1,411 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Reload validates the given config and swaps the backends, backend groups,
+// method mappings, frontend rate limits and API keys of a running server.
+//
+// Backends and backend groups whose configuration did not change are kept as-is,
+// so in-flight requests, websocket sessions and consensus state on them are not
+// disturbed. If the new config is invalid, an error is returned and the
+// current config stays live.
+func (s *Server) Reload(config *Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	err := s.reload(config)
+	RecordConfigReload(err == nil)
+	if err != nil {
+		log.Error("rejected config reload, keeping current config", "err", err)
+		return err
+	}
+	log.Info("reloaded config")
+	return nil
+}
+
+func (s *Server) reload(config *Config) error {
+	if err := validateRoutingConfig(config); err != nil {
+		return err
+	}
+
+	s.stateMu.RLock()
+	oldConfig := s.config
+	oldGroups := s.BackendGroups
+	s.stateMu.RUnlock()
+
+	if oldConfig == nil {
+		return errors.New("server was not started from a config")
+	}
+	warnNonReloadableChanges(oldConfig, config)
+
+	oldBackends := make(map[string]*Backend)
+	for _, bg := range oldGroups {
+		for _, be := range bg.Backends {
+			oldBackends[be.Name] = be
+		}
+	}
+
+	backendsByName, err := buildBackends(config, s.rpcRequestSemaphore, func(name string) *Backend {
+		if !reflect.DeepEqual(oldConfig.BackendOptions, config.BackendOptions) ||
+			!reflect.DeepEqual(oldConfig.Backends[name], config.Backends[name]) {
+			return nil
+		}
+		return oldBackends[name]
+	})
+	if err != nil {
+		return err
+	}
+	for name, be := range backendsByName {
+		// drains and forced candidates are set by operators through the admin API,
+		// keep them when a backend is rebuilt with a new config
+		if old := oldBackends[name]; old != nil && old != be {
+			be.SetDraining(old.IsDraining())
+			// forced candidates are also configured, only an override of the old config is kept
+			if oldCfg := oldConfig.Backends[name]; oldCfg != nil && old.IsForcedCandidate() != oldCfg.ConsensusForcedCandidate {
+				be.SetForcedCandidate(old.IsForcedCandidate())
+			}
+		}
+	}
+
+	backendGroups, err := buildBackendGroups(config, backendsByName, func(name string) *BackendGroup {
+		oldCfg, newCfg := oldConfig.BackendGroups[name], config.BackendGroups[name]
+		bg := oldGroups[name]
+		if oldCfg == nil || bg == nil || !reflect.DeepEqual(normalizeRoutingStrategy(*oldCfg), normalizeRoutingStrategy(*newCfg)) {
+			return nil
+		}
+		for _, be := range bg.Backends {
+			if backendsByName[be.Name] != be {
+				return nil
+			}
+		}
+		return bg
+	})
+	if err != nil {
+		return err
+	}
+
+	wsBackendGroup, err := resolveWSBackendGroup(config, backendGroups)
+	if err != nil {
+		return err
+	}
+
+	routingRules, err := buildRoutingRules(config.RoutingRules)
+	if err != nil {
+		return err
+	}
+
+	s.stateMu.RLock()
+	lims, oldAPIKeys, jwtAuth := s.frontendLims, s.apiKeys, s.jwtAuth
+	s.stateMu.RUnlock()
+	if !reflect.DeepEqual(oldConfig.RateLimit, config.RateLimit) {
+		lims, err = buildFrontendRateLimits(config.RateLimit, s.limiterFactory)
+		if err != nil {
+			return err
+		}
+	}
+
+	apiKeys := oldAPIKeys
+	if !reflect.DeepEqual(oldConfig.APIKeys, config.APIKeys) {
+		apiKeys = nil
+		if config.APIKeys.Enabled() {
+			apiKeys, err = s.apiKeyStoreFactory(config.APIKeys)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(oldConfig.JWTAuth, config.JWTAuth) {
+		jwtAuth = nil
+		if config.JWTAuth.Enabled() {
+			jwtAuth, err = NewJWTAuthenticator(config.JWTAuth, s.limiterFactory)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// only start pollers once everything else was validated, so that a rejected
+	// config doesn't leave pollers running in the background
+	started := make([]*BackendGroup, 0)
+	for bgName, bg := range backendGroups {
+		if oldGroups[bgName] == bg {
+			continue
+		}
+		if err := configureConsensus(bg, config.BackendGroups[bgName], s.handleReorg); err != nil {
+			for _, bg := range started {
+				bg.Shutdown()
+			}
+			return err
+		}
+		started = append(started, bg)
+		if err := configureHealthChecker(bg, config.BackendGroups[bgName]); err != nil {
+			for _, bg := range started {
+				bg.Shutdown()
+			}
+			return err
+		}
+	}
+
+	if apiKeys != nil && apiKeys != oldAPIKeys {
+		apiKeys.Start()
+	}
+
+	s.stateMu.Lock()
+	s.BackendGroups = backendGroups
+	s.wsBackendGroup = wsBackendGroup
+	s.rpcMethodMappings = config.RPCMethodMappings
+	s.routingRules = routingRules
+	s.frontendLims = lims
+	s.apiKeys = apiKeys
+	s.jwtAuth = jwtAuth
+	s.config = config
+	s.stateMu.Unlock()
+
+	if oldAPIKeys != nil && oldAPIKeys != apiKeys {
+		oldAPIKeys.Stop()
+	}
+
+	// requests already holding a replaced group can still finish on it,
+	// we only stop its background polling
+	for bgName, bg := range oldGroups {
+		if backendGroups[bgName] != bg {
+			log.Info("retiring replaced backend group", "name", bgName)
+			bg.Shutdown()
+		}
+	}
+	// the health checks of a replaced backend stopped with its group, which can't be
+	// reused without it, close it to stop the rest of its background work
+	for name, be := range oldBackends {
+		if backendsByName[name] != be {
+			log.Info("retiring replaced backend", "name", name)
+			be.Close()
+		}
+		if backendsByName[name] == nil {
+			RecordBackendDraining(be, false)
+			RecordConsensusBackendForcedCandidate(be, false)
+		}
+	}
+
+	return nil
+}
+
+// validateRoutingConfig runs the static checks on the routing sections of a config
+func validateRoutingConfig(config *Config) error {
+	if errs := routingConfigErrors(config); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// routingConfigErrors returns every problem found by validateRoutingConfig
+func routingConfigErrors(config *Config) []error {
+	var errs []error
+	if len(config.Backends) == 0 {
+		errs = append(errs, errors.New("must define at least one backend"))
+	}
+	if len(config.BackendGroups) == 0 {
+		errs = append(errs, errors.New("must define at least one backend group"))
+	}
+	if len(config.RPCMethodMappings) == 0 {
+		errs = append(errs, errors.New("must define at least one RPC method mapping"))
+	}
+	for _, method := range sortedKeys(config.RPCMethodMappings) {
+		if bg := config.RPCMethodMappings[method]; config.BackendGroups[bg] == nil {
+			errs = append(errs, fmt.Errorf("undefined backend group %s for method %s", bg, method))
+		}
+	}
+	for _, name := range sortedKeys(config.PathRoutes) {
+		if route := config.PathRoutes[name]; config.BackendGroups[route.BackendGroup] == nil {
+			errs = append(errs, fmt.Errorf("undefined backend group %s for path route %s", route.BackendGroup, name))
+		}
+	}
+	for _, name := range sortedKeys(config.APIKeys.Keys) {
+		if key := config.APIKeys.Keys[name]; key.BackendGroup != "" && config.BackendGroups[key.BackendGroup] == nil {
+			errs = append(errs, fmt.Errorf("undefined backend group %s for api key %s", key.BackendGroup, name))
+		}
+	}
+	for _, name := range sortedKeys(config.JWTAuth.Policies) {
+		if policy := config.JWTAuth.Policies[name]; policy.BackendGroup != "" && config.BackendGroups[policy.BackendGroup] == nil {
+			errs = append(errs, fmt.Errorf("undefined backend group %s for jwt policy %s", policy.BackendGroup, name))
+		}
+	}
+	// resolves the deprecated consensus_aware flag and the default strategy in place,
+	// so it must run exactly once per config
+	for _, bgName := range sortedKeys(config.BackendGroups) {
+		if err := config.BackendGroups[bgName].resolveRoutingStrategy(bgName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateRoutingRules(config); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func resolveWSBackendGroup(config *Config, backendGroups map[string]*BackendGroup) (*BackendGroup, error) {
+	var wsBackendGroup *BackendGroup
+	if config.WSBackendGroup != "" {
+		wsBackendGroup = backendGroups[config.WSBackendGroup]
+		if wsBackendGroup == nil {
+			return nil, fmt.Errorf("ws backend group %s does not exist", config.WSBackendGroup)
+		}
+	}
+
+	if wsBackendGroup == nil && config.Server.WSPort != 0 {
+		return nil, fmt.Errorf("a ws port was defined, but no ws group was defined")
+	}
+	return wsBackendGroup, nil
+}
+
+// normalizeRoutingStrategy drops the deprecated consensus_aware flag, which
+// validateRoutingConfig already resolved into the routing strategy
+func normalizeRoutingStrategy(bg BackendGroupConfig) BackendGroupConfig {
+	bg.ConsensusAware = false
+	return bg
+}
+
+func warnNonReloadableChanges(oldCfg, newCfg *Config) {
+	sections := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"server", oldCfg.Server, newCfg.Server},
+		{"cache", oldCfg.Cache, newCfg.Cache},
+		{"redis", oldCfg.Redis, newCfg.Redis},
+		{"metrics", oldCfg.Metrics, newCfg.Metrics},
+		{"tracing", oldCfg.Tracing, newCfg.Tracing},
+		{"capture", oldCfg.Capture, newCfg.Capture},
+		{"path_routes", oldCfg.PathRoutes, newCfg.PathRoutes},
+		{"admin", oldCfg.Admin, newCfg.Admin},
+		{"batch", oldCfg.BatchConfig, newCfg.BatchConfig},
+		{"authentication", oldCfg.Authentication, newCfg.Authentication},
+		{"sender_rate_limit", oldCfg.SenderRateLimit, newCfg.SenderRateLimit},
+		{"tx_policy", oldCfg.TxPolicy, newCfg.TxPolicy},
+		{"ws_method_whitelist", oldCfg.WSMethodWhitelist, newCfg.WSMethodWhitelist},
+		{"rate_limit.use_redis", oldCfg.RateLimit.UseRedis, newCfg.RateLimit.UseRedis},
+		{"rate_limit.ip_header_override", oldCfg.RateLimit.IPHeaderOverride, newCfg.RateLimit.IPHeaderOverride},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.old, section.new) {
+			log.Warn("config section changed but requires a restart to take effect", "section", section.name)
+		}
+	}
+}
+
+// ConfigReloader reloads a running server whenever its config file changes,
+// or when Reload is called explicitly (e.g. on SIGHUP)
+type ConfigReloader struct {
+	path     string
+	srv      *Server
+	interval time.Duration
+
+	mtx      sync.Mutex
+	lastHash [sha256.Size]byte
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+func NewConfigReloader(path string, srv *Server, interval time.Duration) *ConfigReloader {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	r := &ConfigReloader{
+		path:       path,
+		srv:        srv,
+		interval:   interval,
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		r.lastHash = sha256.Sum256(data)
+	}
+	return r
+}
+
+// Start polls the config file for changes, it is a no-op if the interval is zero
+func (r *ConfigReloader) Start() {
+	if r.interval == 0 {
+		return
+	}
+	log.Info("watching config file for changes", "path", r.path, "interval", r.interval)
+	go func() {
+		for {
+			timer := time.NewTimer(r.interval)
+			select {
+			case <-timer.C:
+				if _, err := r.reloadIfChanged(false); err != nil {
+					log.Warn("error checking config file for changes", "path", r.path, "err", err)
+				}
+			case <-r.ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (r *ConfigReloader) Stop() {
+	r.cancelFunc()
+}
+
+// Reload reads the config file and applies it, even if its content didn't change
+func (r *ConfigReloader) Reload() error {
+	_, err := r.reloadIfChanged(true)
+	return err
+}
+
+// WaitForSignals reloads the config whenever SIGHUP is received on sig,
+// and returns the first other signal, e.g. to shut down on SIGINT or SIGTERM
+func (r *ConfigReloader) WaitForSignals(sig <-chan os.Signal) os.Signal {
+	for recvSig := range sig {
+		if recvSig != syscall.SIGHUP {
+			return recvSig
+		}
+		log.Info("caught signal, reloading config", "signal", recvSig)
+		// errors are logged by the reloader, the current config stays live
+		_ = r.Reload()
+	}
+	return nil
+}
+
+func (r *ConfigReloader) reloadIfChanged(force bool) (bool, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(data)
+	if !force && hash == r.lastHash {
+		return false, nil
+	}
+	// remember the hash even if the config is rejected, so that
+	// a broken file is only reported once until it changes again
+	r.lastHash = hash
+
+	log.Info("reloading config", "path", r.path)
+	config := new(Config)
+	if _, err := toml.Decode(string(data), config); err != nil {
+		RecordConfigReload(false)
+		log.Error("rejected config reload, keeping current config", "err", err)
+		return false, wrapErr(err, "error reading config file")
+	}
+	if err := r.srv.Reload(config); err != nil {
+		return false, err
+	}
+	return true, nil
+}
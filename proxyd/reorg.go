@@ -0,0 +1,232 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// DefaultReorgTrackingDepth is the number of blocks behind the consensus head whose hashes are tracked
+	DefaultReorgTrackingDepth = 64
+	reorgWebhookTimeout       = 5 * time.Second
+	reorgInvalidationTimeout  = 5 * time.Second
+)
+
+// ReorgEvent describes a reorg of the consensus head of a backend group. Only the blocks the poller
+// saw as the consensus head are known, so OrphanedHashes may not contain every orphaned block.
+type ReorgEvent struct {
+	BackendGroup string `json:"backend_group"`
+	// Depth is the number of blocks replaced, a lower bound if the fork is older than the tracked blocks
+	Depth uint64 `json:"depth"`
+	// ForkBlockNumber is the last block both chains have in common
+	ForkBlockNumber hexutil.Uint64 `json:"fork_block_number"`
+	OldHeadNumber   hexutil.Uint64 `json:"old_head_number"`
+	OldHeadHash     string         `json:"old_head_hash"`
+	NewHeadNumber   hexutil.Uint64 `json:"new_head_number"`
+	NewHeadHash     string         `json:"new_head_hash"`
+	OrphanedHashes  []string       `json:"orphaned_hashes"`
+	Time            time.Time      `json:"time"`
+}
+
+type OnReorg func(event *ReorgEvent)
+
+type chainBlock struct {
+	number hexutil.Uint64
+	hash   string
+}
+
+// canonicalChain keeps the hashes of the consensus heads seen in the last blocks, oldest first
+type canonicalChain struct {
+	mtx    sync.Mutex
+	depth  uint64
+	blocks []chainBlock
+}
+
+func newCanonicalChain(depth uint64) *canonicalChain {
+	return &canonicalChain{depth: depth}
+}
+
+func (c *canonicalChain) snapshot() []chainBlock {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]chainBlock(nil), c.blocks...)
+}
+
+// update removes the orphaned blocks, records the new head and drops the blocks that are
+// too far behind it
+func (c *canonicalChain) update(head chainBlock, orphaned []chainBlock) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	isOrphaned := make(map[hexutil.Uint64]bool, len(orphaned))
+	for _, b := range orphaned {
+		isOrphaned[b.number] = true
+	}
+	blocks := make([]chainBlock, 0, len(c.blocks)+1)
+	for _, b := range c.blocks {
+		if isOrphaned[b.number] || b.number == head.number {
+			continue
+		}
+		if uint64(b.number)+c.depth < uint64(head.number) {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	blocks = append(blocks, head)
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].number < blocks[j].number
+	})
+	c.blocks = blocks
+}
+
+func (c *canonicalChain) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.blocks = nil
+}
+
+// detectReorg compares the tracked blocks up to the new head with the canonical chain, newest
+// first, until one of them is still canonical. hashAt returns the canonical hash of a block.
+// Blocks above the new head can't be checked yet, they are checked once the head passes them.
+// It returns the orphaned blocks, newest first.
+func detectReorg(tracked []chainBlock, head chainBlock, hashAt func(hexutil.Uint64) (string, error)) (*ReorgEvent, []chainBlock, error) {
+	var orphaned []chainBlock
+	var fork hexutil.Uint64
+	forkFound := false
+	for i := len(tracked) - 1; i >= 0; i-- {
+		b := tracked[i]
+		if b.number > head.number {
+			continue
+		}
+		canonical := head.hash
+		if b.number != head.number {
+			var err error
+			if canonical, err = hashAt(b.number); err != nil {
+				return nil, nil, err
+			}
+		}
+		if canonical == b.hash {
+			fork = b.number
+			forkFound = true
+			break
+		}
+		orphaned = append(orphaned, b)
+	}
+	if len(orphaned) == 0 {
+		return nil, nil, nil
+	}
+
+	oldHead := orphaned[0]
+	if !forkFound {
+		// the fork is older than the tracked blocks
+		fork = orphaned[len(orphaned)-1].number - 1
+	}
+	hashes := make([]string, 0, len(orphaned))
+	for _, b := range orphaned {
+		hashes = append(hashes, b.hash)
+	}
+	return &ReorgEvent{
+		Depth:           uint64(oldHead.number - fork),
+		ForkBlockNumber: fork,
+		OldHeadNumber:   oldHead.number,
+		OldHeadHash:     oldHead.hash,
+		NewHeadNumber:   head.number,
+		NewHeadHash:     head.hash,
+		OrphanedHashes:  hashes,
+		Time:            time.Now(),
+	}, orphaned, nil
+}
+
+// checkReorg records the new consensus head, and notifies the reorg listeners if blocks
+// seen before were replaced. The canonical hashes are read from a member of the consensus.
+func (cp *ConsensusPoller) checkReorg(ctx context.Context, candidates map[*Backend]*backendState, number hexutil.Uint64, hash string) {
+	head := chainBlock{number: number, hash: hash}
+	tracked := cp.chain.snapshot()
+	if len(tracked) > 0 && tracked[len(tracked)-1] == head {
+		return
+	}
+
+	var be *Backend
+	for _, candidate := range cp.backendGroup.Backends {
+		if _, ok := candidates[candidate]; ok {
+			be = candidate
+			break
+		}
+	}
+	if be == nil {
+		return
+	}
+	event, orphaned, err := detectReorg(tracked, head, func(n hexutil.Uint64) (string, error) {
+		actualNumber, actualHash, err := cp.fetchBlock(ctx, be, n.String())
+		if err != nil {
+			return "", err
+		}
+		if actualNumber != n {
+			return "", fmt.Errorf("backend %s returned block %d instead of %d", be.Name, actualNumber, n)
+		}
+		return actualHash, nil
+	})
+	if err != nil {
+		log.Debug("error checking for reorg", "backend_group", cp.backendGroup.Name, "name", be.Name, "err", err)
+		return
+	}
+
+	cp.chain.update(head, orphaned)
+	if event == nil {
+		return
+	}
+	event.BackendGroup = cp.backendGroup.Name
+
+	log.Warn("chain reorg detected",
+		"backend_group", event.BackendGroup,
+		"depth", event.Depth,
+		"fork_block_number", uint64(event.ForkBlockNumber),
+		"old_head_number", uint64(event.OldHeadNumber),
+		"old_head_hash", event.OldHeadHash,
+		"new_head_number", uint64(event.NewHeadNumber),
+		"new_head_hash", event.NewHeadHash,
+		"orphaned_hashes", strings.Join(event.OrphanedHashes, ","),
+	)
+	RecordReorg(cp.backendGroup, event.Depth)
+	for _, l := range cp.reorgListeners {
+		l(event)
+	}
+}
+
+// newReorgWebhook posts the reorg events as JSON to a URL, without blocking the poller
+func newReorgWebhook(url string) OnReorg {
+	client := &http.Client{Timeout: reorgWebhookTimeout}
+	return func(event *ReorgEvent) {
+		body := mustMarshalJSON(event)
+		go func() {
+			res, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Warn("error posting reorg event", "backend_group", event.BackendGroup, "err", err)
+				RecordReorgWebhookError(event.BackendGroup)
+				return
+			}
+			_ = res.Body.Close()
+			if res.StatusCode >= 300 {
+				log.Warn("reorg webhook returned an error", "backend_group", event.BackendGroup, "status_code", res.StatusCode)
+				RecordReorgWebhookError(event.BackendGroup)
+			}
+		}()
+	}
+}
+
+// handleReorg invalidates the cached responses of the orphaned blocks
+func (s *Server) handleReorg(event *ReorgEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), reorgInvalidationTimeout)
+	defer cancel()
+	if err := s.cache.InvalidateBlocks(ctx, event.OrphanedHashes, uint64(event.ForkBlockNumber)+1); err != nil {
+		log.Warn("error invalidating cache after reorg", "backend_group", event.BackendGroup, "err", err)
+	}
+}
@@ -0,0 +1,113 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectReorg(t *testing.T) {
+	tracked := []chainBlock{
+		{number: 10, hash: "0x10"},
+		{number: 11, hash: "0x11"},
+		{number: 12, hash: "0x12"},
+	}
+	canonical := func(hashes map[hexutil.Uint64]string) func(hexutil.Uint64) (string, error) {
+		return func(n hexutil.Uint64) (string, error) {
+			hash, ok := hashes[n]
+			if !ok {
+				return "", fmt.Errorf("unknown block %d", n)
+			}
+			return hash, nil
+		}
+	}
+
+	t.Run("new block", func(t *testing.T) {
+		event, orphaned, err := detectReorg(tracked, chainBlock{number: 13, hash: "0x13"},
+			canonical(map[hexutil.Uint64]string{12: "0x12"}))
+		require.NoError(t, err)
+		require.Nil(t, event)
+		require.Empty(t, orphaned)
+	})
+
+	t.Run("head went back", func(t *testing.T) {
+		event, _, err := detectReorg(tracked, chainBlock{number: 11, hash: "0x11"}, nil)
+		require.NoError(t, err)
+		require.Nil(t, event)
+	})
+
+	t.Run("reorg", func(t *testing.T) {
+		event, orphaned, err := detectReorg(tracked, chainBlock{number: 13, hash: "0x13b"},
+			canonical(map[hexutil.Uint64]string{10: "0x10", 11: "0x11b", 12: "0x12b"}))
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), event.Depth)
+		require.Equal(t, hexutil.Uint64(10), event.ForkBlockNumber)
+		require.Equal(t, hexutil.Uint64(12), event.OldHeadNumber)
+		require.Equal(t, "0x12", event.OldHeadHash)
+		require.Equal(t, hexutil.Uint64(13), event.NewHeadNumber)
+		require.Equal(t, "0x13b", event.NewHeadHash)
+		require.Equal(t, []string{"0x12", "0x11"}, event.OrphanedHashes)
+		require.Equal(t, []chainBlock{tracked[2], tracked[1]}, orphaned)
+	})
+
+	t.Run("head replaced", func(t *testing.T) {
+		event, _, err := detectReorg(tracked, chainBlock{number: 12, hash: "0x12b"},
+			canonical(map[hexutil.Uint64]string{11: "0x11"}))
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), event.Depth)
+		require.Equal(t, hexutil.Uint64(11), event.ForkBlockNumber)
+	})
+
+	t.Run("fork older than the tracked blocks", func(t *testing.T) {
+		event, _, err := detectReorg(tracked, chainBlock{number: 12, hash: "0x12b"},
+			canonical(map[hexutil.Uint64]string{10: "0x10b", 11: "0x11b"}))
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), event.Depth)
+		require.Equal(t, hexutil.Uint64(9), event.ForkBlockNumber)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, _, err := detectReorg(tracked, chainBlock{number: 13, hash: "0x13"}, canonical(nil))
+		require.Error(t, err)
+	})
+}
+
+func TestCanonicalChainUpdate(t *testing.T) {
+	c := newCanonicalChain(2)
+	for i := 10; i <= 13; i++ {
+		c.update(chainBlock{number: hexutil.Uint64(i), hash: fmt.Sprintf("0x%d", i)}, nil)
+	}
+	require.Equal(t, []chainBlock{{11, "0x11"}, {12, "0x12"}, {13, "0x13"}}, c.snapshot())
+
+	c.update(chainBlock{number: 12, hash: "0x12b"}, []chainBlock{{13, "0x13"}, {12, "0x12"}})
+	require.Equal(t, []chainBlock{{11, "0x11"}, {12, "0x12b"}}, c.snapshot())
+
+	c.reset()
+	require.Empty(t, c.snapshot())
+}
+
+func TestReorgWebhook(t *testing.T) {
+	received := make(chan *ReorgEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := new(ReorgEvent)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(event))
+		received <- event
+	}))
+	defer srv.Close()
+
+	newReorgWebhook(srv.URL)(&ReorgEvent{BackendGroup: "main", Depth: 2, OrphanedHashes: []string{"0x12", "0x11"}})
+	select {
+	case event := <-received:
+		require.Equal(t, "main", event.BackendGroup)
+		require.Equal(t, uint64(2), event.Depth)
+		require.Equal(t, []string{"0x12", "0x11"}, event.OrphanedHashes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reorg event not posted")
+	}
+}
@@ -0,0 +1,147 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const maxReplayDiffLen = 512
+
+type ReplayConfig struct {
+	// Target is the URL of the proxyd or backend the requests are replayed against
+	Target string
+	// Speed scales the pace of the capture, 2 replays twice as fast, 0 sends the
+	// requests one after the other as fast as possible
+	Speed   float64
+	Headers map[string]string
+	Client  *http.Client
+	// Diffs receives a line for every response that differs from the captured one
+	Diffs io.Writer
+}
+
+type ReplayReport struct {
+	Total      int
+	Matched    int
+	Mismatched int
+	Failed     int
+}
+
+func (r *ReplayReport) String() string {
+	return fmt.Sprintf("replayed %d requests: %d matched, %d mismatched, %d failed", r.Total, r.Matched, r.Mismatched, r.Failed)
+}
+
+// Replay sends the captured requests to the target in the order and at the pace they were
+// captured, and compares the responses with the captured ones, ignoring key order and whitespace
+func Replay(ctx context.Context, cfg ReplayConfig, entries []*CaptureEntry) (*ReplayReport, error) {
+	if cfg.Speed < 0 {
+		return nil, fmt.Errorf("replay speed must not be negative")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Diffs == nil {
+		cfg.Diffs = io.Discard
+	}
+
+	entries = append([]*CaptureEntry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	report := &ReplayReport{Total: len(entries)}
+	var mtx sync.Mutex
+	record := func(entry *CaptureEntry, res []byte, err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if err != nil {
+			report.Failed++
+			fmt.Fprintf(cfg.Diffs, "%s %s: %s\n", entry.ReqID, captureMethod(entry.Request), err)
+			return
+		}
+		expected, got := canonicalJSON(entry.Response), canonicalJSON(res)
+		if expected == got {
+			report.Matched++
+			return
+		}
+		report.Mismatched++
+		fmt.Fprintf(cfg.Diffs, "%s %s: expected %s, got %s\n",
+			entry.ReqID, captureMethod(entry.Request), truncate(expected, maxReplayDiffLen), truncate(got, maxReplayDiffLen))
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, entry := range entries {
+		if cfg.Speed > 0 {
+			offset := time.Duration(float64(entry.Time.Sub(entries[0].Time)) / cfg.Speed)
+			sleepContext(ctx, time.Until(start.Add(offset)))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if cfg.Speed == 0 {
+			res, err := replayRequest(ctx, cfg, entry)
+			record(entry, res, err)
+			continue
+		}
+		wg.Add(1)
+		go func(entry *CaptureEntry) {
+			defer wg.Done()
+			res, err := replayRequest(ctx, cfg, entry)
+			record(entry, res, err)
+		}(entry)
+	}
+	wg.Wait()
+	return report, ctx.Err()
+}
+
+func replayRequest(ctx context.Context, cfg ReplayConfig, entry *CaptureEntry) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Target, bytes.NewReader(entry.Request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	res, err := cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != entry.StatusCode {
+		return nil, fmt.Errorf("expected status code %d, got %d", entry.StatusCode, res.StatusCode)
+	}
+	return body, nil
+}
+
+// canonicalJSON re-encodes JSON with sorted keys and no whitespace
+func canonicalJSON(b []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(bytes.TrimSpace(b))
+	}
+	return string(mustMarshalJSON(v))
+}
+
+// captureMethod returns the method of a captured request, or <batch>
+func captureMethod(req json.RawMessage) string {
+	if IsBatch(req) {
+		return "<batch>"
+	}
+	var r RPCReq
+	if err := json.Unmarshal(req, &r); err != nil || r.Method == "" {
+		return MethodUnknown
+	}
+	return r.Method
+}
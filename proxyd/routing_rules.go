@@ -0,0 +1,183 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// routingRule routes the calls matching all of its conditions to a backend group
+type routingRule struct {
+	name             string
+	methods          []string
+	blockTags        *StringSet
+	minBlockAge      uint64
+	headBackendGroup string
+	backendGroup     string
+}
+
+func buildRoutingRules(cfgs []*RoutingRuleConfig) ([]*routingRule, error) {
+	rules := make([]*routingRule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("rule_%d", i)
+		}
+		if len(cfg.Methods) == 0 {
+			return nil, fmt.Errorf("routing rule %s must match at least one method", name)
+		}
+		if cfg.BackendGroup == "" {
+			return nil, fmt.Errorf("routing rule %s must set a backend group", name)
+		}
+		if cfg.MinBlockAge > 0 && cfg.HeadBackendGroup == "" {
+			return nil, fmt.Errorf("routing rule %s must set head_backend_group to use min_block_age", name)
+		}
+		rule := &routingRule{
+			name:             name,
+			methods:          cfg.Methods,
+			minBlockAge:      cfg.MinBlockAge,
+			headBackendGroup: cfg.HeadBackendGroup,
+			backendGroup:     cfg.BackendGroup,
+		}
+		if len(cfg.BlockTags) > 0 {
+			rule.blockTags = NewStringSetFromStrings(cfg.BlockTags)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// validateRoutingRules checks the groups the rules refer to, once the routing strategies are resolved
+func validateRoutingRules(config *Config) error {
+	rules, err := buildRoutingRules(config.RoutingRules)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if config.BackendGroups[rule.backendGroup] == nil {
+			return fmt.Errorf("undefined backend group %s for routing rule %s", rule.backendGroup, rule.name)
+		}
+		if rule.headBackendGroup == "" {
+			continue
+		}
+		head := config.BackendGroups[rule.headBackendGroup]
+		if head == nil {
+			return fmt.Errorf("undefined head backend group %s for routing rule %s", rule.headBackendGroup, rule.name)
+		}
+		if head.RoutingStrategy != ConsensusAwareRoutingStrategy {
+			return fmt.Errorf("head backend group %s for routing rule %s must be consensus aware", rule.headBackendGroup, rule.name)
+		}
+	}
+	return nil
+}
+
+// routeRPCReq returns the backend group of a call and the rule that matched it, if any. Calls
+// no rule matches use rpc_method_mappings, an empty group means the method isn't whitelisted.
+func routeRPCReq(req *RPCReq, rules []*routingRule, rpcMethodMappings map[string]string, backendGroups map[string]*BackendGroup) (string, *routingRule) {
+	for _, rule := range rules {
+		if rule.matches(req, backendGroups) {
+			return rule.backendGroup, rule
+		}
+	}
+	return rpcMethodMappings[req.Method], nil
+}
+
+func (r *routingRule) matches(req *RPCReq, backendGroups map[string]*BackendGroup) bool {
+	if !r.matchesMethod(req.Method) {
+		return false
+	}
+	if r.blockTags == nil && r.minBlockAge == 0 {
+		return true
+	}
+	block, ok := blockParam(req)
+	if !ok {
+		return false
+	}
+	if r.blockTags != nil && !r.blockTags.Has(block) {
+		return false
+	}
+	if r.minBlockAge > 0 {
+		head := backendGroups[r.headBackendGroup]
+		if head == nil || head.Consensus == nil {
+			return false
+		}
+		latest := uint64(head.Consensus.GetLatestBlockNumber())
+		bn, ok := resolveBlockTag(block, head.Consensus)
+		if !ok || latest == 0 || bn > latest || latest-bn < r.minBlockAge {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *routingRule) matchesMethod(method string) bool {
+	for _, m := range r.methods {
+		if prefix, ok := strings.CutSuffix(m, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == m {
+			return true
+		}
+	}
+	return false
+}
+
+// blockParamPositions are the positions of the block params, as rewritten by RewriteRequest
+var blockParamPositions = map[string]int{
+	"debug_getRawReceipts":                    0,
+	"consensus_getReceipts":                   0,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getUncleCountByBlockNumber":          0,
+	"eth_getBlockByNumber":                    0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+	"eth_getUncleByBlockNumberAndIndex":       0,
+	"eth_getBalance":                          1,
+	"eth_getCode":                             1,
+	"eth_getTransactionCount":                 1,
+	"eth_call":                                1,
+	"eth_getStorageAt":                        2,
+	"eth_getProof":                            2,
+}
+
+// blockParam returns the block a call reads as a tag or a hex number, latest when the param
+// is omitted. eth_getLogs reads from its fromBlock. Calls by block hash have no block param.
+func blockParam(req *RPCReq) (string, bool) {
+	if req.Method == "eth_getLogs" {
+		var p []map[string]interface{}
+		if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+			return "", false
+		}
+		if _, ok := p[0]["blockHash"]; ok {
+			return "", false
+		}
+		from, ok := p[0]["fromBlock"]
+		if !ok {
+			return "latest", true
+		}
+		s, ok := from.(string)
+		return s, ok
+	}
+
+	pos, ok := blockParamPositions[req.Method]
+	if !ok {
+		return "", false
+	}
+	var p []interface{}
+	if err := json.Unmarshal(req.Params, &p); err != nil {
+		return "", false
+	}
+	if len(p) <= pos {
+		return "latest", true
+	}
+	switch v := p[pos].(type) {
+	case string:
+		return v, true
+	case map[string]interface{}:
+		// EIP-1898 block number or hash
+		s, ok := v["blockNumber"].(string)
+		return s, ok
+	default:
+		return "", false
+	}
+}
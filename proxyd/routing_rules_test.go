@@ -0,0 +1,79 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteRPCReq(t *testing.T) {
+	cp := &ConsensusPoller{tracker: NewInMemoryConsensusTracker()}
+	cp.tracker.SetLatestBlockNumber(1000)
+	backendGroups := map[string]*BackendGroup{
+		"main":    {Name: "main", Consensus: cp},
+		"archive": {Name: "archive"},
+		"tracing": {Name: "tracing"},
+	}
+	rules, err := buildRoutingRules([]*RoutingRuleConfig{
+		{Name: "archive", Methods: []string{"eth_getBlockByNumber", "eth_getBalance", "eth_getLogs"}, MinBlockAge: 100, HeadBackendGroup: "main", BackendGroup: "archive"},
+		{Name: "tracing", Methods: []string{"debug_trace*"}, BackendGroup: "tracing"},
+		{Methods: []string{"eth_getBalance"}, BlockTags: []string{"latest", "pending"}, BackendGroup: "main"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "rule_2", rules[2].name)
+	mappings := map[string]string{
+		"eth_getBlockByNumber": "archive",
+		"eth_getBalance":       "archive",
+		"eth_getLogs":          "main",
+		"eth_chainId":          "main",
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		params string
+		group  string
+		rule   string
+	}{
+		{"old block", "eth_getBlockByNumber", `["0x64", false]`, "archive", "archive"},
+		{"recent block", "eth_getBlockByNumber", `["0x3e7", false]`, "archive", ""},
+		{"block by number object", "eth_getBalance", `["0x1", {"blockNumber": "0x1"}]`, "archive", "archive"},
+		{"block by hash", "eth_getBalance", `["0x1", {"blockHash": "0x00"}]`, "archive", ""},
+		{"earliest", "eth_getBlockByNumber", `["earliest", false]`, "archive", "archive"},
+		{"old logs", "eth_getLogs", `[{"fromBlock": "0x1", "toBlock": "latest"}]`, "archive", "archive"},
+		{"recent logs", "eth_getLogs", `[{"fromBlock": "latest"}]`, "main", ""},
+		{"tracing wildcard", "debug_traceTransaction", `["0x00"]`, "tracing", "tracing"},
+		{"latest tag", "eth_getBalance", `["0x1", "latest"]`, "main", "rule_2"},
+		{"omitted block is latest", "eth_getBalance", `["0x1"]`, "main", "rule_2"},
+		{"no rule", "eth_chainId", `[]`, "main", ""},
+		{"not whitelisted", "eth_sign", `[]`, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &RPCReq{Method: tt.method, Params: json.RawMessage(tt.params)}
+			group, rule := routeRPCReq(req, rules, mappings, backendGroups)
+			require.Equal(t, tt.group, group)
+			if tt.rule == "" {
+				require.Nil(t, rule)
+			} else {
+				require.Equal(t, tt.rule, rule.name)
+			}
+		})
+	}
+
+	// block age rules don't match until the head is known
+	cp.tracker.SetLatestBlockNumber(0)
+	group, rule := routeRPCReq(&RPCReq{Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x1", false]`)}, rules, mappings, backendGroups)
+	require.Equal(t, "archive", group)
+	require.Nil(t, rule)
+}
+
+func TestBuildRoutingRules(t *testing.T) {
+	_, err := buildRoutingRules([]*RoutingRuleConfig{{BackendGroup: "main"}})
+	require.Error(t, err)
+	_, err = buildRoutingRules([]*RoutingRuleConfig{{Methods: []string{"eth_call"}}})
+	require.Error(t, err)
+	_, err = buildRoutingRules([]*RoutingRuleConfig{{Methods: []string{"eth_call"}, MinBlockAge: 10, BackendGroup: "main"}})
+	require.Error(t, err)
+}
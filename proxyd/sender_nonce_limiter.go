@@ -0,0 +1,115 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SenderNonceLimiter caps the distinct nonces a sender can have in flight. A nonce is in
+// flight for a window after the last transaction that used it.
+type SenderNonceLimiter interface {
+	// Take records the nonce for the sender. It returns false if the nonce is new and
+	// the sender already has the maximum number of nonces in flight.
+	Take(ctx context.Context, sender string, nonce uint64) (bool, error)
+}
+
+type MemorySenderNonceLimiter struct {
+	window    time.Duration
+	max       int
+	mtx       sync.Mutex
+	senders   map[string]map[uint64]time.Time
+	lastSweep time.Time
+}
+
+func NewMemorySenderNonceLimiter(window time.Duration, max int) SenderNonceLimiter {
+	return &MemorySenderNonceLimiter{
+		window:    window,
+		max:       max,
+		senders:   make(map[string]map[uint64]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemorySenderNonceLimiter) Take(ctx context.Context, sender string, nonce uint64) (bool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= m.window {
+		for s, nonces := range m.senders {
+			removeExpiredNonces(nonces, now)
+			if len(nonces) == 0 {
+				delete(m.senders, s)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	nonces, ok := m.senders[sender]
+	if !ok {
+		nonces = make(map[uint64]time.Time)
+		m.senders[sender] = nonces
+	}
+	removeExpiredNonces(nonces, now)
+	if _, ok := nonces[nonce]; !ok && len(nonces) >= m.max {
+		return false, nil
+	}
+	nonces[nonce] = now.Add(m.window)
+	return true, nil
+}
+
+func removeExpiredNonces(nonces map[uint64]time.Time, now time.Time) {
+	for n, expiresAt := range nonces {
+		if now.After(expiresAt) {
+			delete(nonces, n)
+		}
+	}
+}
+
+// senderNonceScript keeps the nonces of a sender in a sorted set scored by their expiry. It removes
+// the expired nonces, and adds the nonce ARGV[1] unless it is new and there are already ARGV[4] nonces.
+var senderNonceScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[2])
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) and redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[4]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[5])
+return 1
+`)
+
+type RedisSenderNonceLimiter struct {
+	r      redis.UniversalClient
+	window time.Duration
+	max    int
+	prefix string
+}
+
+func NewRedisSenderNonceLimiter(r redis.UniversalClient, window time.Duration, max int, prefix string) SenderNonceLimiter {
+	return &RedisSenderNonceLimiter{
+		r:      r,
+		window: window,
+		max:    max,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisSenderNonceLimiter) Take(ctx context.Context, sender string, nonce uint64) (bool, error) {
+	now := time.Now().UnixMilli()
+	key := fmt.Sprintf("sender_nonces:%s", sender)
+	if r.prefix != "" {
+		key = r.prefix + ":" + key
+	}
+	ok, err := senderNonceScript.Run(ctx, r.r, []string{key},
+		strconv.FormatUint(nonce, 10), now, now+r.window.Milliseconds(), r.max, r.window.Milliseconds()).Int()
+	if err != nil {
+		frontendRateLimitTakeErrors.Inc()
+		return false, err
+	}
+	return ok == 1, nil
+}
@@ -17,7 +17,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
@@ -26,6 +26,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/cors"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -33,6 +34,9 @@ const (
 	ContextKeyReqID              = "req_id"
 	ContextKeyXForwardedFor      = "x_forwarded_for"
 	ContextKeyOpTxProxyAuth      = "op_txproxy_auth"
+	ContextKeyConsensusPoller    = "consensus_poller"
+	ContextKeyAPIKey             = "api_key"
+	ContextKeyReqHeaders         = "req_headers"
 	DefaultOpTxProxyAuthHeader   = "X-Optimism-Signature"
 	DefaultMaxBatchRPCCallsLimit = 100
 	MaxBatchRPCCallsHardLimit    = 1000
@@ -51,36 +55,57 @@ const (
 var emptyArrayResponse = json.RawMessage("[]")
 
 type Server struct {
-	BackendGroups          map[string]*BackendGroup
-	wsBackendGroup         *BackendGroup
-	wsMethodWhitelist      *StringSet
-	rpcMethodMappings      map[string]string
-	maxBodySize            int64
-	enableRequestLog       bool
-	maxRequestBodyLogLen   int
-	authenticatedPaths     map[string]string
-	timeout                time.Duration
-	maxUpstreamBatchSize   int
-	maxBatchSize           int
-	enableServedByHeader   bool
-	upgrader               *websocket.Upgrader
-	mainLim                FrontendRateLimiter
-	overrideLims           map[string]FrontendRateLimiter
-	senderLim              FrontendRateLimiter
-	allowedChainIds        []*big.Int
-	limExemptOrigins       []*regexp.Regexp
-	limExemptUserAgents    []*regexp.Regexp
-	globallyLimitedMethods map[string]bool
-	rpcServer              *http.Server
-	wsServer               *http.Server
-	cache                  RPCCache
-	srvMu                  sync.Mutex
-	rateLimitHeader        string
+	BackendGroups        map[string]*BackendGroup
+	wsBackendGroup       *BackendGroup
+	wsMethodWhitelist    *StringSet
+	rpcMethodMappings    map[string]string
+	routingRules         []*routingRule
+	maxBodySize          int64
+	enableRequestLog     bool
+	maxRequestBodyLogLen int
+	authenticatedPaths   map[string]string
+	timeout              time.Duration
+	maxUpstreamBatchSize int
+	maxBatchSize         int
+	enableServedByHeader bool
+	upgrader             *websocket.Upgrader
+	frontendLims         *frontendRateLimits
+	senderLim            FrontendRateLimiter
+	senderNonceLim       SenderNonceLimiter
+	txPolicy             *txPolicy
+	allowedChainIds      []*big.Int
+	rpcServer            *http.Server
+	wsServer             *http.Server
+	cache                RPCCache
+	srvMu                sync.Mutex
+	rateLimitHeader      string
+	limiterFactory       limiterFactoryFunc
+	apiKeyStoreFactory   apiKeyStoreFactoryFunc
+
+	wsMultiplexSubscriptions bool
+
+	// capturer is nil unless request capture is enabled
+	capturer *Capturer
+
+	pathRoutes []*pathRoute
+
+	// stateMu guards the fields that can be swapped by a config reload:
+	// BackendGroups, wsBackendGroup, rpcMethodMappings, routingRules, the frontend rate limiters, the API keys
+	// and the JWT authenticator.
+	stateMu             sync.RWMutex
+	reloadMu            sync.Mutex
+	config              *Config
+	rpcRequestSemaphore *semaphore.Weighted
+	apiKeys             *APIKeyStore
+	jwtAuth             *JWTAuthenticator
 }
 
 type limiterFunc func(method string) bool
 
-type limiterFactoryFunc func(dur time.Duration, max int, prefix string) FrontendRateLimiter
+// limiterFactoryFunc creates a rate limiter using the algorithm, fixed_window when it is empty
+type limiterFactoryFunc func(dur time.Duration, max int, prefix string, algorithm string) FrontendRateLimiter
+
+type apiKeyStoreFactoryFunc func(cfg APIKeysConfig) (*APIKeyStore, error)
 
 func NewServer(
 	backendGroups map[string]*BackendGroup,
@@ -124,11 +149,68 @@ func NewServer(
 		maxBatchSize = MaxBatchRPCCallsHardLimit
 	}
 
+	lims, err := buildFrontendRateLimits(rateLimitConfig, limiterFactory)
+	if err != nil {
+		return nil, err
+	}
+	var senderLim FrontendRateLimiter
+	if senderRateLimitConfig.Enabled {
+		if err := validateRateLimitAlgorithm(senderRateLimitConfig.Algorithm); err != nil {
+			return nil, fmt.Errorf("sender_rate_limit: %w", err)
+		}
+		senderLim = limiterFactory(time.Duration(senderRateLimitConfig.Interval), senderRateLimitConfig.Limit, "senders", senderRateLimitConfig.Algorithm)
+	}
+
+	rateLimitHeader := defaultRateLimitHeader
+	if rateLimitConfig.IPHeaderOverride != "" {
+		rateLimitHeader = rateLimitConfig.IPHeaderOverride
+	}
+
+	return &Server{
+		BackendGroups:        backendGroups,
+		wsBackendGroup:       wsBackendGroup,
+		wsMethodWhitelist:    wsMethodWhitelist,
+		rpcMethodMappings:    rpcMethodMappings,
+		maxBodySize:          maxBodySize,
+		authenticatedPaths:   authenticatedPaths,
+		timeout:              timeout,
+		maxUpstreamBatchSize: maxUpstreamBatchSize,
+		enableServedByHeader: enableServedByHeader,
+		cache:                cache,
+		enableRequestLog:     enableRequestLog,
+		maxRequestBodyLogLen: maxRequestBodyLogLen,
+		maxBatchSize:         maxBatchSize,
+		upgrader: &websocket.Upgrader{
+			HandshakeTimeout: defaultWSHandshakeTimeout,
+		},
+		frontendLims:    lims,
+		senderLim:       senderLim,
+		allowedChainIds: senderRateLimitConfig.AllowedChainIds,
+		rateLimitHeader: rateLimitHeader,
+		limiterFactory:  limiterFactory,
+	}, nil
+}
+
+// frontendRateLimits holds the limiters built from a RateLimitConfig.
+// It is swapped as a whole on reload, so a request must read everything from the same instance.
+type frontendRateLimits struct {
+	mainLim                FrontendRateLimiter
+	overrideLims           map[string]FrontendRateLimiter
+	globallyLimitedMethods map[string]bool
+	limExemptOrigins       []*regexp.Regexp
+	limExemptUserAgents    []*regexp.Regexp
+	computeUnits           *computeUnitLimits
+}
+
+func buildFrontendRateLimits(rateLimitConfig RateLimitConfig, limiterFactory limiterFactoryFunc) (*frontendRateLimits, error) {
 	var mainLim FrontendRateLimiter
 	limExemptOrigins := make([]*regexp.Regexp, 0)
 	limExemptUserAgents := make([]*regexp.Regexp, 0)
 	if rateLimitConfig.BaseRate > 0 {
-		mainLim = limiterFactory(time.Duration(rateLimitConfig.BaseInterval), rateLimitConfig.BaseRate, "main")
+		if err := validateRateLimitAlgorithm(rateLimitConfig.BaseAlgorithm); err != nil {
+			return nil, fmt.Errorf("rate_limit: %w", err)
+		}
+		mainLim = limiterFactory(time.Duration(rateLimitConfig.BaseInterval), rateLimitConfig.BaseRate, "main", rateLimitConfig.BaseAlgorithm)
 		for _, origin := range rateLimitConfig.ExemptOrigins {
 			pattern, err := regexp.Compile(origin)
 			if err != nil {
@@ -150,47 +232,28 @@ func NewServer(
 	overrideLims := make(map[string]FrontendRateLimiter)
 	globalMethodLims := make(map[string]bool)
 	for method, override := range rateLimitConfig.MethodOverrides {
-		overrideLims[method] = limiterFactory(time.Duration(override.Interval), override.Limit, method)
+		if err := validateRateLimitAlgorithm(override.Algorithm); err != nil {
+			return nil, fmt.Errorf("rate_limit method override %s: %w", method, err)
+		}
+		overrideLims[method] = limiterFactory(time.Duration(override.Interval), override.Limit, method, override.Algorithm)
 
 		if override.Global {
 			globalMethodLims[method] = true
 		}
 	}
-	var senderLim FrontendRateLimiter
-	if senderRateLimitConfig.Enabled {
-		senderLim = limiterFactory(time.Duration(senderRateLimitConfig.Interval), senderRateLimitConfig.Limit, "senders")
-	}
 
-	rateLimitHeader := defaultRateLimitHeader
-	if rateLimitConfig.IPHeaderOverride != "" {
-		rateLimitHeader = rateLimitConfig.IPHeaderOverride
+	computeUnits, err := buildComputeUnitLimits(rateLimitConfig.ComputeUnits, limiterFactory)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Server{
-		BackendGroups:        backendGroups,
-		wsBackendGroup:       wsBackendGroup,
-		wsMethodWhitelist:    wsMethodWhitelist,
-		rpcMethodMappings:    rpcMethodMappings,
-		maxBodySize:          maxBodySize,
-		authenticatedPaths:   authenticatedPaths,
-		timeout:              timeout,
-		maxUpstreamBatchSize: maxUpstreamBatchSize,
-		enableServedByHeader: enableServedByHeader,
-		cache:                cache,
-		enableRequestLog:     enableRequestLog,
-		maxRequestBodyLogLen: maxRequestBodyLogLen,
-		maxBatchSize:         maxBatchSize,
-		upgrader: &websocket.Upgrader{
-			HandshakeTimeout: defaultWSHandshakeTimeout,
-		},
+	return &frontendRateLimits{
 		mainLim:                mainLim,
 		overrideLims:           overrideLims,
 		globallyLimitedMethods: globalMethodLims,
-		senderLim:              senderLim,
-		allowedChainIds:        senderRateLimitConfig.AllowedChainIds,
 		limExemptOrigins:       limExemptOrigins,
 		limExemptUserAgents:    limExemptUserAgents,
-		rateLimitHeader:        rateLimitHeader,
+		computeUnits:           computeUnits,
 	}, nil
 }
 
@@ -198,6 +261,17 @@ func (s *Server) RPCListenAndServe(host string, port int) error {
 	s.srvMu.Lock()
 	hdlr := mux.NewRouter()
 	hdlr.HandleFunc("/healthz", s.HandleHealthz).Methods("GET")
+	hdlr.HandleFunc("/consensus_ha/{group}", s.HandleConsensusHA).Methods("GET")
+	for _, route := range s.pathRoutes {
+		route := route
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			s.handlePathRoute(route, w, r)
+		}
+		for _, prefix := range []string{"", "/{authorization}"} {
+			hdlr.Path(prefix + route.path).HandlerFunc(handler)
+			hdlr.PathPrefix(prefix + route.path + "/").HandlerFunc(handler)
+		}
+	}
 	hdlr.HandleFunc("/", s.HandleRPC).Methods("POST")
 	hdlr.HandleFunc("/{authorization}", s.HandleRPC).Methods("POST")
 	c := cors.New(cors.Options{
@@ -240,15 +314,42 @@ func (s *Server) Shutdown() {
 	if s.wsServer != nil {
 		_ = s.wsServer.Shutdown(context.Background())
 	}
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
 	for _, bg := range s.BackendGroups {
 		bg.Shutdown()
 	}
+	for _, bg := range s.BackendGroups {
+		for _, be := range bg.Backends {
+			be.Close()
+		}
+	}
+	if s.apiKeys != nil {
+		s.apiKeys.Stop()
+	}
 }
 
 func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("OK"))
 }
 
+// HandleConsensusHA answers the consensus HA peers of the backend group, if it shares its consensus with peers
+func (s *Server) HandleConsensusHA(w http.ResponseWriter, r *http.Request) {
+	s.stateMu.RLock()
+	bg := s.BackendGroups[mux.Vars(r)["group"]]
+	s.stateMu.RUnlock()
+	if bg == nil || bg.Consensus == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	tracker, ok := bg.Consensus.tracker.(*PeerConsensusTracker)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	tracker.ServeHTTP(w, r)
+}
+
 func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 	ctx := s.populateContext(w, r)
 	if ctx == nil {
@@ -258,12 +359,21 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel = context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
+	ctx, span := StartSpan(ContextWithTraceContext(ctx, r.Header), "proxyd.HandleRPC", SpanKindServer)
+	defer span.End()
+	span.SetAttributes("rpc.system", "jsonrpc", "proxyd.req_id", GetReqID(ctx))
+
 	origin := r.Header.Get("Origin")
 	userAgent := r.Header.Get("User-Agent")
 	// Use XFF in context since it will automatically be replaced by the remote IP
 	xff := stripXFF(GetXForwardedFor(ctx))
-	isUnlimitedOrigin := s.isUnlimitedOrigin(origin)
-	isUnlimitedUserAgent := s.isUnlimitedUserAgent(userAgent)
+
+	s.stateMu.RLock()
+	lims := s.frontendLims
+	s.stateMu.RUnlock()
+
+	isUnlimitedOrigin := lims.isUnlimitedOrigin(origin)
+	isUnlimitedUserAgent := lims.isUnlimitedUserAgent(userAgent)
 
 	if xff == "" {
 		writeRPCError(ctx, w, nil, ErrInvalidRequest("request does not include a remote IP"))
@@ -271,30 +381,40 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 	}
 
 	isLimited := func(method string) bool {
-		isGloballyLimitedMethod := s.isGlobalLimit(method)
+		isGloballyLimitedMethod := lims.isGlobalLimit(method)
 		if !isGloballyLimitedMethod && (isUnlimitedOrigin || isUnlimitedUserAgent) {
 			return false
 		}
 
 		var lim FrontendRateLimiter
 		if method == "" {
-			lim = s.mainLim
+			lim = lims.mainLim
 		} else {
-			lim = s.overrideLims[method]
+			lim = lims.overrideLims[method]
 		}
 
 		if lim == nil {
 			return false
 		}
 
+		_, span := StartSpan(ctx, "proxyd.rate_limit", SpanKindInternal)
+		defer span.End()
 		ok, err := lim.Take(ctx, xff)
+		span.SetAttributes("rpc.method", method, "proxyd.rate_limited", err != nil || !ok)
 		if err != nil {
+			span.RecordError(err)
 			log.Warn("error taking rate limit", "err", err)
 			return true
 		}
 		return !ok
 	}
 
+	// compute units apply to the same requesters as the base rate limit
+	computeUnits := lims.computeUnits
+	if isUnlimitedOrigin || isUnlimitedUserAgent {
+		computeUnits = nil
+	}
+
 	log.Debug(
 		"received RPC request",
 		"req_id", GetReqID(ctx),
@@ -318,6 +438,13 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 	}
 	RecordRequestPayloadSize(ctx, len(body))
 
+	if s.capturer != nil && s.capturer.Sample() {
+		cw := newCaptureResponseWriter(w)
+		w = cw
+		start := time.Now()
+		defer s.capturer.Capture(body, cw, GetReqID(ctx), start)
+	}
+
 	if s.enableRequestLog {
 		log.Info("Raw RPC request",
 			"body", truncate(string(body), s.maxRequestBodyLogLen),
@@ -336,6 +463,7 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 		}
 
 		RecordBatchSize(len(reqs))
+		span.SetAttributes("rpc.batch_size", len(reqs))
 
 		if len(reqs) > s.maxBatchSize {
 			RecordRPCError(ctx, BackendProxyd, MethodUnknown, ErrTooManyBatchRequests)
@@ -348,7 +476,7 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		batchRes, batchContainsCached, servedBy, err := s.handleBatchRPC(ctx, reqs, isLimited, true)
+		batchRes, batchContainsCached, servedBy, err := s.handleBatchRPC(ctx, reqs, isLimited, computeUnits, true)
 		if err == context.DeadlineExceeded {
 			writeRPCError(ctx, w, nil, ErrGatewayTimeout)
 			return
@@ -365,13 +493,14 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 		if s.enableServedByHeader {
 			w.Header().Set("x-served-by", servedBy)
 		}
+		setCaptureServedBy(w, servedBy)
 		setCacheHeader(w, batchContainsCached)
 		writeBatchRPCRes(ctx, w, batchRes)
 		return
 	}
 
 	rawBody := json.RawMessage(body)
-	backendRes, cached, servedBy, err := s.handleBatchRPC(ctx, []json.RawMessage{rawBody}, isLimited, false)
+	backendRes, cached, servedBy, err := s.handleBatchRPC(ctx, []json.RawMessage{rawBody}, isLimited, computeUnits, false)
 	if err != nil {
 		if errors.Is(err, ErrConsensusGetReceiptsCantBeBatched) ||
 			errors.Is(err, ErrConsensusGetReceiptsInvalidTarget) {
@@ -384,11 +513,16 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 	if s.enableServedByHeader {
 		w.Header().Set("x-served-by", servedBy)
 	}
+	setCaptureServedBy(w, servedBy)
 	setCacheHeader(w, cached)
 	writeRPCRes(ctx, w, backendRes[0])
 }
 
-func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isLimited limiterFunc, isBatch bool) ([]*RPCRes, bool, string, error) {
+func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isLimited limiterFunc, computeUnits *computeUnitLimits, isBatch bool) ([]*RPCRes, bool, string, error) {
+	ctx, span := StartSpan(ctx, "proxyd.handle_batch", SpanKindInternal)
+	defer span.End()
+	span.SetAttributes("rpc.batch_size", len(reqs), "proxyd.is_batch", isBatch)
+
 	// A request set is transformed into groups of batches.
 	// Each batch group maps to a forwarded JSON-RPC batch request (subject to maxUpstreamBatchSize constraints)
 	// A groupID is used to decouple Requests that have duplicate ID so they're not part of the same batch that's
@@ -400,9 +534,26 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 		backendGroup string
 	}
 
+	// calls that passed validation, they are only forwarded once the compute
+	// units of all of them could be taken
+	type pendingElem struct {
+		batchGroup batchGroup
+		elem       batchElem
+		cost       int
+	}
+
 	responses := make([]*RPCRes, len(reqs))
 	batches := make(map[batchGroup][]batchElem)
 	ids := make(map[string]int, len(reqs))
+	// txHashes are the hashes of the transactions sent, by index of their request
+	txHashes := make(map[int]common.Hash)
+	pending := make([]pendingElem, 0, len(reqs))
+
+	// Resolve routing once so that a concurrent config reload can't
+	// change it halfway through the request.
+	s.stateMu.RLock()
+	backendGroups, rpcMethodMappings, routingRules := s.BackendGroups, s.rpcMethodMappings, s.routingRules
+	s.stateMu.RUnlock()
 
 	for i := range reqs {
 		parsedReq, err := ParseRPCReq(reqs[i])
@@ -411,6 +562,9 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			responses[i] = NewRPCErrorRes(nil, err)
 			continue
 		}
+		if !isBatch {
+			span.SetAttributes("rpc.method", parsedReq.Method)
+		}
 
 		// Simple health check
 		if len(reqs) == 1 && parsedReq.Method == proxydHealthzMethod {
@@ -434,7 +588,7 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			continue
 		}
 
-		group := s.rpcMethodMappings[parsedReq.Method]
+		group, rule := routeRPCReq(parsedReq, routingRules, rpcMethodMappings, backendGroups)
 		if group == "" {
 			// use unknown below to prevent DOS vector that fills up memory
 			// with arbitrary method names.
@@ -448,6 +602,25 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			responses[i] = NewRPCErrorRes(parsedReq.ID, ErrMethodNotWhitelisted)
 			continue
 		}
+		if rule != nil {
+			log.Debug("routed request by rule", "req_id", GetReqID(ctx), "method", parsedReq.Method, "rule", rule.name, "backend_group", group)
+			RecordRoutingRuleMatch(rule.name, group)
+		}
+
+		apiKey := GetAPIKey(ctx)
+		if apiKey != nil && !apiKey.AllowsMethod(parsedReq.Method) {
+			log.Info(
+				"blocked request for method not allowed for api key",
+				"source", "rpc",
+				"req_id", GetReqID(ctx),
+				"api_key", apiKey.Name,
+				"method", parsedReq.Method,
+			)
+			RecordAPIKeyRejection(apiKey.Name, "method")
+			RecordRPCError(ctx, BackendProxyd, parsedReq.Method, ErrMethodNotWhitelisted)
+			responses[i] = NewRPCErrorRes(parsedReq.ID, ErrMethodNotWhitelisted)
+			continue
+		}
 
 		// Take base rate limit first
 		if isLimited("") {
@@ -462,8 +635,8 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			continue
 		}
 
-		// Take rate limit for specific methods.
-		if _, ok := s.overrideLims[parsedReq.Method]; ok && isLimited(parsedReq.Method) {
+		// Take rate limit for specific methods. isLimited is a no-op for methods without an override.
+		if isLimited(parsedReq.Method) {
 			log.Debug(
 				"rate limited specific RPC",
 				"source", "rpc",
@@ -475,15 +648,46 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			continue
 		}
 
-		// Apply a sender-based rate limit if it is enabled. Note that sender-based rate
-		// limits apply regardless of origin or user-agent. As such, they don't use the
-		// isLimited method.
-		if parsedReq.Method == "eth_sendRawTransaction" && s.senderLim != nil {
-			if err := s.rateLimitSender(ctx, parsedReq); err != nil {
+		// Apply the tx policy and a sender-based rate limit if they are enabled. Note that
+		// sender-based rate limits apply regardless of origin or user-agent. As such, they
+		// don't use the isLimited method.
+		if parsedReq.Method == "eth_sendRawTransaction" && (s.txPolicy != nil || s.senderLim != nil) {
+			res, hash, err := s.checkRawTransaction(ctx, parsedReq)
+			if err != nil {
 				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
 				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
 				continue
 			}
+			if res != nil {
+				responses[i] = res
+				continue
+			}
+			txHashes[i] = hash
+		}
+
+		// Count the call against the api key last, so that calls rejected above
+		// don't use up its quota.
+		if apiKey != nil {
+			if err := apiKey.Take(ctx); err != nil {
+				log.Debug(
+					"api key over limit",
+					"source", "rpc",
+					"req_id", GetReqID(ctx),
+					"api_key", apiKey.Name,
+					"method", parsedReq.Method,
+				)
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
+			}
+			if apiKey.BackendGroup != "" {
+				if backendGroups[apiKey.BackendGroup] == nil {
+					log.Error("api key uses an undefined backend group", "api_key", apiKey.Name, "backend_group", apiKey.BackendGroup)
+					responses[i] = NewRPCErrorRes(parsedReq.ID, ErrInternal)
+					continue
+				}
+				group = apiKey.BackendGroup
+			}
 		}
 
 		id := string(parsedReq.ID)
@@ -491,7 +695,45 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 		ids[id]++
 		batchGroupID := ids[id]
 		batchGroup := batchGroup{groupID: batchGroupID, backendGroup: group}
-		batches[batchGroup] = append(batches[batchGroup], batchElem{parsedReq, i})
+		var cost int
+		if computeUnits != nil {
+			cost = computeUnits.cost(parsedReq, backendGroups[group].Consensus)
+		}
+		pending = append(pending, pendingElem{batchGroup, batchElem{parsedReq, i}, cost})
+	}
+
+	// A batch is charged the sum of its calls, and rejected as a whole if it's over budget
+	if computeUnits != nil && len(pending) > 0 {
+		var total int
+		for _, p := range pending {
+			total += p.cost
+		}
+		_, cuSpan := StartSpan(ctx, "proxyd.compute_units", SpanKindInternal)
+		ok, remaining, err := computeUnits.take(ctx, rateLimitKey(ctx), total)
+		cuSpan.SetAttributes("proxyd.compute_units.cost", total, "proxyd.compute_units.remaining", remaining, "proxyd.rate_limited", err != nil || !ok)
+		cuSpan.RecordError(err)
+		cuSpan.End()
+		if err != nil {
+			log.Warn("error taking compute units", "err", err)
+		}
+		if err != nil || !ok {
+			rpcErr := ErrOverComputeUnits(total, remaining)
+			log.Debug(
+				"over compute unit limit",
+				"source", "rpc",
+				"req_id", GetReqID(ctx),
+				"cost", total,
+				"remaining", remaining,
+			)
+			for _, p := range pending {
+				RecordRPCError(ctx, BackendProxyd, p.elem.Req.Method, rpcErr)
+				responses[p.elem.Index] = NewRPCErrorRes(p.elem.Req.ID, rpcErr)
+			}
+			pending = pending[:0]
+		}
+	}
+	for _, p := range pending {
+		batches[p.batchGroup] = append(batches[p.batchGroup], p.elem)
 	}
 
 	servedBy := make(map[string]bool, 0)
@@ -499,8 +741,18 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 	for group, batch := range batches {
 		var cacheMisses []batchElem
 
+		// the finalized cache needs the consensus of the group serving the request
+		cacheCtx := ctx
+		if cp := backendGroups[group.backendGroup].Consensus; cp != nil {
+			cacheCtx = context.WithValue(ctx, ContextKeyConsensusPoller, cp) // nolint:staticcheck
+		}
+
 		for _, req := range batch {
-			backendRes, _ := s.cache.GetRPC(ctx, req.Req)
+			_, cacheSpan := StartSpan(ctx, "proxyd.cache.get", SpanKindInternal)
+			backendRes, err := s.cache.GetRPC(cacheCtx, req.Req)
+			cacheSpan.SetAttributes("rpc.method", req.Req.Method, "proxyd.cache_hit", backendRes != nil)
+			cacheSpan.RecordError(err)
+			cacheSpan.End()
 			if backendRes != nil {
 				responses[req.Index] = backendRes
 				cached = true
@@ -525,7 +777,15 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			start := i * s.maxUpstreamBatchSize
 			end := int(math.Min(float64(start+s.maxUpstreamBatchSize), float64(len(cacheMisses))))
 			elems := cacheMisses[start:end]
-			res, sb, err := s.BackendGroups[group.backendGroup].Forward(ctx, createBatchRequest(elems), isBatch)
+			fwdCtx, fwdSpan := StartSpan(ctx, "proxyd.backend_group.forward", SpanKindInternal)
+			fwdSpan.SetAttributes("proxyd.backend_group", group.backendGroup, "rpc.batch_size", len(elems))
+			if len(elems) == 1 {
+				fwdSpan.SetAttributes("rpc.method", elems[0].Req.Method)
+			}
+			res, sb, err := backendGroups[group.backendGroup].Forward(fwdCtx, createBatchRequest(elems), isBatch)
+			fwdSpan.SetAttributes("proxyd.served_by", sb)
+			fwdSpan.RecordError(err)
+			fwdSpan.End()
 			servedBy[sb] = true
 			if err != nil {
 				if errors.Is(err, ErrConsensusGetReceiptsCantBeBatched) ||
@@ -547,10 +807,13 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 
 			for i := range elems {
 				responses[elems[i].Index] = res[i]
+				if hash, ok := txHashes[elems[i].Index]; ok && s.txPolicy != nil {
+					s.txPolicy.markSent(ctx, hash, res[i])
+				}
 
 				// TODO(inphi): batch put these
 				if res[i].Error == nil && res[i].Result != nil {
-					if err := s.cache.PutRPC(ctx, elems[i].Req, res[i]); err != nil {
+					if err := s.cache.PutRPC(cacheCtx, elems[i].Req, res[i]); err != nil {
 						log.Warn(
 							"cache put error",
 							"req_id", GetReqID(ctx),
@@ -569,6 +832,7 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 		}
 		servedByString += sb
 	}
+	span.SetAttributes("proxyd.cache_hit", cached)
 
 	return responses, cached, servedByString, nil
 }
@@ -588,14 +852,24 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 	}
 	clientConn.SetReadLimit(s.maxBodySize)
 
-	proxier, err := s.wsBackendGroup.ProxyWS(ctx, clientConn, s.wsMethodWhitelist)
-	if err != nil {
-		if errors.Is(err, ErrNoBackends) {
-			RecordUnserviceableRequest(ctx, RPCRequestSourceWS)
+	s.stateMu.RLock()
+	wsBackendGroup := s.wsBackendGroup
+	s.stateMu.RUnlock()
+
+	var proxier wsSession
+	if s.wsMultiplexSubscriptions {
+		proxier = wsBackendGroup.ProxyWSMultiplexed(clientConn, s.wsMethodWhitelist, s.timeout)
+	} else {
+		wsProxier, err := wsBackendGroup.ProxyWS(ctx, clientConn, s.wsMethodWhitelist)
+		if err != nil {
+			if errors.Is(err, ErrNoBackends) {
+				RecordUnserviceableRequest(ctx, RPCRequestSourceWS)
+			}
+			log.Error("error dialing ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+			clientConn.Close()
+			return
 		}
-		log.Error("error dialing ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
-		clientConn.Close()
-		return
+		proxier = wsProxier
 	}
 
 	activeClientWsConnsGauge.WithLabelValues(GetAuthCtx(ctx)).Inc()
@@ -623,20 +897,45 @@ func (s *Server) populateContext(w http.ResponseWriter, r *http.Request) context
 
 	ctx := context.WithValue(r.Context(), ContextKeyXForwardedFor, xff) // nolint:staticcheck
 
+	ctx = context.WithValue(ctx, ContextKeyReqHeaders, r.Header) // nolint:staticcheck
+
 	opTxProxyAuth := r.Header.Get(DefaultOpTxProxyAuthHeader)
 	if opTxProxyAuth != "" {
 		ctx = context.WithValue(ctx, ContextKeyOpTxProxyAuth, opTxProxyAuth) // nolint:staticcheck
 	}
 
-	if len(s.authenticatedPaths) > 0 {
-		if authorization == "" || s.authenticatedPaths[authorization] == "" {
+	s.stateMu.RLock()
+	apiKeys, jwtAuth := s.apiKeys, s.jwtAuth
+	s.stateMu.RUnlock()
+
+	if len(s.authenticatedPaths) > 0 || apiKeys != nil || jwtAuth != nil {
+		var alias string
+		if apiKeys != nil {
+			if key := apiKeys.Authenticate(r, authorization); key != nil {
+				ctx = context.WithValue(ctx, ContextKeyAPIKey, key) // nolint:staticcheck
+				alias = key.Label
+			}
+		}
+		if alias == "" && authorization != "" {
+			alias = s.authenticatedPaths[authorization]
+		}
+		if alias == "" && jwtAuth != nil {
+			key, err := jwtAuth.Authenticate(r, authorization)
+			if err != nil {
+				log.Info("blocked request with invalid jwt", "err", err)
+			} else if key != nil {
+				ctx = context.WithValue(ctx, ContextKeyAPIKey, key) // nolint:staticcheck
+				alias = key.Label
+			}
+		}
+		if alias == "" {
 			log.Info("blocked unauthorized request", "authorization", authorization)
 			httpResponseCodesTotal.WithLabelValues("401").Inc()
 			w.WriteHeader(401)
 			return nil
 		}
 
-		ctx = context.WithValue(ctx, ContextKeyAuth, s.authenticatedPaths[authorization]) // nolint:staticcheck
+		ctx = context.WithValue(ctx, ContextKeyAuth, alias) // nolint:staticcheck
 	}
 
 	return context.WithValue(
@@ -646,6 +945,14 @@ func (s *Server) populateContext(w http.ResponseWriter, r *http.Request) context
 	)
 }
 
+// rateLimitKey identifies the requester, by auth key if the request is authenticated or by IP otherwise
+func rateLimitKey(ctx context.Context) string {
+	if auth := GetAuthCtx(ctx); auth != "none" {
+		return "auth:" + auth
+	}
+	return stripXFF(GetXForwardedFor(ctx))
+}
+
 func randStr(l int) string {
 	b := make([]byte, l)
 	if _, err := rand.Read(b); err != nil {
@@ -654,8 +961,8 @@ func randStr(l int) string {
 	return hex.EncodeToString(b)
 }
 
-func (s *Server) isUnlimitedOrigin(origin string) bool {
-	for _, pat := range s.limExemptOrigins {
+func (l *frontendRateLimits) isUnlimitedOrigin(origin string) bool {
+	for _, pat := range l.limExemptOrigins {
 		if pat.MatchString(origin) {
 			return true
 		}
@@ -664,8 +971,8 @@ func (s *Server) isUnlimitedOrigin(origin string) bool {
 	return false
 }
 
-func (s *Server) isUnlimitedUserAgent(origin string) bool {
-	for _, pat := range s.limExemptUserAgents {
+func (l *frontendRateLimits) isUnlimitedUserAgent(origin string) bool {
+	for _, pat := range l.limExemptUserAgents {
 		if pat.MatchString(origin) {
 			return true
 		}
@@ -673,40 +980,38 @@ func (s *Server) isUnlimitedUserAgent(origin string) bool {
 	return false
 }
 
-func (s *Server) isGlobalLimit(method string) bool {
-	return s.globallyLimitedMethods[method]
+func (l *frontendRateLimits) isGlobalLimit(method string) bool {
+	return l.globallyLimitedMethods[method]
 }
 
-func (s *Server) rateLimitSender(ctx context.Context, req *RPCReq) error {
-	var params []string
-	if err := json.Unmarshal(req.Params, &params); err != nil {
-		log.Debug("error unmarshalling raw transaction params", "err", err, "req_Id", GetReqID(ctx))
-		return ErrParseErr
-	}
-
-	if len(params) != 1 {
-		log.Debug("raw transaction request has invalid number of params", "req_id", GetReqID(ctx))
-		// The error below is identical to the one Geth responds with.
-		return ErrInvalidParams("missing value for required argument 0")
+// checkRawTransaction applies the tx policy and the sender-based rate limit to a transaction.
+// It returns the response of the original transaction when it is a retry that was deduplicated.
+func (s *Server) checkRawTransaction(ctx context.Context, req *RPCReq) (*RPCRes, common.Hash, error) {
+	tx, err := decodeRawTransaction(ctx, req)
+	if err != nil {
+		return nil, common.Hash{}, err
 	}
 
-	var data hexutil.Bytes
-	if err := data.UnmarshalText([]byte(params[0])); err != nil {
-		log.Debug("error decoding raw tx data", "err", err, "req_id", GetReqID(ctx))
-		// Geth returns the raw error from UnmarshalText.
-		return ErrInvalidParams(err.Error())
+	// The policy runs first, so that retries of a transaction and rejected
+	// transactions don't count against the sender's rate limit.
+	if s.txPolicy != nil {
+		res, err := s.txPolicy.check(ctx, req, tx)
+		if err != nil || res != nil {
+			return res, tx.Hash(), err
+		}
 	}
-
-	// Inflates a types.Transaction object from the transaction's raw bytes.
-	tx := new(types.Transaction)
-	if err := tx.UnmarshalBinary(data); err != nil {
-		log.Debug("could not unmarshal transaction", "err", err, "req_id", GetReqID(ctx))
-		return ErrInvalidParams(err.Error())
+	if s.senderLim != nil {
+		if err := s.rateLimitSender(ctx, tx); err != nil {
+			return nil, tx.Hash(), err
+		}
 	}
+	return nil, tx.Hash(), nil
+}
 
+func (s *Server) rateLimitSender(ctx context.Context, tx *types.Transaction) error {
 	// Check if the transaction is for the expected chain,
 	// otherwise reject before rate limiting to avoid replay attacks.
-	if !s.isAllowedChainId(tx.ChainId()) {
+	if !isAllowedChainId(s.allowedChainIds, tx.ChainId()) {
 		log.Debug("chain id is not allowed", "req_id", GetReqID(ctx))
 		return txpool.ErrInvalidSender
 	}
@@ -727,19 +1032,19 @@ func (s *Server) rateLimitSender(ctx context.Context, req *RPCReq) error {
 		return ErrOverSenderRateLimit
 	}
 
-	return nil
-}
-
-func (s *Server) isAllowedChainId(chainId *big.Int) bool {
-	if len(s.allowedChainIds) == 0 {
-		return true
-	}
-	for _, id := range s.allowedChainIds {
-		if chainId.Cmp(id) == 0 {
-			return true
+	if s.senderNonceLim != nil {
+		ok, err := s.senderNonceLim.Take(ctx, from.Hex(), tx.Nonce())
+		if err != nil {
+			log.Error("error taking from sender nonce limiter", "err", err, "req_id", GetReqID(ctx))
+			return ErrInternal
+		}
+		if !ok {
+			log.Debug("sender has too many nonces in flight", "sender", from.Hex(), "nonce", tx.Nonce(), "req_id", GetReqID(ctx))
+			return ErrOverSenderRateLimit
 		}
 	}
-	return false
+
+	return nil
 }
 
 func setCacheHeader(w http.ResponseWriter, cached bool) {
@@ -833,6 +1138,14 @@ func GetXForwardedFor(ctx context.Context) string {
 	return xff
 }
 
+func GetConsensusPoller(ctx context.Context) *ConsensusPoller {
+	cp, ok := ctx.Value(ContextKeyConsensusPoller).(*ConsensusPoller)
+	if !ok {
+		return nil
+	}
+	return cp
+}
+
 type recordLenWriter struct {
 	io.Writer
 	Len int
@@ -854,6 +1167,10 @@ func (n *NoopRPCCache) PutRPC(context.Context, *RPCReq, *RPCRes) error {
 	return nil
 }
 
+func (n *NoopRPCCache) InvalidateBlocks(context.Context, []string, uint64) error {
+	return nil
+}
+
 func truncate(str string, maxLen int) string {
 	if maxLen == 0 {
 		maxLen = maxRequestBodyLogLen
@@ -0,0 +1,273 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	StickySessionKeyIP     = "ip"
+	StickySessionKeyAuth   = "auth"
+	StickySessionKeyHeader = "header"
+
+	defaultStickySessionTTL = 5 * time.Minute
+	// filterSessionTTL matches the timeout of inactive filters in geth
+	filterSessionTTL    = 5 * time.Minute
+	stickySweepInterval = time.Minute
+)
+
+// filterCreationMethods return a filter ID that only the backend that created it knows
+var filterCreationMethods = NewStringSetFromStrings([]string{
+	"eth_newFilter",
+	"eth_newBlockFilter",
+	"eth_newPendingTransactionFilter",
+})
+
+// filterMethods take a filter ID as their first param
+var filterMethods = NewStringSetFromStrings([]string{
+	"eth_getFilterChanges",
+	"eth_getFilterLogs",
+	"eth_uninstallFilter",
+})
+
+type stickyEntry struct {
+	backend   *Backend
+	expiresAt time.Time
+}
+
+// stickySessions maps the filters created through a backend group to the backend that created
+// them, and optionally pins clients to the backend that last served them for a TTL
+type stickySessions struct {
+	bg        *BackendGroup
+	key       string
+	header    string
+	ttl       time.Duration
+	now       func() time.Time
+	mtx       sync.Mutex
+	sessions  map[string]*stickyEntry
+	filters   map[string]*stickyEntry
+	lastSweep time.Time
+}
+
+func newStickySessions(bg *BackendGroup, key string, header string, ttl time.Duration) *stickySessions {
+	if ttl == 0 {
+		ttl = defaultStickySessionTTL
+	}
+	return &stickySessions{
+		bg:       bg,
+		key:      key,
+		header:   http.CanonicalHeaderKey(header),
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: make(map[string]*stickyEntry),
+		filters:  make(map[string]*stickyEntry),
+	}
+}
+
+// clientKey identifies the client a session is pinned for, or is empty if sessions
+// are disabled or the client can't be identified
+func (s *stickySessions) clientKey(ctx context.Context) string {
+	switch s.key {
+	case StickySessionKeyIP:
+		return stripXFF(GetXForwardedFor(ctx))
+	case StickySessionKeyAuth:
+		return rateLimitKey(ctx)
+	case StickySessionKeyHeader:
+		if headers, ok := ctx.Value(ContextKeyReqHeaders).(http.Header); ok {
+			return headers.Get(s.header)
+		}
+	}
+	return ""
+}
+
+// order moves the backend the client is pinned to first, as long as it's still a healthy candidate.
+// Otherwise the usual order is kept, and the client is pinned to whichever backend serves it.
+func (s *stickySessions) order(ctx context.Context, backends []*Backend) []*Backend {
+	key := s.clientKey(ctx)
+	if key == "" {
+		return backends
+	}
+	pinned := s.get(s.sessions, key)
+	if pinned == nil || !pinned.IsHealthy() || !s.bg.HealthChecker.IsHealthy(pinned) {
+		return backends
+	}
+	for i, be := range backends {
+		if be == pinned {
+			ordered := make([]*Backend, 0, len(backends))
+			ordered = append(ordered, be)
+			ordered = append(ordered, backends[:i]...)
+			return append(ordered, backends[i+1:]...)
+		}
+	}
+	return backends
+}
+
+// record pins the client to the backend that served it, and maps the filters it created to it
+func (s *stickySessions) record(ctx context.Context, be *Backend, rpcReqs []*RPCReq, res []*RPCRes) {
+	if be == nil {
+		return
+	}
+	if key := s.clientKey(ctx); key != "" {
+		s.set(s.sessions, key, be, s.ttl)
+	}
+	if len(res) != len(rpcReqs) {
+		return
+	}
+	for i, req := range rpcReqs {
+		if !filterCreationMethods.Has(req.Method) || res[i].IsError() {
+			continue
+		}
+		if id, ok := res[i].Result.(string); ok {
+			s.set(s.filters, id, be, filterSessionTTL)
+		}
+	}
+}
+
+// filterBackend returns the backend that created the filter of a call, if it's known
+func (s *stickySessions) filterBackend(req *RPCReq) (string, *Backend) {
+	if !filterMethods.Has(req.Method) {
+		return "", nil
+	}
+	var params []interface{}
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) == 0 {
+		return "", nil
+	}
+	id, ok := params[0].(string)
+	if !ok {
+		return "", nil
+	}
+	return id, s.get(s.filters, id)
+}
+
+func (s *stickySessions) get(entries map[string]*stickyEntry, key string) *Backend {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	entry, ok := entries[key]
+	if !ok {
+		return nil
+	}
+	if s.now().After(entry.expiresAt) {
+		delete(entries, key)
+		return nil
+	}
+	return entry.backend
+}
+
+func (s *stickySessions) set(entries map[string]*stickyEntry, key string, be *Backend, ttl time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := s.now()
+	entries[key] = &stickyEntry{backend: be, expiresAt: now.Add(ttl)}
+	if now.Sub(s.lastSweep) < stickySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for _, m := range []map[string]*stickyEntry{s.sessions, s.filters} {
+		for k, entry := range m {
+			if now.After(entry.expiresAt) {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+func (s *stickySessions) remove(entries map[string]*stickyEntry, key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(entries, key)
+}
+
+// forwardFilterCalls sends the filter calls to the backend that created their filter, and forwards
+// the other calls as usual. A call fails with ErrFilterNotFound if that backend isn't a candidate of
+// the group anymore, e.g. it was banned by consensus, so that the client creates a new filter.
+// It returns false if there is no call with a known filter.
+func (bg *BackendGroup) forwardFilterCalls(ctx context.Context, rpcReqs []*RPCReq, isBatch bool) ([]*RPCRes, string, bool, error) {
+	type filterCall struct {
+		index   int
+		id      string
+		backend *Backend
+	}
+	var calls []filterCall
+	rest := make([]*RPCReq, 0, len(rpcReqs))
+	restIndexes := make([]int, 0, len(rpcReqs))
+	for i, req := range rpcReqs {
+		if id, be := bg.stickySessions.filterBackend(req); be != nil {
+			calls = append(calls, filterCall{index: i, id: id, backend: be})
+			continue
+		}
+		rest = append(rest, req)
+		restIndexes = append(restIndexes, i)
+	}
+	if len(calls) == 0 {
+		return nil, "", false, nil
+	}
+
+	res := make([]*RPCRes, len(rpcReqs))
+	servedBy := make(map[string]bool)
+	if len(rest) > 0 {
+		restRes, sb, err := bg.Forward(ctx, rest, isBatch)
+		if err != nil {
+			return nil, "", true, err
+		}
+		for i, r := range restRes {
+			res[restIndexes[i]] = r
+		}
+		servedBy[sb] = true
+	}
+
+	candidates := make(map[*Backend]bool)
+	for _, be := range bg.orderedBackendsForRequest() {
+		candidates[be] = true
+	}
+	for _, call := range calls {
+		req := rpcReqs[call.index]
+		if !candidates[call.backend] {
+			log.Warn("backend of filter is unavailable",
+				"req_id", GetReqID(ctx),
+				"backend_group", bg.Name,
+				"backend", call.backend.Name,
+				"method", req.Method,
+			)
+			bg.stickySessions.remove(bg.stickySessions.filters, call.id)
+			RecordStickyFilterMiss(bg)
+			res[call.index] = NewRPCErrorRes(req.ID, ErrFilterNotFound)
+			continue
+		}
+		backendResp := bg.ForwardRequestToBackendGroup([]*RPCReq{req}, []*Backend{call.backend}, ctx, false)
+		if backendResp.error != nil {
+			bg.stickySessions.remove(bg.stickySessions.filters, call.id)
+			RecordStickyFilterMiss(bg)
+			res[call.index] = NewRPCErrorRes(req.ID, ErrFilterNotFound)
+			continue
+		}
+		if req.Method != "eth_uninstallFilter" {
+			bg.stickySessions.set(bg.stickySessions.filters, call.id, call.backend, filterSessionTTL)
+		} else {
+			bg.stickySessions.remove(bg.stickySessions.filters, call.id)
+		}
+		res[call.index] = backendResp.RPCRes[0]
+		servedBy[backendResp.ServedBy] = true
+	}
+	servedByNames := make([]string, 0, len(servedBy))
+	for sb := range servedBy {
+		if sb != "" {
+			servedByNames = append(servedByNames, sb)
+		}
+	}
+	return res, strings.Join(servedByNames, ", "), true, nil
+}
+
+func validateStickySessionKey(key string) error {
+	switch key {
+	case "", StickySessionKeyIP, StickySessionKeyAuth, StickySessionKeyHeader:
+		return nil
+	}
+	return fmt.Errorf("invalid sticky_session_key %q, valid options: ip, auth, header", key)
+}
@@ -0,0 +1,78 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStickySessionsOrder(t *testing.T) {
+	a := NewBackend("a", "", "", nil)
+	b := NewBackend("b", "", "", nil)
+	c := NewBackend("c", "", "", nil)
+	bg := &BackendGroup{Name: "main", Backends: []*Backend{a, b, c}}
+	s := newStickySessions(bg, StickySessionKeyHeader, "x-session-id", time.Minute)
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	ctx := context.WithValue(context.Background(), ContextKeyReqHeaders, http.Header{"X-Session-Id": []string{"client"}})
+	other := context.WithValue(context.Background(), ContextKeyReqHeaders, http.Header{"X-Session-Id": []string{"other"}})
+	backends := []*Backend{a, b, c}
+
+	require.Equal(t, backends, s.order(ctx, backends))
+	s.record(ctx, c, nil, nil)
+	require.Equal(t, []*Backend{c, a, b}, s.order(ctx, backends))
+	require.Equal(t, backends, s.order(other, backends))
+	require.Equal(t, backends, s.order(context.Background(), backends))
+
+	// a pinned backend that isn't a candidate anymore is skipped
+	require.Equal(t, []*Backend{a, b}, s.order(ctx, []*Backend{a, b}))
+
+	now = now.Add(2 * time.Minute)
+	require.Equal(t, backends, s.order(ctx, backends))
+}
+
+func TestStickySessionsFilters(t *testing.T) {
+	a := NewBackend("a", "", "", nil)
+	bg := &BackendGroup{Name: "main", Backends: []*Backend{a}}
+	s := newStickySessions(bg, "", "", 0)
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	newReq := func(method string, params string) *RPCReq {
+		return &RPCReq{JSONRPC: JSONRPCVersion, Method: method, Params: json.RawMessage(params), ID: json.RawMessage("1")}
+	}
+	s.record(context.Background(), a,
+		[]*RPCReq{newReq("eth_newFilter", `[{}]`), newReq("eth_newBlockFilter", `[]`), newReq("eth_chainId", `[]`)},
+		[]*RPCRes{
+			{JSONRPC: JSONRPCVersion, Result: "0x1"},
+			{JSONRPC: JSONRPCVersion, Error: &RPCErr{Code: -32000}},
+			{JSONRPC: JSONRPCVersion, Result: "0x2"},
+		},
+	)
+
+	id, be := s.filterBackend(newReq("eth_getFilterChanges", `["0x1"]`))
+	require.Equal(t, "0x1", id)
+	require.Equal(t, a, be)
+	_, be = s.filterBackend(newReq("eth_getFilterLogs", `["0x2"]`))
+	require.Nil(t, be)
+	_, be = s.filterBackend(newReq("eth_getBalance", `["0x1"]`))
+	require.Nil(t, be)
+	_, be = s.filterBackend(newReq("eth_getFilterChanges", `[]`))
+	require.Nil(t, be)
+
+	now = now.Add(filterSessionTTL + time.Second)
+	_, be = s.filterBackend(newReq("eth_getFilterChanges", `["0x1"]`))
+	require.Nil(t, be)
+}
+
+func TestValidateStickySessionKey(t *testing.T) {
+	for _, key := range []string{"", "ip", "auth", "header"} {
+		require.NoError(t, validateStickySessionKey(key))
+	}
+	require.Error(t, validateStickySessionKey("cookie"))
+}
@@ -99,7 +99,7 @@ func (mh *MockedHandler) Handler(w http.ResponseWriter, req *http.Request) {
 			}
 			idJson, _ := json.Marshal(r["id"])
 			rpcRes.ID = idJson
-			res, _ := json.Marshal(rpcRes)
+			res, _ := json.Marshal(&rpcRes)
 			responses = append(responses, string(res))
 		}
 	}
@@ -118,6 +118,9 @@ func (mh *MockedHandler) Handler(w http.ResponseWriter, req *http.Request) {
 }
 
 func (mh *MockedHandler) LoadFromFile(file string) []*MethodTemplate {
+	if strings.HasSuffix(file, ".jsonl") {
+		return mh.LoadFromCapture(file)
+	}
 	contents, err := os.ReadFile(file)
 	if err != nil {
 		fmt.Printf("error reading MockedResponsesFile: %v\n", err)
@@ -130,6 +133,50 @@ func (mh *MockedHandler) LoadFromFile(file string) []*MethodTemplate {
 	return template
 }
 
+// LoadFromCapture turns the entries of a proxyd capture into templates, so that the
+// mockserver answers like the backends did when the capture was taken
+func (mh *MockedHandler) LoadFromCapture(file string) []*MethodTemplate {
+	entries, err := proxyd.ReadCapture(file)
+	if err != nil {
+		fmt.Printf("error reading capture: %v\n", err)
+		return nil
+	}
+	var template []*MethodTemplate
+	for _, entry := range entries {
+		var reqs []map[string]interface{}
+		var responses []json.RawMessage
+		if proxyd.IsBatch(entry.Request) {
+			if json.Unmarshal(entry.Request, &reqs) != nil || json.Unmarshal(entry.Response, &responses) != nil {
+				continue
+			}
+		} else {
+			var req map[string]interface{}
+			if json.Unmarshal(entry.Request, &req) != nil {
+				continue
+			}
+			reqs = append(reqs, req)
+			responses = append(responses, entry.Response)
+		}
+		for i, req := range reqs {
+			if i >= len(responses) {
+				break
+			}
+			method, _ := req["method"].(string)
+			t := &MethodTemplate{
+				Method:   method,
+				Response: string(responses[i]),
+			}
+			if method == "eth_getBlockByNumber" || method == "debug_getRawReceipts" {
+				if params, ok := req["params"].([]interface{}); ok && len(params) > 0 {
+					t.Block, _ = params[0].(string)
+				}
+			}
+			template = append(template, t)
+		}
+	}
+	return template
+}
+
 func (mh *MockedHandler) AddOverride(template *MethodTemplate) {
 	mh.Overrides = append(mh.Overrides, template)
 }
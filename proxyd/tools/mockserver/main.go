@@ -13,6 +13,7 @@ func main() {
 	if len(os.Args) < 3 {
 		fmt.Printf("simply mock a response based on an external text MockedResponsesFile\n")
 		fmt.Printf("usage: mockserver <port> <MockedResponsesFile.yml>\n")
+		fmt.Printf("       mockserver <port> <capture.jsonl>\n")
 		os.Exit(1)
 	}
 	port, _ := strconv.ParseInt(os.Args[1], 10, 32)
@@ -0,0 +1,259 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterNone   = "none"
+
+	defaultTracingEndpoint    = "http://localhost:4318"
+	defaultTracingServiceName = "proxyd"
+	tracingQueueSize          = 2048
+	tracingBatchSize          = 512
+	tracingFlushInterval      = 5 * time.Second
+	tracingExportTimeout      = 10 * time.Second
+)
+
+// SpanKind is the OpenTelemetry kind of a span
+type SpanKind = trace.SpanKind
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+)
+
+// activeTracer is the tracer installed by Start, nil when tracing is disabled
+var activeTracer atomic.Pointer[Tracer]
+
+// traceContext propagates the trace context in the W3C traceparent and tracestate headers
+var traceContext = propagation.TraceContext{}
+
+// Span is a timed stage of a request. Spans of requests that are not sampled
+// only carry the trace context to the backends. All methods are no-ops on a nil Span.
+type Span struct {
+	span trace.Span
+}
+
+// SetAttributes sets attributes on the span from alternating keys and values
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil || !s.span.IsRecording() {
+		return
+	}
+	attrs := make([]attribute.KeyValue, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		attrs = append(attrs, spanAttribute(fmt.Sprint(kv[i]), kv[i+1]))
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// RecordError marks the span as failed with err, if not nil. The status of
+// spans without errors is left unset.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+func spanAttribute(key string, v interface{}) attribute.KeyValue {
+	switch val := v.(type) {
+	case string:
+		return attribute.String(key, val)
+	case bool:
+		return attribute.Bool(key, val)
+	case int:
+		return attribute.Int(key, val)
+	case int64:
+		return attribute.Int64(key, val)
+	case uint64:
+		return attribute.Int64(key, int64(val))
+	case float64:
+		return attribute.Float64(key, val)
+	default:
+		return attribute.String(key, fmt.Sprint(val))
+	}
+}
+
+// SpanFromContext returns the current span of the context, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if activeTracer.Load() == nil || !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// ContextWithTraceContext continues the trace of the traceparent header of an incoming request
+func ContextWithTraceContext(ctx context.Context, header http.Header) context.Context {
+	if activeTracer.Load() == nil {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// StartSpan starts a span as a child of the current span of the context,
+// and returns a context carrying the new span. It returns a nil span when
+// tracing is disabled.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := activeTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &Span{span: span}
+}
+
+// InjectTraceContext sets the traceparent header of an outgoing request to the current span
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	if activeTracer.Load() == nil {
+		return
+	}
+	traceContext.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Tracer records the spans of sampled requests and exports them in batches
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	stopOnce sync.Once
+}
+
+func NewTracer(cfg TracingConfig) (*Tracer, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("tracing sample_ratio must be between 0 and 1, got %v", cfg.SampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case TracingExporterOTLP:
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = defaultTracingEndpoint
+		}
+		endpoint, err := ReadFromEnvOrConfig(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		headers := make(map[string]string, len(cfg.Headers))
+		for name, value := range cfg.Headers {
+			value, err := ReadFromEnvOrConfig(value)
+			if err != nil {
+				return nil, err
+			}
+			headers[name] = value
+		}
+		exporter, err = otlptracehttp.New(
+			context.Background(),
+			otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"),
+			otlptracehttp.WithHeaders(headers),
+			otlptracehttp.WithTimeout(tracingExportTimeout),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating otlp exporter: %w", err)
+		}
+	case TracingExporterStdout:
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("error creating stdout exporter: %w", err)
+		}
+	case TracingExporterNone:
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter %q", cfg.Exporter)
+	}
+	return newTracer(cfg, exporter), nil
+}
+
+func newTracer(cfg TracingConfig, exporter sdktrace.SpanExporter) *Tracer {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultTracingServiceName
+	}
+	sampleRatio := cfg.SampleRatio
+	if sampleRatio == 0 {
+		sampleRatio = 1
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+		// requests continuing a trace follow the sampling decision of their caller
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(
+			&metricsExporter{SpanExporter: exporter},
+			sdktrace.WithMaxQueueSize(tracingQueueSize),
+			sdktrace.WithMaxExportBatchSize(tracingBatchSize),
+			sdktrace.WithBatchTimeout(tracingFlushInterval),
+			sdktrace.WithExportTimeout(tracingExportTimeout),
+		))
+	}
+	provider := sdktrace.NewTracerProvider(opts...)
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer("proxyd"),
+	}
+}
+
+// Start installs the tracer for the spans started by StartSpan
+func (t *Tracer) Start() {
+	activeTracer.Store(t)
+}
+
+// Stop uninstalls the tracer and exports the spans still queued
+func (t *Tracer) Stop() {
+	t.stopOnce.Do(func() {
+		activeTracer.CompareAndSwap(t, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), tracingExportTimeout)
+		defer cancel()
+		if err := t.provider.Shutdown(ctx); err != nil {
+			log.Warn("error shutting down tracer", "err", err)
+		}
+	})
+}
+
+// metricsExporter counts the spans exported and the ones that failed to export
+type metricsExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e *metricsExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if err := e.SpanExporter.ExportSpans(ctx, spans); err != nil {
+		log.Warn("error exporting trace spans", "spans", len(spans), "err", err)
+		RecordTracingSpansDropped(len(spans))
+		return err
+	}
+	RecordTracingSpansExported(len(spans))
+	return nil
+}
@@ -0,0 +1,80 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracerSampling(t *testing.T) {
+	tr := newTracer(TracingConfig{SampleRatio: 0.25}, nil)
+	tr.Start()
+	defer tr.Stop()
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		_, span := StartSpan(context.Background(), "root", SpanKindServer)
+		if span.span.SpanContext().IsSampled() {
+			sampled++
+		}
+		span.End()
+	}
+	require.InDelta(t, 2500, sampled, 300)
+
+	_, err := NewTracer(TracingConfig{Exporter: TracingExporterNone, SampleRatio: 2})
+	require.Error(t, err)
+	_, err = NewTracer(TracingConfig{Exporter: "jaeger"})
+	require.Error(t, err)
+}
+
+func TestTracerSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tr := newTracer(TracingConfig{}, exporter)
+
+	// spans are nil until the tracer is started
+	_, span := StartSpan(context.Background(), "disabled", SpanKindInternal)
+	require.Nil(t, span)
+	span.SetAttributes("key", "value")
+	span.End()
+
+	tr.Start()
+	incoming := http.Header{"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx := ContextWithTraceContext(context.Background(), incoming)
+	ctx, parent := StartSpan(ctx, "parent", SpanKindServer)
+	childCtx, child := StartSpan(ctx, "child", SpanKindClient)
+	child.SetAttributes("proxyd.backend", "good", "proxyd.attempt", 1)
+	child.RecordError(errors.New("boom"))
+
+	header := make(http.Header)
+	InjectTraceContext(childCtx, header)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+child.span.SpanContext().SpanID().String()+"-01", header.Get("traceparent"))
+
+	child.End()
+	parent.End()
+	require.NoError(t, tr.provider.ForceFlush(context.Background()))
+	defer tr.Stop()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	require.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	require.Equal(t, "00f067aa0ba902b7", spans[1].Parent.SpanID().String())
+	require.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Equal(t, "boom", spans[0].Status.Description)
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("proxyd.backend", "good"),
+		attribute.Int("proxyd.attempt", 1),
+	}, spans[0].Attributes)
+
+	// spans without errors leave their status unset
+	require.Equal(t, codes.Unset, spans[1].Status.Code)
+}
@@ -0,0 +1,184 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// defaultTxMaxSizeBytes matches the maximum size of a transaction in the geth pool
+	defaultTxMaxSizeBytes = 4 * 32 * 1024
+	txDedupeKeyPrefix     = "tx_dedupe:"
+	txSenderOther         = "other"
+)
+
+// txPolicy checks the transactions sent through eth_sendRawTransaction before they reach
+// the backends, and answers the retries of a transaction already sent with its hash
+type txPolicy struct {
+	allowedChainIds []*big.Int
+	minGasPrice     *big.Int
+	minTip          *big.Int
+	maxSize         uint64
+	allowBlobs      bool
+	deniedSenders   map[common.Address]bool
+	meteredSenders  map[common.Address]bool
+	// dedupe stores the result of the transactions sent, it is nil when deduplication is disabled
+	dedupe Cache
+}
+
+func newTxPolicy(cfg TxPolicyConfig, dedupe Cache) (*txPolicy, error) {
+	deniedSenders, err := parseAddresses(cfg.DeniedSenders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx_policy denied_senders: %w", err)
+	}
+	meteredSenders, err := parseAddresses(cfg.MeteredSenders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx_policy metered_senders: %w", err)
+	}
+	p := &txPolicy{
+		allowedChainIds: cfg.AllowedChainIds,
+		minGasPrice:     new(big.Int).SetUint64(cfg.MinGasPriceWei),
+		minTip:          new(big.Int).SetUint64(cfg.MinTipWei),
+		maxSize:         cfg.MaxSizeBytes,
+		allowBlobs:      cfg.AllowBlobs,
+		deniedSenders:   deniedSenders,
+		meteredSenders:  meteredSenders,
+		dedupe:          dedupe,
+	}
+	if p.maxSize == 0 {
+		p.maxSize = defaultTxMaxSizeBytes
+	}
+	return p, nil
+}
+
+func parseAddresses(addrs []string) (map[common.Address]bool, error) {
+	parsed := make(map[common.Address]bool, len(addrs))
+	for _, addr := range addrs {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("%s is not an address", addr)
+		}
+		parsed[common.HexToAddress(addr)] = true
+	}
+	return parsed, nil
+}
+
+// check rejects a transaction that breaks the policy. It returns the response of the
+// original transaction if the same transaction was already sent in the dedupe window.
+func (p *txPolicy) check(ctx context.Context, req *RPCReq, tx *types.Transaction) (*RPCRes, error) {
+	if !isAllowedChainId(p.allowedChainIds, tx.ChainId()) {
+		log.Debug("chain id is not allowed", "req_id", GetReqID(ctx))
+		RecordTxPolicyTransaction(txSenderOther, "chain_id")
+		return nil, txpool.ErrInvalidSender
+	}
+
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		log.Debug("could not get sender from transaction", "err", err, "req_id", GetReqID(ctx))
+		RecordTxPolicyTransaction(txSenderOther, "invalid_sender")
+		return nil, ErrInvalidParams(err.Error())
+	}
+	sender := txSenderOther
+	if p.meteredSenders[from] {
+		sender = from.Hex()
+	}
+
+	var result string
+	var rejectErr error
+	switch {
+	case p.deniedSenders[from]:
+		result, rejectErr = "denied", ErrSenderDenied
+	case tx.Type() == types.BlobTxType && !p.allowBlobs:
+		result, rejectErr = "blob", types.ErrTxTypeNotSupported
+	case tx.Size() > p.maxSize:
+		result, rejectErr = "oversized", txpool.ErrOversizedData
+	case tx.GasFeeCapIntCmp(p.minGasPrice) < 0:
+		result, rejectErr = "gas_price", txpool.ErrUnderpriced
+	case tx.GasTipCapIntCmp(p.minTip) < 0:
+		result, rejectErr = "tip", txpool.ErrUnderpriced
+	}
+	if rejectErr != nil {
+		log.Debug("transaction rejected by tx policy",
+			"req_id", GetReqID(ctx),
+			"sender", from.Hex(),
+			"tx_hash", tx.Hash().Hex(),
+			"reason", result,
+		)
+		RecordTxPolicyTransaction(sender, result)
+		return nil, rejectErr
+	}
+
+	if p.dedupe != nil {
+		val, err := p.dedupe.Get(ctx, txDedupeKeyPrefix+tx.Hash().Hex())
+		if err != nil {
+			log.Warn("error reading tx dedupe", "req_id", GetReqID(ctx), "err", err)
+		}
+		if val != "" {
+			log.Debug("deduplicated transaction", "req_id", GetReqID(ctx), "sender", from.Hex(), "tx_hash", tx.Hash().Hex())
+			RecordTxPolicyTransaction(sender, "deduped")
+			return NewRPCRes(req.ID, json.RawMessage(val)), nil
+		}
+	}
+
+	RecordTxPolicyTransaction(sender, "accepted")
+	return nil, nil
+}
+
+// markSent remembers the result of a transaction, so that its retries aren't sent again
+func (p *txPolicy) markSent(ctx context.Context, hash common.Hash, res *RPCRes) {
+	if p.dedupe == nil || res.IsError() || res.Result == nil {
+		return
+	}
+	if err := p.dedupe.Put(ctx, txDedupeKeyPrefix+hash.Hex(), string(mustMarshalJSON(res.Result))); err != nil {
+		log.Warn("error writing tx dedupe", "req_id", GetReqID(ctx), "err", err)
+	}
+}
+
+// decodeRawTransaction inflates the transaction sent by an eth_sendRawTransaction request
+func decodeRawTransaction(ctx context.Context, req *RPCReq) (*types.Transaction, error) {
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		log.Debug("error unmarshalling raw transaction params", "err", err, "req_Id", GetReqID(ctx))
+		return nil, ErrParseErr
+	}
+
+	if len(params) != 1 {
+		log.Debug("raw transaction request has invalid number of params", "req_id", GetReqID(ctx))
+		// The error below is identical to the one Geth responds with.
+		return nil, ErrInvalidParams("missing value for required argument 0")
+	}
+
+	var data hexutil.Bytes
+	if err := data.UnmarshalText([]byte(params[0])); err != nil {
+		log.Debug("error decoding raw tx data", "err", err, "req_id", GetReqID(ctx))
+		// Geth returns the raw error from UnmarshalText.
+		return nil, ErrInvalidParams(err.Error())
+	}
+
+	// Inflates a types.Transaction object from the transaction's raw bytes.
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		log.Debug("could not unmarshal transaction", "err", err, "req_id", GetReqID(ctx))
+		return nil, ErrInvalidParams(err.Error())
+	}
+	return tx, nil
+}
+
+func isAllowedChainId(allowedChainIds []*big.Int, chainId *big.Int) bool {
+	if len(allowedChainIds) == 0 {
+		return true
+	}
+	for _, id := range allowedChainIds {
+		if chainId.Cmp(id) == 0 {
+			return true
+		}
+	}
+	return false
+}
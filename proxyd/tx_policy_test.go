@@ -0,0 +1,91 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func signTx(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int, txData types.TxData) *types.Transaction {
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(chainID), txData)
+	require.NoError(t, err)
+	return tx
+}
+
+func TestTxPolicyCheck(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	deniedKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	chainID := big.NewInt(10)
+
+	p, err := newTxPolicy(TxPolicyConfig{
+		AllowedChainIds: []*big.Int{chainID},
+		MinGasPriceWei:  100,
+		MinTipWei:       10,
+		MaxSizeBytes:    1024,
+		DeniedSenders:   []string{crypto.PubkeyToAddress(deniedKey.PublicKey).Hex()},
+	}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+		err  error
+	}{
+		{"accepted", signTx(t, key, chainID, &types.DynamicFeeTx{ChainID: chainID, GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(10)}), nil},
+		{"legacy", signTx(t, key, chainID, &types.LegacyTx{GasPrice: big.NewInt(100)}), nil},
+		{"other chain", signTx(t, key, big.NewInt(1), &types.DynamicFeeTx{ChainID: big.NewInt(1), GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(10)}), txpool.ErrInvalidSender},
+		{"denied sender", signTx(t, deniedKey, chainID, &types.DynamicFeeTx{ChainID: chainID, GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(10)}), ErrSenderDenied},
+		{"gas price", signTx(t, key, chainID, &types.DynamicFeeTx{ChainID: chainID, GasFeeCap: big.NewInt(99), GasTipCap: big.NewInt(10)}), txpool.ErrUnderpriced},
+		{"legacy gas price", signTx(t, key, chainID, &types.LegacyTx{GasPrice: big.NewInt(99)}), txpool.ErrUnderpriced},
+		{"tip", signTx(t, key, chainID, &types.DynamicFeeTx{ChainID: chainID, GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(9)}), txpool.ErrUnderpriced},
+		{"oversized", signTx(t, key, chainID, &types.DynamicFeeTx{ChainID: chainID, GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(10), Data: make([]byte, 1024)}), txpool.ErrOversizedData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := p.check(context.Background(), &RPCReq{ID: json.RawMessage("1")}, tt.tx)
+			require.Nil(t, res)
+			require.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestTxPolicyDedupe(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	p, err := newTxPolicy(TxPolicyConfig{}, newMemoryCacheWithTTL(time.Minute))
+	require.NoError(t, err)
+	ctx := context.Background()
+	tx := signTx(t, key, big.NewInt(10), &types.DynamicFeeTx{ChainID: big.NewInt(10)})
+	req := &RPCReq{ID: json.RawMessage("1")}
+
+	res, err := p.check(ctx, req, tx)
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	// failed sends can be retried
+	p.markSent(ctx, tx.Hash(), NewRPCErrorRes(req.ID, ErrNoBackends))
+	res, err = p.check(ctx, req, tx)
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	p.markSent(ctx, tx.Hash(), NewRPCRes(req.ID, tx.Hash().Hex()))
+	res, err = p.check(ctx, &RPCReq{ID: json.RawMessage("2")}, tx)
+	require.NoError(t, err)
+	require.Equal(t, json.RawMessage("2"), res.ID)
+	require.Equal(t, `"`+tx.Hash().Hex()+`"`, string(res.Result.(json.RawMessage)))
+}
+
+func TestNewTxPolicyInvalidSender(t *testing.T) {
+	_, err := newTxPolicy(TxPolicyConfig{DeniedSenders: []string{"0x123"}}, nil)
+	require.Error(t, err)
+}
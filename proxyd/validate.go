@@ -0,0 +1,218 @@
+package proxyd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/semaphore"
+)
+
+// ValidateConfig runs the checks Start performs on a config without connecting to Redis or
+// to the backends, and returns every problem found instead of the first one. Like Start, it
+// resolves the routing strategies of the backend groups in place.
+func ValidateConfig(config *Config) []error {
+	_, errs := buildDryServer(config)
+	return errs
+}
+
+// buildDryServer builds the server Start would, with in-memory rate limits and caches, and
+// without starting it, the consensus pollers or the health checks. The parts of the config
+// that fail to build are left out, and the problems are returned.
+func buildDryServer(config *Config) (*Server, []error) {
+	errs := append(routingConfigErrors(config), serverConfigErrors(config)...)
+	check := func(err error) bool {
+		if err != nil {
+			errs = append(errs, err)
+			return false
+		}
+		return true
+	}
+
+	for _, authKey := range sortedKeys(config.Authentication) {
+		if authKey != "none" {
+			_, err := ReadFromEnvOrConfig(authKey)
+			check(err)
+		}
+	}
+
+	if config.Tracing.Exporter != "" {
+		tracer, err := NewTracer(config.Tracing)
+		check(err)
+		if tracer != nil {
+			tracer.Stop()
+		}
+	}
+
+	// the redis clients only connect once used, they are only created to check their URLs
+	var redisClient redis.UniversalClient
+	if config.Redis.URL != "" {
+		redisClient = checkRedisURL(config.Redis.URL, config.Redis.RedisCluster, check)
+		if redisClient != nil {
+			defer redisClient.Close()
+		}
+	}
+	if config.Redis.ReadURL != "" && config.Redis.URL != "" {
+		if readClient := checkRedisURL(config.Redis.ReadURL, config.Redis.RedisCluster, check); readClient != nil {
+			_ = readClient.Close()
+		}
+	}
+
+	backendsByName := make(map[string]*Backend)
+	rpcRequestSemaphore := semaphore.NewWeighted(math.MaxInt64)
+	for _, name := range sortedKeys(config.Backends) {
+		be, err := buildBackend(name, config.Backends[name], config.BackendOptions, rpcRequestSemaphore)
+		if !check(err) {
+			// keep it defined, so that its groups are still checked
+			be = &Backend{Name: name}
+		}
+		backendsByName[name] = be
+	}
+
+	backendGroups := make(map[string]*BackendGroup)
+	for _, bgName := range sortedKeys(config.BackendGroups) {
+		bgcfg := config.BackendGroups[bgName]
+		bg, err := buildBackendGroup(bgName, bgcfg, backendsByName)
+		if !check(err) {
+			bg = &BackendGroup{Name: bgName, routingStrategy: bgcfg.RoutingStrategy}
+		}
+		backendGroups[bgName] = bg
+		check(validateConsensus(bgName, bgcfg))
+		_, err = validateHealthCheck(bgName, bgcfg)
+		check(err)
+	}
+
+	wsBackendGroup, err := resolveWSBackendGroup(config, backendGroups)
+	check(err)
+
+	var rpcCache RPCCache
+	if config.Cache.Enabled {
+		newCache := func(ttl time.Duration) Cache {
+			return newCacheWithCompression(newMemoryCacheWithTTL(ttl))
+		}
+		finalizedHandlers := make(map[string]*FinalizedBlockMethodHandler)
+		for _, method := range sortedKeys(config.Cache.FinalizedMethods) {
+			if !IsFinalizedCacheMethod(method) {
+				check(fmt.Errorf("method %s is not supported by the finalized cache", method))
+				continue
+			}
+			methodCfg := config.Cache.FinalizedMethods[method]
+			finalizedHandlers[method] = NewFinalizedBlockMethodHandler(newCache(time.Duration(methodCfg.TTL)), methodCfg.MaxSizeBytes)
+		}
+		rpcCache = newRPCCache(newCache(0), finalizedHandlers, nil)
+	}
+
+	limiterFactory := func(dur time.Duration, max int, prefix string, algorithm string) FrontendRateLimiter {
+		return NewMemoryRateLimiter(algorithm, dur, max)
+	}
+
+	srv, err := NewServer(
+		backendGroups,
+		wsBackendGroup,
+		NewStringSetFromStrings(config.WSMethodWhitelist),
+		config.RPCMethodMappings,
+		config.Server.MaxBodySizeBytes,
+		nil,
+		secondsToDuration(config.Server.TimeoutSeconds),
+		config.Server.MaxUpstreamBatchSize,
+		config.Server.EnableXServedByHeader,
+		rpcCache,
+		config.RateLimit,
+		config.SenderRateLimit,
+		config.Server.EnableRequestLog,
+		config.Server.MaxRequestBodyLogLen,
+		config.BatchConfig.MaxSize,
+		limiterFactory,
+	)
+	if !check(err) {
+		return nil, errs
+	}
+	srv.config = config
+
+	// the routing rules were checked with the routing config
+	srv.routingRules, _ = buildRoutingRules(config.RoutingRules)
+
+	srv.pathRoutes, err = buildPathRoutes(config.PathRoutes, srv.maxBodySize, limiterFactory)
+	check(err)
+
+	if config.TxPolicy.Enabled {
+		srv.txPolicy, err = newTxPolicy(config.TxPolicy, nil)
+		check(err)
+	}
+
+	if config.Capture.Dir != "" {
+		check(validateCaptureConfig(config.Capture))
+	}
+
+	if config.APIKeys.Enabled() {
+		_, err := NewAPIKeyStore(config.APIKeys, redisClient, config.Redis.Namespace, limiterFactory)
+		check(err)
+	}
+
+	if config.JWTAuth.Enabled() {
+		_, err := NewJWTAuthenticator(config.JWTAuth, limiterFactory)
+		check(err)
+	} else if len(config.JWTAuth.Policies) > 0 {
+		check(errors.New("jwt_auth has policies but neither a secret nor a jwks file"))
+	}
+
+	if config.Admin.Port != 0 {
+		if len(config.Admin.Authentication) == 0 {
+			check(errors.New("admin server requires at least one authentication token"))
+		}
+		for _, secret := range sortedKeys(config.Admin.Authentication) {
+			_, err := ReadFromEnvOrConfig(secret)
+			check(err)
+		}
+	}
+
+	return srv, errs
+}
+
+// validateConsensus runs the checks of configureConsensus that don't need the backend group
+func validateConsensus(bgName string, bgcfg *BackendGroupConfig) error {
+	if bgcfg.RoutingStrategy != ConsensusAwareRoutingStrategy || !bgcfg.ConsensusHA {
+		return nil
+	}
+	if len(bgcfg.ConsensusHAPeers) > 0 {
+		if bgcfg.ConsensusHAPeerURL != "" && !slices.Contains(bgcfg.ConsensusHAPeers, bgcfg.ConsensusHAPeerURL) {
+			return fmt.Errorf("consensus HA peer %s of backend group %s is not in its list of peers", bgcfg.ConsensusHAPeerURL, bgName)
+		}
+		_, err := ReadFromEnvOrConfig(bgcfg.ConsensusHAPeerToken)
+		return err
+	}
+	if bgcfg.ConsensusHARedis.URL == "" {
+		return nil
+	}
+	client, err := NewRedisClient(bgcfg.ConsensusHARedis.URL, bgcfg.ConsensusHARedis.RedisCluster)
+	if err != nil {
+		return fmt.Errorf("invalid consensus_ha_redis url of backend group %s: %w", bgName, err)
+	}
+	return client.Close()
+}
+
+// checkRedisURL resolves and parses a Redis URL, it returns a client that hasn't connected yet
+func checkRedisURL(url string, cluster bool, check func(error) bool) redis.UniversalClient {
+	rURL, err := ReadFromEnvOrConfig(url)
+	if !check(err) {
+		return nil
+	}
+	client, err := NewRedisClient(rURL, cluster)
+	if !check(err) {
+		return nil
+	}
+	return client
+}
+
+func sortedKeys[M ~map[string]V, V any](m M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package proxyd
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeTestConfig(t *testing.T, s string) *Config {
+	config := new(Config)
+	_, err := toml.Decode(s, config)
+	require.NoError(t, err)
+	return config
+}
+
+const validTestConfig = `
+[backends.a]
+rpc_url = "http://a"
+[backends.b]
+rpc_url = "http://b"
+
+[backend_groups.main]
+backends = ["a", "b"]
+fallbacks = ["b"]
+routing_strategy = "consensus_aware"
+
+[rpc_method_mappings]
+eth_chainId = "main"
+`
+
+func TestValidateConfig(t *testing.T) {
+	require.Empty(t, ValidateConfig(decodeTestConfig(t, validTestConfig)))
+
+	errs := ValidateConfig(decodeTestConfig(t, `
+[server]
+ws_port = 8546
+
+[backends.a]
+rpc_url = "$VALIDATE_TEST_UNSET"
+[backends.b]
+rpc_url = "http://b"
+consensus_receipts_target = "foo"
+
+[backend_groups.main]
+backends = ["a", "b"]
+consensus_aware = true
+routing_strategy = "fallback"
+[backend_groups.fallbacks]
+backends = ["a"]
+fallbacks = ["c"]
+[backend_groups.empty]
+backends = []
+[backend_groups.health]
+backends = ["b"]
+health_check_method = "eth_blockNumber"
+
+[rpc_method_mappings]
+eth_chainId = "main"
+eth_call = "missing"
+
+[rate_limit]
+base_rate = 10
+base_interval = "1s"
+base_algorithm = "leaky_bucket"
+
+[cache]
+enabled = true
+[cache.finalized_methods.eth_chainId]
+
+[jwt_auth.policies.basic]
+backend_group = "missing"
+`))
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.ElementsMatch(t, []string{
+		"undefined backend group missing for method eth_call",
+		"consensus_aware and routing_strategy are mutually exclusive, they cannot both be defined for backend group main",
+		"config env var $VALIDATE_TEST_UNSET not found",
+		"invalid receipts target: foo",
+		"backend group empty must have at least one backend",
+		"fallback c of backend group fallbacks is not one of its backends",
+		"health checks of backend group health require health_check_interval",
+		"a ws port was defined, but no ws group was defined",
+		"method eth_chainId is not supported by the finalized cache",
+		`rate_limit: invalid rate limit algorithm "leaky_bucket", valid options: fixed_window, sliding_window, token_bucket`,
+		"undefined backend group missing for jwt policy basic",
+	}, messages)
+}
+
+func TestValidateConfigNoPrimaries(t *testing.T) {
+	config := decodeTestConfig(t, validTestConfig)
+	config.BackendGroups["main"].Fallbacks = []string{"a", "b"}
+	errs := ValidateConfig(config)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "backend group main has no primary backends, all of them are fallbacks")
+}
+
+func TestValidateConfigJWTAuth(t *testing.T) {
+	config := decodeTestConfig(t, validTestConfig)
+	config.JWTAuth.Policies = map[string]*JWTPolicyConfig{"basic": {}}
+	errs := ValidateConfig(config)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "jwt_auth has policies but neither a secret nor a jwks file")
+
+	config = decodeTestConfig(t, validTestConfig)
+	config.JWTAuth.Secret = "secret"
+	config.JWTAuth.Policies = map[string]*JWTPolicyConfig{"basic": {}}
+	config.Backends["a"].JWTSecret = "0x1234"
+	errs = ValidateConfig(config)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "backend a: invalid jwt secret: must be 32 bytes, got 2")
+}
+
+func TestValidateConfigConsensusHAPeers(t *testing.T) {
+	config := decodeTestConfig(t, validTestConfig)
+	bg := config.BackendGroups["main"]
+	bg.ConsensusHA = true
+	bg.ConsensusHAPeers = []string{"http://proxyd-0:8545", "http://proxyd-1:8545"}
+	bg.ConsensusHAPeerURL = "http://proxyd-0:8545"
+	errs := ValidateConfig(config)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "must specify consensus_ha_peer_token when consensus_ha_peers is set for backend group main")
+
+	bg.ConsensusHAPeerToken = "secret"
+	require.Empty(t, ValidateConfig(config))
+}
+
+func TestValidateConfigServerChecks(t *testing.T) {
+	config := decodeTestConfig(t, validTestConfig)
+	config.Authentication = map[string]string{"none": "none"}
+	config.Redis.ReadURL = "redis://replica:6379"
+	config.RateLimit.UseRedis = true
+	config.SenderRateLimit.Enabled = true
+
+	expected := []string{
+		"cannot use none as an auth key",
+		"must specify a Redis primary URL. only read endpoint is set",
+		"must specify a Redis URL if UseRedis is true in rate limit config",
+		"limit in sender_rate_limit must be > 0",
+		"interval in sender_rate_limit must be >= 1s",
+	}
+	messages := make([]string, 0, len(expected))
+	for _, err := range ValidateConfig(config) {
+		messages = append(messages, err.Error())
+	}
+	require.ElementsMatch(t, expected, messages)
+
+	// Start fails on the first of them
+	_, _, err := Start(config)
+	require.EqualError(t, err, expected[0])
+}
@@ -0,0 +1,343 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const wsFailoverRounds = 3
+
+// wsProxiedSubscription is an eth_subscribe subscription of a proxied client.
+// The client keeps seeing the ID given by the first backend, while upstreamID
+// is the ID on the current backend, or empty while it's being recreated.
+type wsProxiedSubscription struct {
+	params     json.RawMessage
+	upstreamID string
+}
+
+func (w *WSProxier) canFailover() bool {
+	return w.bg != nil && !w.closing.Load()
+}
+
+func (w *WSProxier) currentBackend() *Backend {
+	w.backendConnMu.Lock()
+	defer w.backendConnMu.Unlock()
+	return w.backend
+}
+
+// trackSubscribe remembers an eth_subscribe call of the client until the
+// backend responds to it
+func (w *WSProxier) trackSubscribe(req *RPCReq) {
+	if w.bg == nil {
+		return
+	}
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	w.pendingSubs[string(req.ID)] = req.Params
+}
+
+// trackCall remembers a call of the client until the backend responds to it
+func (w *WSProxier) trackCall(req *RPCReq) {
+	if w.bg == nil {
+		return
+	}
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	w.inflight[string(req.ID)]++
+}
+
+// untrackCall forgets a call of the client, and returns false if it was
+// already answered
+func (w *WSProxier) untrackCall(id json.RawMessage) bool {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	return w.untrackCallLocked(string(id))
+}
+
+func (w *WSProxier) untrackCallLocked(id string) bool {
+	n, ok := w.inflight[id]
+	if !ok {
+		return false
+	}
+	if n > 1 {
+		w.inflight[id] = n - 1
+	} else {
+		delete(w.inflight, id)
+	}
+	return true
+}
+
+// failInflight answers the calls written to the failed backend connection,
+// which won't get a response anymore
+func (w *WSProxier) failInflight() error {
+	w.subsMu.Lock()
+	inflight := w.inflight
+	w.inflight = make(map[string]int)
+	w.subsMu.Unlock()
+
+	for id, n := range inflight {
+		msg := mustMarshalJSON(NewRPCErrorRes(json.RawMessage(id), ErrBackendOffline))
+		for i := 0; i < n; i++ {
+			if err := w.writeClientConn(websocket.TextMessage, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// trackUnsubscribe forgets the subscription cancelled by an eth_unsubscribe call,
+// and returns the message to forward with the ID the current backend knows the
+// subscription by. When the subscription is being recreated, the call is answered
+// by proxyd, and the response is returned instead.
+func (w *WSProxier) trackUnsubscribe(req *RPCReq, msg []byte) ([]byte, *RPCRes) {
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		return msg, nil
+	}
+
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	sub := w.subs[params[0]]
+	if sub == nil {
+		return msg, nil
+	}
+	delete(w.subs, params[0])
+	if sub.upstreamID == "" {
+		return nil, NewRPCRes(req.ID, true)
+	}
+	delete(w.upstreamSubs, sub.upstreamID)
+	if sub.upstreamID == params[0] {
+		return msg, nil
+	}
+	rewritten := *req
+	rewritten.Params = mustMarshalJSON([]string{sub.upstreamID})
+	return mustMarshalJSON(&rewritten), nil
+}
+
+// trackBackendMsg records the subscriptions created by a backend message and
+// returns the message to forward to the client, with subscription IDs rewritten
+// to the ones the client knows. It returns nil for responses to proxyd's own calls.
+func (w *WSProxier) trackBackendMsg(msg []byte) []byte {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	if len(w.pendingSubs) == 0 && len(w.resubscribing) == 0 && len(w.inflight) == 0 && !w.failedOver {
+		return msg
+	}
+
+	var m wsUpstreamMessage
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return msg
+	}
+
+	if m.Method == "eth_subscription" {
+		clientID, ok := w.upstreamSubs[m.Params.Subscription]
+		if !ok || clientID == m.Params.Subscription {
+			return msg
+		}
+		return mustMarshalJSON(map[string]interface{}{
+			"jsonrpc": JSONRPCVersion,
+			"method":  "eth_subscription",
+			"params": map[string]interface{}{
+				"subscription": clientID,
+				"result":       m.Params.Result,
+			},
+		})
+	}
+
+	id := string(m.ID)
+	if clientID, ok := w.resubscribing[id]; ok {
+		delete(w.resubscribing, id)
+		if clientID == "" {
+			return nil
+		}
+		sub := w.subs[clientID]
+		var upstreamID string
+		if m.Error != nil || json.Unmarshal(m.Result, &upstreamID) != nil {
+			log.Warn("error recreating ws subscription", "backend_group", w.bg.Name, "subscription", clientID, "err", m.Error)
+			delete(w.subs, clientID)
+			return nil
+		}
+		if sub == nil {
+			// cancelled by the client while it was being recreated
+			go w.unsubscribeUpstream(upstreamID)
+			return nil
+		}
+		sub.upstreamID = upstreamID
+		w.upstreamSubs[upstreamID] = clientID
+		return nil
+	}
+
+	w.untrackCallLocked(id)
+	if params, ok := w.pendingSubs[id]; ok {
+		delete(w.pendingSubs, id)
+		var subID string
+		if m.Error == nil && json.Unmarshal(m.Result, &subID) == nil {
+			w.subs[subID] = &wsProxiedSubscription{params: params, upstreamID: subID}
+			w.upstreamSubs[subID] = subID
+		}
+	}
+	return msg
+}
+
+func (w *WSProxier) unsubscribeUpstream(upstreamID string) {
+	msg := mustMarshalJSON(&RPCReq{
+		JSONRPC: JSONRPCVersion,
+		Method:  "eth_unsubscribe",
+		Params:  mustMarshalJSON([]string{upstreamID}),
+		ID:      w.internalID(""),
+	})
+	if err := w.writeBackendConn(websocket.TextMessage, msg); err != nil {
+		log.Warn("error cancelling ws subscription", "backend_group", w.bg.Name, "err", err)
+	}
+}
+
+// internalID returns a request ID for a call made by proxyd, recreating the
+// given subscription if any. Responses to the IDs are not forwarded to the client.
+func (w *WSProxier) internalID(clientID string) json.RawMessage {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	return w.internalIDLocked(clientID)
+}
+
+func (w *WSProxier) internalIDLocked(clientID string) json.RawMessage {
+	w.nextInternalID++
+	id := json.RawMessage(fmt.Sprintf("\"proxyd_%d\"", w.nextInternalID))
+	w.resubscribing[string(id)] = clientID
+	return id
+}
+
+// failover replaces the failed backend connection with a connection to the next
+// backend of the group, and replays the subscriptions of the client on it.
+func (w *WSProxier) failover(ctx context.Context, cause error) error {
+	w.backendConnMu.Lock()
+	failed := w.backend
+	if w.backendConn != nil {
+		w.backendConn.Close()
+		w.backendConn = nil
+		activeBackendWsConnsGauge.WithLabelValues(failed.Name).Dec()
+	}
+	w.backendConnMu.Unlock()
+
+	log.Warn(
+		"ws backend connection failed, failing over",
+		"backend", failed.Name,
+		"backend_group", w.bg.Name,
+		"req_id", GetReqID(ctx),
+		"err", cause,
+	)
+	if err := w.failInflight(); err != nil {
+		return err
+	}
+
+	for i := 0; i < wsFailoverRounds; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(calcBackoff(i - 1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		for _, be := range w.failoverCandidates(failed) {
+			if w.closing.Load() {
+				return ErrBackendOffline
+			}
+			conn, err := be.dialWS()
+			if err != nil {
+				log.Warn("error dialing ws backend", "name", be.Name, "backend_group", w.bg.Name, "req_id", GetReqID(ctx), "err", err)
+				continue
+			}
+			if err := w.switchBackend(be, conn); err != nil {
+				log.Warn("error replaying ws subscriptions", "name", be.Name, "backend_group", w.bg.Name, "req_id", GetReqID(ctx), "err", err)
+				continue
+			}
+			RecordWSFailover(w.bg, failed, be)
+			log.Info("ws backend failover succeeded", "from", failed.Name, "to", be.Name, "backend_group", w.bg.Name, "req_id", GetReqID(ctx))
+			return nil
+		}
+	}
+
+	RecordWSFailoverError(w.bg, failed)
+	return ErrNoBackends
+}
+
+// failoverCandidates returns the backends to fail over to, with the failed
+// backend last in case it's the only one left
+func (w *WSProxier) failoverCandidates(failed *Backend) []*Backend {
+	ordered := w.bg.orderedBackendsForRequest()
+	candidates := make([]*Backend, 0, len(ordered))
+	retryFailed := false
+	for _, be := range ordered {
+		if be == failed {
+			retryFailed = true
+			continue
+		}
+		candidates = append(candidates, be)
+	}
+	if retryFailed {
+		candidates = append(candidates, failed)
+	}
+	return candidates
+}
+
+// switchBackend makes conn the backend connection of the proxier and replays
+// the subscriptions of the client on it. Client messages wait for the replay,
+// so that they don't overtake the subscriptions.
+func (w *WSProxier) switchBackend(be *Backend, conn *websocket.Conn) error {
+	w.backendConnMu.Lock()
+	defer w.backendConnMu.Unlock()
+	if w.closing.Load() {
+		conn.Close()
+		return ErrBackendOffline
+	}
+
+	for _, msg := range w.replayMsgs() {
+		err := conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+		if err == nil {
+			err = conn.WriteMessage(websocket.TextMessage, msg)
+		}
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	activeBackendWsConnsGauge.WithLabelValues(be.Name).Inc()
+	w.backendConn, w.backend = conn, be
+	return nil
+}
+
+// replayMsgs returns the eth_subscribe calls recreating the subscriptions of
+// the client, and the ones still waiting for a response
+func (w *WSProxier) replayMsgs() [][]byte {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	w.failedOver = true
+	w.upstreamSubs = make(map[string]string)
+	w.resubscribing = make(map[string]string)
+
+	msgs := make([][]byte, 0, len(w.subs)+len(w.pendingSubs))
+	for clientID, sub := range w.subs {
+		sub.upstreamID = ""
+		msgs = append(msgs, mustMarshalJSON(&RPCReq{
+			JSONRPC: JSONRPCVersion,
+			Method:  "eth_subscribe",
+			Params:  sub.params,
+			ID:      w.internalIDLocked(clientID),
+		}))
+	}
+	for id, params := range w.pendingSubs {
+		msgs = append(msgs, mustMarshalJSON(&RPCReq{
+			JSONRPC: JSONRPCVersion,
+			Method:  "eth_subscribe",
+			Params:  params,
+			ID:      json.RawMessage(id),
+		}))
+	}
+	return msgs
+}
@@ -0,0 +1,760 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsClientSendQueueSize = 128
+	// wsMaxEarlyNotifications caps the notifications kept for an upstream subscription whose
+	// ID isn't mapped yet, and wsMaxEarlySubscriptions the number of such subscriptions
+	wsMaxEarlyNotifications = 64
+	wsMaxEarlySubscriptions = 16
+)
+
+// wsSession proxies a client websocket until it's closed
+type wsSession interface {
+	Proxy(ctx context.Context) error
+}
+
+// upstreamSubscription is an eth_subscribe subscription on the upstream
+// connection, shared by every client subscribed with the same params
+type upstreamSubscription struct {
+	key     string
+	params  json.RawMessage
+	id      string
+	conn    *websocket.Conn
+	clients map[string]*MultiplexedWSProxier
+	// pending clients subscribed, but their eth_subscribe response isn't queued yet.
+	// Their notifications are kept in backlog until it is, see activate.
+	pending map[string]*MultiplexedWSProxier
+	backlog []json.RawMessage
+}
+
+func (sub *upstreamSubscription) numClients() int {
+	return len(sub.clients) + len(sub.pending)
+}
+
+type wsUpstreamMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCErr         `json:"error"`
+}
+
+type wsPendingCall struct {
+	conn *websocket.Conn
+	resC chan *wsUpstreamMessage
+}
+
+// WSSubscriptionMux shares upstream subscriptions between the client websockets
+// of a backend group. Clients subscribing with the same params share a single
+// upstream subscription, whose notifications are fanned out to every client
+// under a subscription ID of their own. When the upstream connection fails, it's
+// redialed on the next backend of the group and the subscriptions are recreated,
+// so clients only see a gap in notifications.
+type WSSubscriptionMux struct {
+	bg          *BackendGroup
+	callTimeout time.Duration
+
+	// opMu serializes the operations that need a round trip to the upstream connection
+	opMu sync.Mutex
+	// writeMu serializes writes to the upstream connection
+	writeMu sync.Mutex
+
+	mtx         sync.Mutex
+	conn        *websocket.Conn
+	backend     *Backend
+	subs        map[string]*upstreamSubscription
+	upstreamIDs map[string]*upstreamSubscription
+	clientSubs  map[string]*upstreamSubscription
+	pending     map[string]*wsPendingCall
+	sessions    map[*MultiplexedWSProxier]struct{}
+	// early holds the notifications of upstream subscription IDs that aren't mapped yet,
+	// as they can arrive before the call creating the subscription returns
+	early  map[string][]json.RawMessage
+	nextID uint64
+	closed bool
+	quit   chan struct{}
+}
+
+func NewWSSubscriptionMux(bg *BackendGroup) *WSSubscriptionMux {
+	return &WSSubscriptionMux{
+		bg:          bg,
+		callTimeout: defaultWSWriteTimeout,
+		subs:        make(map[string]*upstreamSubscription),
+		upstreamIDs: make(map[string]*upstreamSubscription),
+		clientSubs:  make(map[string]*upstreamSubscription),
+		pending:     make(map[string]*wsPendingCall),
+		sessions:    make(map[*MultiplexedWSProxier]struct{}),
+		early:       make(map[string][]json.RawMessage),
+		quit:        make(chan struct{}),
+	}
+}
+
+// SubscriptionMux returns the subscription multiplexer of the group, creating it on first use
+func (bg *BackendGroup) SubscriptionMux() *WSSubscriptionMux {
+	bg.subscriptionMuxMu.Lock()
+	defer bg.subscriptionMuxMu.Unlock()
+	if bg.subscriptionMux == nil {
+		bg.subscriptionMux = NewWSSubscriptionMux(bg)
+	}
+	return bg.subscriptionMux
+}
+
+// Subscribe subscribes the client session with the given eth_subscribe params, and returns
+// the subscription ID of the client. The client only gets notifications once activated,
+// the ones sent meanwhile are replayed then.
+func (m *WSSubscriptionMux) Subscribe(session *MultiplexedWSProxier, params json.RawMessage) (string, error) {
+	key, err := subscriptionKey(params)
+	if err != nil {
+		return "", ErrInvalidParams(err.Error())
+	}
+
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	m.mtx.Lock()
+	sub := m.subs[key]
+	m.mtx.Unlock()
+
+	var upstreamID string
+	if sub == nil {
+		conn, err := m.connect()
+		if err != nil {
+			return "", err
+		}
+		upstreamID, err = m.subscribeUpstream(conn, params)
+		if err != nil {
+			return "", err
+		}
+		sub = &upstreamSubscription{
+			key:     key,
+			params:  params,
+			conn:    conn,
+			clients: make(map[string]*MultiplexedWSProxier),
+			pending: make(map[string]*MultiplexedWSProxier),
+		}
+	}
+
+	clientID := "0x" + randStr(16)
+	m.mtx.Lock()
+	sub.pending[clientID] = session
+	m.clientSubs[clientID] = sub
+	if upstreamID != "" {
+		m.subs[key] = sub
+		m.mapUpstreamID(sub, upstreamID)
+	}
+	m.recordSubscriptions()
+	m.mtx.Unlock()
+	return clientID, nil
+}
+
+// activate starts sending the notifications of a subscription to its client, it's called
+// once the eth_subscribe response is queued so that the client knows the subscription ID
+// before its first notification
+func (m *WSSubscriptionMux) activate(session *MultiplexedWSProxier, clientID string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	sub := m.clientSubs[clientID]
+	if sub == nil || sub.pending[clientID] != session {
+		return
+	}
+	delete(sub.pending, clientID)
+	sub.clients[clientID] = session
+	for _, result := range sub.backlog {
+		session.notify(clientID, result)
+	}
+	if len(sub.pending) == 0 {
+		sub.backlog = nil
+	}
+}
+
+// mapUpstreamID routes the notifications of the upstream subscription ID to sub, and
+// delivers the ones that arrived before. It must be called with mtx held.
+func (m *WSSubscriptionMux) mapUpstreamID(sub *upstreamSubscription, id string) {
+	sub.id = id
+	m.upstreamIDs[id] = sub
+	early := m.early[id]
+	delete(m.early, id)
+	for _, result := range early {
+		m.deliver(sub, result)
+	}
+}
+
+// Unsubscribe removes a subscription of the client session. The upstream
+// subscription is cancelled once its last client is gone.
+func (m *WSSubscriptionMux) Unsubscribe(session *MultiplexedWSProxier, clientID string) bool {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	m.mtx.Lock()
+	sub := m.clientSubs[clientID]
+	if sub == nil || (sub.clients[clientID] != session && sub.pending[clientID] != session) {
+		m.mtx.Unlock()
+		return false
+	}
+	delete(sub.clients, clientID)
+	delete(sub.pending, clientID)
+	delete(m.clientSubs, clientID)
+	if len(sub.pending) == 0 {
+		sub.backlog = nil
+	}
+	last := sub.numClients() == 0
+	if last {
+		delete(m.subs, sub.key)
+		delete(m.upstreamIDs, sub.id)
+	}
+	m.recordSubscriptions()
+	conn := m.conn
+	m.mtx.Unlock()
+
+	if last && conn != nil && sub.conn == conn {
+		res, err := m.call(conn, "eth_unsubscribe", []string{sub.id})
+		if err != nil || res.Error != nil {
+			log.Warn("error cancelling upstream subscription", "backend_group", m.bg.Name, "err", err)
+		}
+	}
+	return true
+}
+
+// Close closes the upstream connection and every client session
+func (m *WSSubscriptionMux) Close() {
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.quit)
+	conn := m.conn
+	sessions := make([]*MultiplexedWSProxier, 0, len(m.sessions))
+	for session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mtx.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+	for _, session := range sessions {
+		session.clientConn.Close()
+	}
+}
+
+func (m *WSSubscriptionMux) addSession(session *MultiplexedWSProxier) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.sessions[session] = struct{}{}
+}
+
+func (m *WSSubscriptionMux) removeSession(session *MultiplexedWSProxier) {
+	m.mtx.Lock()
+	delete(m.sessions, session)
+	m.mtx.Unlock()
+
+	for _, clientID := range session.subscriptionIDs() {
+		m.Unsubscribe(session, clientID)
+	}
+}
+
+// connect returns the upstream connection, dialing the backends of the group
+// in order if there is none. It must be called with opMu held.
+func (m *WSSubscriptionMux) connect() (*websocket.Conn, error) {
+	m.mtx.Lock()
+	conn, closed := m.conn, m.closed
+	m.mtx.Unlock()
+	if closed {
+		return nil, ErrNoBackends
+	}
+	if conn != nil {
+		return conn, nil
+	}
+
+	for _, be := range m.bg.orderedBackendsForRequest() {
+		conn, _, err := be.dialer.Dial(be.wsURL, be.wsHeader()) // nolint:bodyclose
+		if err != nil {
+			log.Warn("error dialing ws backend", "name", be.Name, "backend_group", m.bg.Name, "err", err)
+			continue
+		}
+		activeBackendWsConnsGauge.WithLabelValues(be.Name).Inc()
+
+		m.mtx.Lock()
+		if m.closed {
+			m.mtx.Unlock()
+			conn.Close()
+			activeBackendWsConnsGauge.WithLabelValues(be.Name).Dec()
+			return nil, ErrNoBackends
+		}
+		m.conn, m.backend = conn, be
+		m.mtx.Unlock()
+
+		go m.readPump(conn, be)
+		return conn, nil
+	}
+	return nil, ErrNoBackends
+}
+
+func (m *WSSubscriptionMux) subscribeUpstream(conn *websocket.Conn, params json.RawMessage) (string, error) {
+	res, err := m.call(conn, "eth_subscribe", params)
+	if err != nil {
+		return "", err
+	}
+	if res.Error != nil {
+		return "", res.Error
+	}
+	var id string
+	if err := json.Unmarshal(res.Result, &id); err != nil {
+		return "", ErrBackendBadResponse
+	}
+	return id, nil
+}
+
+// call makes a call on the upstream connection and waits for its response
+func (m *WSSubscriptionMux) call(conn *websocket.Conn, method string, params interface{}) (*wsUpstreamMessage, error) {
+	m.mtx.Lock()
+	m.nextID++
+	id := strconv.FormatUint(m.nextID, 10)
+	pending := &wsPendingCall{conn: conn, resC: make(chan *wsUpstreamMessage, 1)}
+	m.pending[id] = pending
+	m.mtx.Unlock()
+	defer func() {
+		m.mtx.Lock()
+		delete(m.pending, id)
+		m.mtx.Unlock()
+	}()
+
+	req := &RPCReq{
+		JSONRPC: JSONRPCVersion,
+		Method:  method,
+		Params:  mustMarshalJSON(params),
+		ID:      json.RawMessage(id),
+	}
+	m.writeMu.Lock()
+	err := conn.SetWriteDeadline(time.Now().Add(defaultWSWriteTimeout))
+	if err == nil {
+		err = conn.WriteMessage(websocket.TextMessage, mustMarshalJSON(req))
+	}
+	m.writeMu.Unlock()
+	if err != nil {
+		return nil, ErrBackendOffline
+	}
+
+	timer := time.NewTimer(m.callTimeout)
+	defer timer.Stop()
+	select {
+	case res, ok := <-pending.resC:
+		if !ok {
+			return nil, ErrBackendOffline
+		}
+		return res, nil
+	case <-timer.C:
+		return nil, ErrGatewayTimeout
+	}
+}
+
+func (m *WSSubscriptionMux) readPump(conn *websocket.Conn, be *Backend) {
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			m.handleConnFailure(conn, be, err)
+			return
+		}
+		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+			continue
+		}
+		RecordWSMessage(context.Background(), be.Name, SourceBackend)
+
+		var upMsg wsUpstreamMessage
+		if err := json.Unmarshal(msg, &upMsg); err != nil {
+			log.Warn("error parsing upstream ws message", "backend", be.Name, "err", err)
+			continue
+		}
+		if upMsg.Method == "eth_subscription" {
+			m.fanOut(upMsg.Params.Subscription, upMsg.Params.Result)
+			continue
+		}
+
+		m.mtx.Lock()
+		pending := m.pending[string(upMsg.ID)]
+		delete(m.pending, string(upMsg.ID))
+		m.mtx.Unlock()
+		if pending != nil {
+			pending.resC <- &upMsg
+		}
+	}
+}
+
+func (m *WSSubscriptionMux) fanOut(upstreamID string, result json.RawMessage) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	sub := m.upstreamIDs[upstreamID]
+	if sub == nil {
+		// the subscription may not be mapped yet, notifications of cancelled
+		// subscriptions are dropped once there are too many unknown IDs
+		if _, ok := m.early[upstreamID]; !ok && len(m.early) >= wsMaxEarlySubscriptions {
+			m.early = make(map[string][]json.RawMessage)
+		}
+		m.early[upstreamID] = appendBounded(m.early[upstreamID], result, wsMaxEarlyNotifications)
+		return
+	}
+	m.deliver(sub, result)
+}
+
+// deliver sends a notification to the active clients of sub, and keeps it for the pending
+// ones. It must be called with mtx held, notify doesn't block.
+func (m *WSSubscriptionMux) deliver(sub *upstreamSubscription, result json.RawMessage) {
+	if len(sub.pending) > 0 {
+		sub.backlog = appendBounded(sub.backlog, result, wsClientSendQueueSize)
+	}
+	for clientID, session := range sub.clients {
+		session.notify(clientID, result)
+	}
+}
+
+// appendBounded appends msg to msgs, dropping the oldest message once there are max of them
+func appendBounded(msgs []json.RawMessage, msg json.RawMessage, max int) []json.RawMessage {
+	if len(msgs) >= max {
+		msgs = msgs[1:]
+	}
+	return append(msgs, msg)
+}
+
+func (m *WSSubscriptionMux) handleConnFailure(conn *websocket.Conn, be *Backend, err error) {
+	m.mtx.Lock()
+	if m.conn == conn {
+		m.conn, m.backend = nil, nil
+	}
+	for id, pending := range m.pending {
+		if pending.conn == conn {
+			close(pending.resC)
+			delete(m.pending, id)
+		}
+	}
+	closed := m.closed
+	hasSubs := len(m.subs) > 0
+	m.early = make(map[string][]json.RawMessage)
+	m.mtx.Unlock()
+
+	conn.Close()
+	activeBackendWsConnsGauge.WithLabelValues(be.Name).Dec()
+	if closed {
+		return
+	}
+	log.Warn("upstream subscription connection failed", "backend_group", m.bg.Name, "backend", be.Name, "err", err)
+	if hasSubs {
+		go m.restore()
+	}
+}
+
+// restore recreates the subscriptions on a new upstream connection, retrying with a backoff
+func (m *WSSubscriptionMux) restore() {
+	for i := 0; ; i++ {
+		m.opMu.Lock()
+		err := m.resubscribe()
+		m.opMu.Unlock()
+		if err == nil {
+			return
+		}
+		log.Warn("error restoring upstream subscriptions", "backend_group", m.bg.Name, "err", err)
+
+		select {
+		case <-time.After(calcBackoff(i)):
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// resubscribe recreates the subscriptions that are not on the current upstream
+// connection. It must be called with opMu held.
+func (m *WSSubscriptionMux) resubscribe() error {
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return nil
+	}
+	stale := make([]*upstreamSubscription, 0)
+	for _, sub := range m.subs {
+		if sub.conn == nil || sub.conn != m.conn {
+			stale = append(stale, sub)
+		}
+	}
+	m.mtx.Unlock()
+	if len(stale) == 0 {
+		return nil
+	}
+
+	conn, err := m.connect()
+	if err != nil {
+		return err
+	}
+	for _, sub := range stale {
+		id, err := m.subscribeUpstream(conn, sub.params)
+		var rpcErr *RPCErr
+		if errors.As(err, &rpcErr) && rpcErr != ErrBackendOffline && rpcErr != ErrGatewayTimeout {
+			// the new backend rejects the subscription, retrying won't help
+			log.Error("dropping subscription rejected by backend", "backend_group", m.bg.Name, "err", err)
+			m.dropSubscription(sub)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		m.mtx.Lock()
+		delete(m.upstreamIDs, sub.id)
+		sub.conn = conn
+		m.mapUpstreamID(sub, id)
+		m.mtx.Unlock()
+	}
+
+	m.mtx.Lock()
+	be := m.backend
+	m.mtx.Unlock()
+	if be != nil {
+		log.Info("restored upstream subscriptions", "backend_group", m.bg.Name, "backend", be.Name, "subscriptions", len(stale))
+		RecordWSMultiplexedResubscription(m.bg, be)
+	}
+	return nil
+}
+
+func (m *WSSubscriptionMux) dropSubscription(sub *upstreamSubscription) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for clientID := range sub.clients {
+		delete(m.clientSubs, clientID)
+	}
+	for clientID := range sub.pending {
+		delete(m.clientSubs, clientID)
+	}
+	delete(m.subs, sub.key)
+	delete(m.upstreamIDs, sub.id)
+	m.recordSubscriptions()
+}
+
+// recordSubscriptions must be called with mtx held
+func (m *WSSubscriptionMux) recordSubscriptions() {
+	RecordWSMultiplexedSubscriptions(m.bg, len(m.subs), len(m.clientSubs))
+}
+
+// subscriptionKey identifies subscriptions with the same params
+func subscriptionKey(params json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// MultiplexedWSProxier serves a client websocket without a backend connection
+// of its own. Subscriptions go through the WSSubscriptionMux of the backend
+// group, and other calls are forwarded to the backend group over HTTP.
+type MultiplexedWSProxier struct {
+	bg              *BackendGroup
+	mux             *WSSubscriptionMux
+	clientConn      *websocket.Conn
+	methodWhitelist *StringSet
+	timeout         time.Duration
+	writeTimeout    time.Duration
+
+	sendC     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	subsMu sync.Mutex
+	subs   map[string]struct{}
+}
+
+func (bg *BackendGroup) ProxyWSMultiplexed(clientConn *websocket.Conn, methodWhitelist *StringSet, timeout time.Duration) *MultiplexedWSProxier {
+	return &MultiplexedWSProxier{
+		bg:              bg,
+		mux:             bg.SubscriptionMux(),
+		clientConn:      clientConn,
+		methodWhitelist: methodWhitelist,
+		timeout:         timeout,
+		writeTimeout:    defaultWSWriteTimeout,
+		sendC:           make(chan []byte, wsClientSendQueueSize),
+		done:            make(chan struct{}),
+		subs:            make(map[string]struct{}),
+	}
+}
+
+func (w *MultiplexedWSProxier) Proxy(ctx context.Context) error {
+	w.mux.addSession(w)
+	errC := make(chan error, 2)
+	go w.clientPump(ctx, errC)
+	go w.writePump(errC)
+	err := <-errC
+	w.close()
+	return err
+}
+
+func (w *MultiplexedWSProxier) clientPump(ctx context.Context, errC chan error) {
+	for {
+		msgType, msg, err := w.clientConn.ReadMessage()
+		if err != nil {
+			errC <- err
+			return
+		}
+
+		RecordWSMessage(ctx, BackendProxyd, SourceClient)
+
+		// Control messages are handled by the connection
+		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+			continue
+		}
+
+		rpcRequestsTotal.Inc()
+
+		req, err := prepareWSClientMsg(ctx, msg, w.methodWhitelist)
+		if err != nil {
+			var id json.RawMessage
+			method := MethodUnknown
+			if req != nil {
+				id = req.ID
+				method = req.Method
+			}
+			log.Info(
+				"error preparing client message",
+				"auth", GetAuthCtx(ctx),
+				"req_id", GetReqID(ctx),
+				"err", err,
+			)
+			RecordRPCError(ctx, BackendProxyd, method, err)
+			w.send(mustMarshalJSON(NewRPCErrorRes(id, err)))
+			continue
+		}
+
+		if req.Method == "eth_subscribe" {
+			w.subscribe(ctx, req)
+			continue
+		}
+		w.send(mustMarshalJSON(w.handle(ctx, req)))
+	}
+}
+
+// subscribe queues the eth_subscribe response before the subscription is activated, so
+// that the client never gets a notification before the subscription ID it belongs to
+func (w *MultiplexedWSProxier) subscribe(ctx context.Context, req *RPCReq) {
+	clientID, err := w.mux.Subscribe(w, req.Params)
+	if err != nil {
+		log.Info("error subscribing", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		RecordRPCError(ctx, BackendProxyd, req.Method, err)
+		w.send(mustMarshalJSON(NewRPCErrorRes(req.ID, err)))
+		return
+	}
+	w.subsMu.Lock()
+	w.subs[clientID] = struct{}{}
+	w.subsMu.Unlock()
+	RecordRPCForward(ctx, BackendProxyd, req.Method, RPCRequestSourceWS)
+	w.send(mustMarshalJSON(NewRPCRes(req.ID, clientID)))
+	w.mux.activate(w, clientID)
+}
+
+func (w *MultiplexedWSProxier) handle(ctx context.Context, req *RPCReq) *RPCRes {
+	switch req.Method {
+	case "eth_accounts":
+		RecordRPCForward(ctx, BackendProxyd, "eth_accounts", RPCRequestSourceWS)
+		return NewRPCRes(req.ID, emptyArrayResponse)
+	case "eth_unsubscribe":
+		var params []string
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+			return NewRPCErrorRes(req.ID, ErrInvalidParams("expected a subscription id"))
+		}
+		w.subsMu.Lock()
+		delete(w.subs, params[0])
+		w.subsMu.Unlock()
+		RecordRPCForward(ctx, BackendProxyd, req.Method, RPCRequestSourceWS)
+		return NewRPCRes(req.ID, w.mux.Unsubscribe(w, params[0]))
+	}
+
+	// the request context ends with the websocket upgrade, calls only
+	// keep its values
+	fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.timeout)
+	defer cancel()
+	res, _, err := w.bg.Forward(fctx, []*RPCReq{req}, false)
+	if err != nil {
+		log.Info("error forwarding WS call", "method", req.Method, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		return NewRPCErrorRes(req.ID, err)
+	}
+	return res[0]
+}
+
+func (w *MultiplexedWSProxier) writePump(errC chan error) {
+	for {
+		select {
+		case msg := <-w.sendC:
+			if err := w.clientConn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+				errC <- err
+				return
+			}
+			if err := w.clientConn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				errC <- err
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// send queues a response to the client
+func (w *MultiplexedWSProxier) send(msg []byte) {
+	select {
+	case w.sendC <- msg:
+	case <-w.done:
+	}
+}
+
+// notify queues a subscription notification to the client. Clients that
+// can't keep up with their notifications are disconnected, so that they
+// don't hold back the other subscribers.
+func (w *MultiplexedWSProxier) notify(clientID string, result json.RawMessage) {
+	msg := mustMarshalJSON(map[string]interface{}{
+		"jsonrpc": JSONRPCVersion,
+		"method":  "eth_subscription",
+		"params": map[string]interface{}{
+			"subscription": clientID,
+			"result":       result,
+		},
+	})
+	select {
+	case w.sendC <- msg:
+	case <-w.done:
+	default:
+		log.Warn("disconnecting ws client that can't keep up with notifications", "backend_group", w.bg.Name)
+		w.clientConn.Close()
+	}
+}
+
+func (w *MultiplexedWSProxier) subscriptionIDs() []string {
+	w.subsMu.Lock()
+	defer w.subsMu.Unlock()
+	ids := make([]string, 0, len(w.subs))
+	for id := range w.subs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (w *MultiplexedWSProxier) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.clientConn.Close()
+		w.mux.removeSession(w)
+	})
+}